@@ -0,0 +1,229 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// api/v1/nimbleopti_conversion.go
+
+package v1
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// v2SpecAnnotation keeps the v2 spec fields that v1 cannot hold, so a v2 object read and written back as v1 keeps them.
+const v2SpecAnnotation = "adapter.uri-tech.github.io/v2-spec"
+
+const day = 24 * time.Hour
+
+// v2Spec is the content of v2SpecAnnotation.
+type v2Spec struct {
+	RenewBefore            *metav1.Duration `json:"renewBefore,omitempty"`
+	ChallengeAppearTimeout *metav1.Duration `json:"challengeAppearTimeout,omitempty"`
+	ChallengeClearTimeout  *metav1.Duration `json:"challengeClearTimeout,omitempty"`
+	PollInterval           *metav1.Duration `json:"pollInterval,omitempty"`
+	RenewalSpread          *metav1.Duration `json:"renewalSpread,omitempty"`
+
+	MaintenanceWindows []v2.MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+	BlackoutDates      []v2.BlackoutDate      `json:"blackoutDates,omitempty"`
+	EmergencyThreshold *metav1.Duration       `json:"emergencyThreshold,omitempty"`
+	Suspend            bool                   `json:"suspend,omitempty"`
+	Policies           []v2.IngressPolicy     `json:"policies,omitempty"`
+	TargetNamespaces   []string               `json:"targetNamespaces,omitempty"`
+	NamespaceSelector  *metav1.LabelSelector  `json:"namespaceSelector,omitempty"`
+}
+
+var _ conversion.Convertible = &NimbleOpti{}
+
+// ConvertTo converts this NimbleOpti to the Hub version (v2).
+// CertificateRenewalThreshold is in days and AnnotationRemovalDelay in seconds, 0 leaves them unset.
+func (src *NimbleOpti) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v2.NimbleOpti)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = v2.NimbleOptiSpec{
+		TargetNamespace:       src.Spec.TargetNamespace,
+		RenewBefore:           fromUnits(src.Spec.CertificateRenewalThreshold, day),
+		ChallengeClearTimeout: fromUnits(src.Spec.AnnotationRemovalDelay, time.Second),
+		RenewRequestedAt:      src.Spec.RenewRequestedAt,
+	}
+
+	// Restore the fields kept by ConvertFrom. An exact duration is only restored while
+	// the v1 field it was rounded to is unchanged.
+	if raw, ok := dst.Annotations[v2SpecAnnotation]; ok {
+		delete(dst.Annotations, v2SpecAnnotation)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+		var kept v2Spec
+		if err := json.Unmarshal([]byte(raw), &kept); err != nil {
+			return err
+		}
+		if kept.RenewBefore != nil && toUnits(kept.RenewBefore, day) == src.Spec.CertificateRenewalThreshold {
+			dst.Spec.RenewBefore = kept.RenewBefore
+		}
+		if kept.ChallengeClearTimeout != nil && toUnits(kept.ChallengeClearTimeout, time.Second) == src.Spec.AnnotationRemovalDelay {
+			dst.Spec.ChallengeClearTimeout = kept.ChallengeClearTimeout
+		}
+		dst.Spec.ChallengeAppearTimeout = kept.ChallengeAppearTimeout
+		dst.Spec.PollInterval = kept.PollInterval
+		dst.Spec.RenewalSpread = kept.RenewalSpread
+		dst.Spec.MaintenanceWindows = kept.MaintenanceWindows
+		dst.Spec.BlackoutDates = kept.BlackoutDates
+		dst.Spec.EmergencyThreshold = kept.EmergencyThreshold
+		dst.Spec.Suspend = kept.Suspend
+		dst.Spec.Policies = kept.Policies
+		dst.Spec.TargetNamespaces = kept.TargetNamespaces
+		dst.Spec.NamespaceSelector = kept.NamespaceSelector
+	}
+
+	dst.Status = v2.NimbleOptiStatus{
+		Conditions:             src.Status.Conditions,
+		IngressPathsForRenewal: src.Status.IngressPathsForRenewal,
+		IngressRenewRequests:   convertRenewRequestsTo(src.Status.IngressRenewRequests),
+	}
+	if src.Status.LastRenewRequest != nil {
+		last := convertRenewRequestTo(*src.Status.LastRenewRequest)
+		dst.Status.LastRenewRequest = &last
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v2) to this version.
+// The durations are rounded up to whole days and seconds, the exact values are kept in an annotation.
+// Unset durations become 0.
+func (dst *NimbleOpti) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v2.NimbleOpti)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = NimbleOptiSpec{
+		TargetNamespace:             src.Spec.TargetNamespace,
+		CertificateRenewalThreshold: toUnits(src.Spec.RenewBefore, day),
+		AnnotationRemovalDelay:      toUnits(src.Spec.ChallengeClearTimeout, time.Second),
+		RenewRequestedAt:            src.Spec.RenewRequestedAt,
+	}
+
+	var kept v2Spec
+	if src.Spec.RenewBefore != nil && src.Spec.RenewBefore.Duration != time.Duration(dst.Spec.CertificateRenewalThreshold)*day {
+		kept.RenewBefore = src.Spec.RenewBefore.DeepCopy()
+	}
+	if src.Spec.ChallengeClearTimeout != nil && src.Spec.ChallengeClearTimeout.Duration != time.Duration(dst.Spec.AnnotationRemovalDelay)*time.Second {
+		kept.ChallengeClearTimeout = src.Spec.ChallengeClearTimeout.DeepCopy()
+	}
+	kept.ChallengeAppearTimeout = src.Spec.ChallengeAppearTimeout.DeepCopy()
+	kept.PollInterval = src.Spec.PollInterval.DeepCopy()
+	kept.RenewalSpread = src.Spec.RenewalSpread.DeepCopy()
+	spec := src.Spec.DeepCopy()
+	kept.MaintenanceWindows = spec.MaintenanceWindows
+	kept.BlackoutDates = spec.BlackoutDates
+	kept.EmergencyThreshold = spec.EmergencyThreshold
+	kept.Suspend = spec.Suspend
+	kept.Policies = spec.Policies
+	kept.TargetNamespaces = spec.TargetNamespaces
+	kept.NamespaceSelector = spec.NamespaceSelector
+	if !reflect.DeepEqual(kept, v2Spec{}) {
+		raw, err := json.Marshal(kept)
+		if err != nil {
+			return err
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[v2SpecAnnotation] = string(raw)
+	}
+
+	dst.Status = NimbleOptiStatus{
+		Conditions:             src.Status.Conditions,
+		IngressPathsForRenewal: src.Status.IngressPathsForRenewal,
+		IngressRenewRequests:   convertRenewRequestsFrom(src.Status.IngressRenewRequests),
+	}
+	if src.Status.LastRenewRequest != nil {
+		last := convertRenewRequestFrom(*src.Status.LastRenewRequest)
+		dst.Status.LastRenewRequest = &last
+	}
+	return nil
+}
+
+// fromUnits returns n units as a duration, nil for 0.
+func fromUnits(n int, unit time.Duration) *metav1.Duration {
+	if n == 0 {
+		return nil
+	}
+	return &metav1.Duration{Duration: time.Duration(n) * unit}
+}
+
+// toUnits returns d in whole units rounded up, at least one, so a v1 reader never renews later than asked.
+// It returns 0 for an unset d.
+func toUnits(d *metav1.Duration, unit time.Duration) int {
+	if d == nil {
+		return 0
+	}
+	n := int((d.Duration + unit - 1) / unit)
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// convertRenewRequestTo converts a handled request to v2.
+func convertRenewRequestTo(in RenewRequestStatus) v2.RenewRequestStatus {
+	return v2.RenewRequestStatus{
+		Ingress:   in.Ingress,
+		Token:     in.Token,
+		Result:    v2.RenewRequestResult(in.Result),
+		Message:   in.Message,
+		HandledAt: in.HandledAt,
+	}
+}
+
+// convertRenewRequestFrom converts a handled request from v2.
+func convertRenewRequestFrom(in v2.RenewRequestStatus) RenewRequestStatus {
+	return RenewRequestStatus{
+		Ingress:   in.Ingress,
+		Token:     in.Token,
+		Result:    RenewRequestResult(in.Result),
+		Message:   in.Message,
+		HandledAt: in.HandledAt,
+	}
+}
+
+// convertRenewRequestsTo converts the handled requests to v2.
+func convertRenewRequestsTo(in []RenewRequestStatus) []v2.RenewRequestStatus {
+	if in == nil {
+		return nil
+	}
+	out := make([]v2.RenewRequestStatus, len(in))
+	for i := range in {
+		out[i] = convertRenewRequestTo(in[i])
+	}
+	return out
+}
+
+// convertRenewRequestsFrom converts the handled requests from v2.
+func convertRenewRequestsFrom(in []v2.RenewRequestStatus) []RenewRequestStatus {
+	if in == nil {
+		return nil
+	}
+	out := make([]RenewRequestStatus, len(in))
+	for i := range in {
+		out[i] = convertRenewRequestFrom(in[i])
+	}
+	return out
+}
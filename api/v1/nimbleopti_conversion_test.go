@@ -0,0 +1,113 @@
+// api/v1/nimbleopti_conversion_test.go
+
+package v1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConvertTo(t *testing.T) {
+	src := &NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+		Spec: NimbleOptiSpec{
+			TargetNamespace:             "default",
+			CertificateRenewalThreshold: 30,
+			AnnotationRemovalDelay:      10,
+			RenewRequestedAt:            "t1",
+		},
+		Status: NimbleOptiStatus{
+			IngressRenewRequests: []RenewRequestStatus{{Ingress: "ing", Token: "t0", Result: RenewRequestRenewed}},
+		},
+	}
+
+	dst := &v2.NimbleOpti{}
+	require.NoError(t, src.ConvertTo(dst))
+	assert.Equal(t, v2.NimbleOptiSpec{
+		TargetNamespace:       "default",
+		RenewBefore:           &metav1.Duration{Duration: 30 * day},
+		ChallengeClearTimeout: &metav1.Duration{Duration: 10 * time.Second},
+		RenewRequestedAt:      "t1",
+	}, dst.Spec)
+	assert.Equal(t, []v2.RenewRequestStatus{{Ingress: "ing", Token: "t0", Result: v2.RenewRequestRenewed}}, dst.Status.IngressRenewRequests)
+	assert.Nil(t, dst.Annotations)
+
+	// A v1 object read back as v1 is unchanged.
+	back := &NimbleOpti{}
+	require.NoError(t, back.ConvertFrom(dst))
+	assert.Equal(t, src, back)
+}
+
+func TestConvertFromRoundTrip(t *testing.T) {
+	appear := metav1.Duration{Duration: 2 * time.Minute}
+	poll := metav1.Duration{Duration: 5 * time.Second}
+	hub := &v2.NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default", Annotations: map[string]string{"team": "a"}},
+		Spec: v2.NimbleOptiSpec{
+			TargetNamespace:        "default",
+			RenewBefore:            &metav1.Duration{Duration: 36 * time.Hour},
+			ChallengeAppearTimeout: &appear,
+			ChallengeClearTimeout:  &metav1.Duration{Duration: 1500 * time.Millisecond},
+			PollInterval:           &poll,
+			RenewalSpread:          &metav1.Duration{Duration: 12 * time.Hour},
+			MaintenanceWindows:     []v2.MaintenanceWindow{{Days: []v2.Weekday{"Sat"}, Start: "22:00", End: "04:00", TimeZone: "Europe/Berlin"}},
+			BlackoutDates:          []v2.BlackoutDate{"2026-12-24"},
+			EmergencyThreshold:     &metav1.Duration{Duration: 72 * time.Hour},
+			Suspend:                true,
+			Policies: []v2.IngressPolicy{{
+				Name:        "public",
+				Selector:    &metav1.LabelSelector{MatchLabels: map[string]string{"exposure": "public"}},
+				RenewBefore: &metav1.Duration{Duration: 14 * day},
+				Strategy:    "secret-rename",
+			}},
+			TargetNamespaces:  []string{"app-a"},
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+		},
+		Status: v2.NimbleOptiStatus{
+			LastRenewRequest: &v2.RenewRequestStatus{Token: "t1", Result: v2.RenewRequestFailed, Message: "boom"},
+		},
+	}
+
+	spoke := &NimbleOpti{}
+	require.NoError(t, spoke.ConvertFrom(hub))
+	// The durations are rounded up so a v1 reader never renews later than asked.
+	assert.Equal(t, 2, spoke.Spec.CertificateRenewalThreshold)
+	assert.Equal(t, 2, spoke.Spec.AnnotationRemovalDelay)
+	assert.Equal(t, &RenewRequestStatus{Token: "t1", Result: RenewRequestFailed, Message: "boom"}, spoke.Status.LastRenewRequest)
+	assert.Contains(t, spoke.Annotations, v2SpecAnnotation)
+	assert.NotContains(t, hub.Annotations, v2SpecAnnotation)
+
+	// The exact v2 values survive a v1 round trip.
+	got := &v2.NimbleOpti{}
+	require.NoError(t, spoke.ConvertTo(got))
+	assert.Equal(t, hub, got)
+
+	// A v1 edit of a rounded field wins over the kept value.
+	spoke.Spec.CertificateRenewalThreshold = 7
+	require.NoError(t, spoke.ConvertTo(got))
+	assert.Equal(t, 7*day, got.Spec.RenewBefore.Duration)
+	assert.Equal(t, 1500*time.Millisecond, got.Spec.ChallengeClearTimeout.Duration)
+	assert.Equal(t, &appear, got.Spec.ChallengeAppearTimeout)
+}
+
+func TestConvertUnset(t *testing.T) {
+	hub := &v2.NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+		Spec:       v2.NimbleOptiSpec{TargetNamespace: "default"},
+	}
+
+	// Unset durations inherit the cluster defaults, they are 0 in v1 and unset again in v2.
+	spoke := &NimbleOpti{}
+	require.NoError(t, spoke.ConvertFrom(hub))
+	assert.Equal(t, NimbleOptiSpec{TargetNamespace: "default"}, spoke.Spec)
+	assert.Nil(t, spoke.Annotations)
+
+	got := &v2.NimbleOpti{}
+	require.NoError(t, spoke.ConvertTo(got))
+	assert.Equal(t, hub, got)
+}
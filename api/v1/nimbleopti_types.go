@@ -34,13 +34,53 @@ type NimbleOptiSpec struct {
 	// +kubebuilder:validation:MinLength=1
 	TargetNamespace string `json:"targetNamespace"`
 
-	// CertificateRenewalThreshold is the waiting time (in days) before the certificate expires to trigger renewal
-	// +kubebuilder:validation:Minimum=1
+	// CertificateRenewalThreshold is the waiting time (in days) before the certificate expires to trigger renewal.
+	// 0 inherits the ClusterNimbleOpti and the operator defaults.
+	// +kubebuilder:validation:Minimum=0
 	CertificateRenewalThreshold int `json:"certificateRenewalThreshold"`
 
-	// AnnotationRemovalDelay is the delay (in seconds) after removing the "nginx.ingress.kubernetes.io/backend-protocol: HTTPS" annotation before re-adding it
-	// +kubebuilder:validation:Minimum=1
+	// AnnotationRemovalDelay is the delay (in seconds) after removing the "nginx.ingress.kubernetes.io/backend-protocol: HTTPS" annotation before re-adding it.
+	// 0 inherits the ClusterNimbleOpti and the operator defaults.
+	// +kubebuilder:validation:Minimum=0
 	AnnotationRemovalDelay int `json:"annotationRemovalDelay"`
+
+	// RenewRequestedAt requests an immediate renewal of every Ingress of the namespace, bypassing the
+	// renewal threshold. The renewal runs each time the value changes, any token such as the current time works.
+	// +optional
+	RenewRequestedAt string `json:"renewRequestedAt,omitempty"`
+}
+
+// RenewRequestResult is the outcome of an on-demand renewal.
+type RenewRequestResult string
+
+const (
+	// RenewRequestRenewed means every certificate was renewed.
+	RenewRequestRenewed RenewRequestResult = "Renewed"
+	// RenewRequestNotRenewed means the renewal ran but the ACME challenge was not resolved in time.
+	RenewRequestNotRenewed RenewRequestResult = "NotRenewed"
+	// RenewRequestFailed means the renewal returned an error.
+	RenewRequestFailed RenewRequestResult = "Failed"
+)
+
+// RenewRequestStatus records a handled on-demand renewal request.
+type RenewRequestStatus struct {
+	// Ingress is the name of the renewed Ingress, empty for a request of the whole namespace.
+	// +optional
+	Ingress string `json:"ingress,omitempty"`
+
+	// Token is the handled value of spec.renewRequestedAt or of the "nimble.opti.adapter/renew-requested-at" annotation.
+	Token string `json:"token"`
+
+	// Result is the outcome of the renewal.
+	// +kubebuilder:validation:Enum=Renewed;NotRenewed;Failed
+	Result RenewRequestResult `json:"result"`
+
+	// Message details the result, such as the error of a failed renewal.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// HandledAt is when the renewal finished.
+	HandledAt metav1.Time `json:"handledAt"`
 }
 
 // NimbleOptiStatus defines the observed state of NimbleOpti
@@ -53,6 +93,14 @@ type NimbleOptiStatus struct {
 
 	// IngressPathsForRenewal is a list of ingress paths for which certificates need to be renewed.
 	IngressPathsForRenewal []string `json:"ingressPathsForRenewal,omitempty"`
+
+	// LastRenewRequest is the last handled spec.renewRequestedAt.
+	// +optional
+	LastRenewRequest *RenewRequestStatus `json:"lastRenewRequest,omitempty"`
+
+	// IngressRenewRequests holds the last handled renew-requested-at annotation of each Ingress of the namespace.
+	// +optional
+	IngressRenewRequests []RenewRequestStatus `json:"ingressRenewRequests,omitempty"`
 }
 
 //+kubebuilder:object:root=true
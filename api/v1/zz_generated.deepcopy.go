@@ -115,6 +115,18 @@ func (in *NimbleOptiStatus) DeepCopyInto(out *NimbleOptiStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.LastRenewRequest != nil {
+		in, out := &in.LastRenewRequest, &out.LastRenewRequest
+		*out = new(RenewRequestStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IngressRenewRequests != nil {
+		in, out := &in.IngressRenewRequests, &out.IngressRenewRequests
+		*out = make([]RenewRequestStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NimbleOptiStatus.
@@ -126,3 +138,19 @@ func (in *NimbleOptiStatus) DeepCopy() *NimbleOptiStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RenewRequestStatus) DeepCopyInto(out *RenewRequestStatus) {
+	*out = *in
+	in.HandledAt.DeepCopyInto(&out.HandledAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RenewRequestStatus.
+func (in *RenewRequestStatus) DeepCopy() *RenewRequestStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RenewRequestStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// api/v2/clusternimbleopti_types.go
+
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterNimbleOptiName is the name of the only ClusterNimbleOpti the operator reads.
+const ClusterNimbleOptiName = "default"
+
+// ClusterNimbleOptiSpec defines the fleet-wide defaults of the NimbleOpti of every namespace
+type ClusterNimbleOptiSpec struct {
+	// RenewBefore is how long before the certificate expires its renewal starts, such as "720h".
+	// Unset uses the operator default.
+	// +optional
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+
+	// RenewalSpread delays the renewal of each Ingress after RenewBefore by its own offset within the spread,
+	// such as "120h", so the certificates issued together are not renewed together.
+	// Unset renews every certificate at RenewBefore.
+	// +optional
+	RenewalSpread *metav1.Duration `json:"renewalSpread,omitempty"`
+
+	// ChallengeAppearTimeout bounds the wait for cert-manager to add the ACME challenge path once a secret was replaced.
+	// Unset uses the operator default.
+	// +optional
+	ChallengeAppearTimeout *metav1.Duration `json:"challengeAppearTimeout,omitempty"`
+
+	// ChallengeClearTimeout bounds how long the "nginx.ingress.kubernetes.io/backend-protocol: HTTPS" annotation
+	// stays removed while waiting for the ACME challenge path to go away. Unset uses the operator default.
+	// +optional
+	ChallengeClearTimeout *metav1.Duration `json:"challengeClearTimeout,omitempty"`
+
+	// PollInterval is how often the Ingress is checked while its annotation is removed.
+	// Unset uses the operator default.
+	// +optional
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+
+	// Strategy selects how a new certificate is obtained, see the "nimble.opti.adapter/strategy" annotation.
+	// +kubebuilder:validation:Enum=auto;challenge-only;secret-delete;secret-rename
+	// +optional
+	Strategy string `json:"strategy,omitempty"`
+
+	// DisableNimbleOptiCreation stops the operator from creating a NimbleOpti in the namespaces without one.
+	// Their Ingresses then use these defaults, and on-demand renewals need a NimbleOpti to record their result.
+	// +optional
+	DisableNimbleOptiCreation bool `json:"disableNimbleOptiCreation,omitempty"`
+}
+
+// ClusterNimbleOptiStatus defines the observed state of ClusterNimbleOpti
+type ClusterNimbleOptiStatus struct {
+	// EffectivePolicy is the operator defaults overridden by this spec, the policy of the namespaces
+	// whose NimbleOpti sets nothing.
+	// +optional
+	EffectivePolicy *EffectivePolicy `json:"effectivePolicy,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:subresource:status
+
+// ClusterNimbleOpti is the Schema for the clusternimbleoptis API. Only the one named "default" is used.
+type ClusterNimbleOpti struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterNimbleOptiSpec   `json:"spec,omitempty"`
+	Status ClusterNimbleOptiStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterNimbleOptiList contains a list of ClusterNimbleOpti
+type ClusterNimbleOptiList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterNimbleOpti `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterNimbleOpti{}, &ClusterNimbleOptiList{})
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// api/v2/clusternimbleopti_webhook.go
+
+package v2
+
+import (
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var clusternimbleoptilog = nimbleoptilog.WithName("cluster")
+
+// SetupWebhookWithManager registers the validating webhook of ClusterNimbleOpti.
+func (r *ClusterNimbleOpti) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-adapter-uri-tech-github-io-v2-clusternimbleopti,mutating=false,failurePolicy=fail,sideEffects=None,groups=adapter.uri-tech.github.io,resources=clusternimbleoptis,verbs=create;update,versions=v2,name=vclusternimbleopti.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &ClusterNimbleOpti{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterNimbleOpti) ValidateCreate() (admission.Warnings, error) {
+	clusternimbleoptilog.Info("validate create", "name", r.Name)
+	return nil, r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterNimbleOpti) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	clusternimbleoptilog.Info("validate update", "name", r.Name)
+	return nil, r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterNimbleOpti) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validate checks that the name is the one the operator reads, that every duration of the spec is positive
+// and that the renewal spread is at most half of renewBefore.
+func (r *ClusterNimbleOpti) validate() error {
+	var errs field.ErrorList
+	if r.Name != ClusterNimbleOptiName {
+		errs = append(errs, field.Invalid(field.NewPath("metadata", "name"), r.Name,
+			fmt.Sprintf("must be %q, the operator ignores any other ClusterNimbleOpti", ClusterNimbleOptiName)))
+	}
+	spec := field.NewPath("spec")
+	errs = append(errs, validateDurations(spec, r.Spec.RenewBefore, r.Spec.ChallengeAppearTimeout, r.Spec.ChallengeClearTimeout, r.Spec.PollInterval)...)
+	errs = append(errs, validateSpread(spec, r.Spec.RenewBefore, r.Spec.RenewalSpread)...)
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("ClusterNimbleOpti").GroupKind(), r.Name, errs)
+}
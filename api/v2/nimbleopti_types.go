@@ -0,0 +1,446 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// api/v2/nimbleopti_types.go
+
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NimbleOptiSpec defines the desired state of NimbleOpti
+type NimbleOptiSpec struct {
+	// TargetNamespace is the namespace where the operator should manage certificates.
+	// Another namespace than the one of the NimbleOpti is managed from it, see TargetNamespaces.
+	// +kubebuilder:validation:MinLength=1
+	TargetNamespace string `json:"targetNamespace"`
+
+	// TargetNamespaces are more namespaces managed from this NimbleOpti. Its spec applies to their Ingresses
+	// between the ClusterNimbleOpti and the NimbleOpti of each namespace, which still overrides it.
+	// +optional
+	TargetNamespaces []string `json:"targetNamespaces,omitempty"`
+
+	// NamespaceSelector selects more namespaces managed from this NimbleOpti, like TargetNamespaces.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// RenewBefore is how long before the certificate expires its renewal starts, such as "720h".
+	// Unset inherits the ClusterNimbleOpti and the operator defaults.
+	// +optional
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+
+	// RenewalSpread delays the renewal of each Ingress after RenewBefore by its own offset within the spread,
+	// such as "120h", so the certificates issued together are not renewed together. The offset of an Ingress
+	// is a deterministic pseudo-random jitter derived from its namespace and name. The spread is capped at half of RenewBefore.
+	// Unset inherits the ClusterNimbleOpti, which renews every certificate at RenewBefore by default.
+	// +optional
+	RenewalSpread *metav1.Duration `json:"renewalSpread,omitempty"`
+
+	// ChallengeAppearTimeout bounds the wait for cert-manager to add the ACME challenge path once a secret was replaced.
+	// Unset inherits the ClusterNimbleOpti and the operator defaults.
+	// +optional
+	ChallengeAppearTimeout *metav1.Duration `json:"challengeAppearTimeout,omitempty"`
+
+	// ChallengeClearTimeout bounds how long the "nginx.ingress.kubernetes.io/backend-protocol: HTTPS" annotation
+	// stays removed while waiting for the ACME challenge path to go away.
+	// Unset inherits the ClusterNimbleOpti and the operator defaults.
+	// +optional
+	ChallengeClearTimeout *metav1.Duration `json:"challengeClearTimeout,omitempty"`
+
+	// PollInterval is how often the Ingress is checked while its annotation is removed.
+	// Unset inherits the ClusterNimbleOpti and the operator defaults.
+	// +optional
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+
+	// MaintenanceWindows limit when the HTTPS annotation of an Ingress may be removed to resolve an ACME challenge.
+	// A renewal outside of them is deferred to the next window. Unset allows any time.
+	// +optional
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+
+	// BlackoutDates are dates, such as "2026-12-24", on which no maintenance window opens.
+	// A date is read in the time zone of each window.
+	// +optional
+	BlackoutDates []BlackoutDate `json:"blackoutDates,omitempty"`
+
+	// EmergencyThreshold lets a certificate expiring sooner than it bypass the maintenance windows.
+	// Unset never bypasses them.
+	// +optional
+	EmergencyThreshold *metav1.Duration `json:"emergencyThreshold,omitempty"`
+
+	// RenewRequestedAt requests an immediate renewal of every Ingress of the namespace, bypassing RenewBefore.
+	// The renewal runs each time the value changes, any token such as the current time works.
+	// +optional
+	RenewRequestedAt string `json:"renewRequestedAt,omitempty"`
+	// Suspend pauses the renewals of every Ingress of the namespace, the on-demand ones included.
+	// A renewal running when it is set is interrupted and its HTTPS annotation restored.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Policies override this spec for the Ingresses their selector matches. The first policy of the list
+	// matching an Ingress applies, an Ingress no policy matches uses this spec.
+	// The annotations of an Ingress still override its policy.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Policies []IngressPolicy `json:"policies,omitempty"`
+}
+
+// IngressPolicy is the renewal policy of the Ingresses of the namespace matching its selector.
+// Its unset fields inherit the NimbleOpti spec.
+type IngressPolicy struct {
+	// Name identifies the policy in the status.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Selector matches the labels of the Ingresses of the policy. Unset matches every Ingress.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// RenewBefore is how long before the certificate expires its renewal starts, such as "720h".
+	// +optional
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+
+	// RenewalSpread delays the renewal of each Ingress after RenewBefore by its own offset within the spread.
+	// +optional
+	RenewalSpread *metav1.Duration `json:"renewalSpread,omitempty"`
+
+	// ChallengeAppearTimeout bounds the wait for cert-manager to add the ACME challenge path once a secret was replaced.
+	// +optional
+	ChallengeAppearTimeout *metav1.Duration `json:"challengeAppearTimeout,omitempty"`
+
+	// ChallengeClearTimeout bounds how long the HTTPS annotation stays removed while waiting
+	// for the ACME challenge path to go away.
+	// +optional
+	ChallengeClearTimeout *metav1.Duration `json:"challengeClearTimeout,omitempty"`
+
+	// PollInterval is how often the Ingress is checked while its annotation is removed.
+	// +optional
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+
+	// Strategy selects how a new certificate is obtained, see the "nimble.opti.adapter/strategy" annotation.
+	// +kubebuilder:validation:Enum=auto;challenge-only;secret-delete;secret-rename
+	// +optional
+	Strategy string `json:"strategy,omitempty"`
+
+	// MaintenanceWindows replace the maintenance windows of the spec, together with BlackoutDates.
+	// Both unset keep the ones of the spec.
+	// +optional
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+
+	// BlackoutDates replace the blackout dates of the spec, together with MaintenanceWindows.
+	// +optional
+	BlackoutDates []BlackoutDate `json:"blackoutDates,omitempty"`
+
+	// EmergencyThreshold lets a certificate expiring sooner than it bypass the maintenance windows.
+	// +optional
+	EmergencyThreshold *metav1.Duration `json:"emergencyThreshold,omitempty"`
+
+	// StagedRollout renews a single Ingress of the policy first, when the renewal of the namespace is requested
+	// and during each audit, the other Ingresses of the policy are only renewed once it succeeded.
+	// +optional
+	StagedRollout bool `json:"stagedRollout,omitempty"`
+
+	// Notify names the receivers of the outcome of the renewals of the Ingresses of the policy, such as
+	// "slack:#team-web". They are recorded in the renewal history and in the "nimble.opti.adapter/notify"
+	// annotation of the RenewalOutcome event, for an event router to deliver.
+	// +optional
+	Notify []string `json:"notify,omitempty"`
+}
+
+// IngressPolicyMatch is the policy applied to an Ingress.
+type IngressPolicyMatch struct {
+	// Ingress is the name of the Ingress.
+	Ingress string `json:"ingress"`
+
+	// Policy is the name of the policy of the Ingress.
+	Policy string `json:"policy"`
+}
+
+// Weekday is a day of a maintenance window.
+// +kubebuilder:validation:Enum=Mon;Tue;Wed;Thu;Fri;Sat;Sun
+type Weekday string
+
+// TimeOfDay is a time of day such as "22:30".
+// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+type TimeOfDay string
+
+// BlackoutDate is a date such as "2026-12-24".
+// +kubebuilder:validation:Pattern=`^[0-9]{4}-[0-9]{2}-[0-9]{2}$`
+type BlackoutDate string
+
+// MaintenanceWindow is a recurring time range. A window whose end is not after its start ends on the next day.
+type MaintenanceWindow struct {
+	// Days are the days the window starts on. Unset is every day.
+	// +optional
+	Days []Weekday `json:"days,omitempty"`
+
+	// Start is when the window opens.
+	Start TimeOfDay `json:"start"`
+
+	// End is when the window closes.
+	End TimeOfDay `json:"end"`
+
+	// TimeZone is the IANA time zone of the window, such as "Europe/Berlin". Unset is UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// TargetNamespaceReason is why a target namespace is or is not managed.
+type TargetNamespaceReason string
+
+const (
+	// TargetNamespaceManaged is a target namespace managed from the NimbleOpti.
+	TargetNamespaceManaged TargetNamespaceReason = "Managed"
+	// TargetNamespaceForbidden is a target namespace the operator is not allowed to renew the certificates of.
+	TargetNamespaceForbidden TargetNamespaceReason = "Forbidden"
+	// TargetNamespaceNotWatched is a target namespace outside of the namespaces the operator watches.
+	TargetNamespaceNotWatched TargetNamespaceReason = "NotWatched"
+	// TargetNamespaceConflict is a target namespace already managed from another NimbleOpti.
+	TargetNamespaceConflict TargetNamespaceReason = "Conflict"
+)
+
+// TargetNamespaceStatus is whether a target namespace is managed from the NimbleOpti.
+type TargetNamespaceStatus struct {
+	// Namespace is the target namespace.
+	Namespace string `json:"namespace"`
+
+	// Managed is true when the spec of the NimbleOpti applies to the Ingresses of the namespace.
+	Managed bool `json:"managed"`
+
+	// Reason is why the namespace is or is not managed.
+	Reason TargetNamespaceReason `json:"reason"`
+
+	// Message details a namespace that is not managed.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// RenewRequestResult is the outcome of an on-demand renewal.
+type RenewRequestResult string
+
+const (
+	// RenewRequestRenewed means every certificate was renewed.
+	RenewRequestRenewed RenewRequestResult = "Renewed"
+	// RenewRequestNotRenewed means the renewal ran but the ACME challenge was not resolved in time.
+	RenewRequestNotRenewed RenewRequestResult = "NotRenewed"
+	// RenewRequestFailed means the renewal returned an error.
+	RenewRequestFailed RenewRequestResult = "Failed"
+)
+
+// RenewRequestStatus records a handled on-demand renewal request.
+type RenewRequestStatus struct {
+	// Ingress is the name of the renewed Ingress, empty for a request of the whole namespace.
+	// +optional
+	Ingress string `json:"ingress,omitempty"`
+
+	// Token is the handled value of spec.renewRequestedAt or of the "nimble.opti.adapter/renew-requested-at" annotation.
+	Token string `json:"token"`
+
+	// Result is the outcome of the renewal.
+	// +kubebuilder:validation:Enum=Renewed;NotRenewed;Failed
+	Result RenewRequestResult `json:"result"`
+
+	// Message details the result, such as the error of a failed renewal.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// HandledAt is when the renewal finished.
+	HandledAt metav1.Time `json:"handledAt"`
+}
+
+// RenewalTrigger is what started a renewal.
+type RenewalTrigger string
+
+const (
+	// RenewalTriggerAudit is a renewal started by the periodic audit.
+	RenewalTriggerAudit RenewalTrigger = "Audit"
+	// RenewalTriggerEvent is a renewal started by a change of the Ingress.
+	RenewalTriggerEvent RenewalTrigger = "Event"
+	// RenewalTriggerManual is an on-demand renewal.
+	RenewalTriggerManual RenewalTrigger = "Manual"
+)
+
+// RenewalPhase is the duration of a step of a renewal.
+type RenewalPhase struct {
+	// Name is the step: SecretReplace, ChallengeAppear, ChallengeClear or AnnotationRestore.
+	Name string `json:"name"`
+
+	// Duration is how long the step took.
+	Duration metav1.Duration `json:"duration"`
+}
+
+// RenewalAttempt records a renewal of the certificates of an Ingress.
+type RenewalAttempt struct {
+	// StartedAt is when the renewal started.
+	StartedAt metav1.Time `json:"startedAt"`
+
+	// FinishedAt is when the renewal finished.
+	FinishedAt metav1.Time `json:"finishedAt"`
+
+	// Trigger is what started the renewal.
+	// +kubebuilder:validation:Enum=Audit;Event;Manual
+	Trigger RenewalTrigger `json:"trigger"`
+
+	// Strategy is the strategy the renewal ran with.
+	Strategy string `json:"strategy"`
+
+	// Phases are the durations of the steps the renewal went through, in order.
+	// +optional
+	Phases []RenewalPhase `json:"phases,omitempty"`
+
+	// Outcome is the result of the renewal.
+	// +kubebuilder:validation:Enum=Renewed;NotRenewed;Failed
+	Outcome RenewRequestResult `json:"outcome"`
+
+	// Message is the error of a failed renewal.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Notify are the receivers of the outcome, set by the policy of the Ingress.
+	// +optional
+	Notify []string `json:"notify,omitempty"`
+}
+
+// IngressRenewalHistory holds the last renewals of an Ingress.
+type IngressRenewalHistory struct {
+	// Ingress is the name of the Ingress.
+	Ingress string `json:"ingress"`
+
+	// Attempts are the last renewals of the Ingress, the most recent first.
+	// +kubebuilder:validation:MaxItems=10
+	Attempts []RenewalAttempt `json:"attempts"`
+}
+
+// EffectivePolicy is a resolved renewal policy.
+type EffectivePolicy struct {
+	// RenewBefore is how long before the certificate expires its renewal starts.
+	RenewBefore metav1.Duration `json:"renewBefore"`
+
+	// RenewalSpread delays the renewal of each Ingress after RenewBefore by its own offset within the spread.
+	// +optional
+	RenewalSpread *metav1.Duration `json:"renewalSpread,omitempty"`
+
+	// ChallengeAppearTimeout bounds the wait for the ACME challenge path once a secret was replaced.
+	ChallengeAppearTimeout metav1.Duration `json:"challengeAppearTimeout"`
+
+	// ChallengeClearTimeout bounds how long the HTTPS annotation stays removed during a renewal.
+	ChallengeClearTimeout metav1.Duration `json:"challengeClearTimeout"`
+
+	// PollInterval is how often the Ingress is checked while its annotation is removed.
+	PollInterval metav1.Duration `json:"pollInterval"`
+
+	// Strategy selects how a new certificate is obtained.
+	Strategy string `json:"strategy"`
+}
+
+// NimbleOptiStatus defines the observed state of NimbleOpti
+type NimbleOptiStatus struct {
+	// Conditions are the conditions for this resource.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// IngressPathsForRenewal is a list of ingress paths for which certificates need to be renewed.
+	IngressPathsForRenewal []string `json:"ingressPathsForRenewal,omitempty"`
+
+	// LastRenewRequest is the last handled spec.renewRequestedAt.
+	// +optional
+	LastRenewRequest *RenewRequestStatus `json:"lastRenewRequest,omitempty"`
+
+	// IngressRenewRequests holds the last handled renew-requested-at annotation of each Ingress of the namespace.
+	// +optional
+	IngressRenewRequests []RenewRequestStatus `json:"ingressRenewRequests,omitempty"`
+
+	// RenewalHistory holds the last renewals of each Ingress of the namespace, the most recently renewed Ingress first.
+	// +optional
+	// +kubebuilder:validation:MaxItems=100
+	RenewalHistory []IngressRenewalHistory `json:"renewalHistory,omitempty"`
+
+	// ManagedIngresses is the number of Ingresses of the namespace the adapter manages, counted by the last audit.
+	// +optional
+	ManagedIngresses int32 `json:"managedIngresses,omitempty"`
+
+	// DegradedIngresses is the number of managed Ingresses left without their HTTPS annotation by the last audit.
+	// +optional
+	DegradedIngresses int32 `json:"degradedIngresses,omitempty"`
+
+	// FailingIngresses is the number of managed Ingresses whose last audit failed.
+	// +optional
+	FailingIngresses int32 `json:"failingIngresses,omitempty"`
+
+	// SoonestExpiry is when the first certificate of the managed Ingresses expires, as of the last audit.
+	// +optional
+	SoonestExpiry *metav1.Time `json:"soonestExpiry,omitempty"`
+
+	// LastAuditTime is when the Ingresses of the namespace were last audited.
+	// +optional
+	LastAuditTime *metav1.Time `json:"lastAuditTime,omitempty"`
+
+	// LastRenewalOutcome is the outcome of the last renewal in the namespace.
+	// +optional
+	LastRenewalOutcome RenewRequestResult `json:"lastRenewalOutcome,omitempty"`
+
+	// LastRenewalTime is when the last renewal in the namespace finished.
+	// +optional
+	LastRenewalTime *metav1.Time `json:"lastRenewalTime,omitempty"`
+
+	// IngressPolicies are the policies the managed Ingresses matched at the last audit,
+	// the Ingresses no policy matches are left out.
+	// +optional
+	IngressPolicies []IngressPolicyMatch `json:"ingressPolicies,omitempty"`
+
+	// TargetNamespaces are the other namespaces managed from this NimbleOpti, with the ones it may not manage.
+	// +optional
+	TargetNamespaces []TargetNamespaceStatus `json:"targetNamespaces,omitempty"`
+
+	// EffectivePolicy is the policy of the Ingresses of the namespace: the operator defaults, overridden by
+	// the ClusterNimbleOpti, overridden by this spec. The annotations of an Ingress still override it.
+	// +optional
+	EffectivePolicy *EffectivePolicy `json:"effectivePolicy,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Managed",type=integer,JSONPath=`.status.managedIngresses`
+//+kubebuilder:printcolumn:name="Soonest Expiry",type=string,JSONPath=`.status.soonestExpiry`
+//+kubebuilder:printcolumn:name="Last Audit",type=date,JSONPath=`.status.lastAuditTime`
+//+kubebuilder:printcolumn:name="Last Renewal",type=string,JSONPath=`.status.lastRenewalOutcome`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Degraded",type=integer,JSONPath=`.status.degradedIngresses`,priority=1
+//+kubebuilder:printcolumn:name="Failing",type=integer,JSONPath=`.status.failingIngresses`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// NimbleOpti is the Schema for the nimbleoptis API
+type NimbleOpti struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NimbleOptiSpec   `json:"spec,omitempty"`
+	Status NimbleOptiStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// NimbleOptiList contains a list of NimbleOpti
+type NimbleOptiList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NimbleOpti `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NimbleOpti{}, &NimbleOptiList{})
+}
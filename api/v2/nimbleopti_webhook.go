@@ -0,0 +1,135 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// api/v2/nimbleopti_webhook.go
+
+package v2
+
+import (
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var nimbleoptilog = logf.Log.WithName("nimbleopti-resource")
+
+// SetupWebhookWithManager registers the validating webhook of v2 and the conversion webhook of NimbleOpti.
+func (r *NimbleOpti) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-adapter-uri-tech-github-io-v2-nimbleopti,mutating=false,failurePolicy=fail,sideEffects=None,groups=adapter.uri-tech.github.io,resources=nimbleoptis,verbs=create;update,versions=v2,name=vnimbleopti-v2.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &NimbleOpti{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *NimbleOpti) ValidateCreate() (admission.Warnings, error) {
+	nimbleoptilog.Info("validate create", "name", r.Name)
+	return nil, r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *NimbleOpti) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	nimbleoptilog.Info("validate update", "name", r.Name)
+	return nil, r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *NimbleOpti) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validate checks that every duration of the spec and of its policies is positive, that their renewal spread is
+// at most half of their renewBefore, that the maintenance windows
+// parse and that the selectors of the policies are valid.
+func (r *NimbleOpti) validate() error {
+	spec := field.NewPath("spec")
+	errs := validateDurations(spec, r.Spec.RenewBefore, r.Spec.ChallengeAppearTimeout, r.Spec.ChallengeClearTimeout, r.Spec.PollInterval)
+	errs = append(errs, validateSpread(spec, r.Spec.RenewBefore, r.Spec.RenewalSpread)...)
+	errs = append(errs, validatePositive(spec.Child("emergencyThreshold"), r.Spec.EmergencyThreshold)...)
+	errs = append(errs, validateSchedule(spec, r.Spec.MaintenanceWindows, r.Spec.BlackoutDates)...)
+	if _, err := metav1.LabelSelectorAsSelector(r.Spec.NamespaceSelector); err != nil {
+		errs = append(errs, field.Invalid(spec.Child("namespaceSelector"), r.Spec.NamespaceSelector, err.Error()))
+	}
+	for i, p := range r.Spec.Policies {
+		path := spec.Child("policies").Index(i)
+		errs = append(errs, validateDurations(path, p.RenewBefore, p.ChallengeAppearTimeout, p.ChallengeClearTimeout, p.PollInterval)...)
+		errs = append(errs, validateSpread(path, p.RenewBefore, p.RenewalSpread)...)
+		errs = append(errs, validatePositive(path.Child("emergencyThreshold"), p.EmergencyThreshold)...)
+		errs = append(errs, validateSchedule(path, p.MaintenanceWindows, p.BlackoutDates)...)
+		if _, err := metav1.LabelSelectorAsSelector(p.Selector); err != nil {
+			errs = append(errs, field.Invalid(path.Child("selector"), p.Selector, err.Error()))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("NimbleOpti").GroupKind(), r.Name, errs)
+}
+
+// validateSchedule checks that the time zones of the maintenance windows and the blackout dates of a spec parse.
+func validateSchedule(spec *field.Path, windows []MaintenanceWindow, dates []BlackoutDate) field.ErrorList {
+	var errs field.ErrorList
+	for i, w := range windows {
+		if _, err := time.LoadLocation(w.TimeZone); err != nil {
+			errs = append(errs, field.Invalid(spec.Child("maintenanceWindows").Index(i).Child("timeZone"), w.TimeZone, err.Error()))
+		}
+	}
+	for i, d := range dates {
+		if _, err := time.Parse("2006-01-02", string(d)); err != nil {
+			errs = append(errs, field.Invalid(spec.Child("blackoutDates").Index(i), d, "must be a date such as 2026-12-24"))
+		}
+	}
+	return errs
+}
+
+// validateDurations checks that the set durations of a spec are positive.
+func validateDurations(spec *field.Path, renewBefore, challengeAppearTimeout, challengeClearTimeout, pollInterval *metav1.Duration) field.ErrorList {
+	var errs field.ErrorList
+	errs = append(errs, validatePositive(spec.Child("renewBefore"), renewBefore)...)
+	errs = append(errs, validatePositive(spec.Child("challengeAppearTimeout"), challengeAppearTimeout)...)
+	errs = append(errs, validatePositive(spec.Child("challengeClearTimeout"), challengeClearTimeout)...)
+	errs = append(errs, validatePositive(spec.Child("pollInterval"), pollInterval)...)
+	return errs
+}
+
+// validateSpread checks that a set renewal spread is positive and, when the spec also sets renewBefore,
+// at most half of it.
+func validateSpread(spec *field.Path, renewBefore, spread *metav1.Duration) field.ErrorList {
+	errs := validatePositive(spec.Child("renewalSpread"), spread)
+	if len(errs) == 0 && spread != nil && renewBefore != nil && spread.Duration > renewBefore.Duration/2 {
+		errs = append(errs, field.Invalid(spec.Child("renewalSpread"), spread.Duration.String(), "must be at most half of renewBefore"))
+	}
+	return errs
+}
+
+// validatePositive returns an error when d is set and not positive.
+func validatePositive(path *field.Path, d *metav1.Duration) field.ErrorList {
+	if d != nil && d.Duration <= 0 {
+		return field.ErrorList{field.Invalid(path, d.Duration.String(), "must be positive")}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// api/v2/nimbleoptirenewal_types.go
+
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NimbleOptiRenewalPhase is the step a renewal is at.
+// +kubebuilder:validation:Enum=Pending;AnnotationsSuspended;ChallengeInProgress;Restoring;Succeeded;Failed
+type NimbleOptiRenewalPhase string
+
+const (
+	// NimbleOptiRenewalPending is a renewal whose HTTPS annotation is still in place, its secrets may be replaced.
+	NimbleOptiRenewalPending NimbleOptiRenewalPhase = "Pending"
+	// NimbleOptiRenewalAnnotationsSuspended is a renewal that removed the HTTPS annotation of its Ingress.
+	NimbleOptiRenewalAnnotationsSuspended NimbleOptiRenewalPhase = "AnnotationsSuspended"
+	// NimbleOptiRenewalChallengeInProgress is a renewal waiting for the ACME challenge path to go away.
+	NimbleOptiRenewalChallengeInProgress NimbleOptiRenewalPhase = "ChallengeInProgress"
+	// NimbleOptiRenewalRestoring is a renewal reinstating the HTTPS annotation of its Ingress.
+	NimbleOptiRenewalRestoring NimbleOptiRenewalPhase = "Restoring"
+	// NimbleOptiRenewalSucceeded is a finished renewal that renewed the certificates.
+	NimbleOptiRenewalSucceeded NimbleOptiRenewalPhase = "Succeeded"
+	// NimbleOptiRenewalFailed is a renewal that stopped on an error, or whose ACME challenge was not resolved in time.
+	NimbleOptiRenewalFailed NimbleOptiRenewalPhase = "Failed"
+)
+
+const (
+	// NimbleOptiRenewalComplete is the condition type of a succeeded renewal.
+	NimbleOptiRenewalComplete = "Complete"
+	// NimbleOptiRenewalFailure is the condition type of a failed renewal.
+	NimbleOptiRenewalFailure = "Failed"
+)
+
+// NimbleOptiRenewalSpec describes the renewal of the certificates of an Ingress
+type NimbleOptiRenewalSpec struct {
+	// Ingress is the name of the renewed Ingress, in the namespace of the renewal.
+	Ingress string `json:"ingress"`
+
+	// SecretNames are the TLS secrets of the Ingress the renewal replaces, empty when the
+	// ACME challenge was already in progress.
+	// +optional
+	SecretNames []string `json:"secretNames,omitempty"`
+
+	// Strategy is the strategy the renewal runs with.
+	Strategy string `json:"strategy"`
+
+	// Trigger is what started the renewal.
+	// +kubebuilder:validation:Enum=Audit;Event;Manual
+	Trigger RenewalTrigger `json:"trigger"`
+}
+
+// NimbleOptiRenewalPhaseTransition is when a renewal entered a phase.
+type NimbleOptiRenewalPhaseTransition struct {
+	// Phase is the phase entered.
+	Phase NimbleOptiRenewalPhase `json:"phase"`
+
+	// Time is when the phase was entered.
+	Time metav1.Time `json:"time"`
+}
+
+// NimbleOptiRenewalStatus defines the observed state of NimbleOptiRenewal
+type NimbleOptiRenewalStatus struct {
+	// Phase is the step the renewal is at.
+	// +optional
+	Phase NimbleOptiRenewalPhase `json:"phase,omitempty"`
+
+	// StartTime is when the renewal started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the renewal succeeded or failed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// PhaseTransitions are the phases the renewal went through, in order.
+	// +optional
+	PhaseTransitions []NimbleOptiRenewalPhaseTransition `json:"phaseTransitions,omitempty"`
+
+	// Message is the error of a failed renewal.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Conditions are the conditions for this resource, Complete or Failed once the renewal finished.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ingress",type=string,JSONPath=`.spec.ingress`
+//+kubebuilder:printcolumn:name="Trigger",type=string,JSONPath=`.spec.trigger`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Started",type=date,JSONPath=`.status.startTime`
+//+kubebuilder:printcolumn:name="Strategy",type=string,JSONPath=`.spec.strategy`,priority=1
+//+kubebuilder:printcolumn:name="Message",type=string,JSONPath=`.status.message`,priority=1
+
+// NimbleOptiRenewal is a renewal of the certificates of an Ingress. The operator creates one for each
+// renewal, owned by the NimbleOpti of the namespace.
+type NimbleOptiRenewal struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NimbleOptiRenewalSpec   `json:"spec,omitempty"`
+	Status NimbleOptiRenewalStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// NimbleOptiRenewalList contains a list of NimbleOptiRenewal
+type NimbleOptiRenewalList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NimbleOptiRenewal `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NimbleOptiRenewal{}, &NimbleOptiRenewalList{})
+}
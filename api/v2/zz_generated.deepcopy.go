@@ -0,0 +1,706 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by controller-gen. DO NOT EDIT.
+
+package v2
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterNimbleOpti) DeepCopyInto(out *ClusterNimbleOpti) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterNimbleOpti.
+func (in *ClusterNimbleOpti) DeepCopy() *ClusterNimbleOpti {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterNimbleOpti)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterNimbleOpti) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterNimbleOptiList) DeepCopyInto(out *ClusterNimbleOptiList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterNimbleOpti, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterNimbleOptiList.
+func (in *ClusterNimbleOptiList) DeepCopy() *ClusterNimbleOptiList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterNimbleOptiList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterNimbleOptiList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterNimbleOptiSpec) DeepCopyInto(out *ClusterNimbleOptiSpec) {
+	*out = *in
+	if in.RenewBefore != nil {
+		in, out := &in.RenewBefore, &out.RenewBefore
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RenewalSpread != nil {
+		in, out := &in.RenewalSpread, &out.RenewalSpread
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.ChallengeAppearTimeout != nil {
+		in, out := &in.ChallengeAppearTimeout, &out.ChallengeAppearTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.ChallengeClearTimeout != nil {
+		in, out := &in.ChallengeClearTimeout, &out.ChallengeClearTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.PollInterval != nil {
+		in, out := &in.PollInterval, &out.PollInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterNimbleOptiSpec.
+func (in *ClusterNimbleOptiSpec) DeepCopy() *ClusterNimbleOptiSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterNimbleOptiSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterNimbleOptiStatus) DeepCopyInto(out *ClusterNimbleOptiStatus) {
+	*out = *in
+	if in.EffectivePolicy != nil {
+		in, out := &in.EffectivePolicy, &out.EffectivePolicy
+		*out = new(EffectivePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterNimbleOptiStatus.
+func (in *ClusterNimbleOptiStatus) DeepCopy() *ClusterNimbleOptiStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterNimbleOptiStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EffectivePolicy) DeepCopyInto(out *EffectivePolicy) {
+	*out = *in
+	out.RenewBefore = in.RenewBefore
+	if in.RenewalSpread != nil {
+		in, out := &in.RenewalSpread, &out.RenewalSpread
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	out.ChallengeAppearTimeout = in.ChallengeAppearTimeout
+	out.ChallengeClearTimeout = in.ChallengeClearTimeout
+	out.PollInterval = in.PollInterval
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EffectivePolicy.
+func (in *EffectivePolicy) DeepCopy() *EffectivePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(EffectivePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressPolicy) DeepCopyInto(out *IngressPolicy) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RenewBefore != nil {
+		in, out := &in.RenewBefore, &out.RenewBefore
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RenewalSpread != nil {
+		in, out := &in.RenewalSpread, &out.RenewalSpread
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.ChallengeAppearTimeout != nil {
+		in, out := &in.ChallengeAppearTimeout, &out.ChallengeAppearTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.ChallengeClearTimeout != nil {
+		in, out := &in.ChallengeClearTimeout, &out.ChallengeClearTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.PollInterval != nil {
+		in, out := &in.PollInterval, &out.PollInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MaintenanceWindows != nil {
+		in, out := &in.MaintenanceWindows, &out.MaintenanceWindows
+		*out = make([]MaintenanceWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.BlackoutDates != nil {
+		in, out := &in.BlackoutDates, &out.BlackoutDates
+		*out = make([]BlackoutDate, len(*in))
+		copy(*out, *in)
+	}
+	if in.EmergencyThreshold != nil {
+		in, out := &in.EmergencyThreshold, &out.EmergencyThreshold
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Notify != nil {
+		in, out := &in.Notify, &out.Notify
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressPolicy.
+func (in *IngressPolicy) DeepCopy() *IngressPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressPolicyMatch) DeepCopyInto(out *IngressPolicyMatch) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressPolicyMatch.
+func (in *IngressPolicyMatch) DeepCopy() *IngressPolicyMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressPolicyMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressRenewalHistory) DeepCopyInto(out *IngressRenewalHistory) {
+	*out = *in
+	if in.Attempts != nil {
+		in, out := &in.Attempts, &out.Attempts
+		*out = make([]RenewalAttempt, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressRenewalHistory.
+func (in *IngressRenewalHistory) DeepCopy() *IngressRenewalHistory {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressRenewalHistory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]Weekday, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NimbleOpti) DeepCopyInto(out *NimbleOpti) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NimbleOpti.
+func (in *NimbleOpti) DeepCopy() *NimbleOpti {
+	if in == nil {
+		return nil
+	}
+	out := new(NimbleOpti)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NimbleOpti) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NimbleOptiList) DeepCopyInto(out *NimbleOptiList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NimbleOpti, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NimbleOptiList.
+func (in *NimbleOptiList) DeepCopy() *NimbleOptiList {
+	if in == nil {
+		return nil
+	}
+	out := new(NimbleOptiList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NimbleOptiList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NimbleOptiRenewal) DeepCopyInto(out *NimbleOptiRenewal) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NimbleOptiRenewal.
+func (in *NimbleOptiRenewal) DeepCopy() *NimbleOptiRenewal {
+	if in == nil {
+		return nil
+	}
+	out := new(NimbleOptiRenewal)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NimbleOptiRenewal) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NimbleOptiRenewalList) DeepCopyInto(out *NimbleOptiRenewalList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NimbleOptiRenewal, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NimbleOptiRenewalList.
+func (in *NimbleOptiRenewalList) DeepCopy() *NimbleOptiRenewalList {
+	if in == nil {
+		return nil
+	}
+	out := new(NimbleOptiRenewalList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NimbleOptiRenewalList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NimbleOptiRenewalPhaseTransition) DeepCopyInto(out *NimbleOptiRenewalPhaseTransition) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NimbleOptiRenewalPhaseTransition.
+func (in *NimbleOptiRenewalPhaseTransition) DeepCopy() *NimbleOptiRenewalPhaseTransition {
+	if in == nil {
+		return nil
+	}
+	out := new(NimbleOptiRenewalPhaseTransition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NimbleOptiRenewalSpec) DeepCopyInto(out *NimbleOptiRenewalSpec) {
+	*out = *in
+	if in.SecretNames != nil {
+		in, out := &in.SecretNames, &out.SecretNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NimbleOptiRenewalSpec.
+func (in *NimbleOptiRenewalSpec) DeepCopy() *NimbleOptiRenewalSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NimbleOptiRenewalSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NimbleOptiRenewalStatus) DeepCopyInto(out *NimbleOptiRenewalStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.PhaseTransitions != nil {
+		in, out := &in.PhaseTransitions, &out.PhaseTransitions
+		*out = make([]NimbleOptiRenewalPhaseTransition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NimbleOptiRenewalStatus.
+func (in *NimbleOptiRenewalStatus) DeepCopy() *NimbleOptiRenewalStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NimbleOptiRenewalStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NimbleOptiSpec) DeepCopyInto(out *NimbleOptiSpec) {
+	*out = *in
+	if in.TargetNamespaces != nil {
+		in, out := &in.TargetNamespaces, &out.TargetNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RenewBefore != nil {
+		in, out := &in.RenewBefore, &out.RenewBefore
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RenewalSpread != nil {
+		in, out := &in.RenewalSpread, &out.RenewalSpread
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.ChallengeAppearTimeout != nil {
+		in, out := &in.ChallengeAppearTimeout, &out.ChallengeAppearTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.ChallengeClearTimeout != nil {
+		in, out := &in.ChallengeClearTimeout, &out.ChallengeClearTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.PollInterval != nil {
+		in, out := &in.PollInterval, &out.PollInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MaintenanceWindows != nil {
+		in, out := &in.MaintenanceWindows, &out.MaintenanceWindows
+		*out = make([]MaintenanceWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.BlackoutDates != nil {
+		in, out := &in.BlackoutDates, &out.BlackoutDates
+		*out = make([]BlackoutDate, len(*in))
+		copy(*out, *in)
+	}
+	if in.EmergencyThreshold != nil {
+		in, out := &in.EmergencyThreshold, &out.EmergencyThreshold
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Policies != nil {
+		in, out := &in.Policies, &out.Policies
+		*out = make([]IngressPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NimbleOptiSpec.
+func (in *NimbleOptiSpec) DeepCopy() *NimbleOptiSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NimbleOptiSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NimbleOptiStatus) DeepCopyInto(out *NimbleOptiStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.IngressPathsForRenewal != nil {
+		in, out := &in.IngressPathsForRenewal, &out.IngressPathsForRenewal
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastRenewRequest != nil {
+		in, out := &in.LastRenewRequest, &out.LastRenewRequest
+		*out = new(RenewRequestStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IngressRenewRequests != nil {
+		in, out := &in.IngressRenewRequests, &out.IngressRenewRequests
+		*out = make([]RenewRequestStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RenewalHistory != nil {
+		in, out := &in.RenewalHistory, &out.RenewalHistory
+		*out = make([]IngressRenewalHistory, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SoonestExpiry != nil {
+		in, out := &in.SoonestExpiry, &out.SoonestExpiry
+		*out = (*in).DeepCopy()
+	}
+	if in.LastAuditTime != nil {
+		in, out := &in.LastAuditTime, &out.LastAuditTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastRenewalTime != nil {
+		in, out := &in.LastRenewalTime, &out.LastRenewalTime
+		*out = (*in).DeepCopy()
+	}
+	if in.IngressPolicies != nil {
+		in, out := &in.IngressPolicies, &out.IngressPolicies
+		*out = make([]IngressPolicyMatch, len(*in))
+		copy(*out, *in)
+	}
+	if in.TargetNamespaces != nil {
+		in, out := &in.TargetNamespaces, &out.TargetNamespaces
+		*out = make([]TargetNamespaceStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.EffectivePolicy != nil {
+		in, out := &in.EffectivePolicy, &out.EffectivePolicy
+		*out = new(EffectivePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NimbleOptiStatus.
+func (in *NimbleOptiStatus) DeepCopy() *NimbleOptiStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NimbleOptiStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RenewRequestStatus) DeepCopyInto(out *RenewRequestStatus) {
+	*out = *in
+	in.HandledAt.DeepCopyInto(&out.HandledAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RenewRequestStatus.
+func (in *RenewRequestStatus) DeepCopy() *RenewRequestStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RenewRequestStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RenewalAttempt) DeepCopyInto(out *RenewalAttempt) {
+	*out = *in
+	in.StartedAt.DeepCopyInto(&out.StartedAt)
+	in.FinishedAt.DeepCopyInto(&out.FinishedAt)
+	if in.Phases != nil {
+		in, out := &in.Phases, &out.Phases
+		*out = make([]RenewalPhase, len(*in))
+		copy(*out, *in)
+	}
+	if in.Notify != nil {
+		in, out := &in.Notify, &out.Notify
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RenewalAttempt.
+func (in *RenewalAttempt) DeepCopy() *RenewalAttempt {
+	if in == nil {
+		return nil
+	}
+	out := new(RenewalAttempt)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RenewalPhase) DeepCopyInto(out *RenewalPhase) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RenewalPhase.
+func (in *RenewalPhase) DeepCopy() *RenewalPhase {
+	if in == nil {
+		return nil
+	}
+	out := new(RenewalPhase)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TargetNamespaceStatus) DeepCopyInto(out *TargetNamespaceStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetNamespaceStatus.
+func (in *TargetNamespaceStatus) DeepCopy() *TargetNamespaceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TargetNamespaceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,207 @@
+// Package budget tracks the certificates requested from each ACME issuer per registered domain, so the renewals
+// stay within the rate limits of the issuer, such as the weekly certificates per registered domain and the hourly
+// failed validations of Let's Encrypt. The ledger is persisted in a ConfigMap shared by the operator and the cronjob.
+package budget
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// The annotations of cert-manager naming the issuer of the certificates of an Ingress.
+const (
+	// IssuerAnnotation names an Issuer of the namespace of the Ingress.
+	IssuerAnnotation = "cert-manager.io/issuer"
+	// ClusterIssuerAnnotation names a ClusterIssuer.
+	ClusterIssuerAnnotation = "cert-manager.io/cluster-issuer"
+)
+
+// The windows the limits are counted over.
+const (
+	// CertificateWindow is the window of Limits.CertificatesPerWeek.
+	CertificateWindow = 7 * 24 * time.Hour
+	// FailureWindow is the window of Limits.FailedValidationsPerHour.
+	FailureWindow = time.Hour
+)
+
+// Limits is the budget of every account. Zero fields do not limit.
+type Limits struct {
+	// CertificatesPerWeek caps the certificates issued for a registered domain within CertificateWindow.
+	CertificatesPerWeek int
+	// FailedValidationsPerHour caps the failed renewals of a registered domain within FailureWindow.
+	FailedValidationsPerHour int
+}
+
+// Account is the issuer and registered domain a budget applies to.
+type Account struct {
+	// Issuer is "ClusterIssuer/<name>" or "Issuer/<namespace>/<name>", empty when the Ingress names none.
+	Issuer string `json:"issuer"`
+	// Domain is the registered domain, the eTLD+1 of the hosts, such as "example.co.uk".
+	Domain string `json:"domain"`
+}
+
+// String returns the key of the account in the ledger.
+func (a Account) String() string {
+	return a.Issuer + "|" + a.Domain
+}
+
+// Accounts returns the accounts the certificates of ing are requested from: one per registered domain
+// of the hosts of its TLS entries. It is nil when they list no host.
+func Accounts(ing *networkingv1.Ingress) []Account {
+	issuer := ""
+	if name := ing.Annotations[ClusterIssuerAnnotation]; name != "" {
+		issuer = "ClusterIssuer/" + name
+	} else if name := ing.Annotations[IssuerAnnotation]; name != "" {
+		issuer = "Issuer/" + ing.Namespace + "/" + name
+	}
+
+	domains := map[string]bool{}
+	for _, tls := range ing.Spec.TLS {
+		for _, host := range tls.Hosts {
+			if host != "" {
+				domains[RegisteredDomain(host)] = true
+			}
+		}
+	}
+
+	var accounts []Account
+	for domain := range domains {
+		accounts = append(accounts, Account{Issuer: issuer, Domain: domain})
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Domain < accounts[j].Domain })
+	return accounts
+}
+
+// RegisteredDomain returns the eTLD+1 of host, such as "example.co.uk" for "*.api.example.co.uk".
+// A host without one, such as a public suffix or a single label, is returned as is.
+func RegisteredDomain(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(host, "*."), "."))
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// Usage is what an account used within the windows.
+type Usage struct {
+	Account
+	// Certificates are when the certificates were issued.
+	Certificates []time.Time `json:"certificates,omitempty"`
+	// Failures are when the renewals failed their validation.
+	Failures []time.Time `json:"failures,omitempty"`
+}
+
+// Ledger holds the usage of every account, keyed by Account.String.
+type Ledger struct {
+	Usage map[string]*Usage `json:"usage,omitempty"`
+}
+
+// Remaining is the budget left to an account.
+type Remaining struct {
+	Account
+	// Certificates is the number of certificates it may still be issued, -1 without limit.
+	Certificates int
+	// Failures is the number of failed validations it may still have, -1 without limit.
+	Failures int
+	// Until is when a spent budget allows one more request, zero when none is spent.
+	Until time.Time
+}
+
+// Exceeded reports whether one of accounts spent its budget at now, and returns it with the time it may
+// request a certificate again.
+func (l *Ledger) Exceeded(accounts []Account, now time.Time, limits Limits) (Remaining, bool) {
+	for _, a := range accounts {
+		r := l.remaining(a, now, limits)
+		if r.Certificates == 0 || r.Failures == 0 {
+			return r, true
+		}
+	}
+	return Remaining{}, false
+}
+
+// Record adds a certificate issued to accounts at now, or a failed validation when failed is true.
+func (l *Ledger) Record(accounts []Account, now time.Time, failed bool) {
+	if l.Usage == nil {
+		l.Usage = map[string]*Usage{}
+	}
+	for _, a := range accounts {
+		u := l.Usage[a.String()]
+		if u == nil {
+			u = &Usage{Account: a}
+			l.Usage[a.String()] = u
+		}
+		if failed {
+			u.Failures = append(u.Failures, now)
+		} else {
+			u.Certificates = append(u.Certificates, now)
+		}
+	}
+}
+
+// Prune drops the usage older than its window at now, and the accounts left without usage.
+func (l *Ledger) Prune(now time.Time) {
+	for key, u := range l.Usage {
+		u.Certificates = within(u.Certificates, now, CertificateWindow)
+		u.Failures = within(u.Failures, now, FailureWindow)
+		if len(u.Certificates) == 0 && len(u.Failures) == 0 {
+			delete(l.Usage, key)
+		}
+	}
+}
+
+// Remaining returns the budget left to every account of the ledger at now, sorted by account.
+func (l *Ledger) Remaining(now time.Time, limits Limits) []Remaining {
+	remaining := make([]Remaining, 0, len(l.Usage))
+	for _, u := range l.Usage {
+		remaining = append(remaining, l.remaining(u.Account, now, limits))
+	}
+	sort.Slice(remaining, func(i, j int) bool { return remaining[i].Account.String() < remaining[j].Account.String() })
+	return remaining
+}
+
+// remaining returns the budget left to a at now.
+func (l *Ledger) remaining(a Account, now time.Time, limits Limits) Remaining {
+	r := Remaining{Account: a, Certificates: -1, Failures: -1}
+	u := l.Usage[a.String()]
+	if u == nil {
+		u = &Usage{}
+	}
+	r.Certificates, r.Until = left(u.Certificates, now, CertificateWindow, limits.CertificatesPerWeek, r.Until)
+	r.Failures, r.Until = left(u.Failures, now, FailureWindow, limits.FailedValidationsPerHour, r.Until)
+	return r
+}
+
+// left returns how many of limit are left of the times within window at now, -1 when limit is zero.
+// When none is left, until is moved to when the oldest of them leaves the window, if that is later.
+func left(times []time.Time, now time.Time, window time.Duration, limit int, until time.Time) (int, time.Time) {
+	if limit <= 0 {
+		return -1, until
+	}
+	times = within(times, now, window)
+	n := limit - len(times)
+	if n > 0 {
+		return n, until
+	}
+	// The oldest entries beyond the limit must leave the window before one more is allowed.
+	if free := times[len(times)-limit].Add(window); free.After(until) {
+		until = free
+	}
+	return 0, until
+}
+
+// within returns the times that are not older than window at now, sorted.
+func within(times []time.Time, now time.Time, window time.Duration) []time.Time {
+	kept := make([]time.Time, 0, len(times))
+	for _, t := range times {
+		if now.Sub(t) < window {
+			kept = append(kept, t)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Before(kept[j]) })
+	return kept
+}
@@ -0,0 +1,134 @@
+package budget
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRegisteredDomain(t *testing.T) {
+	tests := map[string]string{
+		"www.example.com":      "example.com",
+		"*.api.example.co.uk":  "example.co.uk",
+		"Shop.Example.COM.":    "example.com",
+		"example.com":          "example.com",
+		"localhost":            "localhost",
+		"co.uk":                "co.uk",
+		"team.apps.github.io":  "apps.github.io",
+		"a.b.c.example.org":    "example.org",
+		"service.internal.net": "internal.net",
+	}
+	for host, want := range tests {
+		assert.Equal(t, want, RegisteredDomain(host), host)
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	tls := []networkingv1.IngressTLS{
+		{Hosts: []string{"www.example.com", "api.example.com"}, SecretName: "a"},
+		{Hosts: []string{"shop.example.org"}, SecretName: "b"},
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		tls         []networkingv1.IngressTLS
+		want        []Account
+	}{
+		{
+			name:        "cluster issuer",
+			annotations: map[string]string{ClusterIssuerAnnotation: "letsencrypt"},
+			tls:         tls,
+			want: []Account{
+				{Issuer: "ClusterIssuer/letsencrypt", Domain: "example.com"},
+				{Issuer: "ClusterIssuer/letsencrypt", Domain: "example.org"},
+			},
+		},
+		{
+			name:        "namespaced issuer",
+			annotations: map[string]string{IssuerAnnotation: "acme"},
+			tls:         tls[1:],
+			want:        []Account{{Issuer: "Issuer/team/acme", Domain: "example.org"}},
+		},
+		{
+			name: "no issuer",
+			tls:  tls[1:],
+			want: []Account{{Domain: "example.org"}},
+		},
+		{
+			name: "no host",
+			tls:  []networkingv1.IngressTLS{{SecretName: "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ing := &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Name: "ing", Namespace: "team", Annotations: tt.annotations},
+				Spec:       networkingv1.IngressSpec{TLS: tt.tls},
+			}
+			assert.Equal(t, tt.want, Accounts(ing))
+		})
+	}
+}
+
+func TestLedger(t *testing.T) {
+	now := time.Date(2024, time.June, 10, 12, 0, 0, 0, time.UTC)
+	limits := Limits{CertificatesPerWeek: 2, FailedValidationsPerHour: 2}
+	a := Account{Issuer: "ClusterIssuer/letsencrypt", Domain: "example.com"}
+	b := Account{Issuer: "ClusterIssuer/letsencrypt", Domain: "example.org"}
+
+	t.Run("certificates per week", func(t *testing.T) {
+		l := &Ledger{}
+		l.Record([]Account{a}, now.Add(-8*24*time.Hour), false)
+		l.Record([]Account{a}, now.Add(-3*24*time.Hour), false)
+		_, exceeded := l.Exceeded([]Account{a, b}, now, limits)
+		assert.False(t, exceeded, "the certificate of 8 days ago left the window")
+
+		l.Record([]Account{a}, now.Add(-time.Hour), false)
+		r, exceeded := l.Exceeded([]Account{b, a}, now, limits)
+		assert.True(t, exceeded)
+		assert.Equal(t, a, r.Account)
+		assert.Equal(t, 0, r.Certificates)
+		assert.Equal(t, now.Add(4*24*time.Hour), r.Until)
+	})
+
+	t.Run("failed validations per hour", func(t *testing.T) {
+		l := &Ledger{}
+		l.Record([]Account{a}, now.Add(-50*time.Minute), true)
+		l.Record([]Account{a}, now.Add(-10*time.Minute), true)
+		r, exceeded := l.Exceeded([]Account{a}, now, limits)
+		assert.True(t, exceeded)
+		assert.Equal(t, now.Add(10*time.Minute), r.Until)
+
+		_, exceeded = l.Exceeded([]Account{a}, now.Add(11*time.Minute), limits)
+		assert.False(t, exceeded)
+	})
+
+	t.Run("zero limits never exceed", func(t *testing.T) {
+		l := &Ledger{}
+		for i := 0; i < 10; i++ {
+			l.Record([]Account{a}, now, i%2 == 0)
+		}
+		_, exceeded := l.Exceeded([]Account{a}, now, Limits{})
+		assert.False(t, exceeded)
+		assert.Equal(t, []Remaining{{Account: a, Certificates: -1, Failures: -1}}, l.Remaining(now, Limits{}))
+	})
+
+	t.Run("remaining and prune", func(t *testing.T) {
+		l := &Ledger{}
+		l.Record([]Account{a, b}, now.Add(-2*time.Hour), true)
+		l.Record([]Account{b}, now.Add(-time.Hour), false)
+		assert.Equal(t, []Remaining{
+			{Account: a, Certificates: 2, Failures: 2},
+			{Account: b, Certificates: 1, Failures: 2},
+		}, l.Remaining(now, limits))
+
+		l.Prune(now)
+		assert.Len(t, l.Usage, 1, "the account with only an expired failure is dropped")
+		assert.Empty(t, l.Usage[b.String()].Failures)
+	})
+}
@@ -0,0 +1,88 @@
+package budget
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	errorsK8S "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DataKey is the key of the ConfigMap holding the ledger, in JSON.
+const DataKey = "ledger.json"
+
+// Store persists a Ledger in a ConfigMap.
+type Store struct {
+	Client client.Client
+	// ConfigMap is the ConfigMap holding the ledger, created on the first update.
+	ConfigMap types.NamespacedName
+}
+
+// Load returns the ledger, empty when the ConfigMap does not exist yet.
+func (s *Store) Load(ctx context.Context) (*Ledger, error) {
+	ledger, _, err := s.get(ctx)
+	return ledger, err
+}
+
+// Update applies mutate to the ledger pruned at now and saves it, retrying on conflicts
+// with the other writers. It returns the saved ledger.
+func (s *Store) Update(ctx context.Context, now time.Time, mutate func(*Ledger)) (*Ledger, error) {
+	var saved *Ledger
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		ledger, cm, err := s.get(ctx)
+		if err != nil {
+			return err
+		}
+		mutate(ledger)
+		ledger.Prune(now)
+
+		data, err := json.Marshal(ledger)
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[DataKey] = string(data)
+		if cm.ResourceVersion == "" {
+			err = s.Client.Create(ctx, cm)
+		} else {
+			err = s.Client.Update(ctx, cm)
+		}
+		// A ConfigMap created meanwhile by another writer is a conflict too.
+		if errorsK8S.IsAlreadyExists(err) {
+			return errorsK8S.NewConflict(corev1.Resource("configmaps"), s.ConfigMap.Name, err)
+		}
+		saved = ledger
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("updating the ACME budget in ConfigMap %s: %w", s.ConfigMap, err)
+	}
+	return saved, nil
+}
+
+// get returns the ledger and its ConfigMap, a new one when it does not exist yet.
+func (s *Store) get(ctx context.Context) (*Ledger, *corev1.ConfigMap, error) {
+	ledger := &Ledger{}
+	cm := &corev1.ConfigMap{}
+	if err := s.Client.Get(ctx, s.ConfigMap, cm); err != nil {
+		if !errorsK8S.IsNotFound(err) {
+			return nil, nil, fmt.Errorf("reading the ACME budget from ConfigMap %s: %w", s.ConfigMap, err)
+		}
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: s.ConfigMap.Namespace, Name: s.ConfigMap.Name}}
+		return ledger, cm, nil
+	}
+	if raw := cm.Data[DataKey]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), ledger); err != nil {
+			return nil, nil, fmt.Errorf("parsing the ACME budget of ConfigMap %s: %w", s.ConfigMap, err)
+		}
+	}
+	return ledger, cm, nil
+}
@@ -0,0 +1,61 @@
+package budget
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Date(2024, time.June, 10, 12, 0, 0, 0, time.UTC)
+	a := Account{Issuer: "ClusterIssuer/letsencrypt", Domain: "example.com"}
+	key := types.NamespacedName{Namespace: "system", Name: "acme-budget"}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	store := &Store{Client: fakeClient, ConfigMap: key}
+
+	ledger, err := store.Load(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, ledger.Usage, "a missing ConfigMap is an empty ledger")
+
+	// The first update creates the ConfigMap, the next ones update it.
+	for i := 0; i < 2; i++ {
+		_, err = store.Update(ctx, now, func(l *Ledger) { l.Record([]Account{a}, now, false) })
+		require.NoError(t, err)
+	}
+	ledger, err = store.Load(ctx)
+	require.NoError(t, err)
+	require.Contains(t, ledger.Usage, a.String())
+	assert.Len(t, ledger.Usage[a.String()].Certificates, 2)
+	assert.Equal(t, a, ledger.Usage[a.String()].Account)
+
+	// A week later the update prunes the old certificates.
+	saved, err := store.Update(ctx, now.Add(CertificateWindow), func(*Ledger) {})
+	require.NoError(t, err)
+	assert.Empty(t, saved.Usage)
+
+	cm := &corev1.ConfigMap{}
+	require.NoError(t, fakeClient.Get(ctx, key, cm))
+	assert.JSONEq(t, `{}`, cm.Data[DataKey])
+}
+
+func TestStoreInvalidLedger(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "system", Name: "acme-budget"},
+		Data:       map[string]string{DataKey: "not json"},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cm).Build()
+	store := &Store{Client: fakeClient, ConfigMap: types.NamespacedName{Namespace: "system", Name: "acme-budget"}}
+
+	_, err := store.Load(context.TODO())
+	assert.ErrorContains(t, err, "parsing the ACME budget")
+}
@@ -23,15 +23,20 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	adapterv1 "github.com/uri-tech/nimble-opti-adapter/api/v1"
+	adapterv2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
 	"github.com/uri-tech/nimble-opti-adapter/internal/controller"
+	"github.com/uri-tech/nimble-opti-adapter/internal/operatorconfig"
+	uberzap "go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
@@ -44,6 +49,8 @@ var (
 	metricsAddr, probeAddr string
 	// Flag to enable leader election.
 	enableLeaderElection bool
+	// Flags and config file of the operator component configuration.
+	operatorFlags *operatorconfig.Flags
 	// Configuration options for the zap logger.
 	opts = zap.Options{
 		Development: false,
@@ -57,9 +64,10 @@ var (
 
 // Initialize command line flags.
 func init() {
-	// Add schemes for client-go and adapterv1.
+	// Add schemes for client-go, adapterv1 and adapterv2.
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(adapterv1.AddToScheme(scheme))
+	utilruntime.Must(adapterv2.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 
 	// Parse CLI flags.
@@ -74,24 +82,49 @@ func parseFlags() {
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	operatorFlags = operatorconfig.BindFlags(flag.CommandLine)
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 }
 
 // Entry point of the program.
 func main() {
-	// Set up the logger.
+	// Set up the logger, with a level the operator config can change at runtime.
+	logLevel := atomicLevel(opts.Level)
+	defaultLogLevel := logLevel.Level()
+	opts.Level = logLevel
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	// Load the operator configuration, from its file and flags.
+	operatorCfg, err := operatorFlags.Load()
+	if err != nil {
+		setupLog.Error(err, "unable to load operator config")
+		os.Exit(1)
+	}
+	setupLog.Info("loaded operator config", "config", operatorCfg)
+	if level, ok := operatorCfg.Level(); ok {
+		logLevel.SetLevel(level)
+	}
+
+	namespaces := operatorCfg.WatchNamespaces
+	if len(namespaces) > 0 {
+		setupLog.Info("restricting the operator to namespaces", "namespaces", namespaces)
+	}
+
+	// Give the runnables the grace period plus time to restore the annotations of interrupted renewals.
+	gracefulShutdownTimeout := operatorCfg.Timings.ShutdownGracePeriod.Duration + 30*time.Second
+
 	// Initialize the manager with configurations.
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
 		// MetricsBindAddress:     "0",
-		Port:                   9443,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "8f24f142.uri-tech.github.io",
+		Port:                    9443,
+		HealthProbeBindAddress:  probeAddr,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        "8f24f142.uri-tech.github.io",
+		Cache:                   cache.Options{Namespaces: namespaces},
+		GracefulShutdownTimeout: &gracefulShutdownTimeout,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -99,18 +132,37 @@ func main() {
 	}
 
 	// Initialize the Kubernetes client.
-	stopCh := make(chan struct{})
-	defer close(stopCh)
-
 	kubernetesClient := kubernetes.NewForConfigOrDie(mgr.GetConfig())
-	ingressWatcher, err := controller.NewIngressWatcher(kubernetesClient, stopCh)
+	ingressWatcher, err := controller.NewIngressWatcher(kubernetesClient, operatorCfg)
 	if err != nil {
 		setupLog.Error(err, "unable to create ingress watcher")
 		os.Exit(1)
 	}
+	// Report invalid override annotations as events on the Ingress.
+	ingressWatcher.Recorder = mgr.GetEventRecorderFor("nimble-opti-adapter")
+
+	// Run the ingress watcher within the manager, its audits and renewals only run on the leader.
+	if err = ingressWatcher.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to set up ingress watcher")
+		os.Exit(1)
+	}
 
-	// Start the daily audit for the ingress watcher.
-	ingressWatcher.StartAudit(stopCh)
+	// Apply the changes of the operator config ConfigMap without a restart.
+	if cmNamespace, cmName, _ := operatorFlags.ConfigMapRef(); cmName != "" {
+		if err = (&controller.ConfigReloader{
+			Client:          kubernetesClient,
+			Namespace:       cmNamespace,
+			Name:            cmName,
+			Flags:           operatorFlags,
+			IngressWatcher:  ingressWatcher,
+			LogLevel:        logLevel,
+			DefaultLogLevel: defaultLogLevel,
+			Recorder:        mgr.GetEventRecorderFor("nimble-opti-adapter"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to set up config reloader")
+			os.Exit(1)
+		}
+	}
 
 	// Setup the reconciler with the manager.
 	if err = (&controller.NimbleOptiReconciler{
@@ -122,6 +174,20 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "NimbleOpti")
 		os.Exit(1)
 	}
+	if err = (&controller.ClusterNimbleOptiReconciler{
+		Client:         mgr.GetClient(),
+		IngressWatcher: ingressWatcher,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterNimbleOpti")
+		os.Exit(1)
+	}
+	if err = (&controller.NimbleOptiRenewalReconciler{
+		Client:   mgr.GetClient(),
+		Recorder: mgr.GetEventRecorderFor("nimble-opti-adapter"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "NimbleOptiRenewal")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	// Set up the webhook server.
@@ -129,6 +195,15 @@ func main() {
 		setupLog.Error(err, "unable to create webhook", "webhook", "NimbleOpti")
 		os.Exit(1)
 	}
+	// v2 is the hub, its webhook also serves the conversion from v1.
+	if err = (&adapterv2.NimbleOpti{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "NimbleOpti", "version", "v2")
+		os.Exit(1)
+	}
+	if err = (&adapterv2.ClusterNimbleOpti{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ClusterNimbleOpti")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	// Add health checks.
@@ -150,3 +225,15 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// atomicLevel returns the level set by the zap flags as an AtomicLevel, so it can change at runtime.
+func atomicLevel(enabler zapcore.LevelEnabler) uberzap.AtomicLevel {
+	switch l := enabler.(type) {
+	case uberzap.AtomicLevel:
+		return l
+	case zapcore.Level:
+		return uberzap.NewAtomicLevelAt(l)
+	default:
+		return uberzap.NewAtomicLevelAt(zapcore.InfoLevel)
+	}
+}
@@ -3,11 +3,19 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/uri-tech/nimble-opti-adapter/cronjob/configenv"
 	"github.com/uri-tech/nimble-opti-adapter/cronjob/internal/ingresswatcher"
+	"github.com/uri-tech/nimble-opti-adapter/cronjob/internal/report"
 	"github.com/uri-tech/nimble-opti-adapter/loggerpkg"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -15,23 +23,55 @@ import (
 // Initialize logger for the main application context
 var logger = loggerpkg.GetNamedLogger("main")
 
+// Exit codes of the cronjob, so the Job status tells a partial failure apart from a fatal one.
+const (
+	// exitOK means every ingress was audited successfully.
+	exitOK = 0
+	// exitFatal means the audit could not run, for example a bad configuration or an unreachable API server.
+	exitFatal = 1
+	// exitPartialFailure means the audit ran but some ingresses failed.
+	exitPartialFailure = 2
+)
+
+// reportPublishTimeout bounds the publishing of the audit report.
+const reportPublishTimeout = 30 * time.Second
+
 // main is the entry point of the application.
 func main() {
 	logger.Debug("main")
 
-	// Load environment variables configuration
-	ecfg, err := configenv.LoadConfig()
+	// Load the configuration from the config file, the environment variables and the flags
+	ecfg, err := configenv.LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(exitOK)
+	}
 	if err != nil {
 		logger.Fatalf("Failed to load config: %v", err)
 	}
+	loggerpkg.SetRunMode(ecfg.RunMode)
 
-	// log info of the setup
-	logger.Infof("RUN_MODE: %s, ADMIN_USER_PERMISSION: %v", ecfg.RunMode, ecfg.AdminUserPermission)
+	// log the effective configuration
+	logger.Infof("Effective configuration:\n%s", ecfg)
 
 	// Run the core functionality of the application
-	if err := run(ecfg); err != nil {
+	err = run(ecfg)
+	if err != nil {
 		logger.Error(err)
 	}
+	_ = logger.Sync()
+	os.Exit(exitCode(err))
+}
+
+// exitCode maps the result of run to the process exit code.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var agg utilerrors.Aggregate
+	if errors.As(err, &agg) {
+		return exitPartialFailure
+	}
+	return exitFatal
 }
 
 // run orchestrates the main flow of the application, setting up the Kubernetes client and initiating the IngressWatcher.
@@ -76,14 +116,69 @@ func runIngressWatcher(clientset *kubernetes.Clientset, ecfg *configenv.ConfigEn
 		return errors.New("error creating IngressWatcher: " + err.Error())
 	}
 
-	// Define a context with a 10-minute timeout for the auditing process.
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	// Report invalid override annotations and config reloads as events.
+	recorder, stopRecorder := utils.NewEventRecorder(clientset, "ingress-annotation-modifier")
+	defer stopRecorder()
+	iw.Recorder = recorder
+
+	// Define a context with the configured timeout for the auditing process.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(ecfg.AuditTimeout)*time.Second)
 	defer cancel()
 
+	// A termination signal stops the audit gracefully instead of killing in-flight renewals.
+	sigCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stopSignals()
+
+	// Apply the changes of the reload ConfigMap while the audit runs.
+	reloadRef, err := report.ParseConfigMapRef(ecfg.ReloadConfigMap)
+	if err != nil {
+		return err
+	}
+	if reloadRef.Name != "" {
+		watchCtx, stopWatch := context.WithCancel(ctx)
+		defer stopWatch()
+		go func() {
+			if err := iw.WatchConfig(watchCtx, clientset, reloadRef.Namespace, reloadRef.Name); err != nil {
+				logger.Errorf("Failed to watch the config ConfigMap: %v", err)
+			}
+		}()
+	}
+
 	// Audit all Ingress resources in the cluster.
-	if err := iw.AuditIngressResources(ctx); err != nil {
-		return errors.New("error auditing Ingress resources: " + err.Error())
+	rep, auditErr := iw.AuditIngressResources(ctx, sigCtx.Done())
+
+	// Publish the report also when the audit stopped on an error, so the processed ingresses are visible.
+	// It uses its own deadline, the audit one may already be over.
+	publishCtx, cancelPublish := context.WithTimeout(context.Background(), reportPublishTimeout)
+	defer cancelPublish()
+	if err := publishReport(publishCtx, iw, rep, ecfg); err != nil {
+		logger.Errorf("Failed to publish audit report: %v", err)
+	}
+
+	if auditErr != nil {
+		return fmt.Errorf("error auditing Ingress resources: %w", auditErr)
 	}
 
 	return nil
 }
+
+// publishReport writes the audit report to the targets selected in the configuration.
+func publishReport(ctx context.Context, iw *ingresswatcher.IngressWatcher, rep *report.Report, ecfg *configenv.ConfigEnv) error {
+	logger.Debug("publishReport")
+
+	formats, err := report.ParseFormats(ecfg.ReportFormat)
+	if err != nil {
+		return err
+	}
+	cmRef, err := report.ParseConfigMapRef(ecfg.ReportConfigMap)
+	if err != nil {
+		return err
+	}
+
+	return report.Publish(ctx, iw.ClientObj, os.Stdout, rep, report.Options{
+		Formats:   formats,
+		Stdout:    ecfg.ReportStdout,
+		FilePath:  ecfg.ReportFile,
+		ConfigMap: cmRef,
+	})
+}
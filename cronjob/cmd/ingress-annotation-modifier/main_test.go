@@ -1,10 +1,13 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
@@ -53,6 +56,24 @@ func TestSetupKubernetesClient(t *testing.T) {
 
 }
 
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"no error", nil, exitOK},
+		{"fatal error", errors.New("error getting in-cluster config"), exitFatal},
+		{"partial failure", fmt.Errorf("error auditing Ingress resources: %w", utilerrors.NewAggregate([]error{errors.New("ingress default/a: boom")})), exitPartialFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, exitCode(tt.err))
+		})
+	}
+}
+
 type CustomClientset struct {
 	*kubernetes.Clientset
 	fakeClient *fake.Clientset
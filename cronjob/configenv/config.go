@@ -2,27 +2,193 @@ package configenv
 
 import (
 	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+
+	"github.com/uri-tech/nimble-opti-adapter/cronjob/internal/report"
+	"sigs.k8s.io/yaml"
 )
 
-// Config holds all configuration for our program
+// Config holds all configuration for our program.
+// It is loaded, from the lowest to the highest precedence, from the defaults, the config file,
+// the environment variables and the command-line flags.
 type ConfigEnv struct {
-	RunMode                     string
-	LogOutput                   string
-	CertificateRenewalThreshold int  // in days
-	AnnotationRemovalDelay      int  // in seconds
-	AdminUserPermission         bool // for reading secrets
+	RunMode                          string `json:"runMode"`
+	LogOutput                        string `json:"logOutput"`
+	CertificateRenewalThreshold      int    `json:"certificateRenewalThreshold"`      // in days
+	RenewalSpread                    int    `json:"renewalSpread"`                    // in days, renewals are spread over this long after the threshold, 0 to disable
+	AnnotationRemovalDelay           int    `json:"annotationRemovalDelay"`           // in seconds
+	AdminUserPermission              bool   `json:"adminUserPermission"`              // for reading secrets
+	ReportFormat                     string `json:"reportFormat"`                     // comma separated list of "json" and "markdown"
+	ReportStdout                     bool   `json:"reportStdout"`                     // write the audit report to stdout
+	ReportFile                       string `json:"reportFile"`                       // base path of the audit report files, empty to disable
+	ReportConfigMap                  string `json:"reportConfigMap"`                  // "namespace/name" of the audit report ConfigMap, empty to disable
+	AuditConcurrency                 int    `json:"auditConcurrency"`                 // number of ingresses processed in parallel
+	AuditTimeout                     int    `json:"auditTimeout"`                     // in seconds, deadline of the whole audit
+	IngressTimeout                   int    `json:"ingressTimeout"`                   // in seconds, deadline of a single ingress
+	MaxDegradedIngresses             int    `json:"maxDegradedIngresses"`             // ingresses allowed without the HTTPS annotation at once, 0 for no cap
+	MaxDegradedIngressesPerNamespace int    `json:"maxDegradedIngressesPerNamespace"` // ingresses of a namespace allowed without the HTTPS annotation at once, 0 for no cap
+	SecretDeletionWait               int    `json:"secretDeletionWait"`               // in seconds, wait after deleting a secret before resolving the challenge
+	WatchNamespaces                  string `json:"watchNamespaces"`                  // comma separated namespaces to audit, empty for all namespaces
+	ShutdownGracePeriod              int    `json:"shutdownGracePeriod"`              // in seconds, wait for in-flight renewals on shutdown before restoring their annotations
+	ReloadConfigMap                  string `json:"reloadConfigMap"`                  // "namespace/name" of the ConfigMap reloaded during the audit, empty to disable
+	AcmeBudgetConfigMap              string `json:"acmeBudgetConfigMap"`              // "namespace/name" of the ACME budget ledger ConfigMap, empty to disable
+	AcmeCertificatesPerWeek          int    `json:"acmeCertificatesPerWeek"`          // certificates per issuer and registered domain within a week, 0 for no cap
+	AcmeFailedValidationsPerHour     int    `json:"acmeFailedValidationsPerHour"`     // failed renewals per issuer and registered domain within an hour, 0 for no cap
+}
+
+// configFileEnv is the environment variable holding the path of the config file.
+const configFileEnv = "CONFIG_FILE"
+
+// setting describes one configuration key and the env var and flag that override it.
+type setting struct {
+	key   string      // key is the name of the setting in the config file.
+	env   string      // env is the environment variable overriding the file.
+	flag  string      // flag is the command-line flag overriding the env var.
+	usage string      // usage is the help text of the flag.
+	ptr   interface{} // ptr points to the *string, *int or *bool field of the setting.
+}
+
+// settings returns the settings of cfg, in the order they are printed.
+func (cfg *ConfigEnv) settings() []setting {
+	return []setting{
+		{"runMode", "RUN_MODE", "run-mode", "dev or prod", &cfg.RunMode},
+		{"logOutput", "LOG_OUTPUT", "log-output", "console or json", &cfg.LogOutput},
+		{"certificateRenewalThreshold", "CERTIFICATE_RENEWAL_THRESHOLD", "certificate-renewal-threshold", "days before expiry to renew a certificate", &cfg.CertificateRenewalThreshold},
+		{"renewalSpread", "RENEWAL_SPREAD", "renewal-spread", "days after the threshold the renewals are spread over, 0 to disable", &cfg.RenewalSpread},
+		{"annotationRemovalDelay", "ANNOTATION_REMOVAL_DELAY", "annotation-removal-delay", "seconds to wait after removing the HTTPS annotation", &cfg.AnnotationRemovalDelay},
+		{"adminUserPermission", "ADMIN_USER_PERMISSION", "admin-user-permission", "read secrets to check certificate expiry", &cfg.AdminUserPermission},
+		{"reportFormat", "REPORT_FORMAT", "report-format", "comma separated report formats, json and/or markdown", &cfg.ReportFormat},
+		{"reportStdout", "REPORT_STDOUT", "report-stdout", "write the audit report to stdout", &cfg.ReportStdout},
+		{"reportFile", "REPORT_FILE", "report-file", "base path of the report files, empty to disable", &cfg.ReportFile},
+		{"reportConfigMap", "REPORT_CONFIGMAP", "report-configmap", "namespace/name of the report ConfigMap, empty to disable", &cfg.ReportConfigMap},
+		{"auditConcurrency", "AUDIT_CONCURRENCY", "audit-concurrency", "number of ingresses audited in parallel", &cfg.AuditConcurrency},
+		{"auditTimeout", "AUDIT_TIMEOUT", "audit-timeout", "seconds, deadline of the whole audit", &cfg.AuditTimeout},
+		{"ingressTimeout", "INGRESS_TIMEOUT", "ingress-timeout", "seconds, deadline of a single ingress", &cfg.IngressTimeout},
+		{"maxDegradedIngresses", "MAX_DEGRADED_INGRESSES", "max-degraded-ingresses", "ingresses allowed without the HTTPS annotation at once, 0 for no cap", &cfg.MaxDegradedIngresses},
+		{"maxDegradedIngressesPerNamespace", "MAX_DEGRADED_INGRESSES_PER_NAMESPACE", "max-degraded-ingresses-per-namespace", "ingresses of a namespace allowed without the HTTPS annotation at once, 0 for no cap", &cfg.MaxDegradedIngressesPerNamespace},
+		{"secretDeletionWait", "SECRET_DELETION_WAIT", "secret-deletion-wait", "seconds to wait after deleting a secret", &cfg.SecretDeletionWait},
+		{"watchNamespaces", "WATCH_NAMESPACES", "watch-namespaces", "comma separated namespaces to audit, empty for all", &cfg.WatchNamespaces},
+		{"shutdownGracePeriod", "SHUTDOWN_GRACE_PERIOD", "shutdown-grace-period", "seconds to wait for in-flight renewals on shutdown", &cfg.ShutdownGracePeriod},
+		{"reloadConfigMap", "RELOAD_CONFIGMAP", "reload-configmap", "namespace/name of a ConfigMap whose " + ConfigMapKey + " key is reloaded during the audit, empty to disable", &cfg.ReloadConfigMap},
+		{"acmeBudgetConfigMap", "ACME_BUDGET_CONFIGMAP", "acme-budget-configmap", "namespace/name of the ConfigMap holding the ACME budget ledger, empty to disable", &cfg.AcmeBudgetConfigMap},
+		{"acmeCertificatesPerWeek", "ACME_CERTIFICATES_PER_WEEK", "acme-certificates-per-week", "certificates per issuer and registered domain within a week, 0 for no cap", &cfg.AcmeCertificatesPerWeek},
+		{"acmeFailedValidationsPerHour", "ACME_FAILED_VALIDATIONS_PER_HOUR", "acme-failed-validations-per-hour", "failed renewals per issuer and registered domain within an hour, 0 for no cap", &cfg.AcmeFailedValidationsPerHour},
+	}
+}
+
+// parse parses value strictly for the type of the field of s.
+func (s setting) parse(value string) (interface{}, error) {
+	switch s.ptr.(type) {
+	case *int:
+		v, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q", value)
+		}
+		return v, nil
+	case *bool:
+		v, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean %q", value)
+		}
+		return v, nil
+	default:
+		return value, nil
+	}
 }
 
-// LoadConfig loads configuration from environment variables
-func LoadConfig() (*ConfigEnv, error) {
-	cfg := &ConfigEnv{
-		RunMode:                     getEnv("RUN_MODE", "dev"),
-		CertificateRenewalThreshold: getEnvAsInt("CERTIFICATE_RENEWAL_THRESHOLD", 60),
-		AnnotationRemovalDelay:      getEnvAsInt("ANNOTATION_REMOVAL_DELAY", 30),
-		AdminUserPermission:         getEnv("ADMIN_USER_PERMISSION", "false") == "true",
-		LogOutput:                   getEnv("LOG_OUTPUT", "console"),
+// set parses value strictly and stores it in the field of s.
+func (s setting) set(value string) error {
+	v, err := s.parse(value)
+	if err != nil {
+		return err
+	}
+	switch p := s.ptr.(type) {
+	case *string:
+		*p = v.(string)
+	case *int:
+		*p = v.(int)
+	case *bool:
+		*p = v.(bool)
+	}
+	return nil
+}
+
+// defaultConfig returns the configuration used when nothing overrides it.
+func defaultConfig() *ConfigEnv {
+	return &ConfigEnv{
+		RunMode:                     "dev",
+		LogOutput:                   "console",
+		CertificateRenewalThreshold: 60,
+		AnnotationRemovalDelay:      30,
+		AdminUserPermission:         false,
+		ReportFormat:                "json,markdown",
+		ReportStdout:                true,
+		AuditConcurrency:            4,
+		AuditTimeout:                600,
+		IngressTimeout:              180,
+		MaxDegradedIngresses:        2,
+		SecretDeletionWait:          5,
+		ShutdownGracePeriod:         20,
+		// The rate limits of Let's Encrypt, the ledger is off until a ConfigMap is set.
+		AcmeCertificatesPerWeek:      50,
+		AcmeFailedValidationsPerHour: 5,
+	}
+}
+
+// LoadConfig loads the configuration from the defaults, the config file, the environment variables
+// and the command-line args, each one overriding the previous ones.
+// The config file is given by the --config flag or the CONFIG_FILE environment variable.
+func LoadConfig(args []string) (*ConfigEnv, error) {
+	cfg := defaultConfig()
+	settings := cfg.settings()
+
+	// Parse the flags first to find the config file. Their values are applied last.
+	type flagValue struct {
+		s     setting
+		value string
+	}
+	var flagValues []flagValue
+	configFile := os.Getenv(configFileEnv)
+
+	fs := flag.NewFlagSet("ingress-annotation-modifier", flag.ContinueOnError)
+	fs.StringVar(&configFile, "config", configFile, "path of a YAML or JSON config file, also read from "+configFileEnv)
+	for _, s := range settings {
+		s := s
+		fs.Func(s.flag, s.usage+" (env "+s.env+")", func(value string) error {
+			// Check the value now, so the error names the flag.
+			if _, err := s.parse(value); err != nil {
+				return err
+			}
+			flagValues = append(flagValues, flagValue{s, value})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if configFile != "" {
+		if err := loadFile(cfg, configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(value); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, fv := range flagValues {
+		if err := fv.s.set(fv.value); err != nil {
+			return nil, fmt.Errorf("--%s: %w", fv.s.flag, err)
+		}
 	}
 
 	// Validation
@@ -33,48 +199,95 @@ func LoadConfig() (*ConfigEnv, error) {
 	return cfg, nil
 }
 
+// loadFile overrides cfg with the keys of a YAML or JSON config file.
+// Unknown keys and values of the wrong type are rejected.
+func loadFile(cfg *ConfigEnv, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// String renders the effective configuration, one "key: value" line per setting.
+func (cfg *ConfigEnv) String() string {
+	var b strings.Builder
+	for _, s := range cfg.settings() {
+		switch p := s.ptr.(type) {
+		case *string:
+			fmt.Fprintf(&b, "%s: %q\n", s.key, *p)
+		case *int:
+			fmt.Fprintf(&b, "%s: %d\n", s.key, *p)
+		case *bool:
+			fmt.Fprintf(&b, "%s: %t\n", s.key, *p)
+		}
+	}
+	return b.String()
+}
+
 func validate(cfg *ConfigEnv) error {
 	// Check that RunMode is either 'dev' or 'prod'
 	if cfg.RunMode != "dev" && cfg.RunMode != "prod" {
-		return errors.New("RUN_MODE must be either 'dev' or 'prod'")
+		return errors.New("runMode (RUN_MODE) must be either 'dev' or 'prod'")
 	}
 
 	// Check that LogOutput is either 'console' or 'json'
 	if cfg.LogOutput != "console" && cfg.LogOutput != "json" {
-		return errors.New("LOG_OUTPUT must be either 'console' or 'json'")
+		return errors.New("logOutput (LOG_OUTPUT) must be either 'console' or 'json'")
 	}
 
-	// Check that CertificateRenewalThreshold is a positive number
-	if cfg.CertificateRenewalThreshold <= 0 {
-		return errors.New("CERTIFICATE_RENEWAL_THRESHOLD must be a positive number")
+	// Check the positive numbers
+	for _, c := range []struct {
+		name  string
+		value int
+	}{
+		{"certificateRenewalThreshold (CERTIFICATE_RENEWAL_THRESHOLD)", cfg.CertificateRenewalThreshold},
+		{"annotationRemovalDelay (ANNOTATION_REMOVAL_DELAY)", cfg.AnnotationRemovalDelay},
+		{"auditConcurrency (AUDIT_CONCURRENCY)", cfg.AuditConcurrency},
+		{"auditTimeout (AUDIT_TIMEOUT)", cfg.AuditTimeout},
+		{"ingressTimeout (INGRESS_TIMEOUT)", cfg.IngressTimeout},
+	} {
+		if c.value <= 0 {
+			return fmt.Errorf("%s must be a positive number, got %d", c.name, c.value)
+		}
 	}
 
-	// Check that AnnotationRemovalDelay is a positive number
-	if cfg.AnnotationRemovalDelay <= 0 {
-		return errors.New("ANNOTATION_REMOVAL_DELAY must be a positive number")
+	// Check the numbers that may be zero
+	for _, c := range []struct {
+		name  string
+		value int
+	}{
+		{"renewalSpread (RENEWAL_SPREAD)", cfg.RenewalSpread},
+		{"maxDegradedIngresses (MAX_DEGRADED_INGRESSES)", cfg.MaxDegradedIngresses},
+		{"maxDegradedIngressesPerNamespace (MAX_DEGRADED_INGRESSES_PER_NAMESPACE)", cfg.MaxDegradedIngressesPerNamespace},
+		{"secretDeletionWait (SECRET_DELETION_WAIT)", cfg.SecretDeletionWait},
+		{"shutdownGracePeriod (SHUTDOWN_GRACE_PERIOD)", cfg.ShutdownGracePeriod},
+		{"acmeCertificatesPerWeek (ACME_CERTIFICATES_PER_WEEK)", cfg.AcmeCertificatesPerWeek},
+		{"acmeFailedValidationsPerHour (ACME_FAILED_VALIDATIONS_PER_HOUR)", cfg.AcmeFailedValidationsPerHour},
+	} {
+		if c.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %d", c.name, c.value)
+		}
 	}
 
-	// Check that AdminUserPermission is a boolean
-	if cfg.AdminUserPermission != true && cfg.AdminUserPermission != false {
-		return errors.New("ADMIN_USER_PERMISSION must be a boolean")
+	// Check that ReportFormat only lists known formats
+	if _, err := report.ParseFormats(cfg.ReportFormat); err != nil {
+		return fmt.Errorf("reportFormat (REPORT_FORMAT) is invalid: %w", err)
 	}
 
-	return nil
-}
-
-// getEnv fetches an environment variable, returning a default value if it's not found
-func getEnv(key string, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+	// Check that ReportConfigMap, ReloadConfigMap and AcmeBudgetConfigMap are "namespace/name" references
+	if _, err := report.ParseConfigMapRef(cfg.ReportConfigMap); err != nil {
+		return fmt.Errorf("reportConfigMap (REPORT_CONFIGMAP) is invalid: %w", err)
 	}
-	return defaultValue
-}
-
-// getEnvAsInt fetches an environment variable as an integer, returning a default value if it's not found
-func getEnvAsInt(key string, defaultValue int) int {
-	valueStr := getEnv(key, "")
-	if value, err := strconv.Atoi(valueStr); err == nil {
-		return value
+	if _, err := report.ParseConfigMapRef(cfg.ReloadConfigMap); err != nil {
+		return fmt.Errorf("reloadConfigMap (RELOAD_CONFIGMAP) is invalid: %w", err)
+	}
+	if _, err := report.ParseConfigMapRef(cfg.AcmeBudgetConfigMap); err != nil {
+		return fmt.Errorf("acmeBudgetConfigMap (ACME_BUDGET_CONFIGMAP) is invalid: %w", err)
 	}
-	return defaultValue
+
+	return nil
 }
@@ -0,0 +1,175 @@
+package configenv
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeConfigFile writes content to a config file in a temporary directory and returns its path.
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := LoadConfig(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultConfig(), cfg)
+}
+
+// TestLoadConfigPrecedence checks that env vars override the file and flags override env vars.
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+runMode: prod
+auditConcurrency: 8
+ingressTimeout: 90
+adminUserPermission: true
+`)
+	t.Setenv("AUDIT_CONCURRENCY", "6")
+	t.Setenv("INGRESS_TIMEOUT", "60")
+
+	cfg, err := LoadConfig([]string{"--config", path, "--ingress-timeout", "30"})
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", cfg.RunMode)     // file
+	assert.True(t, cfg.AdminUserPermission)  // file
+	assert.Equal(t, 6, cfg.AuditConcurrency) // env over file
+	assert.Equal(t, 30, cfg.IngressTimeout)  // flag over env
+	assert.Equal(t, 600, cfg.AuditTimeout)   // default
+	assert.Equal(t, "json,markdown", cfg.ReportFormat)
+}
+
+func TestLoadConfigJSONFileFromEnv(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"watchNamespaces": "team-a,team-b", "reportStdout": false}`)
+	t.Setenv(configFileEnv, path)
+
+	cfg, err := LoadConfig(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a,team-b", cfg.WatchNamespaces)
+	assert.False(t, cfg.ReportStdout)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "malformed integer env var",
+			env:     map[string]string{"AUDIT_CONCURRENCY": "four"},
+			wantErr: `AUDIT_CONCURRENCY: invalid integer "four"`,
+		},
+		{
+			name:    "malformed boolean env var",
+			env:     map[string]string{"ADMIN_USER_PERMISSION": "yes please"},
+			wantErr: `ADMIN_USER_PERMISSION: invalid boolean "yes please"`,
+		},
+		{
+			name:    "malformed integer flag",
+			args:    []string{"--audit-timeout=10m"},
+			wantErr: "audit-timeout",
+		},
+		{
+			name:    "unknown file key",
+			file:    "auditConcurency: 4\n",
+			wantErr: "auditConcurency",
+		},
+		{
+			name:    "wrong type in file",
+			file:    "auditConcurrency: many\n",
+			wantErr: "auditConcurrency",
+		},
+		{
+			name:    "invalid value",
+			env:     map[string]string{"INGRESS_TIMEOUT": "0"},
+			wantErr: "ingressTimeout (INGRESS_TIMEOUT) must be a positive number",
+		},
+		{
+			name:    "missing file",
+			args:    []string{"--config", "/does/not/exist.yaml"},
+			wantErr: "reading config file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append(args, "--config", writeConfigFile(t, "config.yaml", tt.file))
+			}
+
+			_, err := LoadConfig(args)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigString(t *testing.T) {
+	out := defaultConfig().String()
+	assert.Contains(t, out, "runMode: \"dev\"\n")
+	assert.Contains(t, out, "auditConcurrency: 4\n")
+	assert.Contains(t, out, "reportStdout: true\n")
+}
+
+func TestReload(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantChanged []string
+		wantErr     string
+	}{
+		{
+			name:        "reloadable keys",
+			data:        "runMode: prod\ncertificateRenewalThreshold: 30\nmaxDegradedIngresses: 5\n",
+			wantChanged: []string{"runMode", "certificateRenewalThreshold", "maxDegradedIngresses"},
+		},
+		{
+			name: "unchanged keys",
+			data: "runMode: dev\nauditConcurrency: 4\n",
+		},
+		{
+			name:    "key only read at start-up",
+			data:    "certificateRenewalThreshold: 30\nauditConcurrency: 8\nwatchNamespaces: team-a\n",
+			wantErr: "auditConcurrency, watchNamespaces cannot change during an audit",
+		},
+		{
+			name:    "invalid value",
+			data:    "ingressTimeout: 0\n",
+			wantErr: "ingressTimeout (INGRESS_TIMEOUT) must be a positive number, got 0",
+		},
+		{
+			name:    "unknown key",
+			data:    "ingresTimeout: 10\n",
+			wantErr: "parsing config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := defaultConfig()
+			next, changed, err := current.Reload([]byte(tt.data))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Nil(t, next)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantChanged, changed)
+			assert.Equal(t, defaultConfig(), current, "the current config must not be modified")
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package configenv
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ConfigMapKey is the key holding the config file in the ConfigMap reloaded during the audit.
+const ConfigMapKey = "config.yaml"
+
+// reloadableKeys are the settings that may change during an audit. The others size the audit
+// or select what it covers, and only change on the next run.
+var reloadableKeys = map[string]bool{
+	"runMode":                          true,
+	"certificateRenewalThreshold":      true,
+	"renewalSpread":                    true,
+	"annotationRemovalDelay":           true,
+	"ingressTimeout":                   true,
+	"maxDegradedIngresses":             true,
+	"maxDegradedIngressesPerNamespace": true,
+	"secretDeletionWait":               true,
+	"acmeCertificatesPerWeek":          true,
+	"acmeFailedValidationsPerHour":     true,
+}
+
+// Reload returns a copy of cfg overridden by the keys of a config file, and the keys it changed.
+// Keys missing from the file keep their current value. The result is validated and only
+// reloadable keys may change, otherwise cfg is left in place and an error is returned.
+func (cfg *ConfigEnv) Reload(data []byte) (*ConfigEnv, []string, error) {
+	next := *cfg
+	if err := yaml.UnmarshalStrict(data, &next); err != nil {
+		return nil, nil, fmt.Errorf("parsing config: %w", err)
+	}
+	if err := validate(&next); err != nil {
+		return nil, nil, err
+	}
+
+	var changed, restart []string
+	nextSettings := next.settings()
+	for i, s := range cfg.settings() {
+		if reflect.DeepEqual(reflect.ValueOf(s.ptr).Elem().Interface(), reflect.ValueOf(nextSettings[i].ptr).Elem().Interface()) {
+			continue
+		}
+		if !reloadableKeys[s.key] {
+			restart = append(restart, s.key)
+			continue
+		}
+		changed = append(changed, s.key)
+	}
+	if len(restart) > 0 {
+		return nil, nil, fmt.Errorf("%s cannot change during an audit", strings.Join(restart, ", "))
+	}
+	return &next, changed, nil
+}
@@ -5,11 +5,22 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/uri-tech/nimble-opti-adapter/policy"
 	"github.com/uri-tech/nimble-opti-adapter/utils"
 	networkingv1 "k8s.io/api/networking/v1"
+	errorsK8S "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// backendProtocolAnnotation is the annotation a renewal temporarily removes from an Ingress.
+const backendProtocolAnnotation = "nginx.ingress.kubernetes.io/backend-protocol"
+
+// originalBackendProtocolAnnotation holds the removed backend-protocol annotation, like the operator keeps it,
+// so the operator can restore a renewal the cronjob interrupted.
+const originalBackendProtocolAnnotation = policy.OriginalBackendProtocolAnnotation
+
 // removeHTTPSAnnotation removes the "nginx.ingress.kubernetes.io/backend-protocol: HTTPS" annotation from an Ingress.
 func (iw *IngressWatcher) removeHTTPSAnnotation(ctx context.Context, ing *networkingv1.Ingress) error {
 	logger.Debugf("starting removeHTTPSAnnotation, ing: %v", ing.Name)
@@ -22,7 +33,11 @@ func (iw *IngressWatcher) removeHTTPSAnnotation(ctx context.Context, ing *networ
 			logger.Errorf("Failed to get ingress: %v", err)
 			return err
 		}
-		delete(ing.Annotations, "nginx.ingress.kubernetes.io/backend-protocol")
+		// Keep the removed value on the Ingress, so it can be restored when the NimbleOpti is deleted.
+		if val, ok := ing.Annotations[backendProtocolAnnotation]; ok {
+			ing.Annotations[originalBackendProtocolAnnotation] = val
+		}
+		delete(ing.Annotations, backendProtocolAnnotation)
 
 		defer iw.auditMutex.Unlock(key)
 		logger.Debug("removeHTTPSAnnotation - key is locked")
@@ -57,7 +72,8 @@ func (iw *IngressWatcher) addHTTPSAnnotation(ctx context.Context, ing *networkin
 		if ing.Annotations == nil {
 			ing.Annotations = make(map[string]string)
 		}
-		ing.Annotations["nginx.ingress.kubernetes.io/backend-protocol"] = "HTTPS"
+		ing.Annotations[backendProtocolAnnotation] = "HTTPS"
+		delete(ing.Annotations, originalBackendProtocolAnnotation)
 
 		defer iw.auditMutex.Unlock(key)
 		logger.Debug("addHTTPSAnnotation - key is locked")
@@ -76,3 +92,32 @@ func (iw *IngressWatcher) addHTTPSAnnotation(ctx context.Context, ing *networkin
 
 	return nil
 }
+
+// restoreAnnotations sets back the pre-renewal annotations of the Ingress of key, after its renewal was interrupted.
+func (iw *IngressWatcher) restoreAnnotations(ctx context.Context, key string, annotations map[string]string) error {
+	logger.Debugf("starting restoreAnnotations, ing: %v", key)
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		ing := &networkingv1.Ingress{}
+		if err := iw.ClientObj.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, ing); err != nil {
+			if errorsK8S.IsNotFound(err) {
+				// Nothing left to restore.
+				return nil
+			}
+			return err
+		}
+		if ing.Annotations == nil {
+			ing.Annotations = make(map[string]string)
+		}
+		for k, v := range annotations {
+			ing.Annotations[k] = v
+		}
+		delete(ing.Annotations, originalBackendProtocolAnnotation)
+		return iw.ClientObj.Update(ctx, ing)
+	})
+}
@@ -43,6 +43,8 @@ func TestRemoveHTTPSAnnotation(t *testing.T) {
 
 	_, exists := ing.Annotations[httpsAnnotation]
 	assert.False(t, exists, "Expected HTTPS annotation to be removed")
+	// The removed value is kept, like the operator does.
+	assert.Equal(t, "HTTPS", ing.Annotations[originalBackendProtocolAnnotation])
 }
 
 func TestAddHTTPSAnnotation(t *testing.T) {
@@ -55,6 +57,7 @@ func TestAddHTTPSAnnotation(t *testing.T) {
 	ctx := context.TODO()
 
 	ing := generateIngress("test-ingress", "default", nil, nil, nil)
+	ing.Annotations = map[string]string{originalBackendProtocolAnnotation: "HTTPS"}
 
 	// Create the Ingress object using the fake client.
 	if err := fakeClient.Create(ctx, ing); err != nil {
@@ -68,4 +71,5 @@ func TestAddHTTPSAnnotation(t *testing.T) {
 
 	val, exists := ing.Annotations[httpsAnnotation]
 	assert.True(t, exists && val == "HTTPS", "Expected HTTPS annotation to be added")
+	assert.NotContains(t, ing.Annotations, originalBackendProtocolAnnotation)
 }
@@ -0,0 +1,66 @@
+package ingresswatcher
+
+import (
+	"context"
+	"time"
+
+	"github.com/uri-tech/nimble-opti-adapter/budget"
+	"github.com/uri-tech/nimble-opti-adapter/cronjob/internal/report"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// acmeBudget returns the ledger and the limits of the ACME budget, ok is false when it is disabled.
+func (iw *IngressWatcher) acmeBudget() (store *budget.Store, limits budget.Limits, ok bool) {
+	cfg := iw.config()
+	ref, err := report.ParseConfigMapRef(cfg.AcmeBudgetConfigMap)
+	if err != nil || ref.Name == "" {
+		return nil, budget.Limits{}, false
+	}
+	limits = budget.Limits{
+		CertificatesPerWeek:      cfg.AcmeCertificatesPerWeek,
+		FailedValidationsPerHour: cfg.AcmeFailedValidationsPerHour,
+	}
+	return &budget.Store{Client: iw.ClientObj, ConfigMap: ref}, limits, true
+}
+
+// acmeBudgetExceeded reports whether a new certificate for ing would exceed the ACME budget.
+// A ledger that cannot be read does not block the renewal.
+func (iw *IngressWatcher) acmeBudgetExceeded(ctx context.Context, ing *networkingv1.Ingress) bool {
+	store, limits, ok := iw.acmeBudget()
+	if !ok {
+		return false
+	}
+	accounts := budget.Accounts(ing)
+	if len(accounts) == 0 {
+		return false
+	}
+	ledger, err := store.Load(ctx)
+	if err != nil {
+		logger.Errorf("Failed to check the ACME budget of ingress %s: %v", utils.IngressKey(ing), err)
+		return false
+	}
+	spent, exceeded := ledger.Exceeded(accounts, time.Now(), limits)
+	if exceeded {
+		logger.Warnf("The ACME budget of %s is spent until %s, not renewing ingress %s",
+			spent.Account, spent.Until.Format(time.RFC3339), utils.IngressKey(ing))
+	}
+	return exceeded
+}
+
+// recordAcmeBudget adds the outcome of a renewal of ing to the ACME budget: a certificate when it renewed,
+// a failed validation when the challenge did not clear. The ledger is best effort, errors are only logged.
+func (iw *IngressWatcher) recordAcmeBudget(ctx context.Context, ing *networkingv1.Ingress, renewed bool) {
+	store, _, ok := iw.acmeBudget()
+	if !ok {
+		return
+	}
+	accounts := budget.Accounts(ing)
+	if len(accounts) == 0 {
+		return
+	}
+	now := time.Now()
+	if _, err := store.Update(ctx, now, func(l *budget.Ledger) { l.Record(accounts, now, !renewed) }); err != nil {
+		logger.Errorf("Failed to record the renewal of ingress %s in the ACME budget: %v", utils.IngressKey(ing), err)
+	}
+}
@@ -0,0 +1,80 @@
+package ingresswatcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uri-tech/nimble-opti-adapter/budget"
+	"github.com/uri-tech/nimble-opti-adapter/cronjob/internal/report"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	fakec "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAuditIngressAcmeBudget(t *testing.T) {
+	ctx := context.TODO()
+	account := budget.Account{Issuer: "ClusterIssuer/letsencrypt", Domain: "example.com"}
+
+	tests := []struct {
+		name             string
+		issued           int
+		wantAction       report.Action
+		wantSecrets      []string
+		wantCertificates int
+	}{
+		{name: "within the budget", issued: 1, wantAction: report.ActionRenewed, wantSecrets: []string{"tls-v1"}, wantCertificates: 2},
+		{name: "budget spent", issued: 2, wantAction: report.ActionDeferred, wantSecrets: []string{"tls"}, wantCertificates: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+			iw, err := setupIngressWatcher(fakeClient)
+			require.NoError(t, err)
+			iw.Config.AdminUserPermission = true
+			iw.Config.AcmeBudgetConfigMap = "default/acme-budget"
+			iw.Config.AcmeCertificatesPerWeek = 2
+
+			store := &budget.Store{Client: fakeClient, ConfigMap: types.NamespacedName{Namespace: "default", Name: "acme-budget"}}
+			_, err = store.Update(ctx, time.Now(), func(l *budget.Ledger) {
+				for i := 0; i < tt.issued; i++ {
+					l.Record([]budget.Account{account}, time.Now().Add(-time.Hour), false)
+				}
+			})
+			require.NoError(t, err)
+
+			certDER, err := generateTestCert(time.Now().Add(24 * time.Hour))
+			require.NoError(t, err)
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "default"},
+				Data:       map[string][]byte{"tls.crt": certDER},
+			}
+			require.NoError(t, fakeClient.Create(ctx, secret))
+
+			ing := generateIngress("ing", "default", nil, nil, map[string]string{
+				"nginx.ingress.kubernetes.io/backend-protocol": "HTTPS",
+				policy.StrategyAnnotation:                      "secret-rename",
+				budget.ClusterIssuerAnnotation:                 "letsencrypt",
+			})
+			ing.Spec.TLS = []networkingv1.IngressTLS{{Hosts: []string{"app.example.com"}, SecretName: "tls"}}
+			require.NoError(t, fakeClient.Create(ctx, ing))
+
+			rec, err := iw.auditIngress(ctx, ing)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAction, rec.Action)
+			assert.Equal(t, tt.wantSecrets, rec.TLSSecrets)
+
+			ledger, err := store.Load(ctx)
+			require.NoError(t, err)
+			require.Contains(t, ledger.Usage, account.String())
+			assert.Len(t, ledger.Usage[account.String()].Certificates, tt.wantCertificates)
+		})
+	}
+}
@@ -3,18 +3,26 @@ package ingresswatcher
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	// v1 "github.com/uri-tech/nimble-opti-adapter/api/v1"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
 	"github.com/uri-tech/nimble-opti-adapter/cronjob/configenv"
+	"github.com/uri-tech/nimble-opti-adapter/cronjob/internal/report"
 	"github.com/uri-tech/nimble-opti-adapter/loggerpkg"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
 	"github.com/uri-tech/nimble-opti-adapter/utils"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
@@ -24,9 +32,29 @@ type IngressWatcher struct {
 	Client     KubernetesClient
 	ClientObj  client.Client
 	auditMutex *utils.NamedMutex
-	Config     *configenv.ConfigEnv
+	// Config is the configuration of the audit. Once the audit runs, read it with config and replace it with ApplyConfig.
+	Config *configenv.ConfigEnv
+	// configMu protects Config.
+	configMu sync.RWMutex
+	// degraded caps how many ingresses are without the HTTPS annotation at the same time, in total and per namespace.
+	degraded *utils.NamespaceSemaphore
+	// inFlight tracks the renewals that removed the HTTPS annotation and did not reinstate it yet.
+	inFlight *utils.InFlight
+	// Recorder records the events on the Ingress resources, such as an invalid override annotation.
+	Recorder record.EventRecorder
+	// suspended holds the namespaces whose NimbleOpti is suspended, read when an audit starts.
+	// The others are read again before each renewal, see namespaceSuspended.
+	suspended map[string]bool
+	// rollout holds back the renewals of the staged policies behind their canary during an audit, see holdBack.
+	rollout *stagedRollout
 }
 
+// annotationRestoreTimeout bounds the re-adding of the HTTPS annotation once the ingress deadline has passed.
+const annotationRestoreTimeout = 30 * time.Second
+
+// errShuttingDown is returned for work refused because a shutdown was requested.
+var errShuttingDown = errors.New("shutting down")
+
 // logger is the logger for the ingresswatcher package.
 var logger = loggerpkg.GetNamedLogger("ingresswatcher")
 
@@ -49,6 +77,12 @@ func NewIngressWatcher(clientKube kubernetes.Interface, ecfg *configenv.ConfigEn
 		return nil, err
 	}
 
+	// Add the NimbleOpti types, to honour their suspend field.
+	if err := v2.AddToScheme(scheme); err != nil {
+		logger.Fatalf("unable to add NimbleOpti scheme %v", err)
+		return nil, err
+	}
+
 	// Create a new client to Kubernetes API.
 	cl, err := client.New(cfg, client.Options{
 		Scheme: scheme,
@@ -65,122 +99,400 @@ func NewIngressWatcher(clientKube kubernetes.Interface, ecfg *configenv.ConfigEn
 		ClientObj:  cl,
 		auditMutex: utils.NewNamedMutex(),
 		Config:     ecfg,
+		degraded:   utils.NewNamespaceSemaphore(ecfg.MaxDegradedIngresses, ecfg.MaxDegradedIngressesPerNamespace),
+		inFlight:   utils.NewInFlight(),
+		Recorder:   &record.FakeRecorder{},
 	}, nil
 }
 
-// auditIngressResources audits all Ingress with the label. renew the certificate if needed.
-func (iw *IngressWatcher) AuditIngressResources(ctx context.Context) error {
+// AuditIngressResources audits all Ingress with the label. renew the certificate if needed.
+// It returns a report with one record per audited ingress, also when it stops on an error.
+// Closing stop asks for a graceful shutdown: no new ingress is started, the in-flight ones get
+// SHUTDOWN_GRACE_PERIOD to finish and the annotations of those that did not are restored.
+func (iw *IngressWatcher) AuditIngressResources(ctx context.Context, stop <-chan struct{}) (*report.Report, error) {
 	logger.Debug("starting AuditIngressResources")
 
-	// initialize the IngressForRenewal struct
-	countIngressForRenewal := 0
-	// count the ingress that was successfully renewed
-	countIngressRenewed := 0
-
-	// Fetch all Ingress resources
-	ingresses := &networkingv1.IngressList{}
+	rep := report.New()
+	defer rep.Finish()
 
-	// Fetch all Ingress resources using the standard Kubernetes client
-	// ingresses, err := iw.Client.NetworkingV1().Ingresses("").List(ctx, metav1.ListOptions{})
-	err := iw.ClientObj.List(ctx, ingresses, &client.ListOptions{})
+	// Fetch all Ingress resources of the watched namespaces
+	ingresses, err := iw.listIngresses(ctx)
 	if err != nil {
 		logger.Errorf("Failed to list ingresses: %v", err)
-		return err
+		return rep, err
+	}
+
+	// The ingresses of a suspended namespace are left alone for the whole audit.
+	iw.suspended, err = iw.suspendedNamespaces(ctx)
+	if err != nil {
+		logger.Errorf("Failed to list the suspended namespaces: %v", err)
+		return rep, err
+	}
+	iw.rollout = newStagedRollout()
+
+	// Feed the ingresses to a bounded pool of workers. A failing ingress does not stop the audit,
+	// its error is collected and reported together with the others.
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	// The workers run on their own context, so a shutdown gives in-flight ingresses the grace period.
+	workCtx, cancelWork := context.WithCancel(ctx)
+	defer cancelWork()
+	go iw.cancelAfterGracePeriod(workCtx, stop, cancelWork)
+
+	items := make(chan *networkingv1.Ingress)
+	for w := 0; w < iw.config().AuditConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ing := range items {
+				rec, err := iw.auditIngressWithDeadline(workCtx, ing)
+				rep.Add(rec)
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("ingress %s: %w", utils.IngressKey(ing), err))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	var stopErr error
+	dispatched := 0
+dispatch:
+	for ; dispatched < len(ingresses.Items); dispatched++ {
+		select {
+		case items <- &ingresses.Items[dispatched]:
+		case <-ctx.Done():
+			stopErr = ctx.Err()
+			break dispatch
+		case <-stop:
+			stopErr = errShuttingDown
+			break dispatch
+		}
+	}
+	close(items)
+	wg.Wait()
+
+	// Restore the ingresses whose renewal was interrupted by the shutdown or could not reinstate its annotations.
+	if err := iw.restoreInFlight(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, iw.rollout.errs()...)
+
+	// Record the ingresses the audit never got to, so the report still covers every ingress.
+	for _, ing := range ingresses.Items[dispatched:] {
+		rep.Add(report.Record{
+			Namespace: ing.Namespace,
+			Name:      ing.Name,
+			Action:    report.ActionFailed,
+			Error:     "not audited: " + stopErr.Error(),
+		})
+	}
+	if dispatched < len(ingresses.Items) {
+		logger.Errorf("Audit stopped after %d of %d Ingress resources: %v", dispatched, len(ingresses.Items), stopErr)
+		errs = append(errs, fmt.Errorf("%d ingresses not audited: %w", len(ingresses.Items)-dispatched, stopErr))
+	}
+
+	logger.Infof("Finished auditing %d Ingress resources. There was %d ingress needed renewal", len(ingresses.Items), rep.Summary.Renewed+rep.Summary.NotRenewed)
+	logger.Infof("There was %d ingress successfully renewed", rep.Summary.Renewed)
+
+	// NewAggregate returns nil when there are no errors.
+	return rep, utilerrors.NewAggregate(errs)
+}
+
+// cancelAfterGracePeriod cancels the work SHUTDOWN_GRACE_PERIOD after stop is closed,
+// unless the in-flight renewals finished before.
+func (iw *IngressWatcher) cancelAfterGracePeriod(workCtx context.Context, stop <-chan struct{}, cancelWork context.CancelFunc) {
+	select {
+	case <-stop:
+	case <-workCtx.Done():
+		return
+	}
+
+	grace := time.Duration(iw.config().ShutdownGracePeriod) * time.Second
+	logger.Warnf("Shutdown requested, waiting up to %v for in-flight renewals", grace)
+
+	graceCtx, cancel := context.WithTimeout(workCtx, grace)
+	defer cancel()
+	if !iw.inFlight.Drain(graceCtx) && workCtx.Err() == nil {
+		logger.Warn("Grace period expired with renewals still in flight, cancelling them")
+		cancelWork()
+	}
+}
+
+// restoreInFlight restores the pre-renewal annotations of every renewal that did not reinstate them.
+func (iw *IngressWatcher) restoreInFlight() error {
+	var errs []error
+	for key, annotations := range iw.inFlight.Pending() {
+		ctx, cancel := context.WithTimeout(context.Background(), annotationRestoreTimeout)
+		err := iw.restoreAnnotations(ctx, key, annotations)
+		cancel()
+		if err != nil {
+			logger.Errorf("Failed to restore the annotations of %s: %v", key, err)
+			errs = append(errs, fmt.Errorf("ingress %s: restoring annotations: %w", key, err))
+			continue
+		}
+		iw.endRenewal(key)
+		logger.Infof("Restored the annotations of the interrupted renewal of %s", key)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// listIngresses lists the Ingress resources of every namespace in WATCH_NAMESPACES, or of all namespaces when it is empty.
+func (iw *IngressWatcher) listIngresses(ctx context.Context) (*networkingv1.IngressList, error) {
+	namespaces := utils.SplitCommaList(iw.config().WatchNamespaces)
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	ingresses := &networkingv1.IngressList{}
+	for _, ns := range namespaces {
+		list := &networkingv1.IngressList{}
+		if err := iw.ClientObj.List(ctx, list, client.InNamespace(ns)); err != nil {
+			return nil, fmt.Errorf("listing ingresses in namespace %q: %w", ns, err)
+		}
+		ingresses.Items = append(ingresses.Items, list.Items...)
+	}
+	return ingresses, nil
+}
+
+// auditIngressWithDeadline audits a single ingress within the configured per-ingress deadline.
+func (iw *IngressWatcher) auditIngressWithDeadline(ctx context.Context, ing *networkingv1.Ingress) (report.Record, error) {
+	ingCtx, cancel := context.WithTimeout(ctx, time.Duration(iw.config().IngressTimeout)*time.Second)
+	defer cancel()
+
+	return iw.auditIngress(ingCtx, ing)
+}
+
+// auditIngress audits a single ingress and returns its report record.
+func (iw *IngressWatcher) auditIngress(ctx context.Context, ing *networkingv1.Ingress) (report.Record, error) {
+	logger.Debugf("starting auditIngress, ingress: %v", ing.Name)
+
+	startTime := time.Now()
+	rec := report.Record{
+		Namespace: ing.Namespace,
+		Name:      ing.Name,
+		Action:    report.ActionNone,
+	}
+	for _, tlsSpec := range ing.Spec.TLS {
+		rec.TLSSecrets = append(rec.TLSSecrets, tlsSpec.SecretName)
+	}
+
+	// finish fills the fields every return path shares. A renewal refused by a suspension is skipped, not failed.
+	// The outcome releases the renewals waiting for ing when it is the canary of a staged policy.
+	finish := func(err error) (report.Record, error) {
+		rec.DurationSeconds = time.Since(startTime).Seconds()
+		switch {
+		case errors.Is(err, errRenewalSuspended):
+			rec.Action = report.ActionSkipped
+			err = nil
+		case err != nil:
+			rec.Action = report.ActionFailed
+			rec.Error = err.Error()
+		}
+		iw.rollout.done(ing, rec.Action == report.ActionRenewed)
+		return rec, err
+	}
+
+	// Leave the ingress alone when its annotations ask for it.
+	pol := iw.resolvePolicy(ing)
+	if pol.Skip {
+		logger.Infof("Skipping ingress %s, it has %s set", utils.IngressKey(ing), policy.SkipAnnotation)
+		rec.Action = report.ActionSkipped
+		return finish(nil)
+	}
+	if suspended, err := iw.namespaceSuspended(ctx, ing.Namespace); err != nil {
+		logger.Errorf("Failed to check whether the namespace is suspended: %v", err)
+		return finish(err)
+	} else if suspended {
+		logger.Infof("Skipping ingress %s, its namespace is suspended or released", utils.IngressKey(ing))
+		rec.Action = report.ActionSkipped
+		return finish(nil)
 	}
 
-	// Iterate through all Ingress resources
-	for _, ing := range ingresses.Items {
-		// check if the ingress has any ACME challenge paths.
-		if isContainsAcmeChallenge(ctx, &ing) {
-			countIngressForRenewal++
-			logger.Infof("Found ingress with ACME challenge path, ingress name: %v", ing.Name)
-			// start certificate renewal
-			isRenew, err := iw.startCertificateRenewalAudit(ctx, &ing)
+	// check if the ingress has any ACME challenge paths.
+	if isContainsAcmeChallenge(ctx, ing) {
+		logger.Infof("Found ingress with ACME challenge path, ingress name: %v", ing.Name)
+		// The ingresses of a staged policy wait for its canary.
+		if held, err := iw.holdBack(ctx, ing); err != nil {
+			return finish(err)
+		} else if held {
+			rec.Action = report.ActionDeferred
+			return finish(nil)
+		}
+		rec.Strategy = report.StrategyChallenge
+		// start certificate renewal
+		isRenew, err := iw.startCertificateRenewalAudit(ctx, ing, pol)
+		if err != nil {
+			logger.Errorf("Failed to start certificate renewal: %v", err)
+			return finish(err)
+		}
+		iw.recordAcmeBudget(ctx, ing, isRenew)
+		// The fallback requests another certificate, it only runs within the ACME budget.
+		if !isRenew && len(ing.Spec.TLS) > 0 && renameFallback(pol) && !iw.acmeBudgetExceeded(ctx, ing) {
+			oldSecret := ing.Spec.TLS[0].SecretName
+			logger.Infof("Certificate was not renewed, trying now change secret %s for renewal.", oldSecret)
+			rec.Strategy = report.StrategySecretRename
+
+			// change the connected ingress secret in ing.Spec.TLS for making cert-manager create new certificate secret.
+			if err := iw.changeIngressSecretName(ctx, ing, oldSecret); err != nil {
+				logger.Errorf("Failed to change ingress secret name: %v", err)
+				return finish(err)
+			}
+			rec.TLSSecrets = nil
+			for _, tlsSpec := range ing.Spec.TLS {
+				rec.TLSSecrets = append(rec.TLSSecrets, tlsSpec.SecretName)
+			}
+			// start certificate renewal by make sure letsencrypt can reach the ACME challenge path.
+			isRenew, err = iw.startCertificateRenewalAudit(ctx, ing, pol)
 			if err != nil {
 				logger.Errorf("Failed to start certificate renewal: %v", err)
-				return err
+				return finish(err)
 			}
+			iw.recordAcmeBudget(ctx, ing, isRenew)
 			if !isRenew {
-				oldSecret := ing.Spec.TLS[0].SecretName
-				logger.Infof("Certificate was not renewed, trying now change secret %s for renewal.", oldSecret)
+				logger.Infof("Certificate was not renewed also when it secret name was change, old secret: %s, new secret: %s.", oldSecret, ing.Spec.TLS[0].SecretName)
+			} else {
+				logger.Infof("Certificate was renewed when it secret name was change, ingress name: %v", ing.Name)
+			}
+		} else if isRenew {
+			logger.Infof("Certificate was renewed, ingress name: %v", ing.Name)
+		}
+		rec.Action = report.ActionNotRenewed
+		if isRenew {
+			rec.Action = report.ActionRenewed
+		}
+	} else if iw.config().AdminUserPermission && pol.Strategy != policy.StrategyChallengeOnly { // check if the cronjob has admin user permission for reading secrets.
+		// Calculate the time remaining for renewal.
+		timeRemaining, secretName, err := iw.timeRemainingCertificateUpToRenewal(ctx, ing)
+		if err != nil {
+			logger.Errorf("Failed to check if the certificate is up to renewal: %v", err)
+			return finish(err)
+		}
+		if secretName != "" {
+			expiry := time.Now().Add(timeRemaining).UTC()
+			rec.Expiry = &expiry
+		}
+		// Check if the certificate is up to renewal, at the threshold of the ingress within the renewal spread.
+		if secretName != "" && timeRemaining <= pol.Threshold(utils.IngressKey(ing)) {
+			// Replacing the secret requests a new certificate, it waits for the ACME budget.
+			if iw.acmeBudgetExceeded(ctx, ing) {
+				rec.Action = report.ActionDeferred
+				return finish(nil)
+			}
+			// So does the canary of a staged policy.
+			if held, err := iw.holdBack(ctx, ing); err != nil {
+				return finish(err)
+			} else if held {
+				rec.Action = report.ActionDeferred
+				return finish(nil)
+			}
+			if pol.RenamesSecrets() {
+				rec.Strategy = report.StrategySecretRename
 
-				// change the connected ingress secret in ing.Spec.TLS for making cert-manager create new certificate secret.
-				if err := iw.changeIngressSecretName(ctx, &ing, oldSecret); err != nil {
+				// point the ingress at a new secret, the old one is kept.
+				if err := iw.changeIngressSecretName(ctx, ing, secretName); err != nil {
 					logger.Errorf("Failed to change ingress secret name: %v", err)
-					return err
+					return finish(err)
 				}
-				// start certificate renewal by make sure letsencrypt can reach the ACME challenge path.
-				isSecondTeyRenew, err := iw.startCertificateRenewalAudit(ctx, &ing)
-				if err != nil {
-					logger.Errorf("Failed to start certificate renewal: %v", err)
-					return err
-				}
-				if !isSecondTeyRenew {
-					logger.Infof("Certificate was not renewed also when it secret name was change, old secret: %s, new secret: %s.", oldSecret, ing.Spec.TLS[0].SecretName)
-				} else {
-					countIngressRenewed++
-					logger.Infof("Certificate was renewed when it secret name was change, ingress name: %v", ing.Name)
+				rec.TLSSecrets = nil
+				for _, tlsSpec := range ing.Spec.TLS {
+					rec.TLSSecrets = append(rec.TLSSecrets, tlsSpec.SecretName)
 				}
 			} else {
-				countIngressRenewed++
-				logger.Infof("Certificate was renewed, ingress name: %v", ing.Name)
-			}
-		} else if iw.Config.AdminUserPermission { // check if the cronjob has admin user permission for reading secrets.
-			// Calculate the time remaining for renewal.
-			timeRemaining, secretName, err := iw.timeRemainingCertificateUpToRenewal(ctx, &ing)
-			if err != nil {
-				logger.Errorf("Failed to check if the certificate is up to renewal: %v", err)
-				return err
-			}
-			// Check if the certificate is up to renewal.
-			if timeRemaining <= time.Duration(iw.Config.CertificateRenewalThreshold*24)*time.Hour {
+				rec.Strategy = report.StrategySecretDelete
 
 				// delete connected ingress secret
 				if err := iw.deleteIngressSecret(ctx, secretName, ing.Namespace); err != nil {
 					logger.Errorf("Failed to delete ingress secret: %v", err)
-					return err
+					return finish(err)
 				}
 
-				// sleep for 5 seconds for make sure the secret was deleted
-				time.Sleep(5 * time.Second)
-
-				// start certificate renewal by make sure letsencrypt can reach the ACME challenge path.
-				isRenew, err := iw.startCertificateRenewalAudit(ctx, &ing)
-				if err != nil {
-					logger.Errorf("Failed to start certificate renewal: %v", err)
-					return err
+				// wait for make sure the secret was deleted
+				select {
+				case <-time.After(time.Duration(iw.config().SecretDeletionWait) * time.Second):
+				case <-ctx.Done():
+					return finish(ctx.Err())
 				}
-				if isRenew {
-					logger.Infof("Certificate was renewed, ingress name: %v", ing.Name)
-				}
-			} else {
-				logger.Infof("Certificate is not up to renewal, time remaining: %v", timeRemaining)
 			}
+
+			// start certificate renewal by make sure letsencrypt can reach the ACME challenge path.
+			isRenew, err := iw.startCertificateRenewalAudit(ctx, ing, pol)
+			if err != nil {
+				logger.Errorf("Failed to start certificate renewal: %v", err)
+				return finish(err)
+			}
+			iw.recordAcmeBudget(ctx, ing, isRenew)
+			rec.Action = report.ActionNotRenewed
+			if isRenew {
+				rec.Action = report.ActionRenewed
+				logger.Infof("Certificate was renewed, ingress name: %v", ing.Name)
+			}
+		} else {
+			logger.Infof("Certificate is not up to renewal, time remaining: %v", timeRemaining)
 		}
 	}
-	logger.Infof("Finished auditing %d Ingress resources. There was %d ingress needed renewal", len(ingresses.Items), countIngressForRenewal)
-	logger.Infof("There was %d ingress successfully renewed", countIngressRenewed)
 
-	return nil
+	return finish(nil)
 }
 
 // startCertificateRenewal get ingress that has "".well-known/acme-challenge" and resolve it. if the resolve was successful - return true, else - return false.
-func (iw *IngressWatcher) startCertificateRenewalAudit(ctx context.Context, ing *networkingv1.Ingress) (bool, error) {
+// The HTTPS annotation stays removed up to the annotation removal delay of pol.
+func (iw *IngressWatcher) startCertificateRenewalAudit(ctx context.Context, ing *networkingv1.Ingress, pol policy.Policy) (bool, error) {
 	logger.Debugf("starting startCertificateRenewal, ingress: %v", ing.Name)
 
 	var isRenew = false
 
+	// Wait for a free slot, so only a bounded number of ingresses are without the HTTPS annotation at once.
+	// Once the annotation is removed, the slot is held until it is reinstated, see endRenewal.
+	if err := iw.degraded.Acquire(ctx, ing.Namespace); err != nil {
+		logger.Errorf("Failed to wait for a degraded slot: %v", err)
+		return false, err
+	}
+
+	// The namespace may have been suspended meanwhile, never remove the annotation then.
+	key := utils.IngressKey(ing)
+	if suspended, err := iw.namespaceSuspended(ctx, ing.Namespace); err != nil {
+		iw.degraded.Release(ing.Namespace)
+		return false, err
+	} else if suspended {
+		iw.degraded.Release(ing.Namespace)
+		logger.Infof("Not starting the renewal of ingress %s, its namespace is suspended or released", key)
+		return false, errRenewalSuspended
+	}
+
+	// Register the renewal with the pre-renewal annotations, so they are restored if it cannot finish.
+	original := map[string]string{}
+	if val, ok := ing.Annotations[backendProtocolAnnotation]; ok {
+		original[backendProtocolAnnotation] = val
+	}
+	if !iw.inFlight.Begin(key, original) {
+		iw.degraded.Release(ing.Namespace)
+		return false, errShuttingDown
+	}
+
 	// Remove the annotation.
 	if err := iw.removeHTTPSAnnotation(ctx, ing); err != nil {
 		// logger.Errorf("Failed to remove HTTPS annotation: %v", err)
+		iw.endRenewal(key)
 		return false, err
 	}
 
 	// Wait for the absence of the ACME challenge path or for the timeout.
-	timeout := time.Duration(iw.Config.AnnotationRemovalDelay) * time.Second
+	timeout := pol.ChallengeClearTimeout
 	successTime, err := iw.waitForChallengeAbsence(ctx, timeout, ing.Namespace, ing.Name)
 	if err != nil {
 		logger.Errorf("Failed to wait for the absence of ACME challenge path: %v", err)
+		// Never leave the ingress without its annotation, reinstate it before returning.
+		// When it fails the renewal stays in flight, holding its degraded slot, and is restored by restoreInFlight.
+		if addErr := iw.reinstateHTTPSAnnotation(ctx, ing); addErr != nil {
+			logger.Errorf("Failed to add HTTPS annotation: %v", addErr)
+		} else {
+			iw.endRenewal(key)
+		}
 		return false, err
 	}
 	if successTime > timeout {
@@ -189,15 +501,36 @@ func (iw *IngressWatcher) startCertificateRenewalAudit(ctx context.Context, ing
 		isRenew = true
 	}
 
-	// Reinstate the annotation.
-	if err := iw.addHTTPSAnnotation(ctx, ing); err != nil {
+	// When reinstating the annotation fails the renewal stays in flight, holding its degraded slot,
+	// and is restored by restoreInFlight.
+	if err := iw.reinstateHTTPSAnnotation(ctx, ing); err != nil {
 		logger.Errorf("Failed to add HTTPS annotation: %v", err)
 		return isRenew, err
 	}
+	iw.endRenewal(key)
 
 	return isRenew, nil
 }
 
+// endRenewal ends the renewal of the ingress of key once its annotations are reinstated, freeing its degraded slot.
+func (iw *IngressWatcher) endRenewal(key string) {
+	namespace, _, _ := cache.SplitMetaNamespaceKey(key)
+	iw.inFlight.End(key)
+	iw.degraded.Release(namespace)
+}
+
+// reinstateHTTPSAnnotation adds the HTTPS annotation back to ing. When the ingress deadline already passed it
+// uses a fresh one bounded by annotationRestoreTimeout, an expired deadline must never leave the ingress
+// without its HTTPS annotation.
+func (iw *IngressWatcher) reinstateHTTPSAnnotation(ctx context.Context, ing *networkingv1.Ingress) error {
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), annotationRestoreTimeout)
+		defer cancel()
+	}
+	return iw.addHTTPSAnnotation(ctx, ing)
+}
+
 // changeIngressSecretName change the secret name in ing.Spec.TLS to make cert-manager create new certificate secret.
 func (iw *IngressWatcher) changeIngressSecretName(ctx context.Context, ing *networkingv1.Ingress, secretName string) error {
 	logger.Debugf("starting changeIngressSecretName, ingress: %v", ing.Name)
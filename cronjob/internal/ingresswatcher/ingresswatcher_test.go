@@ -7,6 +7,7 @@ import (
 	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"errors"
 	"fmt"
 	"math/big"
 	"testing"
@@ -15,15 +16,19 @@ import (
 	// v1 "github.com/uri-tech/nimble-opti-adapter/api/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/uri-tech/nimble-opti-adapter/cronjob/configenv"
+	"github.com/uri-tech/nimble-opti-adapter/cronjob/internal/report"
 	"github.com/uri-tech/nimble-opti-adapter/utils"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	fakec "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 )
 
 // func newIngressWatcherForTesting(clientKube *kubernetes.Clientset, ecfg *configenv.ConfigEnv) (*IngressWatcher, error) {
@@ -40,6 +45,9 @@ func newIngressWatcherForTesting(cfakeClientset *fake.Clientset, ecfg *configenv
 		ClientObj:  cl,
 		auditMutex: utils.NewNamedMutex(),
 		Config:     ecfg,
+		degraded:   utils.NewNamespaceSemaphore(ecfg.MaxDegradedIngresses, ecfg.MaxDegradedIngressesPerNamespace),
+		inFlight:   utils.NewInFlight(),
+		Recorder:   &record.FakeRecorder{},
 	}, nil
 }
 
@@ -150,6 +158,10 @@ func setupIngressWatcher(client client.Client) (*IngressWatcher, error) {
 		AnnotationRemovalDelay:      10,
 		AdminUserPermission:         false,
 		LogOutput:                   "console",
+		AuditConcurrency:            2,
+		AuditTimeout:                60,
+		IngressTimeout:              30,
+		MaxDegradedIngresses:        1,
 	}
 
 	iw, err := newIngressWatcherForTesting(fakeClientset, ecfg)
@@ -175,6 +187,10 @@ func setupIngressWatcherMock(clientObj client.Client, client *FakeKubernetesClie
 		AnnotationRemovalDelay:      10,
 		AdminUserPermission:         false,
 		LogOutput:                   "console",
+		AuditConcurrency:            2,
+		AuditTimeout:                60,
+		IngressTimeout:              30,
+		MaxDegradedIngresses:        1,
 	}
 
 	// Create a new IngressWatcher.
@@ -202,6 +218,10 @@ func TestNewIngressWatcher(t *testing.T) {
 		AnnotationRemovalDelay:      10,
 		AdminUserPermission:         false,
 		LogOutput:                   "console",
+		AuditConcurrency:            2,
+		AuditTimeout:                60,
+		IngressTimeout:              30,
+		MaxDegradedIngresses:        1,
 	}
 
 	t.Run("successfully initialize an IngressWatcher", func(t *testing.T) {
@@ -251,10 +271,189 @@ func TestAuditIngressResources(t *testing.T) {
 
 	// 2. Call the audit function
 	iw.auditMutex.Unlock("default")
-	err = iw.AuditIngressResources(ctx)
+	rep, err := iw.AuditIngressResources(ctx, nil)
 	if err != nil {
 		t.Fatalf("Failed to audit ingress resources: %v", err)
 	}
+
+	// 3. Every ingress gets a record in the report.
+	assert.Equal(t, 2, rep.Summary.Total)
+	assert.Equal(t, 2, rep.Summary.Unchanged)
+	assert.Len(t, rep.Records, 2)
+	assert.Equal(t, "ingress-with-label", rep.Records[0].Name)
+}
+
+func TestAuditIngressResourcesConcurrent(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+
+	for i := 0; i < 5; i++ {
+		ing := generateIngress(fmt.Sprintf("ingress-%d", i), "default", nil, []string{"/app"}, nil)
+		if err := fakeClient.Create(ctx, ing); err != nil {
+			t.Fatalf("Failed to create ingress: %v", err)
+		}
+	}
+
+	iw, err := setupIngressWatcher(fakeClient)
+	if err != nil {
+		t.Fatalf("Failed to setup IngressWatcher: %v", err)
+	}
+	iw.Config.AuditConcurrency = 3
+
+	rep, err := iw.AuditIngressResources(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, rep.Summary.Total)
+	assert.Len(t, rep.Records, 5)
+}
+
+// TestAuditIngressResourcesWatchNamespaces checks that only the namespaces in WATCH_NAMESPACES are audited.
+func TestAuditIngressResourcesWatchNamespaces(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+
+	for _, ns := range []string{"team-a", "team-b", "team-c"} {
+		if err := fakeClient.Create(ctx, generateIngress("ingress", ns, nil, []string{"/app"}, nil)); err != nil {
+			t.Fatalf("Failed to create ingress: %v", err)
+		}
+	}
+
+	iw, err := setupIngressWatcher(fakeClient)
+	if err != nil {
+		t.Fatalf("Failed to setup IngressWatcher: %v", err)
+	}
+	iw.Config.WatchNamespaces = "team-a, team-c"
+
+	rep, err := iw.AuditIngressResources(ctx, nil)
+	assert.NoError(t, err)
+
+	var namespaces []string
+	for _, rec := range rep.Records {
+		namespaces = append(namespaces, rec.Namespace)
+	}
+	assert.Equal(t, []string{"team-a", "team-c"}, namespaces)
+}
+
+// TestAuditIngressResourcesPartialFailure checks that a failing ingress does not stop the audit of the others.
+func TestAuditIngressResourcesPartialFailure(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+
+	// The secret of the first ingress does not exist, so reading its certificate fails.
+	broken := generateIngress("broken", "a-namespace", nil, []string{"/app"}, nil)
+	broken.Spec.TLS = []networkingv1.IngressTLS{{SecretName: "missing-secret"}}
+	healthy := generateIngress("healthy", "b-namespace", nil, []string{"/app"}, nil)
+	for _, ing := range []*networkingv1.Ingress{broken, healthy} {
+		if err := fakeClient.Create(ctx, ing); err != nil {
+			t.Fatalf("Failed to create ingress: %v", err)
+		}
+	}
+
+	iw, err := setupIngressWatcher(fakeClient)
+	if err != nil {
+		t.Fatalf("Failed to setup IngressWatcher: %v", err)
+	}
+	iw.Config.AdminUserPermission = true
+
+	rep, err := iw.AuditIngressResources(ctx, nil)
+
+	var agg utilerrors.Aggregate
+	if assert.True(t, errors.As(err, &agg), "expected an aggregate error, got %v", err) {
+		assert.Len(t, agg.Errors(), 1)
+		assert.Contains(t, agg.Error(), "a-namespace/broken")
+	}
+	assert.Equal(t, 2, rep.Summary.Total)
+	assert.Equal(t, 1, rep.Summary.Failed)
+	assert.Equal(t, 1, rep.Summary.Unchanged)
+}
+
+// TestRestoreInFlight checks that a renewal which could not reinstate its annotation gets it restored.
+func TestRestoreInFlight(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+
+	ing := generateIngress("ing", "default", nil, []string{"/app"}, map[string]string{originalBackendProtocolAnnotation: "HTTPS"})
+	if err := fakeClient.Create(ctx, ing); err != nil {
+		t.Fatalf("Failed to create ingress: %v", err)
+	}
+
+	iw, err := setupIngressWatcher(fakeClient)
+	if err != nil {
+		t.Fatalf("Failed to setup IngressWatcher: %v", err)
+	}
+	iw.inFlight.Begin("default/ing", map[string]string{backendProtocolAnnotation: "HTTPS"})
+	// The ingress of a renewal may be deleted meanwhile, there is nothing to restore then.
+	iw.inFlight.Begin("default/deleted", map[string]string{backendProtocolAnnotation: "HTTPS"})
+
+	assert.NoError(t, iw.restoreInFlight())
+	assert.Empty(t, iw.inFlight.Pending())
+
+	updated := &networkingv1.Ingress{}
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "ing", Namespace: "default"}, updated))
+	assert.Equal(t, "HTTPS", updated.Annotations[backendProtocolAnnotation])
+	assert.NotContains(t, updated.Annotations, originalBackendProtocolAnnotation)
+}
+
+func TestCancelAfterGracePeriod(t *testing.T) {
+	tests := []struct {
+		name       string
+		inFlight   bool
+		wantCancel bool
+	}{
+		{"renewal still in flight is cancelled", true, true},
+		{"nothing in flight is left alone", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iw, err := setupIngressWatcher(fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build())
+			if err != nil {
+				t.Fatalf("Failed to setup IngressWatcher: %v", err)
+			}
+			iw.Config.ShutdownGracePeriod = 0
+			if tt.inFlight {
+				iw.inFlight.Begin("default/ing", nil)
+			}
+
+			workCtx, cancelWork := context.WithCancel(context.TODO())
+			defer cancelWork()
+			stop := make(chan struct{})
+			close(stop)
+
+			iw.cancelAfterGracePeriod(workCtx, stop, cancelWork)
+
+			assert.Equal(t, tt.wantCancel, workCtx.Err() != nil)
+			assert.True(t, iw.inFlight.Draining())
+		})
+	}
+}
+
+// TestAuditIngressDeadlineRestoresAnnotation checks that an ingress whose deadline expires while its
+// ACME challenge is still pending gets its HTTPS annotation back.
+func TestAuditIngressDeadlineRestoresAnnotation(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+
+	ing := generateIngress("test-ingress", "default", nil, []string{"/app", "/.well-known/acme-challenge"},
+		map[string]string{"nginx.ingress.kubernetes.io/backend-protocol": "HTTPS"})
+	if err := fakeClient.Create(ctx, ing); err != nil {
+		t.Fatalf("Failed to create ingress: %v", err)
+	}
+
+	iw, err := setupIngressWatcher(fakeClient)
+	if err != nil {
+		t.Fatalf("Failed to setup IngressWatcher: %v", err)
+	}
+	iw.Config.IngressTimeout = 1
+	iw.Config.AnnotationRemovalDelay = 5
+
+	rec, err := iw.auditIngressWithDeadline(ctx, ing)
+	assert.NoError(t, err)
+	assert.Equal(t, report.ActionNotRenewed, rec.Action)
+	assert.Equal(t, 0, iw.degraded.InUse())
+
+	updated := &networkingv1.Ingress{}
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "test-ingress", Namespace: "default"}, updated))
+	assert.Equal(t, "HTTPS", updated.Annotations["nginx.ingress.kubernetes.io/backend-protocol"])
 }
 
 func TestStartCertificateRenewalAudit(t *testing.T) {
@@ -298,7 +497,7 @@ func TestStartCertificateRenewalAudit(t *testing.T) {
 			gotRenewalCh := make(chan bool)
 			errorCh := make(chan error)
 			go func() {
-				renewal, err := iw.startCertificateRenewalAudit(ctx, ing)
+				renewal, err := iw.startCertificateRenewalAudit(ctx, ing, iw.resolvePolicy(ing))
 				if err != nil {
 					errorCh <- err
 					return
@@ -336,6 +535,87 @@ func TestStartCertificateRenewalAudit(t *testing.T) {
 	}
 }
 
+// TestStartCertificateRenewalAuditWaitError checks that a renewal whose wait failed reinstates the HTTPS annotation
+// before it frees its degraded slot, even once the deadline of the ingress passed.
+func TestStartCertificateRenewalAuditWaitError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	// The client honours the context like a real one. The wait fails when the deadline of the ingress passes.
+	gets := 0
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if gets++; gets == 2 {
+				cancel()
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return c.Update(ctx, obj, opts...)
+		},
+	}).Build()
+
+	ing := generateIngress("test-ingress", "default", nil, []string{"/.well-known/acme-challenge"},
+		map[string]string{backendProtocolAnnotation: "HTTPS"})
+	if err := fakeClient.Create(context.TODO(), ing); err != nil {
+		t.Fatalf("Failed to create ingress: %v", err)
+	}
+	iw, err := setupIngressWatcher(fakeClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renewed, err := iw.startCertificateRenewalAudit(ctx, ing, iw.resolvePolicy(ing))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, renewed)
+	assert.Empty(t, iw.inFlight.Pending())
+	assert.Equal(t, 0, iw.degraded.InUse())
+
+	updated := &networkingv1.Ingress{}
+	assert.NoError(t, fakeClient.Get(context.TODO(), client.ObjectKey{Name: "test-ingress", Namespace: "default"}, updated))
+	assert.Equal(t, "HTTPS", updated.Annotations[backendProtocolAnnotation])
+}
+
+// TestStartCertificateRenewalAuditHoldsDegradedSlot checks that a renewal that cannot reinstate the HTTPS annotation
+// keeps its degraded slot until restoreInFlight restores it.
+func TestStartCertificateRenewalAuditHoldsDegradedSlot(t *testing.T) {
+	ctx := context.TODO()
+	failRestore := true
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			if failRestore && obj.GetAnnotations()[backendProtocolAnnotation] != "" {
+				return errors.New("update refused")
+			}
+			return c.Update(ctx, obj, opts...)
+		},
+	}).Build()
+	ing := generateIngress("test-ingress", "default", nil, []string{"/app"}, map[string]string{backendProtocolAnnotation: "HTTPS"})
+	if err := fakeClient.Create(ctx, ing); err != nil {
+		t.Fatalf("Failed to create ingress: %v", err)
+	}
+	iw, err := setupIngressWatcher(fakeClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = iw.startCertificateRenewalAudit(ctx, ing, iw.resolvePolicy(ing))
+	assert.ErrorContains(t, err, "update refused")
+	assert.Equal(t, 1, iw.degraded.InUse(), "the ingress is still degraded")
+	assert.Contains(t, iw.inFlight.Pending(), "default/test-ingress")
+
+	// Restoring the annotation frees the slot.
+	failRestore = false
+	assert.NoError(t, iw.restoreInFlight())
+	assert.Equal(t, 0, iw.degraded.InUse())
+	assert.Empty(t, iw.inFlight.Pending())
+}
+
 func TestChangeIngressSecretName(t *testing.T) {
 	ctx := context.TODO()
 
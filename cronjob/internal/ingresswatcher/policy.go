@@ -0,0 +1,37 @@
+package ingresswatcher
+
+import (
+	"time"
+
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// reasonInvalidOverride is recorded on an Ingress with an invalid override annotation, its default stays in place.
+const reasonInvalidOverride = "InvalidOverride"
+
+// resolvePolicy returns the renewal policy of ing: the configured thresholds overridden by its annotations.
+// Invalid annotations are reported by an event on ing.
+func (iw *IngressWatcher) resolvePolicy(ing *networkingv1.Ingress) policy.Policy {
+	cfg := iw.config()
+	base := policy.Policy{
+		RenewBefore:           time.Duration(cfg.CertificateRenewalThreshold) * 24 * time.Hour,
+		RenewalSpread:         time.Duration(cfg.RenewalSpread) * 24 * time.Hour,
+		ChallengeClearTimeout: time.Duration(cfg.AnnotationRemovalDelay) * time.Second,
+	}
+
+	pol, err := policy.Resolve(base, ing.Annotations)
+	if err != nil {
+		logger.Warnf("Ignoring invalid overrides of ingress %s: %v", utils.IngressKey(ing), err)
+		iw.Recorder.Eventf(ing, corev1.EventTypeWarning, reasonInvalidOverride, "Kept the defaults of the invalid overrides: %v", err)
+	}
+
+	return pol
+}
+
+// renameFallback reports whether a challenge that was not resolved is retried with a new secret name.
+func renameFallback(pol policy.Policy) bool {
+	return pol.Strategy != policy.StrategyChallengeOnly && pol.Strategy != policy.StrategySecretDelete
+}
@@ -0,0 +1,116 @@
+package ingresswatcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uri-tech/nimble-opti-adapter/cronjob/internal/report"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakec "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAuditIngressPolicy(t *testing.T) {
+	ctx := context.TODO()
+
+	tests := []struct {
+		name         string
+		annotations  map[string]string
+		paths        []string
+		expiresIn    time.Duration
+		wantAction   report.Action
+		wantStrategy report.Strategy
+		wantSecrets  []string
+		wantEvent    string
+	}{
+		{
+			name:        "skip leaves the ingress alone",
+			annotations: map[string]string{policy.SkipAnnotation: "true"},
+			paths:       []string{"/.well-known/acme-challenge"},
+			expiresIn:   24 * time.Hour,
+			wantAction:  report.ActionSkipped,
+			wantSecrets: []string{"tls"},
+		},
+		{
+			name:        "challenge-only never touches the secret",
+			annotations: map[string]string{policy.StrategyAnnotation: "challenge-only"},
+			expiresIn:   24 * time.Hour,
+			wantAction:  report.ActionNone,
+			wantSecrets: []string{"tls"},
+		},
+		{
+			name:         "secret-rename keeps the old secret",
+			annotations:  map[string]string{policy.StrategyAnnotation: "secret-rename"},
+			expiresIn:    24 * time.Hour,
+			wantAction:   report.ActionRenewed,
+			wantStrategy: report.StrategySecretRename,
+			wantSecrets:  []string{"tls-v1"},
+		},
+		{
+			name:        "renewal threshold override",
+			annotations: map[string]string{policy.RenewalThresholdAnnotation: "5"},
+			expiresIn:   10 * 24 * time.Hour,
+			wantAction:  report.ActionNone,
+			wantSecrets: []string{"tls"},
+		},
+		{
+			name:        "invalid override is reported and ignored",
+			annotations: map[string]string{policy.SkipAnnotation: "yes please"},
+			expiresIn:   100 * 24 * time.Hour,
+			wantAction:  report.ActionNone,
+			wantSecrets: []string{"tls"},
+			wantEvent:   `Warning InvalidOverride Kept the defaults of the invalid overrides: annotation nimble.opti.adapter/skip: invalid boolean "yes please"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+			iw, err := setupIngressWatcher(fakeClient)
+			require.NoError(t, err)
+			iw.Config.AdminUserPermission = true
+			recorder := record.NewFakeRecorder(10)
+			iw.Recorder = recorder
+
+			certDER, err := generateTestCert(time.Now().Add(tt.expiresIn))
+			require.NoError(t, err)
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "default"},
+				Data:       map[string][]byte{"tls.crt": certDER},
+			}
+			require.NoError(t, fakeClient.Create(ctx, secret))
+
+			annotations := map[string]string{"nginx.ingress.kubernetes.io/backend-protocol": "HTTPS"}
+			for k, v := range tt.annotations {
+				annotations[k] = v
+			}
+			ing := generateIngress("ing", "default", nil, tt.paths, annotations)
+			ing.Spec.TLS = []networkingv1.IngressTLS{{SecretName: "tls"}}
+			require.NoError(t, fakeClient.Create(ctx, ing))
+
+			rec, err := iw.auditIngress(ctx, ing)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAction, rec.Action)
+			assert.Equal(t, tt.wantStrategy, rec.Strategy)
+			assert.Equal(t, tt.wantSecrets, rec.TLSSecrets)
+
+			// None of the strategies deletes the old secret.
+			assert.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "tls", Namespace: "default"}, &corev1.Secret{}))
+
+			if tt.wantEvent == "" {
+				assert.Empty(t, recorder.Events)
+				return
+			}
+			require.Len(t, recorder.Events, 1)
+			assert.Contains(t, <-recorder.Events, tt.wantEvent)
+		})
+	}
+}
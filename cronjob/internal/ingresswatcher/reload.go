@@ -0,0 +1,72 @@
+package ingresswatcher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/uri-tech/nimble-opti-adapter/cronjob/configenv"
+	"github.com/uri-tech/nimble-opti-adapter/loggerpkg"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Reasons of the events recorded on the reloaded ConfigMap.
+const (
+	// reasonConfigReloaded is recorded when a config change is applied.
+	reasonConfigReloaded = "ConfigReloaded"
+	// reasonConfigRejected is recorded when a config change is invalid, the last good config stays in place.
+	reasonConfigRejected = "ConfigRejected"
+)
+
+// config returns the current configuration of the audit.
+func (iw *IngressWatcher) config() *configenv.ConfigEnv {
+	iw.configMu.RLock()
+	defer iw.configMu.RUnlock()
+	return iw.Config
+}
+
+// ApplyConfig replaces the configuration of the running audit. The thresholds, delays and timeouts
+// apply to the next ingress processed, the degraded caps and RUN_MODE apply at once.
+func (iw *IngressWatcher) ApplyConfig(cfg *configenv.ConfigEnv) {
+	iw.configMu.Lock()
+	iw.Config = cfg
+	iw.configMu.Unlock()
+
+	iw.degraded.SetLimits(cfg.MaxDegradedIngresses, cfg.MaxDegradedIngressesPerNamespace)
+	loggerpkg.SetRunMode(cfg.RunMode)
+}
+
+// WatchConfig applies the changes of the ConfigMap namespace/name until ctx is done.
+// Every change is validated and reported by an event on the ConfigMap, an invalid one is rejected.
+func (iw *IngressWatcher) WatchConfig(ctx context.Context, clientKube kubernetes.Interface, namespace, name string) error {
+	logger.Infof("Watching the config ConfigMap %s/%s", namespace, name)
+	return utils.WatchConfigMap(ctx, clientKube, namespace, name, iw.reloadConfig)
+}
+
+// reloadConfig validates and applies the config of cm. An unchanged config is ignored.
+func (iw *IngressWatcher) reloadConfig(cm *corev1.ConfigMap) {
+	next, changed, err := parseConfigMap(iw.config(), cm)
+	if err != nil {
+		logger.Errorf("Rejected the config of ConfigMap %s/%s, keeping the last good one: %v", cm.Namespace, cm.Name, err)
+		iw.Recorder.Eventf(cm, corev1.EventTypeWarning, reasonConfigRejected, "Kept the last good config: %v", err)
+		return
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	iw.ApplyConfig(next)
+	logger.Infof("Reloaded the config of ConfigMap %s/%s, changed: %s", cm.Namespace, cm.Name, strings.Join(changed, ", "))
+	iw.Recorder.Eventf(cm, corev1.EventTypeNormal, reasonConfigReloaded, "Applied %s", strings.Join(changed, ", "))
+}
+
+// parseConfigMap reloads current with the config file held by cm.
+func parseConfigMap(current *configenv.ConfigEnv, cm *corev1.ConfigMap) (*configenv.ConfigEnv, []string, error) {
+	data, ok := cm.Data[configenv.ConfigMapKey]
+	if !ok {
+		return nil, nil, fmt.Errorf("key %q not found", configenv.ConfigMapKey)
+	}
+	return current.Reload([]byte(data))
+}
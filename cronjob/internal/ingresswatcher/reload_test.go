@@ -0,0 +1,82 @@
+package ingresswatcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uri-tech/nimble-opti-adapter/cronjob/configenv"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestReloadConfig(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          map[string]string
+		wantEvent     string
+		wantLimit     int
+		wantThreshold int
+	}{
+		{
+			name:          "valid change is applied",
+			data:          map[string]string{configenv.ConfigMapKey: "certificateRenewalThreshold: 30\nmaxDegradedIngresses: 1\n"},
+			wantEvent:     "Normal ConfigReloaded Applied certificateRenewalThreshold, maxDegradedIngresses",
+			wantLimit:     1,
+			wantThreshold: 30,
+		},
+		{
+			name:          "invalid change is rejected",
+			data:          map[string]string{configenv.ConfigMapKey: "maxDegradedIngresses: -1\n"},
+			wantEvent:     "Warning ConfigRejected Kept the last good config: maxDegradedIngresses (MAX_DEGRADED_INGRESSES) must not be negative",
+			wantLimit:     2,
+			wantThreshold: 60,
+		},
+		{
+			name:          "missing key is rejected",
+			data:          map[string]string{"other.yaml": "runMode: prod\n"},
+			wantEvent:     `Warning ConfigRejected Kept the last good config: key "config.yaml" not found`,
+			wantLimit:     2,
+			wantThreshold: 60,
+		},
+		{
+			name:          "unchanged config records nothing",
+			data:          map[string]string{configenv.ConfigMapKey: "runMode: dev\n"},
+			wantLimit:     2,
+			wantThreshold: 60,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ecfg, err := configenv.LoadConfig(nil)
+			require.NoError(t, err)
+			iw, err := newIngressWatcherForTesting(fake.NewSimpleClientset(), ecfg)
+			require.NoError(t, err)
+
+			// Hold the slots of the expected limit, so taking one more must fail.
+			for i := 0; i < tt.wantLimit; i++ {
+				require.True(t, iw.degraded.TryAcquire("default"))
+			}
+
+			recorder := record.NewFakeRecorder(10)
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "ingress-modify-ns"},
+				Data:       tt.data,
+			}
+			iw.Recorder = recorder
+			iw.reloadConfig(cm)
+
+			if tt.wantEvent == "" {
+				assert.Empty(t, recorder.Events)
+			} else {
+				require.Len(t, recorder.Events, 1)
+				assert.Contains(t, <-recorder.Events, tt.wantEvent)
+			}
+			assert.False(t, iw.degraded.TryAcquire("default"), "the limit must be %d", tt.wantLimit)
+			assert.Equal(t, tt.wantThreshold, iw.config().CertificateRenewalThreshold)
+		})
+	}
+}
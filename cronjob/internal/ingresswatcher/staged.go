@@ -0,0 +1,176 @@
+package ingresswatcher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reasonRenewalHeldBack is recorded on an Ingress whose renewal was held back by the failed canary of its policy,
+// as the operator does.
+const reasonRenewalHeldBack = "RenewalHeldBack"
+
+// stagedRollout tracks the canaries of the staged policies during an audit: the first Ingress renewed of a policy
+// with stagedRollout set, in the NimbleOpti of its namespace, is its canary. The renewals of the other Ingresses of
+// the policy wait for it, and are held back when it was not renewed. It is safe for concurrent use by the workers.
+type stagedRollout struct {
+	mu sync.Mutex // mu protects the fields below.
+	// policies maps a namespace to the policies of its NimbleOpti, read on the first renewal of the namespace.
+	policies map[string][]v2.IngressPolicy
+	// canaries maps a staged policy, as namespace/name, to its canary.
+	canaries map[string]*canary
+	// heldBack holds the staged policies with held back Ingresses, in the order they were held back.
+	heldBack []string
+	// held counts the Ingresses held back by each staged policy.
+	held map[string]int
+}
+
+// canary is the first Ingress renewed of a staged policy, done is closed once its renewal ended.
+type canary struct {
+	namespace string
+	ingress   string
+	renewed   bool
+	done      chan struct{}
+}
+
+// newStagedRollout returns the rollout of an audit.
+func newStagedRollout() *stagedRollout {
+	return &stagedRollout{
+		policies: map[string][]v2.IngressPolicy{},
+		canaries: map[string]*canary{},
+		held:     map[string]int{},
+	}
+}
+
+// holdBack reports whether the renewal of ing must not run, because the canary of its policy was not renewed.
+// The first Ingress of a staged policy becomes its canary, the others wait for its renewal to end.
+// A held back Ingress is reported by an event. Outside of an audit, iw.rollout is nil and nothing is held back.
+func (iw *IngressWatcher) holdBack(ctx context.Context, ing *networkingv1.Ingress) (bool, error) {
+	r := iw.rollout
+	if r == nil {
+		return false, nil
+	}
+
+	r.mu.Lock()
+	group, err := r.group(ctx, iw.ClientObj, ing)
+	if err != nil || group == "" {
+		r.mu.Unlock()
+		return false, err
+	}
+	c, ok := r.canaries[group]
+	if !ok {
+		r.canaries[group] = &canary{namespace: ing.Namespace, ingress: ing.Name, done: make(chan struct{})}
+	}
+	r.mu.Unlock()
+	if !ok || c.ingress == ing.Name {
+		return false, nil
+	}
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return false, fmt.Errorf("waiting for the canary %s of policy %s: %w", c.ingress, group, ctx.Err())
+	}
+	if c.renewed {
+		return false, nil
+	}
+
+	logger.Infof("Holding back the renewal of ingress %s, the canary %s of policy %s was not renewed", utils.IngressKey(ing), c.ingress, group)
+	iw.Recorder.Eventf(ing, corev1.EventTypeWarning, reasonRenewalHeldBack,
+		"Renewal held back, the canary %s of policy %s was not renewed", c.ingress, group)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.held[group] == 0 {
+		r.heldBack = append(r.heldBack, group)
+	}
+	r.held[group]++
+	return true, nil
+}
+
+// done records the outcome of the renewal of ing, which releases the Ingresses waiting for it when it is a canary.
+func (r *stagedRollout) done(ing *networkingv1.Ingress, renewed bool) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.canaries {
+		if c.namespace != ing.Namespace || c.ingress != ing.Name {
+			continue
+		}
+		select {
+		case <-c.done:
+			// Renewed again, by the secret-rename fallback, the first outcome stays.
+		default:
+			c.renewed = renewed
+			close(c.done)
+		}
+	}
+}
+
+// group returns the staged policy of ing as namespace/name, empty when its renewal is not staged.
+// r.mu must be held.
+func (r *stagedRollout) group(ctx context.Context, c client.Client, ing *networkingv1.Ingress) (string, error) {
+	policies, ok := r.policies[ing.Namespace]
+	if !ok {
+		nimbleOpti := &v2.NimbleOpti{}
+		err := c.Get(ctx, client.ObjectKey{Namespace: ing.Namespace, Name: ing.Namespace}, nimbleOpti)
+		switch {
+		case apierrors.IsNotFound(err) || apierrors.IsForbidden(err) || meta.IsNoMatchError(err) || runtime.IsNotRegisteredError(err):
+		case err != nil:
+			return "", fmt.Errorf("getting the nimbleopti of namespace %q: %w", ing.Namespace, err)
+		default:
+			policies = nimbleOpti.Spec.Policies
+		}
+		r.policies[ing.Namespace] = policies
+	}
+
+	// The first policy whose selector matches wins, as in the operator.
+	for _, p := range policies {
+		matches := p.Selector == nil
+		if !matches {
+			selector, err := metav1.LabelSelectorAsSelector(p.Selector)
+			if err != nil {
+				// The operator reports the invalid selector, the Ingress is not staged.
+				return "", nil
+			}
+			matches = selector.Matches(labels.Set(ing.Labels))
+		}
+		if !matches {
+			continue
+		}
+		if !p.StagedRollout {
+			return "", nil
+		}
+		return ing.Namespace + "/" + p.Name, nil
+	}
+	return "", nil
+}
+
+// errs returns an error for each staged policy whose Ingresses were held back.
+func (r *stagedRollout) errs() []error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	for _, group := range r.heldBack {
+		errs = append(errs, fmt.Errorf("policy %s: canary ingress %s was not renewed, held back %d ingresses",
+			group, r.canaries[group].ingress, r.held[group]))
+	}
+	return errs
+}
@@ -0,0 +1,82 @@
+package ingresswatcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/cronjob/internal/report"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	fakec "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAuditIngressResourcesStagedRollout(t *testing.T) {
+	ctx := context.TODO()
+
+	tests := []struct {
+		name        string
+		staged      bool
+		wantErr     string
+		wantActions []report.Action
+	}{
+		{
+			name:        "failed canary holds back its policy",
+			staged:      true,
+			wantErr:     "held back 1 ingresses",
+			wantActions: []report.Action{report.ActionNotRenewed, report.ActionDeferred},
+		},
+		{
+			name:        "unstaged policy renews every ingress",
+			wantActions: []report.Action{report.ActionNotRenewed, report.ActionNotRenewed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			require.NoError(t, clientgoscheme.AddToScheme(scheme))
+			require.NoError(t, v2.AddToScheme(scheme))
+
+			nimbleOpti := &v2.NimbleOpti{
+				ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+				Spec: v2.NimbleOptiSpec{Policies: []v2.IngressPolicy{{
+					Name:          "web",
+					Selector:      &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "web"}},
+					StagedRollout: tt.staged,
+				}}},
+			}
+			fakeClient := fakec.NewClientBuilder().WithScheme(scheme).WithObjects(nimbleOpti).Build()
+			// Their ACME challenge never clears, whichever is renewed first is the canary and fails.
+			labels := map[string]string{"tier": "web"}
+			annotations := map[string]string{backendProtocolAnnotation: "HTTPS"}
+			for _, name := range []string{"a", "b"} {
+				require.NoError(t, fakeClient.Create(ctx, generateIngress(name, "default", labels, []string{"/.well-known/acme-challenge"}, annotations)))
+			}
+
+			iw, err := setupIngressWatcher(fakeClient)
+			require.NoError(t, err)
+			iw.Config.AnnotationRemovalDelay = 1
+			recorder := record.NewFakeRecorder(10)
+			iw.Recorder = recorder
+
+			rep, err := iw.AuditIngressResources(ctx, nil)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Contains(t, <-recorder.Events, "Warning RenewalHeldBack Renewal held back, the canary")
+			} else {
+				assert.NoError(t, err)
+			}
+			var actions []report.Action
+			for _, rec := range rep.Records {
+				actions = append(actions, rec.Action)
+			}
+			assert.ElementsMatch(t, tt.wantActions, actions)
+		})
+	}
+}
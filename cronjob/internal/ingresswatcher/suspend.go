@@ -0,0 +1,87 @@
+package ingresswatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// errRenewalSuspended is returned for a renewal refused because its namespace got suspended or released.
+var errRenewalSuspended = errors.New("the namespace is suspended or released")
+
+// suspendedNamespaces returns the watched namespaces whose NimbleOpti sets spec.suspend.
+// Without the NimbleOpti CRD, or without the permission to list it, no namespace is suspended.
+func (iw *IngressWatcher) suspendedNamespaces(ctx context.Context) (map[string]bool, error) {
+	namespaces := utils.SplitCommaList(iw.config().WatchNamespaces)
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	suspended := map[string]bool{}
+	for _, ns := range namespaces {
+		list := &v2.NimbleOptiList{}
+		err := iw.ClientObj.List(ctx, list, client.InNamespace(ns))
+		switch {
+		case meta.IsNoMatchError(err) || runtime.IsNotRegisteredError(err):
+			logger.Debugf("NimbleOpti is not installed, no namespace is suspended: %v", err)
+			return suspended, nil
+		case apierrors.IsForbidden(err):
+			logger.Warnf("Cannot list NimbleOpti in namespace %q, its suspend field is ignored: %v", ns, err)
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("listing nimbleoptis in namespace %q: %w", ns, err)
+		}
+
+		for _, item := range list.Items {
+			// The operator only reads the NimbleOpti named after its namespace.
+			if item.Name == item.Namespace && item.Spec.Suspend {
+				suspended[item.Namespace] = true
+			}
+		}
+	}
+	return suspended, nil
+}
+
+// namespaceSuspended reports whether the NimbleOpti of namespace sets spec.suspend, read again so a namespace
+// suspended during the audit is left alone too. Without the NimbleOpti, its CRD, or the permission to read it,
+// the namespace is not suspended, unless the deletion of its NimbleOpti released it, see namespaceReleased.
+func (iw *IngressWatcher) namespaceSuspended(ctx context.Context, namespace string) (bool, error) {
+	if iw.suspended[namespace] {
+		return true, nil
+	}
+	nimbleOpti := &v2.NimbleOpti{}
+	err := iw.ClientObj.Get(ctx, client.ObjectKey{Namespace: namespace, Name: namespace}, nimbleOpti)
+	switch {
+	case apierrors.IsNotFound(err):
+		return iw.namespaceReleased(ctx, namespace)
+	case apierrors.IsForbidden(err) || meta.IsNoMatchError(err) || runtime.IsNotRegisteredError(err):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("getting the nimbleopti of namespace %q: %w", namespace, err)
+	}
+	return nimbleOpti.Spec.Suspend, nil
+}
+
+// namespaceReleased reports whether the operator marked namespace released when its NimbleOpti was deleted,
+// until a NimbleOpti is created there again. Without the permission to read the namespace, it is not released.
+func (iw *IngressWatcher) namespaceReleased(ctx context.Context, namespace string) (bool, error) {
+	ns := &corev1.Namespace{}
+	err := iw.ClientObj.Get(ctx, client.ObjectKey{Name: namespace}, ns)
+	switch {
+	case apierrors.IsNotFound(err) || apierrors.IsForbidden(err):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("getting namespace %q: %w", namespace, err)
+	}
+	return ns.Annotations[policy.ReleasedAnnotation] == "true", nil
+}
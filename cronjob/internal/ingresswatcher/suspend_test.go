@@ -0,0 +1,137 @@
+package ingresswatcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/cronjob/internal/report"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakec "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAuditIngressResourcesSuspended(t *testing.T) {
+	ctx := context.TODO()
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, v2.AddToScheme(scheme))
+
+	nimbleOpti := func(name, namespace string, suspend bool) *v2.NimbleOpti {
+		return &v2.NimbleOpti{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       v2.NimbleOptiSpec{Suspend: suspend},
+		}
+	}
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme).WithObjects(
+		nimbleOpti("team-a", "team-a", true),
+		nimbleOpti("team-b", "team-b", false),
+		// The operator ignores a NimbleOpti not named after its namespace.
+		nimbleOpti("other", "team-c", true),
+	).Build()
+	for _, ns := range []string{"team-a", "team-b", "team-c"} {
+		require.NoError(t, fakeClient.Create(ctx, generateIngress("ingress", ns, nil, []string{"/app", "/.well-known/acme-challenge"}, nil)))
+	}
+
+	iw, err := setupIngressWatcher(fakeClient)
+	require.NoError(t, err)
+	iw.Config.WatchNamespaces = "team-a"
+
+	rep, err := iw.AuditIngressResources(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, rep.Records, 1)
+	assert.Equal(t, "team-a", rep.Records[0].Namespace)
+	assert.Equal(t, report.ActionSkipped, rep.Records[0].Action)
+
+	suspended, err := iw.suspendedNamespaces(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"team-a": true}, suspended)
+
+	iw.Config.WatchNamespaces = ""
+	suspended, err = iw.suspendedNamespaces(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"team-a": true}, suspended)
+}
+
+func TestSuspendedDuringAudit(t *testing.T) {
+	ctx := context.TODO()
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, v2.AddToScheme(scheme))
+
+	nimbleOpti := &v2.NimbleOpti{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Namespace: "team-a"}}
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme).WithObjects(nimbleOpti).Build()
+	ing := generateIngress("ingress", "team-a", nil, []string{"/app", "/.well-known/acme-challenge"},
+		map[string]string{backendProtocolAnnotation: "HTTPS"})
+	require.NoError(t, fakeClient.Create(ctx, ing))
+	key := client.ObjectKeyFromObject(ing)
+	require.NoError(t, fakeClient.Get(ctx, key, ing))
+
+	iw, err := setupIngressWatcher(fakeClient)
+	require.NoError(t, err)
+	iw.suspended, err = iw.suspendedNamespaces(ctx)
+	require.NoError(t, err)
+
+	// Another renewal holds the only degraded slot while the namespace gets suspended.
+	require.NoError(t, iw.degraded.Acquire(ctx, "team-a"))
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := iw.startCertificateRenewalAudit(ctx, ing.DeepCopy(), iw.resolvePolicy(ing))
+		errCh <- err
+	}()
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(nimbleOpti), nimbleOpti))
+	nimbleOpti.Spec.Suspend = true
+	require.NoError(t, fakeClient.Update(ctx, nimbleOpti))
+	iw.degraded.Release("team-a")
+	assert.ErrorIs(t, <-errCh, errRenewalSuspended)
+
+	// The ingresses audited afterwards are skipped.
+	rec, err := iw.auditIngress(ctx, ing.DeepCopy())
+	require.NoError(t, err)
+	assert.Equal(t, report.ActionSkipped, rec.Action)
+
+	got := &networkingv1.Ingress{}
+	require.NoError(t, fakeClient.Get(ctx, key, got))
+	assert.Equal(t, ing.ResourceVersion, got.ResourceVersion, "the annotation was never removed")
+	assert.Empty(t, iw.inFlight.Pending())
+}
+
+func TestAuditIngressResourcesReleased(t *testing.T) {
+	ctx := context.TODO()
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, v2.AddToScheme(scheme))
+
+	namespace := func(name string, annotations map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations}}
+	}
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme).WithObjects(
+		namespace("team-a", map[string]string{policy.ReleasedAnnotation: "true"}),
+		namespace("team-b", nil),
+		// A NimbleOpti created again manages the namespace before the operator removes the annotation.
+		namespace("team-c", map[string]string{policy.ReleasedAnnotation: "true"}),
+		&v2.NimbleOpti{ObjectMeta: metav1.ObjectMeta{Name: "team-c", Namespace: "team-c"}},
+	).Build()
+
+	iw, err := setupIngressWatcher(fakeClient)
+	require.NoError(t, err)
+	for ns, want := range map[string]bool{"team-a": true, "team-b": false, "team-c": false, "missing": false} {
+		got, err := iw.namespaceSuspended(ctx, ns)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, ns)
+	}
+
+	require.NoError(t, fakeClient.Create(ctx, generateIngress("ingress", "team-a", nil, []string{"/app", "/.well-known/acme-challenge"}, nil)))
+	iw.Config.WatchNamespaces = "team-a"
+	rep, err := iw.AuditIngressResources(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, rep.Records, 1)
+	assert.Equal(t, report.ActionSkipped, rep.Records[0].Action)
+}
@@ -0,0 +1,100 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Format is an output format of the report.
+type Format string
+
+const (
+	// FormatJSON renders the report as indented JSON.
+	FormatJSON Format = "json"
+	// FormatMarkdown renders the report as a Markdown table.
+	FormatMarkdown Format = "markdown"
+)
+
+// Extension returns the file extension used for the format.
+func (f Format) Extension() string {
+	if f == FormatMarkdown {
+		return ".md"
+	}
+	return ".json"
+}
+
+// ParseFormats parses a comma separated list of formats, for example "json,markdown".
+func ParseFormats(s string) ([]Format, error) {
+	var formats []Format
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		switch Format(part) {
+		case FormatJSON, FormatMarkdown:
+			formats = append(formats, Format(part))
+		case "":
+			// ignore empty entries such as a trailing comma
+		default:
+			return nil, fmt.Errorf("unknown report format %q, must be %q or %q", part, FormatJSON, FormatMarkdown)
+		}
+	}
+	return formats, nil
+}
+
+// Write renders the report in the given format.
+func (r *Report) Write(w io.Writer, f Format) error {
+	switch f {
+	case FormatJSON:
+		return r.WriteJSON(w)
+	case FormatMarkdown:
+		return r.WriteMarkdown(w)
+	default:
+		return fmt.Errorf("unknown report format %q", f)
+	}
+}
+
+// WriteJSON renders the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteMarkdown renders the report as a Markdown document with a summary and one table row per ingress.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# Ingress audit report\n\n")
+	fmt.Fprintf(&b, "- Started: %s\n", r.StartTime.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Finished: %s\n", r.EndTime.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Total: %d, renewed: %d, not renewed: %d, failed: %d, unchanged: %d\n\n",
+		r.Summary.Total, r.Summary.Renewed, r.Summary.NotRenewed, r.Summary.Failed, r.Summary.Unchanged)
+
+	b.WriteString("| Namespace | Ingress | TLS secrets | Expiry | Action | Strategy | Duration | Error |\n")
+	b.WriteString("|---|---|---|---|---|---|---|---|\n")
+	for _, rec := range r.Records {
+		expiry := ""
+		if rec.Expiry != nil {
+			expiry = rec.Expiry.Format(time.RFC3339)
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s | %.1fs | %s |\n",
+			rec.Namespace, rec.Name, strings.Join(rec.TLSSecrets, ", "), expiry,
+			rec.Action, rec.Strategy, rec.DurationSeconds, markdownEscape(rec.Error))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownEscape keeps free-form text from breaking the table layout.
+func markdownEscape(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", " ")
+}
@@ -0,0 +1,102 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	errorsK8S "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Options selects where and in which formats a report is published.
+type Options struct {
+	// Formats are the formats to render, for example json and markdown.
+	Formats []Format
+	// Stdout writes the report to Stdout when true.
+	Stdout bool
+	// FilePath is the base path of the report files. The format extension is appended to it.
+	FilePath string
+	// ConfigMap is the ConfigMap the report is stored in. It is skipped when the name is empty.
+	ConfigMap types.NamespacedName
+}
+
+// ParseConfigMapRef parses a "namespace/name" reference to a ConfigMap.
+func ParseConfigMapRef(s string) (types.NamespacedName, error) {
+	if s == "" {
+		return types.NamespacedName{}, nil
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, fmt.Errorf("invalid ConfigMap reference %q, must be namespace/name", s)
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
+
+// Publish renders the report in every requested format and writes it to every requested target.
+// Stdout is the writer used for the stdout target.
+func Publish(ctx context.Context, cl client.Client, stdout io.Writer, r *Report, opts Options) error {
+	data := map[Format][]byte{}
+	for _, f := range opts.Formats {
+		var buf bytes.Buffer
+		if err := r.Write(&buf, f); err != nil {
+			return fmt.Errorf("rendering %s report: %w", f, err)
+		}
+		data[f] = buf.Bytes()
+	}
+
+	for _, f := range opts.Formats {
+		if opts.Stdout {
+			if _, err := stdout.Write(data[f]); err != nil {
+				return fmt.Errorf("writing %s report to stdout: %w", f, err)
+			}
+		}
+		if opts.FilePath != "" {
+			path := opts.FilePath + f.Extension()
+			if err := os.WriteFile(path, data[f], 0o644); err != nil {
+				return fmt.Errorf("writing %s report to %s: %w", f, path, err)
+			}
+		}
+	}
+
+	if opts.ConfigMap.Name != "" {
+		if err := writeConfigMap(ctx, cl, opts.ConfigMap, data); err != nil {
+			return fmt.Errorf("writing report to ConfigMap %s: %w", opts.ConfigMap, err)
+		}
+	}
+
+	return nil
+}
+
+// writeConfigMap creates or replaces the report ConfigMap with one key per format.
+func writeConfigMap(ctx context.Context, cl client.Client, key types.NamespacedName, data map[Format][]byte) error {
+	cmData := map[string]string{}
+	for f, b := range data {
+		cmData["report"+f.Extension()] = string(b)
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := cl.Get(ctx, key, cm); err != nil {
+		if !errorsK8S.IsNotFound(err) {
+			return err
+		}
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": "nimble-opti-adapter-cronjob"},
+			},
+			Data: cmData,
+		}
+		return cl.Create(ctx, cm)
+	}
+
+	cm.Data = cmData
+	return cl.Update(ctx, cm)
+}
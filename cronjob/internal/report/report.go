@@ -0,0 +1,115 @@
+// Package report collects the per-ingress outcome of a cronjob audit run and
+// renders it in machine-readable (JSON) and human-readable (Markdown) form.
+package report
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Action describes what the audit did with an ingress.
+type Action string
+
+const (
+	// ActionNone means the ingress did not need any work.
+	ActionNone Action = "none"
+	// ActionRenewed means a renewal was attempted and the ACME challenge was resolved.
+	ActionRenewed Action = "renewed"
+	// ActionNotRenewed means a renewal was attempted but the ACME challenge was not resolved in time.
+	ActionNotRenewed Action = "not-renewed"
+	// ActionFailed means processing the ingress returned an error.
+	ActionFailed Action = "failed"
+	// ActionSkipped means the ingress was left alone by its "nimble.opti.adapter/skip" annotation,
+	// or because the NimbleOpti of its namespace is suspended.
+	ActionSkipped Action = "skipped"
+	// ActionDeferred means a renewal was due but the ACME budget of its issuer and registered domain is spent,
+	// or the canary of its staged policy was not renewed.
+	ActionDeferred Action = "deferred"
+)
+
+// Strategy describes how the audit tried to get a new certificate.
+type Strategy string
+
+const (
+	// StrategyNone is used when no renewal was attempted.
+	StrategyNone Strategy = ""
+	// StrategyChallenge resolves an ACME challenge that cert-manager already started.
+	StrategyChallenge Strategy = "acme-challenge"
+	// StrategySecretRename points the ingress at a new secret name so cert-manager issues a new certificate.
+	StrategySecretRename Strategy = "secret-rename"
+	// StrategySecretDelete deletes the TLS secret so cert-manager issues a new certificate.
+	StrategySecretDelete Strategy = "secret-delete"
+)
+
+// Record is the audit outcome of a single ingress.
+type Record struct {
+	Namespace       string     `json:"namespace"`
+	Name            string     `json:"name"`
+	TLSSecrets      []string   `json:"tlsSecrets,omitempty"`
+	Expiry          *time.Time `json:"expiry,omitempty"`
+	Action          Action     `json:"action"`
+	Strategy        Strategy   `json:"strategy,omitempty"`
+	DurationSeconds float64    `json:"durationSeconds"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// Summary holds the aggregated counters of a report.
+type Summary struct {
+	Total      int `json:"total"`
+	Renewed    int `json:"renewed"`
+	NotRenewed int `json:"notRenewed"`
+	Failed     int `json:"failed"`
+	Unchanged  int `json:"unchanged"`
+}
+
+// Report is the result of one audit run. It is safe for concurrent use.
+type Report struct {
+	mu sync.Mutex
+
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Summary   Summary   `json:"summary"`
+	Records   []Record  `json:"records"`
+}
+
+// New returns an empty report started at the current time.
+func New() *Report {
+	return &Report{
+		StartTime: time.Now().UTC(),
+		Records:   []Record{},
+	}
+}
+
+// Add appends a record to the report and updates the summary counters.
+func (r *Report) Add(rec Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Records = append(r.Records, rec)
+	r.Summary.Total++
+	switch rec.Action {
+	case ActionRenewed:
+		r.Summary.Renewed++
+	case ActionNotRenewed:
+		r.Summary.NotRenewed++
+	case ActionFailed:
+		r.Summary.Failed++
+	default:
+		r.Summary.Unchanged++
+	}
+}
+
+// Finish stamps the end time and sorts the records by namespace and name so the output is stable.
+func (r *Report) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.EndTime = time.Now().UTC()
+	sort.SliceStable(r.Records, func(i, j int) bool {
+		if r.Records[i].Namespace != r.Records[j].Namespace {
+			return r.Records[i].Namespace < r.Records[j].Namespace
+		}
+		return r.Records[i].Name < r.Records[j].Name
+	})
+}
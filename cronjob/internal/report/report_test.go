@@ -0,0 +1,149 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	fakec "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newTestReport returns a finished report with one record of each action.
+func newTestReport() *Report {
+	expiry := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	r := New()
+	r.Add(Record{Namespace: "b", Name: "failed", Action: ActionFailed, Strategy: StrategySecretDelete, Error: "boom | bang"})
+	r.Add(Record{Namespace: "a", Name: "renewed", TLSSecrets: []string{"tls-a"}, Expiry: &expiry, Action: ActionRenewed, Strategy: StrategyChallenge, DurationSeconds: 2.5})
+	r.Add(Record{Namespace: "a", Name: "unchanged", Action: ActionNone})
+	r.Add(Record{Namespace: "a", Name: "not-renewed", Action: ActionNotRenewed, Strategy: StrategySecretRename})
+	r.Finish()
+	return r
+}
+
+func TestReportAdd(t *testing.T) {
+	r := newTestReport()
+
+	assert.Equal(t, Summary{Total: 4, Renewed: 1, NotRenewed: 1, Failed: 1, Unchanged: 1}, r.Summary)
+	assert.False(t, r.EndTime.IsZero())
+
+	// Records are sorted by namespace and name.
+	var names []string
+	for _, rec := range r.Records {
+		names = append(names, rec.Namespace+"/"+rec.Name)
+	}
+	assert.Equal(t, []string{"a/not-renewed", "a/renewed", "a/unchanged", "b/failed"}, names)
+}
+
+func TestParseFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []Format
+		wantErr bool
+	}{
+		{"json only", "json", []Format{FormatJSON}, false},
+		{"both with spaces", "json, markdown,", []Format{FormatJSON, FormatMarkdown}, false},
+		{"empty", "", nil, false},
+		{"unknown", "yaml", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFormats(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFormats() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseConfigMapRef(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    types.NamespacedName
+		wantErr bool
+	}{
+		{"empty disables the target", "", types.NamespacedName{}, false},
+		{"valid", "ns/report", types.NamespacedName{Namespace: "ns", Name: "report"}, false},
+		{"missing namespace", "report", types.NamespacedName{}, true},
+		{"too many parts", "a/b/c", types.NamespacedName{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseConfigMapRef(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseConfigMapRef() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, newTestReport().WriteJSON(&buf))
+
+	decoded := struct {
+		Summary Summary  `json:"summary"`
+		Records []Record `json:"records"`
+	}{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, 4, decoded.Summary.Total)
+	assert.Equal(t, StrategyChallenge, decoded.Records[1].Strategy)
+	assert.Equal(t, "2030-01-02T03:04:05Z", decoded.Records[1].Expiry.Format(time.RFC3339))
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, newTestReport().WriteMarkdown(&buf))
+
+	out := buf.String()
+	assert.Contains(t, out, "Total: 4, renewed: 1, not renewed: 1, failed: 1, unchanged: 1")
+	assert.Contains(t, out, "| a | renewed | tls-a | 2030-01-02T03:04:05Z | renewed | acme-challenge | 2.5s |  |")
+	// The pipe in the error message must not break the table.
+	assert.Contains(t, out, "boom \\| bang")
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	base := filepath.Join(t.TempDir(), "audit")
+	cmKey := types.NamespacedName{Namespace: "ingress-modify-ns", Name: "audit-report"}
+
+	opts := Options{
+		Formats:   []Format{FormatJSON, FormatMarkdown},
+		Stdout:    true,
+		FilePath:  base,
+		ConfigMap: cmKey,
+	}
+
+	// Publish twice to cover both the create and the update of the ConfigMap.
+	for i := 0; i < 2; i++ {
+		var stdout bytes.Buffer
+		assert.NoError(t, Publish(ctx, fakeClient, &stdout, newTestReport(), opts))
+		assert.True(t, strings.Contains(stdout.String(), `"summary"`))
+		assert.True(t, strings.Contains(stdout.String(), "# Ingress audit report"))
+	}
+
+	for _, ext := range []string{".json", ".md"} {
+		_, err := os.Stat(base + ext)
+		assert.NoError(t, err)
+	}
+
+	cm := &corev1.ConfigMap{}
+	assert.NoError(t, fakeClient.Get(ctx, cmKey, cm))
+	assert.Contains(t, cm.Data, "report.json")
+	assert.Contains(t, cm.Data, "report.md")
+}
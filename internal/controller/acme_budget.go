@@ -0,0 +1,106 @@
+// internal/controller/acme_budget.go
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/uri-tech/nimble-opti-adapter/budget"
+	metrics "github.com/uri-tech/nimble-opti-adapter/metrics"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/klog/v2"
+)
+
+// reasonAcmeBudgetExceeded is recorded when a renewal would exceed the ACME budget of its issuer and registered domain.
+const reasonAcmeBudgetExceeded = "AcmeBudgetExceeded"
+
+// acmeBudget returns the ledger and the limits of the ACME budget, ok is false when it is disabled.
+func (iw *IngressWatcher) acmeBudget() (store *budget.Store, limits budget.Limits, ok bool) {
+	cfg := iw.config().AcmeBudget
+	ref, err := cfg.ConfigMapRef()
+	if err != nil || ref.Name == "" {
+		return nil, budget.Limits{}, false
+	}
+	limits = budget.Limits{
+		CertificatesPerWeek:      cfg.CertificatesPerWeek,
+		FailedValidationsPerHour: cfg.FailedValidationsPerHour,
+	}
+	return &budget.Store{Client: iw.ClientObj, ConfigMap: ref}, limits, true
+}
+
+// acmeBudgetExceeded reports whether a new certificate for ing would exceed the ACME budget, and returns
+// the spent budget. A ledger that cannot be read does not block the renewal.
+func (iw *IngressWatcher) acmeBudgetExceeded(ctx context.Context, ing *networkingv1.Ingress) (budget.Remaining, bool) {
+	store, limits, ok := iw.acmeBudget()
+	if !ok {
+		return budget.Remaining{}, false
+	}
+	accounts := budget.Accounts(ing)
+	if len(accounts) == 0 {
+		return budget.Remaining{}, false
+	}
+	ledger, err := store.Load(ctx)
+	if err != nil {
+		klog.Errorf("Checking the ACME budget of ingress %s: %v", utils.IngressKey(ing), err)
+		return budget.Remaining{}, false
+	}
+	now := iw.now()
+	metrics.SetAcmeBudgetRemaining(ledger.Remaining(now, limits))
+	return ledger.Exceeded(accounts, now, limits)
+}
+
+// deferForAcmeBudget reports whether the renewal of ing must wait for the ACME budget of its issuer and
+// registered domain. A deferred Ingress is audited again when the budget allows one more request, see scheduleAudit.
+func (iw *IngressWatcher) deferForAcmeBudget(ctx context.Context, ing *networkingv1.Ingress) bool {
+	spent, exceeded := iw.acmeBudgetExceeded(ctx, ing)
+	if !exceeded {
+		return false
+	}
+
+	key := utils.IngressKey(ing)
+	until := spent.Until.Format(time.RFC3339)
+	klog.Warningf("Deferring the renewal of ingress %s to %s, the ACME budget of %s is spent", key, until, spent.Account)
+	iw.Recorder.Eventf(ing, corev1.EventTypeWarning, reasonAcmeBudgetExceeded,
+		"Renewal deferred to %s, the ACME budget of domain %s is spent", until, spent.Domain)
+	iw.scheduleAudit(key, spent.Until.Sub(iw.now()))
+	return true
+}
+
+// refuseForAcmeBudget returns an error when a new certificate for ing would exceed the ACME budget.
+func (iw *IngressWatcher) refuseForAcmeBudget(ctx context.Context, ing *networkingv1.Ingress) error {
+	spent, exceeded := iw.acmeBudgetExceeded(ctx, ing)
+	if !exceeded {
+		return nil
+	}
+	iw.Recorder.Eventf(ing, corev1.EventTypeWarning, reasonAcmeBudgetExceeded,
+		"Renewal refused until %s, the ACME budget of domain %s is spent", spent.Until.Format(time.RFC3339), spent.Domain)
+	return fmt.Errorf("ACME budget of domain %s is spent until %s", spent.Domain, spent.Until.Format(time.RFC3339))
+}
+
+// recordAcmeBudget adds the outcome of a renewal of ing to the ACME budget: a certificate when it renewed,
+// a failed validation when the challenge did not clear. Errors before the challenge are not counted.
+// The ledger is best effort, errors are only logged.
+func (iw *IngressWatcher) recordAcmeBudget(ctx context.Context, ing *networkingv1.Ingress, renewed bool, err error) {
+	store, limits, ok := iw.acmeBudget()
+	if !ok || err != nil {
+		return
+	}
+	accounts := budget.Accounts(ing)
+	if len(accounts) == 0 {
+		return
+	}
+
+	now := iw.now()
+	ledger, updateErr := store.Update(ctx, now, func(l *budget.Ledger) {
+		l.Record(accounts, now, !renewed)
+	})
+	if updateErr != nil {
+		klog.Errorf("Failed to record the renewal of ingress %s in the ACME budget: %v", utils.IngressKey(ing), updateErr)
+		return
+	}
+	metrics.SetAcmeBudgetRemaining(ledger.Remaining(now, limits))
+}
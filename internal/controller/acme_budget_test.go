@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uri-tech/nimble-opti-adapter/budget"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// budgetIngress returns an Ingress of the cluster issuer letsencrypt for a host of example.com.
+func budgetIngress() *networkingv1.Ingress {
+	ing := generateIngress("ing", "default", nil, []string{"/app"},
+		map[string]string{budget.ClusterIssuerAnnotation: "letsencrypt"})
+	ing.Spec.TLS = []networkingv1.IngressTLS{{Hosts: []string{"app.example.com"}, SecretName: "tls"}}
+	return ing
+}
+
+func TestDeferForAcmeBudget(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().Truncate(time.Second)
+	account := budget.Account{Issuer: "ClusterIssuer/letsencrypt", Domain: "example.com"}
+
+	tests := []struct {
+		name      string
+		configMap string
+		issued    []time.Time
+		wantDefer bool
+		wantDue   time.Duration
+	}{
+		{name: "budget left", configMap: "system/acme-budget", issued: []time.Time{now.Add(-time.Hour)}},
+		{name: "budget spent", configMap: "system/acme-budget",
+			issued:    []time.Time{now.Add(-6 * 24 * time.Hour), now.Add(-time.Hour)},
+			wantDefer: true, wantDue: 24 * time.Hour},
+		{name: "budget disabled", issued: []time.Time{now.Add(-6 * 24 * time.Hour), now.Add(-time.Hour)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iw, fakeClient, recorder := setupRenewRequestWatcher(t)
+			iw.now = func() time.Time { return now }
+			cfg := *iw.config()
+			cfg.AcmeBudget.ConfigMap = tt.configMap
+			cfg.AcmeBudget.CertificatesPerWeek = 2
+			iw.Config = &cfg
+
+			store := &budget.Store{Client: fakeClient, ConfigMap: types.NamespacedName{Namespace: "system", Name: "acme-budget"}}
+			_, err := store.Update(ctx, now, func(l *budget.Ledger) {
+				for _, issued := range tt.issued {
+					l.Record([]budget.Account{account}, issued, false)
+				}
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantDefer, iw.deferForAcmeBudget(ctx, budgetIngress()))
+			if !tt.wantDefer {
+				assert.NotContains(t, iw.scheduled, "default/ing")
+				assert.Empty(t, recorder.Events)
+				return
+			}
+			assert.Contains(t, <-recorder.Events, reasonAcmeBudgetExceeded)
+			assert.Equal(t, now.Add(tt.wantDue), iw.scheduled["default/ing"])
+			assert.Error(t, iw.refuseForAcmeBudget(ctx, budgetIngress()))
+		})
+	}
+}
+
+func TestRecordAcmeBudget(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().Truncate(time.Second)
+	account := budget.Account{Issuer: "ClusterIssuer/letsencrypt", Domain: "example.com"}
+
+	tests := []struct {
+		name             string
+		renewed          bool
+		err              error
+		wantCertificates int
+		wantFailures     int
+	}{
+		{name: "renewed", renewed: true, wantCertificates: 1},
+		{name: "challenge not cleared", wantFailures: 1},
+		{name: "error", err: errors.New("boom")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iw, fakeClient, _ := setupRenewRequestWatcher(t)
+			iw.now = func() time.Time { return now }
+			cfg := *iw.config()
+			cfg.AcmeBudget.ConfigMap = "system/acme-budget"
+			iw.Config = &cfg
+
+			iw.recordAcmeBudget(ctx, budgetIngress(), tt.renewed, tt.err)
+
+			store := &budget.Store{Client: fakeClient, ConfigMap: types.NamespacedName{Namespace: "system", Name: "acme-budget"}}
+			ledger, err := store.Load(ctx)
+			require.NoError(t, err)
+			usage := ledger.Usage[account.String()]
+			if tt.wantCertificates == 0 && tt.wantFailures == 0 {
+				assert.Nil(t, usage)
+				return
+			}
+			require.NotNil(t, usage)
+			assert.Len(t, usage.Certificates, tt.wantCertificates)
+			assert.Len(t, usage.Failures, tt.wantFailures)
+		})
+	}
+}
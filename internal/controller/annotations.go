@@ -7,10 +7,16 @@ import (
 
 	"github.com/uri-tech/nimble-opti-adapter/utils"
 	networkingv1 "k8s.io/api/networking/v1"
+	errorsK8S "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// backendProtocolAnnotation is the annotation a renewal temporarily removes from an Ingress.
+const backendProtocolAnnotation = "nginx.ingress.kubernetes.io/backend-protocol"
+
 // removeHTTPSAnnotation removes the "nginx.ingress.kubernetes.io/backend-protocol: HTTPS" annotation from an Ingress.
 func (iw *IngressWatcher) removeHTTPSAnnotation(ctx context.Context, ing *networkingv1.Ingress) error {
 	klog.Infof("starting removeHTTPSAnnotation, ing: %v", ing.Name)
@@ -23,7 +29,11 @@ func (iw *IngressWatcher) removeHTTPSAnnotation(ctx context.Context, ing *networ
 			klog.Errorf("Failed to get ingress: %v", err)
 			return err
 		}
-		delete(ing.Annotations, "nginx.ingress.kubernetes.io/backend-protocol")
+		// Keep the removed value on the Ingress, so it can be restored when the NimbleOpti is deleted.
+		if val, ok := ing.Annotations[backendProtocolAnnotation]; ok {
+			ing.Annotations[originalBackendProtocolAnnotation] = val
+		}
+		delete(ing.Annotations, backendProtocolAnnotation)
 
 		defer iw.auditMutex.Unlock(key)
 		klog.Info("removeHTTPSAnnotation - key is locked")
@@ -58,7 +68,8 @@ func (iw *IngressWatcher) addHTTPSAnnotation(ctx context.Context, ing *networkin
 		if ing.Annotations == nil {
 			ing.Annotations = make(map[string]string)
 		}
-		ing.Annotations["nginx.ingress.kubernetes.io/backend-protocol"] = "HTTPS"
+		ing.Annotations[backendProtocolAnnotation] = "HTTPS"
+		delete(ing.Annotations, originalBackendProtocolAnnotation)
 
 		defer iw.auditMutex.Unlock(key)
 		klog.Info("addHTTPSAnnotation - key is locked")
@@ -77,3 +88,32 @@ func (iw *IngressWatcher) addHTTPSAnnotation(ctx context.Context, ing *networkin
 
 	return nil
 }
+
+// restoreAnnotations sets back the pre-renewal annotations of the Ingress of key, after its renewal was interrupted.
+func (iw *IngressWatcher) restoreAnnotations(ctx context.Context, key string, annotations map[string]string) error {
+	klog.Infof("starting restoreAnnotations, ing: %v", key)
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		ing := &networkingv1.Ingress{}
+		if err := iw.ClientObj.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, ing); err != nil {
+			if errorsK8S.IsNotFound(err) {
+				// Nothing left to restore.
+				return nil
+			}
+			return err
+		}
+		if ing.Annotations == nil {
+			ing.Annotations = make(map[string]string)
+		}
+		for k, v := range annotations {
+			ing.Annotations[k] = v
+		}
+		delete(ing.Annotations, originalBackendProtocolAnnotation)
+		return iw.ClientObj.Update(ctx, ing)
+	})
+}
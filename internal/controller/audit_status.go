@@ -0,0 +1,145 @@
+// internal/controller/audit_status.go
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	networkingv1 "k8s.io/api/networking/v1"
+	errorsK8S "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// conditionReady is the condition type of a NimbleOpti whose last audit succeeded for every managed Ingress.
+const conditionReady = "Ready"
+
+// namespaceAudit counts the outcome of an audit for the Ingresses of a namespace.
+type namespaceAudit struct {
+	managed  int32
+	degraded int32
+	failing  int32
+	// soonestExpiry is when the first certificate of the managed Ingresses expires, nil when none was read.
+	soonestExpiry *time.Time
+	// ingresses are the managed Ingresses.
+	ingresses []*networkingv1.Ingress
+}
+
+// addIngress counts ing once its audit returned auditErr. It is managed when it matches the selector and has
+// the HTTPS annotation, or lost it to a renewal, in which case it is degraded. Its certificates are read from
+// the Secret informers, see cachedSecretCertificate.
+func (iw *IngressWatcher) addIngress(ctx context.Context, a *namespaceAudit, ing *networkingv1.Ingress, auditErr error) {
+	_, degraded := ing.Annotations[originalBackendProtocolAnnotation]
+	if !iw.isAdapterEnabledLabel(ctx, ing) || !(isBackendHttpsAnnotations(ctx, ing) || degraded) {
+		return
+	}
+
+	a.managed++
+	a.ingresses = append(a.ingresses, ing)
+	if degraded {
+		a.degraded++
+	}
+	if auditErr != nil {
+		a.failing++
+	}
+	for _, tlsSpec := range ing.Spec.TLS {
+		cert, err := iw.cachedSecretCertificate(ing.Namespace, tlsSpec.SecretName)
+		if err != nil {
+			continue
+		}
+		if a.soonestExpiry == nil || cert.NotAfter.Before(*a.soonestExpiry) {
+			notAfter := cert.NotAfter
+			a.soonestExpiry = &notAfter
+		}
+	}
+}
+
+// updateAuditStatus records the audit of each namespace in the status of its NimbleOpti.
+// A watched namespace without any managed Ingress is recorded with zero counts.
+func (iw *IngressWatcher) updateAuditStatus(ctx context.Context, audits map[string]*namespaceAudit, auditTime time.Time) error {
+	var errs []error
+	for _, ns := range iw.watchedNamespaces() {
+		list := &v2.NimbleOptiList{}
+		if err := iw.ClientObj.List(ctx, list, client.InNamespace(ns)); err != nil {
+			errs = append(errs, fmt.Errorf("listing nimbleoptis in namespace %q: %w", ns, err))
+			continue
+		}
+		for i := range list.Items {
+			adapter := &list.Items[i]
+			// The renewals only read the NimbleOpti named after its namespace, see getOrCreateNimbleOpti.
+			if adapter.Name != adapter.Namespace {
+				continue
+			}
+			a := audits[adapter.Namespace]
+			if a == nil {
+				a = &namespaceAudit{}
+			}
+			key := types.NamespacedName{Namespace: adapter.Namespace, Name: adapter.Name}
+			manager, err := iw.managingNimbleOpti(ctx, adapter.Namespace)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("nimbleopti %s: %w", key, err))
+				continue
+			}
+			matches := ingressPolicyMatches(ingressPoliciesOf(adapter, manager), a.ingresses)
+			err = iw.updateNimbleOptiStatus(ctx, key, func(s *v2.NimbleOptiStatus) {
+				setAuditStatus(s, a, auditTime, adapter.Generation)
+				s.IngressPolicies = matches
+			})
+			// The NimbleOpti may be deleted since it was listed.
+			if err != nil && !errorsK8S.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("nimbleopti %s: %w", key, err))
+			}
+		}
+	}
+
+	// NewAggregate returns nil when there are no errors.
+	return utilerrors.NewAggregate(errs)
+}
+
+// ingressPolicyMatches returns the policy of adapter each of ingresses matches, sorted by Ingress.
+// The Ingresses no policy matches are left out, like those of a policy with an invalid selector.
+func ingressPolicyMatches(adapter *v2.NimbleOpti, ingresses []*networkingv1.Ingress) []v2.IngressPolicyMatch {
+	var matches []v2.IngressPolicyMatch
+	for _, ing := range ingresses {
+		p, err := matchIngressPolicy(adapter, ing)
+		if err != nil || p == nil {
+			continue
+		}
+		matches = append(matches, v2.IngressPolicyMatch{Ingress: ing.Name, Policy: p.Name})
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Ingress < matches[j].Ingress })
+	return matches
+}
+
+// setAuditStatus sets the audit counts of a and the Ready condition in s.
+func setAuditStatus(s *v2.NimbleOptiStatus, a *namespaceAudit, auditTime time.Time, generation int64) {
+	s.ManagedIngresses = a.managed
+	s.DegradedIngresses = a.degraded
+	s.FailingIngresses = a.failing
+	s.SoonestExpiry = nil
+	if a.soonestExpiry != nil {
+		s.SoonestExpiry = &metav1.Time{Time: *a.soonestExpiry}
+	}
+	s.LastAuditTime = &metav1.Time{Time: auditTime}
+
+	condition := metav1.Condition{
+		Type:               conditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "AuditSucceeded",
+		Message:            fmt.Sprintf("Audited %d managed ingresses", a.managed),
+		ObservedGeneration: generation,
+	}
+	if a.failing > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "IngressesFailing"
+		condition.Message = fmt.Sprintf("%d of %d managed ingresses failed their audit", a.failing, a.managed)
+	}
+	meta.SetStatusCondition(&s.Conditions, condition)
+}
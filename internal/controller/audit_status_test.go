@@ -0,0 +1,129 @@
+// internal/controller/audit_status_test.go
+package controller
+
+import (
+	"context"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestAuditStatus(t *testing.T) {
+	ctx := context.TODO()
+	enabled := map[string]string{"nimble.opti.adapter/enabled": "true"}
+	expiry := time.Now().Add(60 * 24 * time.Hour).Truncate(time.Second)
+	certDER, err := generateTestCert(expiry)
+	require.NoError(t, err)
+
+	withTLS := func(ing *networkingv1.Ingress, secretName string) *networkingv1.Ingress {
+		ing.Spec.TLS = []networkingv1.IngressTLS{{SecretName: secretName}}
+		return ing
+	}
+
+	tests := []struct {
+		name          string
+		ingresses     []*networkingv1.Ingress
+		wantManaged   int32
+		wantDegraded  int32
+		wantFailing   int32
+		wantExpiry    bool
+		wantReady     metav1.ConditionStatus
+		wantReason    string
+		wantAuditErrs bool
+	}{
+		{
+			name:       "no managed ingress",
+			ingresses:  []*networkingv1.Ingress{generateIngress("plain", "default", nil, []string{"/app"}, nil)},
+			wantReady:  metav1.ConditionTrue,
+			wantReason: "AuditSucceeded",
+		},
+		{
+			name: "healthy and degraded ingresses",
+			ingresses: []*networkingv1.Ingress{
+				withTLS(generateIngress("ok", "default", enabled, []string{"/app"},
+					map[string]string{httpsAnnotation: "HTTPS"}), "ok-tls"),
+				generateIngress("degraded", "default", enabled, []string{"/app"},
+					map[string]string{originalBackendProtocolAnnotation: "HTTPS"}),
+				generateIngress("plain", "default", nil, []string{"/app"}, map[string]string{httpsAnnotation: "HTTPS"}),
+			},
+			wantManaged:  2,
+			wantDegraded: 1,
+			wantExpiry:   true,
+			wantReady:    metav1.ConditionTrue,
+			wantReason:   "AuditSucceeded",
+		},
+		{
+			name: "failing ingress",
+			ingresses: []*networkingv1.Ingress{
+				withTLS(generateIngress("ok", "default", enabled, []string{"/app"},
+					map[string]string{httpsAnnotation: "HTTPS"}), "ok-tls"),
+				withTLS(generateIngress("missing", "default", enabled, []string{"/app"},
+					map[string]string{httpsAnnotation: "HTTPS"}), "missing-tls"),
+			},
+			wantManaged:   2,
+			wantFailing:   1,
+			wantExpiry:    true,
+			wantReady:     metav1.ConditionFalse,
+			wantReason:    "IngressesFailing",
+			wantAuditErrs: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nimbleOpti := &v2.NimbleOpti{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"}}
+			other := &v2.NimbleOpti{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "ok-tls", Namespace: "default"},
+				Type:       corev1.SecretTypeTLS,
+				Data:       map[string][]byte{"tls.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})},
+			}
+			iw, fakeClient, _ := setupRenewRequestWatcher(t, nimbleOpti, other, secret)
+			// The soonest expiry is read from the Secret informers.
+			require.NoError(t, iw.SecretInformers[0].GetStore().Add(secret))
+			for _, ing := range tt.ingresses {
+				require.NoError(t, fakeClient.Create(ctx, ing))
+			}
+			auditTime := time.Now().Truncate(time.Second)
+			iw.now = func() time.Time { return auditTime }
+
+			err := iw.auditIngressResources(ctx)
+			if tt.wantAuditErrs {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			adapter := &v2.NimbleOpti{}
+			require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "default", Namespace: "default"}, adapter))
+			assert.Equal(t, tt.wantManaged, adapter.Status.ManagedIngresses)
+			assert.Equal(t, tt.wantDegraded, adapter.Status.DegradedIngresses)
+			assert.Equal(t, tt.wantFailing, adapter.Status.FailingIngresses)
+			require.NotNil(t, adapter.Status.LastAuditTime)
+			assert.True(t, adapter.Status.LastAuditTime.Time.Equal(auditTime))
+			if tt.wantExpiry {
+				require.NotNil(t, adapter.Status.SoonestExpiry)
+				assert.True(t, adapter.Status.SoonestExpiry.Time.Equal(expiry))
+			} else {
+				assert.Nil(t, adapter.Status.SoonestExpiry)
+			}
+			ready := meta.FindStatusCondition(adapter.Status.Conditions, conditionReady)
+			require.NotNil(t, ready)
+			assert.Equal(t, tt.wantReady, ready.Status)
+			assert.Equal(t, tt.wantReason, ready.Reason)
+
+			// Only the NimbleOpti named after the namespace gets the audit.
+			require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "other", Namespace: "default"}, other))
+			assert.Nil(t, other.Status.LastAuditTime)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	adapterv2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+)
+
+// ClusterNimbleOptiReconciler shows the cluster policy in the status of the ClusterNimbleOpti.
+type ClusterNimbleOptiReconciler struct {
+	client.Client
+
+	IngressWatcher *IngressWatcher
+}
+
+//+kubebuilder:rbac:groups=adapter.uri-tech.github.io,resources=clusternimbleoptis,verbs=get;list;watch
+//+kubebuilder:rbac:groups=adapter.uri-tech.github.io,resources=clusternimbleoptis/status,verbs=get;update;patch
+
+// Reconcile records the operator defaults overridden by the ClusterNimbleOpti in its status.
+// A ClusterNimbleOpti with another name than "default" is ignored.
+func (r *ClusterNimbleOptiReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if req.Name != adapterv2.ClusterNimbleOptiName {
+		klog.InfoS("Ignoring ClusterNimbleOpti, only the one named default is used", "name", req.Name)
+		return ctrl.Result{}, nil
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cluster := &adapterv2.ClusterNimbleOpti{}
+		if err := r.Get(ctx, req.NamespacedName, cluster); err != nil {
+			return err
+		}
+		want := effectivePolicy(r.IngressWatcher.clusterPolicy(cluster))
+		if reflect.DeepEqual(cluster.Status.EffectivePolicy, want) {
+			return nil
+		}
+		cluster.Status.EffectivePolicy = want
+		return r.Status().Update(ctx, cluster)
+	})
+	return ctrl.Result{}, client.IgnoreNotFound(err)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterNimbleOptiReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&adapterv2.ClusterNimbleOpti{}).
+		Complete(r)
+}
@@ -0,0 +1,109 @@
+// internal/controller/config_reloader.go
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/uri-tech/nimble-opti-adapter/internal/operatorconfig"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// Reasons of the events recorded on the config ConfigMap.
+const (
+	// reasonConfigReloaded is recorded when a config change is applied.
+	reasonConfigReloaded = "ConfigReloaded"
+	// reasonConfigRejected is recorded when a config change is invalid, the last good config stays in place.
+	reasonConfigRejected = "ConfigRejected"
+)
+
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+// ConfigReloader applies the operator config held by a ConfigMap without a restart.
+// Every change is validated, applied to the IngressWatcher and the logger,
+// and reported by an event on the ConfigMap. An invalid change is rejected.
+type ConfigReloader struct {
+	Client kubernetes.Interface
+	// Namespace and Name designate the ConfigMap, its operatorconfig.ConfigMapKey key holds the config file.
+	Namespace, Name string
+	// Flags are re-applied over every change, so the flags set on the command line keep their precedence.
+	Flags          *operatorconfig.Flags
+	IngressWatcher *IngressWatcher
+	// LogLevel is the level of the manager logger, DefaultLogLevel is used when the config has no logLevel.
+	LogLevel        zap.AtomicLevel
+	DefaultLogLevel zapcore.Level
+	Recorder        record.EventRecorder
+}
+
+// SetupWithManager adds the ConfigReloader to the manager.
+func (r *ConfigReloader) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.Add(r); err != nil {
+		return fmt.Errorf("adding the config reloader: %w", err)
+	}
+	return nil
+}
+
+// NeedLeaderElection returns false, every replica applies the config so a new leader starts with it.
+func (r *ConfigReloader) NeedLeaderElection() bool {
+	return false
+}
+
+// Start watches the ConfigMap until ctx is done.
+func (r *ConfigReloader) Start(ctx context.Context) error {
+	klog.InfoS("Watching the operator config", "configmap", r.Namespace+"/"+r.Name)
+	return utils.WatchConfigMap(ctx, r.Client, r.Namespace, r.Name, r.reload)
+}
+
+// reload validates and applies the config of cm. An unchanged config is ignored.
+func (r *ConfigReloader) reload(cm *corev1.ConfigMap) {
+	current := r.IngressWatcher.config()
+
+	next, err := r.parse(cm)
+	if err == nil {
+		err = current.CheckReload(next)
+	}
+	if err != nil {
+		klog.ErrorS(err, "Rejected the operator config, keeping the last good one", "configmap", r.Namespace+"/"+r.Name)
+		r.Recorder.Eventf(cm, corev1.EventTypeWarning, reasonConfigRejected, "Kept the last good config: %v", err)
+		return
+	}
+
+	changed := current.Changed(next)
+	if len(changed) == 0 {
+		return
+	}
+
+	r.IngressWatcher.ApplyConfig(next)
+	r.applyLogLevel(next)
+
+	klog.InfoS("Reloaded the operator config", "configmap", r.Namespace+"/"+r.Name, "changed", changed)
+	r.Recorder.Eventf(cm, corev1.EventTypeNormal, reasonConfigReloaded, "Applied %s", strings.Join(changed, ", "))
+}
+
+// parse parses the config file held by cm and applies the flags over it.
+func (r *ConfigReloader) parse(cm *corev1.ConfigMap) (*operatorconfig.OperatorConfig, error) {
+	data, ok := cm.Data[operatorconfig.ConfigMapKey]
+	if !ok {
+		return nil, fmt.Errorf("key %q not found", operatorconfig.ConfigMapKey)
+	}
+	return r.Flags.Parse([]byte(data))
+}
+
+// applyLogLevel sets the level of the manager logger from cfg.
+func (r *ConfigReloader) applyLogLevel(cfg *operatorconfig.OperatorConfig) {
+	level, ok := cfg.Level()
+	if !ok {
+		level = r.DefaultLogLevel
+	}
+	r.LogLevel.SetLevel(level)
+}
@@ -0,0 +1,148 @@
+// internal/controller/config_reloader_test.go
+package controller
+
+import (
+	"context"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uri-tech/nimble-opti-adapter/internal/operatorconfig"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// configMapWith returns the operator config ConfigMap holding data.
+func configMapWith(data string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "operator-config", Namespace: "system"},
+		Data:       map[string]string{operatorconfig.ConfigMapKey: data},
+	}
+}
+
+const configHeader = "apiVersion: config.adapter.uri-tech.github.io/v1alpha1\nkind: OperatorConfig\n"
+
+func TestConfigReloaderReload(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		cm         *corev1.ConfigMap
+		wantEvent  string
+		wantConfig func(t *testing.T, cfg *operatorconfig.OperatorConfig)
+		wantLevel  zapcore.Level
+	}{
+		{
+			name:      "valid change is applied",
+			cm:        configMapWith(configHeader + "workers: 3\ntimings:\n  auditInterval: 1h\nlogLevel: debug\n"),
+			wantEvent: "Normal ConfigReloaded Applied timings.auditInterval, workers, logLevel",
+			wantConfig: func(t *testing.T, cfg *operatorconfig.OperatorConfig) {
+				assert.Equal(t, 3, cfg.Workers)
+				assert.Equal(t, time.Hour, cfg.Timings.AuditInterval.Duration)
+			},
+			wantLevel: zapcore.DebugLevel,
+		},
+		{
+			name:      "flags keep their precedence",
+			args:      []string{"--workers", "2"},
+			cm:        configMapWith(configHeader + "workers: 3\nnimbleOptiDefaults:\n  certificateRenewalThreshold: 15\n"),
+			wantEvent: "Normal ConfigReloaded Applied nimbleOptiDefaults.certificateRenewalThreshold",
+			wantConfig: func(t *testing.T, cfg *operatorconfig.OperatorConfig) {
+				assert.Equal(t, 2, cfg.Workers)
+				assert.Equal(t, 15, cfg.NimbleOptiDefaults.CertificateRenewalThreshold)
+			},
+			wantLevel: zapcore.InfoLevel,
+		},
+		{
+			name:      "invalid value is rejected",
+			cm:        configMapWith(configHeader + "workers: 0\n"),
+			wantEvent: "Warning ConfigRejected Kept the last good config: invalid operator config: workers must be positive, got 0",
+		},
+		{
+			name:      "unknown key is rejected",
+			cm:        configMapWith(configHeader + "worker: 3\n"),
+			wantEvent: "Warning ConfigRejected Kept the last good config: parsing operator config",
+		},
+		{
+			name:      "restart only key is rejected",
+			cm:        configMapWith(configHeader + "workers: 3\nwatchNamespaces: [team-a]\n"),
+			wantEvent: "Warning ConfigRejected Kept the last good config: watchNamespaces cannot change without a restart",
+		},
+		{
+			name: "missing key is rejected",
+			cm: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "operator-config", Namespace: "system"},
+			},
+			wantEvent: `Warning ConfigRejected Kept the last good config: key "config.yaml" not found`,
+		},
+		{
+			name: "unchanged config records nothing",
+			cm:   configMapWith(configHeader),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags := operatorconfig.BindFlags(fs)
+			require.NoError(t, fs.Parse(tt.args))
+			startCfg, err := flags.Load()
+			require.NoError(t, err)
+
+			iw, err := NewIngressWatcher(fake.NewSimpleClientset(), startCfg)
+			require.NoError(t, err)
+			initial := iw.config()
+
+			recorder := record.NewFakeRecorder(10)
+			r := &ConfigReloader{
+				Namespace:       "system",
+				Name:            "operator-config",
+				Flags:           flags,
+				IngressWatcher:  iw,
+				LogLevel:        zap.NewAtomicLevelAt(zapcore.InfoLevel),
+				DefaultLogLevel: zapcore.InfoLevel,
+				Recorder:        recorder,
+			}
+			r.reload(tt.cm)
+
+			if tt.wantEvent == "" {
+				assert.Empty(t, recorder.Events)
+				assert.Same(t, initial, iw.config())
+				return
+			}
+			require.Len(t, recorder.Events, 1)
+			assert.Contains(t, <-recorder.Events, tt.wantEvent)
+
+			if tt.wantConfig == nil {
+				assert.Same(t, initial, iw.config(), "the last good config must stay in place")
+				assert.Empty(t, iw.configChanged)
+				return
+			}
+			tt.wantConfig(t, iw.config())
+			assert.Len(t, iw.configChanged, 1)
+			assert.Equal(t, tt.wantLevel, r.LogLevel.Level())
+		})
+	}
+}
+
+func TestApplyConfigSelector(t *testing.T) {
+	iw, err := NewIngressWatcher(fake.NewSimpleClientset(), nil)
+	require.NoError(t, err)
+
+	ing := generateIngress("ing", "default", map[string]string{"team": "payments"}, nil, nil)
+	assert.False(t, iw.isAdapterEnabledLabel(context.TODO(), ing))
+
+	cfg := operatorconfig.Default()
+	cfg.IngressSelector = "team=payments"
+	iw.ApplyConfig(cfg)
+	// A second change while the first is pending does not block.
+	iw.ApplyConfig(cfg)
+
+	assert.True(t, iw.isAdapterEnabledLabel(context.TODO(), ing))
+	assert.Len(t, iw.configChanged, 1)
+}
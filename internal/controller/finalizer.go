@@ -0,0 +1,208 @@
+// internal/controller/finalizer.go
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	errorsK8S "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// nimbleOptiFinalizer keeps a deleted NimbleOpti until the Ingresses of its namespace are released, see finalizeNimbleOpti.
+const nimbleOptiFinalizer = "adapter.uri-tech.github.io/finalizer"
+
+// finalizerRequeueDelay is how often a deleted NimbleOpti checks whether the renewals of its namespace ended.
+const finalizerRequeueDelay = time.Second
+
+// The bookkeeping the adapter adds to the objects of a namespace, removed when its NimbleOpti is deleted.
+const (
+	// originalBackendProtocolAnnotation holds the backend-protocol annotation of an Ingress while a renewal removed it.
+	originalBackendProtocolAnnotation = policy.OriginalBackendProtocolAnnotation
+	// backupSecretLabel marks a TLS secret replaced by the secret-rename strategy, kept as a backup.
+	backupSecretLabel = "nimble.opti.adapter/backup"
+	// backupOfAnnotation names the Ingress a backup secret was replaced for.
+	backupOfAnnotation = "nimble.opti.adapter/backup-of"
+	// enabledLabel is the label of the default Ingress selector.
+	enabledLabel = "nimble.opti.adapter/enabled"
+	// releasedAnnotation marks a Namespace released by the deletion of its NimbleOpti, see markNamespaceReleased.
+	releasedAnnotation = policy.ReleasedAnnotation
+)
+
+// finalizeNimbleOpti releases the Ingresses of the namespace of the deleted adapter: its running renewals are
+// interrupted, the annotations they removed restored, the bookkeeping of the adapter removed from the Ingresses
+// and the backup secrets deleted. The namespace is then marked released. It returns false while renewals are still running.
+func (iw *IngressWatcher) finalizeNimbleOpti(ctx context.Context, adapter *v2.NimbleOpti) (bool, error) {
+	namespace := adapter.Namespace
+	klog.Infof("Releasing the ingresses of namespace %s, its NimbleOpti is deleted", namespace)
+
+	// Interrupt the running renewals, they restore their annotations on their way out.
+	iw.suspension.set(namespace, true)
+	for key := range iw.inFlight.Pending() {
+		if strings.HasPrefix(key, namespace+"/") {
+			klog.Infof("Waiting for the renewal of ingress %s to end", key)
+			return false, nil
+		}
+	}
+
+	var errs []error
+	list := &networkingv1.IngressList{}
+	if err := iw.ClientObj.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return false, fmt.Errorf("listing ingresses in namespace %q: %w", namespace, err)
+	}
+	for i := range list.Items {
+		if err := iw.releaseIngress(ctx, &list.Items[i]); err != nil {
+			errs = append(errs, fmt.Errorf("ingress %s: %w", utils.IngressKey(&list.Items[i]), err))
+		}
+	}
+
+	secrets := &corev1.SecretList{}
+	if err := iw.ClientObj.List(ctx, secrets, client.InNamespace(namespace), client.MatchingLabels{backupSecretLabel: "true"}); err != nil {
+		return false, fmt.Errorf("listing backup secrets in namespace %q: %w", namespace, err)
+	}
+	for i := range secrets.Items {
+		if err := iw.ClientObj.Delete(ctx, &secrets.Items[i]); err != nil && !errorsK8S.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("backup secret %s: %w", secrets.Items[i].Name, err))
+			continue
+		}
+		klog.Infof("Deleted backup secret %s/%s", namespace, secrets.Items[i].Name)
+	}
+
+	// NewAggregate returns nil when there are no errors.
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		return false, err
+	}
+	if err := iw.markNamespaceReleased(ctx, namespace); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// releaseIngress restores the backend-protocol annotation a renewal removed from ing and removes the bookkeeping
+// of the adapter: the renew-requested-at annotation, whose handled token goes with the NimbleOpti, and the
+// default enabled label, so the NimbleOpti is not created again.
+func (iw *IngressWatcher) releaseIngress(ctx context.Context, ing *networkingv1.Ingress) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := iw.ClientObj.Get(ctx, client.ObjectKeyFromObject(ing), ing); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+
+		changed := false
+		if original, ok := ing.Annotations[originalBackendProtocolAnnotation]; ok {
+			if original != "" {
+				ing.Annotations[backendProtocolAnnotation] = original
+			}
+			delete(ing.Annotations, originalBackendProtocolAnnotation)
+			changed = true
+		}
+		if _, ok := ing.Annotations[renewRequestedAtAnnotation]; ok {
+			delete(ing.Annotations, renewRequestedAtAnnotation)
+			changed = true
+		}
+		if _, ok := ing.Labels[enabledLabel]; ok {
+			delete(ing.Labels, enabledLabel)
+			changed = true
+		}
+		if !changed {
+			return nil
+		}
+
+		klog.Infof("Releasing ingress %s", utils.IngressKey(ing))
+		return iw.ClientObj.Update(ctx, ing)
+	})
+}
+
+// markNamespaceReleased sets releasedAnnotation on namespace, so no NimbleOpti is created in it again, whatever
+// the Ingress selector, and the cronjob leaves it alone. A namespace being deleted is left as is. Without the
+// permission to patch Namespaces the mark is skipped, the Ingresses are released all the same.
+func (iw *IngressWatcher) markNamespaceReleased(ctx context.Context, namespace string) error {
+	return iw.setNamespaceReleased(ctx, namespace, true)
+}
+
+// claimNamespace removes releasedAnnotation from namespace, once a NimbleOpti is created in it again.
+func (iw *IngressWatcher) claimNamespace(ctx context.Context, namespace string) error {
+	return iw.setNamespaceReleased(ctx, namespace, false)
+}
+
+// setNamespaceReleased adds or removes releasedAnnotation on namespace, see markNamespaceReleased.
+func (iw *IngressWatcher) setNamespaceReleased(ctx context.Context, namespace string, released bool) error {
+	ns := &corev1.Namespace{}
+	err := iw.ClientObj.Get(ctx, client.ObjectKey{Name: namespace}, ns)
+	switch {
+	case errorsK8S.IsNotFound(err):
+		return nil
+	case errorsK8S.IsForbidden(err):
+		klog.Warningf("Cannot read namespace %s, it is not marked released: %v", namespace, err)
+		return nil
+	case err != nil:
+		return fmt.Errorf("getting namespace %q: %w", namespace, err)
+	}
+	if _, ok := ns.Annotations[releasedAnnotation]; ok == released || !ns.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	patch := client.MergeFrom(ns.DeepCopy())
+	if released {
+		if ns.Annotations == nil {
+			ns.Annotations = map[string]string{}
+		}
+		ns.Annotations[releasedAnnotation] = "true"
+	} else {
+		delete(ns.Annotations, releasedAnnotation)
+	}
+	if err := iw.ClientObj.Patch(ctx, ns, patch); err != nil {
+		if errorsK8S.IsForbidden(err) {
+			klog.Warningf("Cannot patch namespace %s, its released mark is not updated: %v", namespace, err)
+			return nil
+		}
+		return fmt.Errorf("patching namespace %q: %w", namespace, err)
+	}
+	klog.Infof("Set the released mark of namespace %s to %t", namespace, released)
+	return nil
+}
+
+// namespaceReleased reports whether namespace is marked released, see markNamespaceReleased.
+// A namespace that cannot be read is not released.
+func (iw *IngressWatcher) namespaceReleased(ctx context.Context, namespace string) (bool, error) {
+	ns := &corev1.Namespace{}
+	err := iw.ClientObj.Get(ctx, client.ObjectKey{Name: namespace}, ns)
+	switch {
+	case errorsK8S.IsNotFound(err) || errorsK8S.IsForbidden(err):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("getting namespace %q: %w", namespace, err)
+	}
+	return ns.Annotations[releasedAnnotation] == "true", nil
+}
+
+// markBackupSecret labels the secret replaced by the secret-rename strategy for ing as a backup,
+// so it is deleted together with the NimbleOpti of the namespace.
+func (iw *IngressWatcher) markBackupSecret(ctx context.Context, ing *networkingv1.Ingress, secretName string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret := &corev1.Secret{}
+		if err := iw.ClientObj.Get(ctx, client.ObjectKey{Name: secretName, Namespace: ing.Namespace}, secret); err != nil {
+			// cert-manager did not issue it yet, there is nothing to keep.
+			return client.IgnoreNotFound(err)
+		}
+		if secret.Labels == nil {
+			secret.Labels = map[string]string{}
+		}
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Labels[backupSecretLabel] = "true"
+		secret.Annotations[backupOfAnnotation] = ing.Name
+		return iw.ClientObj.Update(ctx, secret)
+	})
+}
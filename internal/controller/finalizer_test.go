@@ -0,0 +1,126 @@
+// internal/controller/finalizer_test.go
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestFinalizeNimbleOpti(t *testing.T) {
+	ctx := context.TODO()
+	nimbleOpti := &v2.NimbleOpti{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"}}
+	backup := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name: "tls-v1", Namespace: "default", Labels: map[string]string{backupSecretLabel: "true"},
+	}}
+	current := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "tls-v2", Namespace: "default"}}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+	iw, fakeClient, _ := setupRenewRequestWatcher(t, nimbleOpti, backup, current, namespace)
+
+	// A renewal interrupted by a crash left its ingress without the HTTPS annotation.
+	interrupted := generateIngress("ing", "default", map[string]string{enabledLabel: "true", "team": "a"}, []string{"/app"},
+		map[string]string{originalBackendProtocolAnnotation: "HTTPS", renewRequestedAtAnnotation: "t1", "keep": "me"})
+	untouched := generateIngress("other", "default", nil, []string{"/app"}, map[string]string{httpsAnnotation: "HTTPS"})
+	require.NoError(t, fakeClient.Create(ctx, interrupted))
+	require.NoError(t, fakeClient.Create(ctx, untouched))
+
+	r := &NimbleOptiReconciler{Client: fakeClient, IngressWatcher: iw}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "default", Namespace: "default"}}
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	got := &v2.NimbleOpti{}
+	require.NoError(t, fakeClient.Get(ctx, req.NamespacedName, got))
+	assert.Contains(t, got.Finalizers, nimbleOptiFinalizer)
+
+	// A renewal still running holds the deletion back, and is interrupted.
+	running, stop := iw.suspension.context(ctx, "default")
+	defer stop()
+	require.True(t, iw.inFlight.Begin("default/ing", map[string]string{httpsAnnotation: "HTTPS"}))
+	require.NoError(t, fakeClient.Delete(ctx, got))
+	result, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, finalizerRequeueDelay, result.RequeueAfter)
+	assert.Error(t, running.Err())
+	require.NoError(t, fakeClient.Get(ctx, req.NamespacedName, got))
+
+	// Once it ended the namespace is released.
+	iw.inFlight.End("default/ing")
+	result, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Zero(t, result)
+	assert.True(t, apierrors.IsNotFound(fakeClient.Get(ctx, req.NamespacedName, got)))
+
+	ing := &networkingv1.Ingress{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(interrupted), ing))
+	assert.Equal(t, map[string]string{httpsAnnotation: "HTTPS", "keep": "me"}, ing.Annotations)
+	assert.Equal(t, map[string]string{"team": "a"}, ing.Labels)
+	assert.False(t, iw.isAdapterEnabledLabel(ctx, ing))
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(namespace), namespace))
+	assert.Equal(t, "true", namespace.Annotations[releasedAnnotation])
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(untouched), ing))
+	assert.Equal(t, map[string]string{httpsAnnotation: "HTTPS"}, ing.Annotations)
+
+	assert.True(t, apierrors.IsNotFound(fakeClient.Get(ctx, client.ObjectKeyFromObject(backup), &corev1.Secret{})))
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(current), &corev1.Secret{}))
+
+	// The deleted NimbleOpti no longer holds the namespace.
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	resumed, stopResumed := iw.suspension.context(ctx, "default")
+	defer stopResumed()
+	assert.NoError(t, resumed.Err())
+
+	// No NimbleOpti is created again in the released namespace.
+	adapter, err := iw.getOrCreateNimbleOpti(ctx, "default", nil)
+	require.NoError(t, err)
+	assert.Nil(t, adapter)
+
+	// A NimbleOpti created again manages the released namespace.
+	require.NoError(t, fakeClient.Create(ctx, &v2.NimbleOpti{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"}}))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(namespace), namespace))
+	assert.NotContains(t, namespace.Annotations, releasedAnnotation)
+}
+
+func TestBackendProtocolBookkeeping(t *testing.T) {
+	ctx := context.TODO()
+	iw, fakeClient, _ := setupRenewRequestWatcher(t)
+	ing := generateIngress("ing", "default", nil, []string{"/app"}, map[string]string{httpsAnnotation: "HTTPS"})
+	require.NoError(t, fakeClient.Create(ctx, ing))
+
+	require.NoError(t, iw.removeHTTPSAnnotation(ctx, ing))
+	assert.Equal(t, map[string]string{originalBackendProtocolAnnotation: "HTTPS"}, ing.Annotations)
+
+	require.NoError(t, iw.addHTTPSAnnotation(ctx, ing))
+	assert.Equal(t, map[string]string{httpsAnnotation: "HTTPS"}, ing.Annotations)
+}
+
+func TestMarkBackupSecret(t *testing.T) {
+	ctx := context.TODO()
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "tls-v1", Namespace: "default"}}
+	iw, fakeClient, _ := setupRenewRequestWatcher(t, secret)
+	ing := generateIngress("ing", "default", nil, []string{"/app"}, nil)
+	ing.Spec.TLS = []networkingv1.IngressTLS{{SecretName: "tls-v1"}}
+	require.NoError(t, fakeClient.Create(ctx, ing))
+
+	require.NoError(t, iw.renameIngressSecret(ctx, ing, "tls-v1"))
+
+	got := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(secret), got))
+	assert.Equal(t, "true", got.Labels[backupSecretLabel])
+	assert.Equal(t, "ing", got.Annotations[backupOfAnnotation])
+
+	// A secret cert-manager did not issue yet is not an error.
+	assert.NoError(t, iw.markBackupSecret(ctx, ing, "missing"))
+}
@@ -0,0 +1,303 @@
+// internal/controller/ingress_policy.go
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	errorsK8S "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reasonInvalidOverride is recorded on an Ingress with an invalid override annotation, its default stays in place.
+const reasonInvalidOverride = "InvalidOverride"
+
+// resolvePolicy returns the renewal policy of ing: the policy of its namespace overridden by the first policy
+// matching ing, overridden by its annotations. Invalid annotations are reported by an event on ing.
+func (iw *IngressWatcher) resolvePolicy(ctx context.Context, ing *networkingv1.Ingress) (policy.Policy, error) {
+	base, adapter, err := iw.namespacePolicy(ctx, ing.Namespace)
+	if err != nil {
+		return policy.Policy{}, err
+	}
+	if adapter != nil {
+		p, err := matchIngressPolicy(adapter, ing)
+		if err != nil {
+			return policy.Policy{}, fmt.Errorf("nimbleopti %s/%s: %w", adapter.Namespace, adapter.Name, err)
+		}
+		if p != nil {
+			override, err := ingressPolicy(p)
+			if err != nil {
+				return policy.Policy{}, fmt.Errorf("nimbleopti %s/%s: policy %s: %w", adapter.Namespace, adapter.Name, p.Name, err)
+			}
+			base = base.Merge(override)
+		}
+	}
+
+	pol, err := policy.Resolve(base, ing.Annotations)
+	if err != nil {
+		klog.Errorf("Ignoring invalid overrides of ingress %s: %v", utils.IngressKey(ing), err)
+		iw.Recorder.Eventf(ing, corev1.EventTypeWarning, reasonInvalidOverride, "Kept the defaults of the invalid overrides: %v", err)
+	}
+
+	return pol, nil
+}
+
+// namespacePolicy returns the policy of the namespace: the cluster policy overridden by the NimbleOpti managing
+// the namespace from another one, overridden by the NimbleOpti of the namespace, created unless the
+// ClusterNimbleOpti disables it. The returned NimbleOpti holds the policies of the Ingresses, see ingressPoliciesOf;
+// it is nil when there is none.
+func (iw *IngressWatcher) namespacePolicy(ctx context.Context, namespace string) (policy.Policy, *v2.NimbleOpti, error) {
+	cluster, err := iw.getClusterNimbleOpti(ctx)
+	if err != nil {
+		return policy.Policy{}, nil, err
+	}
+
+	// Check if there's a v2.NimbleOpti CRD in the same namespace.
+	adapter, err := iw.getOrCreateNimbleOpti(ctx, namespace, cluster)
+	if err != nil {
+		klog.Errorf("Failed to get or create v2.NimbleOpti: %v", err)
+		return policy.Policy{}, nil, err
+	}
+	iw.renewalOwners.set(namespace, adapter)
+	manager, err := iw.managingNimbleOpti(ctx, namespace)
+	if err != nil {
+		return policy.Policy{}, nil, err
+	}
+
+	pol := iw.clusterPolicy(cluster)
+	for _, nimbleOpti := range []*v2.NimbleOpti{manager, adapter} {
+		if nimbleOpti == nil {
+			continue
+		}
+		override, err := nimbleOptiSpecPolicy(nimbleOpti)
+		if err != nil {
+			return policy.Policy{}, nil, fmt.Errorf("nimbleopti %s/%s: %w", nimbleOpti.Namespace, nimbleOpti.Name, err)
+		}
+		pol = pol.Merge(override)
+	}
+	return pol, ingressPoliciesOf(adapter, manager), nil
+}
+
+// nimbleOptiSpecPolicy returns the policy set in the spec of adapter, the unset fields are zero.
+func nimbleOptiSpecPolicy(adapter *v2.NimbleOpti) (policy.Policy, error) {
+	pol := nimbleOptiPolicy(adapter)
+	schedule, err := maintenanceSchedule(adapter.Spec.MaintenanceWindows, adapter.Spec.BlackoutDates)
+	if err != nil {
+		return policy.Policy{}, err
+	}
+	pol.Schedule = schedule
+	pol.EmergencyThreshold = durationOf(adapter.Spec.EmergencyThreshold)
+	// A deleted NimbleOpti releases its namespace, no renewal starts meanwhile.
+	pol.Suspended = adapter.Spec.Suspend || !adapter.DeletionTimestamp.IsZero()
+	return pol, nil
+}
+
+// ingressPoliciesOf returns the NimbleOpti whose policies apply to the Ingresses of a namespace: its own adapter
+// when it sets policies, otherwise the manager of the namespace when there is one. Either may be nil.
+func ingressPoliciesOf(adapter, manager *v2.NimbleOpti) *v2.NimbleOpti {
+	if manager != nil && (adapter == nil || len(adapter.Spec.Policies) == 0) {
+		return manager
+	}
+	return adapter
+}
+
+// matchIngressPolicy returns the first policy of adapter whose selector matches the labels of ing,
+// nil when none does.
+func matchIngressPolicy(adapter *v2.NimbleOpti, ing *networkingv1.Ingress) (*v2.IngressPolicy, error) {
+	for i := range adapter.Spec.Policies {
+		p := &adapter.Spec.Policies[i]
+		// An unset selector matches every Ingress, LabelSelectorAsSelector would match none.
+		if p.Selector == nil {
+			return p, nil
+		}
+		selector, err := metav1.LabelSelectorAsSelector(p.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", p.Name, err)
+		}
+		if selector.Matches(labels.Set(ing.Labels)) {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+// ingressPolicy returns the fields set in p, the unset ones are zero.
+func ingressPolicy(p *v2.IngressPolicy) (policy.Policy, error) {
+	schedule, err := maintenanceSchedule(p.MaintenanceWindows, p.BlackoutDates)
+	if err != nil {
+		return policy.Policy{}, err
+	}
+	return policy.Policy{
+		RenewBefore:            durationOf(p.RenewBefore),
+		RenewalSpread:          durationOf(p.RenewalSpread),
+		ChallengeAppearTimeout: durationOf(p.ChallengeAppearTimeout),
+		ChallengeClearTimeout:  durationOf(p.ChallengeClearTimeout),
+		PollInterval:           durationOf(p.PollInterval),
+		Strategy:               policy.Strategy(p.Strategy),
+		Schedule:               schedule,
+		EmergencyThreshold:     durationOf(p.EmergencyThreshold),
+		Notify:                 p.Notify,
+	}, nil
+}
+
+// maintenanceSchedule returns the schedule of windows and dates, nil when renewals may run at any time.
+func maintenanceSchedule(windows []v2.MaintenanceWindow, dates []v2.BlackoutDate) (*policy.Schedule, error) {
+	if len(windows) == 0 && len(dates) == 0 {
+		return nil, nil
+	}
+	schedule := &policy.Schedule{}
+	for i, mw := range windows {
+		days := make([]string, 0, len(mw.Days))
+		for _, day := range mw.Days {
+			days = append(days, string(day))
+		}
+		w, err := policy.ParseWindow(days, string(mw.Start), string(mw.End), mw.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("maintenance window %d: %w", i, err)
+		}
+		schedule.Windows = append(schedule.Windows, w)
+	}
+	for _, date := range dates {
+		schedule.BlackoutDates = append(schedule.BlackoutDates, string(date))
+	}
+	return schedule, nil
+}
+
+// clusterPolicy returns the operator defaults overridden by cluster, which may be nil.
+func (iw *IngressWatcher) clusterPolicy(cluster *v2.ClusterNimbleOpti) policy.Policy {
+	cfg := iw.config()
+	pol := policy.Policy{
+		RenewBefore:            time.Duration(cfg.NimbleOptiDefaults.CertificateRenewalThreshold) * 24 * time.Hour,
+		ChallengeAppearTimeout: cfg.Timings.AcmeChallengeTimeout.Duration,
+		ChallengeClearTimeout:  time.Duration(cfg.NimbleOptiDefaults.AnnotationRemovalDelay) * time.Second,
+		PollInterval:           cfg.Timings.PollInterval.Duration,
+		Strategy:               policy.StrategyAuto,
+	}
+	if cluster == nil {
+		return pol
+	}
+	return pol.Merge(policy.Policy{
+		RenewBefore:            durationOf(cluster.Spec.RenewBefore),
+		RenewalSpread:          durationOf(cluster.Spec.RenewalSpread),
+		ChallengeAppearTimeout: durationOf(cluster.Spec.ChallengeAppearTimeout),
+		ChallengeClearTimeout:  durationOf(cluster.Spec.ChallengeClearTimeout),
+		PollInterval:           durationOf(cluster.Spec.PollInterval),
+		Strategy:               policy.Strategy(cluster.Spec.Strategy),
+	})
+}
+
+// getClusterNimbleOpti returns the ClusterNimbleOpti, nil when there is none.
+func (iw *IngressWatcher) getClusterNimbleOpti(ctx context.Context) (*v2.ClusterNimbleOpti, error) {
+	cluster := &v2.ClusterNimbleOpti{}
+	if err := iw.ClientObj.Get(ctx, client.ObjectKey{Name: v2.ClusterNimbleOptiName}, cluster); err != nil {
+		if errorsK8S.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("getting ClusterNimbleOpti %s: %w", v2.ClusterNimbleOptiName, err)
+	}
+	return cluster, nil
+}
+
+// nimbleOptiPolicy returns the durations set in the spec of adapter, the unset ones are zero.
+func nimbleOptiPolicy(adapter *v2.NimbleOpti) policy.Policy {
+	return policy.Policy{
+		RenewBefore:            durationOf(adapter.Spec.RenewBefore),
+		RenewalSpread:          durationOf(adapter.Spec.RenewalSpread),
+		ChallengeAppearTimeout: durationOf(adapter.Spec.ChallengeAppearTimeout),
+		ChallengeClearTimeout:  durationOf(adapter.Spec.ChallengeClearTimeout),
+		PollInterval:           durationOf(adapter.Spec.PollInterval),
+	}
+}
+
+// durationOf returns d, zero when it is unset.
+func durationOf(d *metav1.Duration) time.Duration {
+	if d == nil {
+		return 0
+	}
+	return d.Duration
+}
+
+// updateEffectivePolicy records the policy of the namespace of adapter in its status when it changed.
+func (iw *IngressWatcher) updateEffectivePolicy(ctx context.Context, adapter *v2.NimbleOpti) error {
+	cluster, err := iw.getClusterNimbleOpti(ctx)
+	if err != nil {
+		return err
+	}
+	pol := iw.clusterPolicy(cluster)
+	if adapter.Name == adapter.Namespace {
+		manager, err := iw.managingNimbleOpti(ctx, adapter.Namespace)
+		if err != nil {
+			return err
+		}
+		if manager != nil {
+			pol = pol.Merge(nimbleOptiPolicy(manager))
+		}
+	}
+	want := effectivePolicy(pol.Merge(nimbleOptiPolicy(adapter)))
+	if reflect.DeepEqual(adapter.Status.EffectivePolicy, want) {
+		return nil
+	}
+
+	key := types.NamespacedName{Namespace: adapter.Namespace, Name: adapter.Name}
+	return iw.updateNimbleOptiStatus(ctx, key, func(s *v2.NimbleOptiStatus) {
+		s.EffectivePolicy = want
+	})
+}
+
+// effectivePolicy returns pol as shown in the status of a NimbleOpti or ClusterNimbleOpti.
+func effectivePolicy(pol policy.Policy) *v2.EffectivePolicy {
+	effective := &v2.EffectivePolicy{
+		RenewBefore:            metav1.Duration{Duration: pol.RenewBefore},
+		ChallengeAppearTimeout: metav1.Duration{Duration: pol.ChallengeAppearTimeout},
+		ChallengeClearTimeout:  metav1.Duration{Duration: pol.ChallengeClearTimeout},
+		PollInterval:           metav1.Duration{Duration: pol.PollInterval},
+		Strategy:               string(pol.Strategy),
+	}
+	if pol.RenewalSpread > 0 {
+		effective.RenewalSpread = &metav1.Duration{Duration: pol.RenewalSpread}
+	}
+	return effective
+}
+
+// renameIngressSecret points the TLS entry of ing using secretName at a new secret name,
+// so cert-manager issues a new certificate and the old secret is kept.
+func (iw *IngressWatcher) renameIngressSecret(ctx context.Context, ing *networkingv1.Ingress, secretName string) error {
+	for i := range ing.Spec.TLS {
+		if ing.Spec.TLS[i].SecretName != secretName {
+			continue
+		}
+
+		// Add a "-vX" suffix, or increment it when the name has one.
+		newSecretName, err := utils.ChangeSecretName(secretName)
+		if err != nil {
+			return err
+		}
+		ing.Spec.TLS[i].SecretName = newSecretName
+
+		if err := iw.ClientObj.Update(ctx, ing); err != nil {
+			klog.Errorf("Unable to change ingress secret name: %v", err)
+			return err
+		}
+		klog.Infof("Changed the secret of ingress %s from %s to %s", utils.IngressKey(ing), secretName, newSecretName)
+
+		// The old secret is kept as a backup, a failure to mark it does not fail the renewal.
+		if err := iw.markBackupSecret(ctx, ing, secretName); err != nil {
+			klog.Errorf("Failed to mark secret %s as a backup: %v", secretName, err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("secret %s is not used by ingress %s", secretName, utils.IngressKey(ing))
+}
@@ -0,0 +1,379 @@
+// internal/controller/ingress_policy_test.go
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakec "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestResolvePolicy(t *testing.T) {
+	ctx := context.TODO()
+	const day = 24 * time.Hour
+	defaults := policy.Policy{
+		RenewBefore:            30 * day,
+		ChallengeAppearTimeout: 10 * time.Second,
+		ChallengeClearTimeout:  10 * time.Second,
+		PollInterval:           time.Second,
+		Strategy:               policy.StrategyAuto,
+	}
+	cluster := &v2.ClusterNimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: v2.ClusterNimbleOptiName},
+		Spec: v2.ClusterNimbleOptiSpec{
+			RenewBefore:  &metav1.Duration{Duration: 20 * day},
+			PollInterval: &metav1.Duration{Duration: 2 * time.Second},
+			Strategy:     "secret-rename",
+		},
+	}
+
+	tests := []struct {
+		name        string
+		cluster     *v2.ClusterNimbleOpti
+		nimbleOpti  *v2.NimbleOpti
+		annotations map[string]string
+		want        policy.Policy
+		wantEvent   string
+	}{
+		{
+			name: "operator defaults",
+			want: defaults,
+		},
+		{
+			name: "NimbleOpti overrides the operator defaults",
+			nimbleOpti: &v2.NimbleOpti{
+				ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+				Spec: v2.NimbleOptiSpec{
+					RenewBefore:  &metav1.Duration{Duration: 36 * time.Hour},
+					PollInterval: &metav1.Duration{Duration: 3 * time.Second},
+				},
+			},
+			want: policy.Policy{
+				RenewBefore:            36 * time.Hour,
+				ChallengeAppearTimeout: 10 * time.Second,
+				ChallengeClearTimeout:  10 * time.Second,
+				PollInterval:           3 * time.Second,
+				Strategy:               policy.StrategyAuto,
+			},
+		},
+		{
+			name:    "ClusterNimbleOpti overrides the operator defaults",
+			cluster: cluster,
+			want: policy.Policy{
+				RenewBefore:            20 * day,
+				ChallengeAppearTimeout: 10 * time.Second,
+				ChallengeClearTimeout:  10 * time.Second,
+				PollInterval:           2 * time.Second,
+				Strategy:               policy.StrategySecretRename,
+			},
+		},
+		{
+			name:    "NimbleOpti overrides the ClusterNimbleOpti",
+			cluster: cluster,
+			nimbleOpti: &v2.NimbleOpti{
+				ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+				Spec:       v2.NimbleOptiSpec{RenewBefore: &metav1.Duration{Duration: 14 * day}},
+			},
+			annotations: map[string]string{policy.StrategyAnnotation: "challenge-only"},
+			want: policy.Policy{
+				RenewBefore:            14 * day,
+				ChallengeAppearTimeout: 10 * time.Second,
+				ChallengeClearTimeout:  10 * time.Second,
+				PollInterval:           2 * time.Second,
+				Strategy:               policy.StrategyChallengeOnly,
+			},
+		},
+		{
+			name: "annotations override the NimbleOpti",
+			nimbleOpti: &v2.NimbleOpti{
+				ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+				Spec: v2.NimbleOptiSpec{
+					RenewBefore:           &metav1.Duration{Duration: 14 * day},
+					ChallengeClearTimeout: &metav1.Duration{Duration: 5 * time.Second},
+				},
+			},
+			annotations: map[string]string{
+				policy.RenewalThresholdAnnotation: "7",
+				policy.StrategyAnnotation:         "secret-rename",
+			},
+			want: policy.Policy{
+				RenewBefore:            7 * day,
+				ChallengeAppearTimeout: 10 * time.Second,
+				ChallengeClearTimeout:  5 * time.Second,
+				PollInterval:           time.Second,
+				Strategy:               policy.StrategySecretRename,
+			},
+		},
+		{
+			name:        "invalid annotation is reported and ignored",
+			annotations: map[string]string{policy.AnnotationRemovalDelayAnnotation: "soon"},
+			want:        defaults,
+			wantEvent:   `Warning InvalidOverride Kept the defaults of the invalid overrides: annotation nimble.opti.adapter/annotation-removal-delay: invalid value "soon"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+			iw, err := setupIngressWatcher(fakeClient)
+			require.NoError(t, err)
+			recorder := record.NewFakeRecorder(10)
+			iw.Recorder = recorder
+
+			if tt.cluster != nil {
+				require.NoError(t, fakeClient.Create(ctx, tt.cluster.DeepCopy()))
+			}
+			if tt.nimbleOpti != nil {
+				require.NoError(t, fakeClient.Create(ctx, tt.nimbleOpti))
+			}
+			ing := generateIngress("ing", "default", nil, nil, tt.annotations)
+
+			got, err := iw.resolvePolicy(ctx, ing)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			if tt.wantEvent == "" {
+				assert.Empty(t, recorder.Events)
+				return
+			}
+			require.Len(t, recorder.Events, 1)
+			assert.Contains(t, <-recorder.Events, tt.wantEvent)
+		})
+	}
+}
+
+func TestAuditIngressSkip(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	iw, err := setupIngressWatcher(fakeClient)
+	require.NoError(t, err)
+
+	labels := map[string]string{"nimble.opti.adapter/enabled": "true"}
+	annotations := map[string]string{httpsAnnotation: "HTTPS", policy.SkipAnnotation: "true"}
+	ing := generateIngress("ing", "default", labels, []string{"/.well-known/acme-challenge"}, annotations)
+	require.NoError(t, fakeClient.Create(ctx, ing))
+
+	// A skipped ingress keeps its HTTPS annotation although it has an ACME challenge path.
+	assert.NoError(t, iw.auditIngress(ctx, ing))
+	assert.NoError(t, iw.handleIngressAdd(ctx, ing))
+
+	got := &networkingv1.Ingress{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "ing", Namespace: "default"}, got))
+	assert.Equal(t, "HTTPS", got.Annotations[httpsAnnotation])
+}
+
+func TestRenameIngressSecret(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	iw, err := setupIngressWatcher(fakeClient)
+	require.NoError(t, err)
+
+	ing := generateIngress("ing", "default", nil, []string{"/app"}, nil)
+	ing.Spec.TLS = []networkingv1.IngressTLS{{SecretName: "other"}, {SecretName: "tls-v1"}}
+	require.NoError(t, fakeClient.Create(ctx, ing))
+
+	require.NoError(t, iw.renameIngressSecret(ctx, ing, "tls-v1"))
+
+	got := &networkingv1.Ingress{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "ing", Namespace: "default"}, got))
+	assert.Equal(t, []networkingv1.IngressTLS{{SecretName: "other"}, {SecretName: "tls-v2"}}, got.Spec.TLS)
+
+	assert.ErrorContains(t, iw.renameIngressSecret(ctx, ing, "missing"), "secret missing is not used by ingress default/ing")
+}
+
+func TestDisableNimbleOptiCreation(t *testing.T) {
+	ctx := context.TODO()
+	cluster := &v2.ClusterNimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: v2.ClusterNimbleOptiName},
+		Spec: v2.ClusterNimbleOptiSpec{
+			RenewBefore:               &metav1.Duration{Duration: 10 * 24 * time.Hour},
+			DisableNimbleOptiCreation: true,
+		},
+	}
+	iw, fakeClient, recorder := setupRenewRequestWatcher(t, cluster)
+
+	annotations := map[string]string{httpsAnnotation: "HTTPS", renewRequestedAtAnnotation: "t1"}
+	ing := generateIngress("ing", "default", nil, []string{"/app"}, annotations)
+	require.NoError(t, fakeClient.Create(ctx, ing))
+
+	// The cluster defaults apply without creating a NimbleOpti.
+	pol, err := iw.resolvePolicy(ctx, ing)
+	require.NoError(t, err)
+	assert.Equal(t, 10*24*time.Hour, pol.RenewBefore)
+	err = fakeClient.Get(ctx, client.ObjectKey{Name: "default", Namespace: "default"}, &v2.NimbleOpti{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// A renewal request cannot be recorded, it is reported and ignored.
+	handled, err := iw.handleRenewRequest(ctx, ing, pol)
+	assert.NoError(t, err)
+	assert.False(t, handled)
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning RenewRequestFailed")
+}
+
+func TestEffectivePolicyStatus(t *testing.T) {
+	ctx := context.TODO()
+	cluster := &v2.ClusterNimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: v2.ClusterNimbleOptiName},
+		Spec: v2.ClusterNimbleOptiSpec{
+			ChallengeClearTimeout: &metav1.Duration{Duration: time.Minute},
+			RenewalSpread:         &metav1.Duration{Duration: 12 * time.Hour},
+		},
+	}
+	nimbleOpti := &v2.NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+		Spec:       v2.NimbleOptiSpec{RenewBefore: &metav1.Duration{Duration: 36 * time.Hour}},
+	}
+	iw, fakeClient, _ := setupRenewRequestWatcher(t, cluster, nimbleOpti)
+
+	clusterReconciler := &ClusterNimbleOptiReconciler{Client: fakeClient, IngressWatcher: iw}
+	_, err := clusterReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKey{Name: v2.ClusterNimbleOptiName}})
+	require.NoError(t, err)
+	gotCluster := &v2.ClusterNimbleOpti{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: v2.ClusterNimbleOptiName}, gotCluster))
+	assert.Equal(t, &v2.EffectivePolicy{
+		RenewBefore:            metav1.Duration{Duration: 30 * 24 * time.Hour},
+		RenewalSpread:          &metav1.Duration{Duration: 12 * time.Hour},
+		ChallengeAppearTimeout: metav1.Duration{Duration: 10 * time.Second},
+		ChallengeClearTimeout:  metav1.Duration{Duration: time.Minute},
+		PollInterval:           metav1.Duration{Duration: time.Second},
+		Strategy:               "auto",
+	}, gotCluster.Status.EffectivePolicy)
+
+	r := &NimbleOptiReconciler{Client: fakeClient, IngressWatcher: iw}
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKey{Name: "default", Namespace: "default"}})
+	require.NoError(t, err)
+	got := &v2.NimbleOpti{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "default", Namespace: "default"}, got))
+	assert.Equal(t, &v2.EffectivePolicy{
+		RenewBefore:            metav1.Duration{Duration: 36 * time.Hour},
+		RenewalSpread:          &metav1.Duration{Duration: 12 * time.Hour},
+		ChallengeAppearTimeout: metav1.Duration{Duration: 10 * time.Second},
+		ChallengeClearTimeout:  metav1.Duration{Duration: time.Minute},
+		PollInterval:           metav1.Duration{Duration: time.Second},
+		Strategy:               "auto",
+	}, got.Status.EffectivePolicy)
+}
+
+func TestResolveIngressPolicies(t *testing.T) {
+	ctx := context.TODO()
+	const day = 24 * time.Hour
+	nimbleOpti := &v2.NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+		Spec: v2.NimbleOptiSpec{
+			RenewBefore:           &metav1.Duration{Duration: 20 * day},
+			ChallengeClearTimeout: &metav1.Duration{Duration: 5 * time.Second},
+			Policies: []v2.IngressPolicy{
+				{
+					Name:               "public",
+					Selector:           &metav1.LabelSelector{MatchLabels: map[string]string{"exposure": "public"}},
+					RenewBefore:        &metav1.Duration{Duration: 14 * day},
+					Strategy:           "secret-rename",
+					MaintenanceWindows: []v2.MaintenanceWindow{{Start: "02:00", End: "04:00"}},
+					Notify:             []string{"slack:#team-web"},
+				},
+				{
+					Name: "internal",
+					Selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: "exposure", Operator: metav1.LabelSelectorOpIn, Values: []string{"internal", "public"}},
+					}},
+					ChallengeClearTimeout: &metav1.Duration{Duration: 30 * time.Second},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		labels       map[string]string
+		annotations  map[string]string
+		want         policy.Policy
+		wantSchedule bool
+	}{
+		{
+			name: "no policy matches",
+			want: policy.Policy{
+				RenewBefore:            20 * day,
+				ChallengeAppearTimeout: 10 * time.Second,
+				ChallengeClearTimeout:  5 * time.Second,
+				PollInterval:           time.Second,
+				Strategy:               policy.StrategyAuto,
+			},
+		},
+		{
+			name:   "the first matching policy applies",
+			labels: map[string]string{"exposure": "public"},
+			want: policy.Policy{
+				RenewBefore:            14 * day,
+				ChallengeAppearTimeout: 10 * time.Second,
+				ChallengeClearTimeout:  5 * time.Second,
+				PollInterval:           time.Second,
+				Strategy:               policy.StrategySecretRename,
+				Notify:                 []string{"slack:#team-web"},
+			},
+			wantSchedule: true,
+		},
+		{
+			name:        "annotations override the policy",
+			labels:      map[string]string{"exposure": "internal"},
+			annotations: map[string]string{policy.RenewalThresholdAnnotation: "7"},
+			want: policy.Policy{
+				RenewBefore:            7 * day,
+				ChallengeAppearTimeout: 10 * time.Second,
+				ChallengeClearTimeout:  30 * time.Second,
+				PollInterval:           time.Second,
+				Strategy:               policy.StrategyAuto,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iw, _, _ := setupRenewRequestWatcher(t, nimbleOpti.DeepCopy())
+			ing := generateIngress("ing", "default", tt.labels, nil, tt.annotations)
+
+			got, err := iw.resolvePolicy(ctx, ing)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSchedule, got.Schedule != nil)
+			got.Schedule = nil
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestIngressPolicyMatches(t *testing.T) {
+	nimbleOpti := &v2.NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+		Spec: v2.NimbleOptiSpec{
+			Policies: []v2.IngressPolicy{
+				{Name: "public", Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"exposure": "public"}}},
+				{Name: "catch-all"},
+			},
+		},
+	}
+	ingresses := []*networkingv1.Ingress{
+		generateIngress("web", "default", map[string]string{"exposure": "public"}, nil, nil),
+		generateIngress("api", "default", nil, nil, nil),
+	}
+
+	assert.Equal(t, []v2.IngressPolicyMatch{
+		{Ingress: "api", Policy: "catch-all"},
+		{Ingress: "web", Policy: "public"},
+	}, ingressPolicyMatches(nimbleOpti, ingresses))
+
+	// Without a catch-all policy the Ingresses no policy matches are left out.
+	nimbleOpti.Spec.Policies = nimbleOpti.Spec.Policies[:1]
+	assert.Equal(t, []v2.IngressPolicyMatch{{Ingress: "web", Policy: "public"}}, ingressPolicyMatches(nimbleOpti, ingresses))
+}
@@ -1,644 +1,1030 @@
-// internal/controller/ingress_watcher.go
-
-package controller
-
-import (
-	"context"
-	"crypto/x509"
-	"encoding/pem"
-	"errors"
-	"fmt"
-	"reflect"
-	"strings"
-	"time"
-
-	v1 "github.com/uri-tech/nimble-opti-adapter/api/v1"
-	metrics "github.com/uri-tech/nimble-opti-adapter/metrics"
-	"github.com/uri-tech/nimble-opti-adapter/utils"
-	corev1 "k8s.io/api/core/v1"
-	networkingv1 "k8s.io/api/networking/v1"
-
-	errorsK8S "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/watch"
-
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/client-go/informers"
-	"k8s.io/client-go/kubernetes"
-	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/util/workqueue"
-	"k8s.io/klog/v2"
-	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/client/config"
-)
-
-// IngressWatcher is a structure that holds the Client for Kubernetes
-// API communication and IngressInformer for caching Ingress resources.
-type IngressWatcher struct {
-	// IngressWatcherClient IngressWatcherInterface
-	// Client               kubernetes.Interface
-	Client          KubernetesClient
-	IngressInformer cache.SharedIndexInformer
-	ClientObj       client.Client
-	auditMutex      *utils.NamedMutex
-	Queue           workqueue.RateLimitingInterface
-}
-
-// KubernetesClient defines methods we're interested in mocking.
-type KubernetesClient interface {
-	Watch(ctx context.Context, namespace, ingressName string) (watch.Interface, error)
-}
-
-// RealKubernetesClient is a structure that holds the Client for Kubernetes.
-type RealKubernetesClient struct {
-	kubernetes.Interface
-}
-
-// Watch implements the KubernetesClient interface.
-func (r *RealKubernetesClient) Watch(ctx context.Context, namespace, ingressName string) (watch.Interface, error) {
-	// debug
-	klog.Info("debug - RealKubernetesClient.Watch")
-
-	opts := metav1.SingleObject(metav1.ObjectMeta{Name: ingressName})
-	return r.NetworkingV1().Ingresses(namespace).Watch(ctx, opts)
-}
-
-// NewIngressWatcher initializes a new IngressWatcher and starts
-// an IngressInformer for caching Ingress resources.
-func NewIngressWatcher(clientKube kubernetes.Interface, stopCh <-chan struct{}) (*IngressWatcher, error) {
-	// debug
-	klog.Info("debug - NewIngressWatcher")
-
-	cfg, err := config.GetConfig()
-	if err != nil {
-		klog.Fatalf("unable to get config %v", err)
-		return nil, err
-	}
-
-	// Create a new scheme for decoding into.
-	scheme := runtime.NewScheme()
-	// assuming `v1` package has `AddToScheme` function
-	if err := v1.AddToScheme(scheme); err != nil {
-		klog.Fatalf("unable to add v1 scheme %v", err)
-		return nil, err
-	}
-
-	// Add client-go's scheme for core Kubernetes types
-	if err := clientgoscheme.AddToScheme(scheme); err != nil {
-		klog.Fatalf("unable to add client-go scheme %v", err)
-		// setupLog.Error(err, "unable to add client-go scheme")
-		return nil, err
-	}
-
-	// Create a new client to Kubernetes API.
-	cl, err := client.New(cfg, client.Options{Scheme: scheme})
-	if err != nil {
-		klog.Fatalf("unable to create client %v", err)
-		return nil, err
-	}
-
-	iw := &IngressWatcher{
-		Client:     &RealKubernetesClient{clientKube},
-		ClientObj:  cl,
-		auditMutex: utils.NewNamedMutex(),
-		Queue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "IngressQueue"),
-	}
-
-	// Setup informer
-	informerFactory := informers.NewSharedInformerFactory(clientKube, 0)
-	iw.IngressInformer = informerFactory.Networking().V1().Ingresses().Informer()
-	iw.IngressInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			key, err := cache.MetaNamespaceKeyFunc(obj) // it like ingressKey
-
-			// debug
-			klog.Infof("debug - AddFunc - key: %s", key)
-
-			if err != nil {
-				klog.ErrorS(err, "Failed to get MetaNamespaceKey")
-				return
-			}
-			if iw.auditMutex.IsLocked(key) {
-				klog.Info("debug - AddFunc - key is locked, skip the processing")
-				// iw.auditMutex.Unlock(key)
-				return
-			}
-			iw.handleIngressAdd(obj)
-		},
-	})
-
-	// After starting the IngressInformer
-	go iw.IngressInformer.Run(stopCh)
-
-	// Wait for the cache to be synced.
-	if !cache.WaitForCacheSync(stopCh, iw.IngressInformer.HasSynced) {
-		return nil, fmt.Errorf("failed to wait for caches to sync")
-	}
-
-	return iw, nil
-}
-
-// handleIngressAdd is called when an Ingress resource is added.
-func (iw *IngressWatcher) handleIngressAdd(obj interface{}) {
-	// debug
-	klog.Info("debug - handleIngressAdd")
-
-	ctx := context.Background()
-
-	ing, ok := obj.(*networkingv1.Ingress)
-	if !ok {
-		klog.Error("Expected Ingress in handleIngressAdd")
-	}
-
-	// If "nimble.opti.adapter/enabled" label is true, process it.
-	if isAdapterEnabledLabel(ctx, ing) && isBackendHttpsAnnotations(ctx, ing) {
-		_, err := iw.processIngressForRenewal(ctx, ing)
-		if err != nil {
-			klog.Errorf("error processing ingress. %v", err)
-		}
-	}
-}
-
-// StartAudit audits daily all Ingress resources with the label "nimble.opti.adapter/enabled=true" in the cluster
-func (iw *IngressWatcher) StartAudit(stopCh <-chan struct{}) {
-	// debug
-	klog.Info("debug - StartAudit")
-
-	go func() {
-		// debug
-		klog.Info("debug - StartAudit - go func")
-
-		ticker := time.NewTicker(24 * time.Hour)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				if err := iw.auditIngressResources(context.TODO()); err != nil {
-					klog.ErrorS(err, "error auditing ingress resources")
-				}
-			case <-stopCh:
-				return
-			}
-		}
-	}()
-}
-
-// section 2
-
-// isAdapterEnabledLabel checks if the "nimble.opti.adapter/enabled" label is present and set to "true".
-func isAdapterEnabledLabel(ctx context.Context, ing *networkingv1.Ingress) bool {
-	// debug
-	klog.Info("debug - isAdapterEnabledLabel")
-
-	val, ok := ing.Labels["nimble.opti.adapter/enabled"]
-
-	return ok && val == "true"
-}
-
-// isBackendHttpsAnnotations checks if the "nginx.ingress.kubernetes.io/backend-protocol" annotation is present and set to "HTTPS".
-func isBackendHttpsAnnotations(ctx context.Context, ing *networkingv1.Ingress) bool {
-	// debug
-	klog.Info("debug - isBackendHttpsAnnotations")
-
-	val, ok := ing.Annotations["nginx.ingress.kubernetes.io/backend-protocol"]
-
-	return ok && val == "HTTPS"
-}
-
-// processIngressForRenewal return true if it renew the certificate.
-func (iw *IngressWatcher) processIngressForRenewal(ctx context.Context, ing *networkingv1.Ingress) (bool, error) {
-	// debug
-	klog.Info("debug  - processIngressForRenewal")
-
-	// indicate if make ceartificate renewal process
-	makeRenewal := false
-
-	// Check if there's a v1.NimbleOpti CRD in the same namespace.
-	adapter, err := iw.getOrCreateNimbleOpti(ctx, ing.Namespace)
-	if err != nil {
-		klog.Errorf("Failed to get or create v1.NimbleOpti: %v", err)
-		return makeRenewal, err
-	}
-
-	// debug
-	klog.Infof("adapter: %s", adapter)
-
-	// Scan for any path in spec.rules[].http.paths[].path containing .well-known/acme-challenge.
-	if isContainsAcmeChallenge(ctx, ing) {
-		// Trigger the certificate renewal process.
-		isRenew, err := iw.startCertificateRenewal(ctx, ing, adapter)
-		if err != nil {
-			klog.Errorf("Failed to start certificate renewal: %v", err)
-			return false, err
-		}
-		makeRenewal = isRenew
-	}
-
-	return makeRenewal, nil
-}
-
-// isAcmeChallengePath checks if the given path contains the ACME challenge string.
-func isAcmeChallengePath(ctx context.Context, p string) bool {
-	// debug
-	klog.Info("debug - isAcmeChallengePath")
-
-	const acmeChallengePath = ".well-known/acme-challenge"
-
-	return strings.Contains(p, acmeChallengePath)
-}
-
-// isContainsAcmeChallenge checks if the given ingress contains any ACME challenge paths.
-func isContainsAcmeChallenge(ctx context.Context, ing *networkingv1.Ingress) bool {
-	// debug
-	klog.Info("debug - isContainsAcmeChallenge")
-
-	for _, rule := range ing.Spec.Rules {
-		for _, path := range rule.IngressRuleValue.HTTP.Paths {
-			if isAcmeChallengePath(ctx, path.Path) {
-				klog.Infof("Found %s in path %s", ".well-known/acme-challenge", path.Path)
-				return true
-			}
-		}
-	}
-	return false
-}
-
-// getOrCreateNimbleOpti gets or creates a v1.NimbleOpti CRD in the same namespace as the Ingress.
-func (iw *IngressWatcher) getOrCreateNimbleOpti(ctx context.Context, namespace string) (*v1.NimbleOpti, error) {
-	// debug
-	klog.Info("debug - getOrCreateNimbleOpti")
-
-	nimbleOpti := &v1.NimbleOpti{}
-	key := types.NamespacedName{
-		Namespace: namespace,
-		Name:      namespace,
-	}
-
-	if err := iw.ClientObj.Get(ctx, key, nimbleOpti); err != nil {
-		if errorsK8S.IsNotFound(err) {
-			// debug
-			klog.Info("debug - create NimbleOpti")
-
-			nimbleOpti = &v1.NimbleOpti{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      namespace,
-					Namespace: namespace,
-				},
-				Spec: v1.NimbleOptiSpec{
-					TargetNamespace:             namespace,
-					CertificateRenewalThreshold: 30,
-					AnnotationRemovalDelay:      10,
-				},
-			}
-
-			if err := iw.ClientObj.Create(ctx, nimbleOpti); err != nil {
-				klog.ErrorS(err, "Failed to create NimbleOpti", "namespace", namespace)
-				return nil, err
-			}
-			// debug
-			klog.Info("debug - create NimbleOpti done")
-
-		} else {
-			klog.ErrorS(err, "Failed to get NimbleOpti", "namespace", namespace)
-			return nil, err
-		}
-	}
-
-	return nimbleOpti, nil
-}
-
-// hasIngressChanged checks if the important parts of the Ingress have changed.
-func hasIngressChanged(ctx context.Context, oldIng *networkingv1.Ingress, newIng *networkingv1.Ingress) bool {
-	// debug
-	klog.Info("debug - hasIngressChanged")
-
-	// Check for changes in the spec.rules configurations
-	if !reflect.DeepEqual(oldIng.Spec.Rules, newIng.Spec.Rules) {
-		klog.Info("Ingress spec.rules configuration has changed")
-		return true
-	}
-
-	return false
-}
-
-// startCertificateRenewal get ingress that has "".well-known/acme-challenge" and resolve it.
-func (iw *IngressWatcher) startCertificateRenewal(ctx context.Context, ing *networkingv1.Ingress, adapter *v1.NimbleOpti) (bool, error) {
-	// debug
-	klog.Info("debug - startCertificateRenewal")
-
-	var isRenew = false
-
-	// Remove the annotation.
-	if err := iw.removeHTTPSAnnotation(ctx, ing); err != nil {
-		klog.Errorf("Failed to remove HTTPS annotation: %v", err)
-		return false, err
-	}
-
-	// Wait for the absence of the ACME challenge path or for the timeout.
-	timeout := time.Duration(adapter.Spec.AnnotationRemovalDelay) * time.Second
-	successTime, err := iw.waitForChallengeAbsence(ctx, timeout, ing.Namespace, ing.Name)
-	if err != nil {
-		klog.Errorf("Failed to wait for the absence of ACME challenge path: %v", err)
-		return false, err
-	}
-	if successTime > timeout {
-		klog.Warningln("Failed to confirm the absence of ACME challenge path before timeout.")
-	}
-
-	// log the duration (in seconds) of annotation updates during each renewal
-	if successTime == timeout*2 {
-		klog.Infof("Annotation update duration: %v", timeout)
-		metrics.RecordAnnotationUpdateDuration(timeout.Seconds())
-	} else {
-		klog.Infof("Annotation update duration: %v", successTime)
-		metrics.RecordAnnotationUpdateDuration(successTime.Seconds())
-		isRenew = true
-	}
-
-	// Reinstate the annotation.
-	if err := iw.addHTTPSAnnotation(ctx, ing); err != nil {
-		klog.Errorf("Failed to add HTTPS annotation: %v", err)
-		return isRenew, err
-	}
-
-	// Increment the certificate renewals counter.
-	if successTime <= timeout {
-		metrics.IncrementCertificateRenewals()
-	}
-
-	return isRenew, nil
-}
-
-// waitForChallengeAbsence waits for the absence of the ACME challenge path in the Ingress or until a timeout is reached.
-// Returns the time it took to renew(timeout*2 when it failed) or there is an error.
-func (iw *IngressWatcher) waitForChallengeAbsence(ctx context.Context, timeout time.Duration, ingNamespace, ingName string) (time.Duration, error) {
-	// debug
-	klog.Info("Starting waitForChallengeAbsence")
-
-	// Capture the start time
-	startTime := time.Now()
-
-	// Create a child context with the specified timeout
-	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel() // Ensure resources are cleaned up after timeout or successful completion
-
-	for {
-		select {
-		case <-timeoutCtx.Done():
-			klog.Info("Timeout reached or context cancelled. Stopping.")
-			return timeout * 2, nil
-		default:
-			// debug
-			klog.Info("debug - Checking Ingress")
-
-			// Get the Ingress
-			ingress := &networkingv1.Ingress{}
-			if err := iw.ClientObj.Get(timeoutCtx, client.ObjectKey{Name: ingName, Namespace: ingNamespace}, ingress); err != nil {
-				klog.ErrorS(err, "Error fetching ingress")
-				elapsedTime := time.Since(startTime)
-				return elapsedTime, err
-			}
-
-			// Check all paths of the Ingress for the ACME challenge path
-			pathFound := false
-			for _, rule := range ingress.Spec.Rules {
-				for _, pathType := range rule.HTTP.Paths {
-					if strings.Contains(pathType.Path, ".well-known/acme-challenge") {
-						// debug
-						klog.Info("debug - ACME challenge path found")
-
-						pathFound = true
-						break
-					}
-				}
-				if pathFound {
-					break
-				}
-			}
-
-			if !pathFound {
-				// debug
-				klog.Info("ACME challenge path not found. Stopping.")
-
-				// If we reach here, the ACME challenge path was not found in any rule
-				elapsedTime := time.Since(startTime)
-				return elapsedTime, nil // Return the elapsed time on success
-			}
-
-			// Introduce a short delay to prevent high CPU usage
-			time.Sleep(1 * time.Second)
-		}
-	}
-}
-
-// auditIngressResources audits all Ingress with the label "nimble.opti.adapter/enabled:true".
-func (iw *IngressWatcher) auditIngressResources(ctx context.Context) error {
-	// debug
-	klog.Info("debug - auditIngressResources")
-
-	// Fetch all Ingress resources
-	ingresses := &networkingv1.IngressList{}
-
-	// Fetch all Ingress resources using the standard Kubernetes client
-	// ingresses, err := iw.Client.NetworkingV1().Ingresses("").List(ctx, metav1.ListOptions{})
-	err := iw.ClientObj.List(ctx, ingresses, &client.ListOptions{})
-	if err != nil {
-		klog.Errorf("Failed to list ingresses: %v", err)
-		return err
-	}
-
-	// Iterate through all Ingress resources
-	for _, ing := range ingresses.Items {
-		// check if the ingress is labeled with the label "nimble.opti.adapter/enabled:true"
-		if isAdapterEnabledLabel(ctx, &ing) && isBackendHttpsAnnotations(ctx, &ing) {
-			// process the ingress
-			isRenew, err := iw.processIngressForRenewal(ctx, &ing)
-			if err != nil {
-				klog.Errorf("Failed to process ingress: %v", err)
-				return err
-			}
-
-			if !isRenew {
-				// The operator fetches the associated Secret referenced in `spec.tls[].secretName` for each tls[],
-				//  calculates the remaining time until certificate expiry and checks it against the `CertificateRenewalThreshold` specified in the `NimbleOpti` CRD.
-				// If the certificate is due to expire within or on the threshold, certificate renewal is initiated.
-				if err := iw.renewValidCertificateIfNecessary(ctx, &ing); err != nil {
-					klog.Errorf("Error renewing certificate for ingress %s: %v", ing.Name, err)
-					return err
-				}
-			}
-		}
-	}
-	return nil
-}
-
-// move on all the secret connected to the ingress and renew the certificate if necessary
-func (iw *IngressWatcher) renewValidCertificateIfNecessary(ctx context.Context, ing *networkingv1.Ingress) error {
-	// debug
-	klog.Info("debug - renewValidCertificateIfNecessary")
-
-	// Iterate over spec.tls[] to fetch associated secrets
-	for _, tlsSpec := range ing.Spec.TLS {
-		secretName := tlsSpec.SecretName
-
-		// Fetch the secret
-		secret := &corev1.Secret{}
-		err := iw.ClientObj.Get(ctx, client.ObjectKey{Name: secretName, Namespace: ing.Namespace}, secret)
-		if err != nil {
-			klog.Errorf("Failed to fetch secret %s: %v", secretName, err)
-			// continue
-			return err
-		}
-
-		// Extract the certificate from the secret. Assuming it's stored under the key "tls.crt"
-		certData, ok := secret.Data["tls.crt"]
-		if !ok {
-			klog.Errorf("Secret %s does not have tls.crt", secretName)
-			return errors.New("missing tls.crt in secret")
-		}
-
-		// Check if the certificate is in PEM or DER format
-		var certDER []byte
-		if strings.Contains(string(certData), "-----BEGIN CERTIFICATE-----") {
-			// debug
-			klog.Info("debug - renewValidCertificateIfNecessary - PEM format")
-
-			// Decode PEM to get the DER-encoded certificate
-			block, _ := pem.Decode(certData)
-			if block == nil || block.Type != "CERTIFICATE" {
-				klog.Errorf("Failed to decode PEM block from secret %s", secretName)
-				return errors.New("failed to decode PEM block")
-			}
-			certDER = block.Bytes
-		} else {
-			// debug
-			klog.Info("debug - renewValidCertificateIfNecessary - DER format")
-
-			// Assume it's DER format
-			certDER = certData
-		}
-
-		cert, err := x509.ParseCertificate(certDER)
-		if err != nil {
-			klog.Errorf("Failed to parse certificate from secret %s: %v", secretName, err)
-			return err
-		}
-
-		// Calculate remaining duration until certificate expiry
-		timeRemaining := cert.NotAfter.Sub(time.Now())
-
-		// debug
-		klog.Infof("debug - timeRemaining: %v", timeRemaining)
-
-		// Fetch the associated NimbleOpti CRD
-		adapter := &v1.NimbleOpti{}
-		err = iw.ClientObj.Get(ctx, client.ObjectKey{Name: ing.Namespace, Namespace: ing.Namespace}, adapter)
-		if err != nil {
-			klog.Errorf("Failed to fetch NimbleOpti CRD: %v", err)
-			// continue
-			return err
-		}
-
-		// debug
-		klog.Infof("debug - adapter.Spec.CertificateRenewalThreshold: %v", adapter.Spec.CertificateRenewalThreshold)
-		klog.Infof("debug - time.Duration(adapter.Spec.CertificateRenewalThreshold*24)*time.Hour: %s", time.Duration(adapter.Spec.CertificateRenewalThreshold*24)*time.Hour)
-
-		// Check against CertificateRenewalThreshold
-		if timeRemaining <= time.Duration(adapter.Spec.CertificateRenewalThreshold*24)*time.Hour {
-			// debug
-			klog.Infof("Initiating certificate renewal for secret %s", secretName)
-
-			// Create a Secret object with only Name and Namespace populated.
-			deleteSecret := &corev1.Secret{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      secretName,
-					Namespace: ing.Namespace,
-				},
-			}
-
-			// Delete the secret.
-			if err := iw.ClientObj.Delete(ctx, deleteSecret); err != nil {
-				klog.Errorf("Failed to remove secret: %v", err)
-				return err
-			}
-
-			// Wait until ".well-known/acme-challenge" appears in the path of the associate ingress.
-			if err := iw.waitForAcmeChallenge(ctx, ing.Namespace, ing.Name); err != nil {
-				return err
-			}
-
-			// Start certificate renewal
-			_, err := iw.startCertificateRenewal(ctx, ing, adapter)
-			if err != nil {
-				klog.Errorf("Failed to start certificate renewal: %v", err)
-				continue
-			}
-		}
-	}
-	return nil
-}
-
-// waitForAcmeChallenge waits for the ".well-known/acme-challenge" to appear in the specified ingress's paths.
-// It uses a Kubernetes watcher to efficiently detect changes to the ingress resource.
-//
-// Parameters:
-// - ctx: context for cancellation and timeout.
-// - client: Kubernetes clientset to interact with the cluster.
-// - namespace: The namespace where the ingress is located.
-// - ingressName: The name of the ingress resource to watch.
-//
-// Returns:
-// - nil if the acme challenge appears in the ingress paths.
-// - error if the ingress gets deleted, if there's a watcher error, or if the function times out.
-func (iw *IngressWatcher) waitForAcmeChallenge(ctx context.Context, namespace string, ingressName string) error {
-	// debug
-	klog.Info("debug - waitForAcmeChallenge")
-
-	// Start watching the specified ingress for changes.
-	// watcher, err := iw.Client.Client.NetworkingV1().Ingresses(namespace).Watch(ctx, metav1.SingleObject(metav1.ObjectMeta{Name: ingressName}))
-	watcher, err := iw.Client.Watch(ctx, namespace, ingressName)
-	if err != nil {
-		return err
-	}
-	defer watcher.Stop()
-
-	// Set a timeout for safety, for example, to exit after 10 minutes if the condition doesn't become true.
-	// TODO: Make this configurable.
-	timeoutCh := time.After(10 * time.Second)
-
-	for {
-		select {
-		case event, ok := <-watcher.ResultChan():
-			if !ok {
-				return fmt.Errorf("watch channel closed")
-			}
-
-			// debug
-			klog.Infof("debug - event.Type: %v", event.Type)
-			klog.Infof("debug - event.Object: %v", event.Object)
-
-			// Handle different types of watch events.
-			switch event.Type {
-			case watch.Added, watch.Modified:
-				// Check if the updated ingress contains the ACME challenge.
-				ing, ok := event.Object.(*networkingv1.Ingress)
-				if ok && isContainsAcmeChallenge(ctx, ing) {
-					return nil
-				}
-			case watch.Deleted:
-				return fmt.Errorf("ingress deleted before acme challenge appeared")
-			case watch.Error:
-				return fmt.Errorf("error watching ingress")
-			}
-		case <-timeoutCh:
-			// Handle the case where the function times out.
-			return fmt.Errorf("timed out waiting for acme challenge")
-		case <-ctx.Done():
-			// Handle context cancellation or deadline exceed.
-			return ctx.Err()
-		}
-	}
-}
+// internal/controller/ingress_watcher.go
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/internal/operatorconfig"
+	metrics "github.com/uri-tech/nimble-opti-adapter/metrics"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+
+	errorsK8S "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"golang.org/x/time/rate"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// IngressWatcher is a structure that holds the Client for Kubernetes
+// API communication and IngressInformers for caching Ingress resources.
+type IngressWatcher struct {
+	// IngressWatcherClient IngressWatcherInterface
+	// Client               kubernetes.Interface
+	Client KubernetesClient
+	// IngressInformers holds one informer per watched namespace, or a single cluster-wide one.
+	IngressInformers []cache.SharedIndexInformer
+	ClientObj        client.Client
+	auditMutex       *utils.NamedMutex
+	Queue            workqueue.RateLimitingInterface
+	// Config holds the timings, defaults, workers, rate limits, selector and namespaces of the watcher.
+	// Once the watcher runs, read it with config and replace it with ApplyConfig.
+	Config *operatorconfig.OperatorConfig
+	// selector is the parsed Config.IngressSelector.
+	selector labels.Selector
+	// configMu protects Config and selector.
+	configMu sync.RWMutex
+	// configChanged is signalled by ApplyConfig, so Start resizes the workers and the audit interval.
+	configChanged chan struct{}
+	// inFlight tracks the renewals that removed the HTTPS annotation and did not reinstate it yet.
+	inFlight *utils.InFlight
+	// Recorder records the events on the Ingress resources, such as an invalid override annotation.
+	Recorder record.EventRecorder
+	// now returns the current time, to check the maintenance windows.
+	now func() time.Time
+	// SecretInformers holds one Secret informer per watched namespace, a changed certificate reschedules
+	// the audit of its Ingresses, see handleSecretChange. They only cache the TLS secrets, see tlsSecretFieldSelector.
+	SecretInformers []cache.SharedIndexInformer
+	// scheduled holds when the Ingresses queued for an audit are due: their next maintenance window
+	// or the crossing of their renewal threshold, see scheduleAudit.
+	scheduled map[string]time.Time
+	// thresholds holds the renewal threshold last resolved for each Ingress, see scheduleThresholdCrossing.
+	thresholds map[string]time.Duration
+	// scheduledMu protects scheduled and thresholds.
+	scheduledMu sync.Mutex
+	// suspension interrupts the renewals of a namespace when its NimbleOpti gets suspended.
+	suspension *suspension
+	// managers holds the namespaces managed from the NimbleOpti of another namespace.
+	managers *namespaceManagers
+	// degraded caps how many Ingresses are without the HTTPS annotation at the same time, in total and per namespace.
+	degraded *utils.NamespaceSemaphore
+	// namespaceRenewals runs the renewals of whole namespaces requested from their NimbleOpti.
+	namespaceRenewals *namespaceRenewals
+	// renewalOwners holds the NimbleOpti owning the NimbleOptiRenewals of each namespace.
+	renewalOwners *renewalOwners
+	// rollouts holds back the renewals of the staged policies behind their canary, see holdBackRenewal.
+	rollouts *stagedRollouts
+}
+
+// tlsSecretFieldSelector restricts the Secret informers to the secrets of type kubernetes.io/tls, those cert-manager issues.
+var tlsSecretFieldSelector = fields.OneTermEqualSelector("type", string(corev1.SecretTypeTLS)).String()
+
+// errShuttingDown is returned for work refused because the watcher is shutting down.
+var errShuttingDown = errors.New("ingress watcher is shutting down")
+
+// KubernetesClient defines methods we're interested in mocking.
+type KubernetesClient interface {
+	Watch(ctx context.Context, namespace, ingressName string) (watch.Interface, error)
+}
+
+// RealKubernetesClient is a structure that holds the Client for Kubernetes.
+type RealKubernetesClient struct {
+	kubernetes.Interface
+}
+
+// Watch implements the KubernetesClient interface.
+func (r *RealKubernetesClient) Watch(ctx context.Context, namespace, ingressName string) (watch.Interface, error) {
+	// debug
+	klog.Info("debug - RealKubernetesClient.Watch")
+
+	opts := metav1.SingleObject(metav1.ObjectMeta{Name: ingressName})
+	return r.NetworkingV1().Ingresses(namespace).Watch(ctx, opts)
+}
+
+// NewIngressWatcher initializes a new IngressWatcher and its IngressInformers for caching Ingress resources.
+// The informers are started by the manager, see SetupWithManager.
+// A nil operatorCfg uses operatorconfig.Default(). When its WatchNamespaces is not empty
+// the informers and every list call are restricted to them.
+func NewIngressWatcher(clientKube kubernetes.Interface, operatorCfg *operatorconfig.OperatorConfig) (*IngressWatcher, error) {
+	// debug
+	klog.Info("debug - NewIngressWatcher")
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		klog.Fatalf("unable to get config %v", err)
+		return nil, err
+	}
+
+	// Create a new scheme for decoding into.
+	scheme := runtime.NewScheme()
+	// NimbleOpti is read and written in its storage version v2.
+	if err := v2.AddToScheme(scheme); err != nil {
+		klog.Fatalf("unable to add v2 scheme %v", err)
+		return nil, err
+	}
+
+	// Add client-go's scheme for core Kubernetes types
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		klog.Fatalf("unable to add client-go scheme %v", err)
+		// setupLog.Error(err, "unable to add client-go scheme")
+		return nil, err
+	}
+
+	// Create a new client to Kubernetes API.
+	cl, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		klog.Fatalf("unable to create client %v", err)
+		return nil, err
+	}
+
+	if operatorCfg == nil {
+		operatorCfg = operatorconfig.Default()
+	}
+	if err := operatorCfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	iw := &IngressWatcher{
+		Client:     &RealKubernetesClient{clientKube},
+		ClientObj:  cl,
+		auditMutex: utils.NewNamedMutex(),
+		Queue:      workqueue.NewNamedRateLimitingQueue(newRateLimiter(operatorCfg.RateLimit), "IngressQueue"),
+		Config:     operatorCfg,
+		selector:   operatorCfg.Selector(),
+		inFlight:   utils.NewInFlight(),
+		Recorder:   &record.FakeRecorder{},
+		now:        time.Now,
+		scheduled:  map[string]time.Time{},
+		thresholds: map[string]time.Duration{},
+		suspension: newSuspension(),
+		managers:   newNamespaceManagers(),
+		degraded:   utils.NewNamespaceSemaphore(operatorCfg.MaxDegradedIngresses, operatorCfg.MaxDegradedIngressesPerNamespace),
+
+		namespaceRenewals: newNamespaceRenewals(),
+		renewalOwners:     newRenewalOwners(),
+		rollouts:          newStagedRollouts(),
+		configChanged:     make(chan struct{}, 1),
+	}
+
+	// Setup one informer per watched namespace, so no cluster-wide list or watch is needed.
+	// The informers only enqueue keys, the queue is processed by the leader.
+	for _, ns := range iw.watchedNamespaces() {
+		informerFactory := informers.NewSharedInformerFactoryWithOptions(clientKube, 0, informers.WithNamespace(ns))
+		informer := informerFactory.Networking().V1().Ingresses().Informer()
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				key, err := cache.MetaNamespaceKeyFunc(obj) // it like ingressKey
+
+				// debug
+				klog.Infof("debug - AddFunc - key: %s", key)
+
+				if err != nil {
+					klog.ErrorS(err, "Failed to get MetaNamespaceKey")
+					return
+				}
+				iw.Queue.Add(key)
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				// Only a new renewal request needs the Ingress processed again.
+				if renewRequestToken(oldObj) == renewRequestToken(newObj) {
+					return
+				}
+				key, err := cache.MetaNamespaceKeyFunc(newObj)
+				if err != nil {
+					klog.ErrorS(err, "Failed to get MetaNamespaceKey")
+					return
+				}
+				iw.Queue.Add(key)
+			},
+		})
+		if err := informer.AddIndexers(cache.Indexers{tlsSecretIndex: indexTLSSecrets}); err != nil {
+			return nil, err
+		}
+		iw.IngressInformers = append(iw.IngressInformers, informer)
+
+		// A deleted secret is replaced by cert-manager, its new certificate reschedules the Ingresses.
+		// Only the TLS secrets are cached, not every Secret of the namespace, or of the cluster when not restricted.
+		secretFactory := informers.NewSharedInformerFactoryWithOptions(clientKube, 0, informers.WithNamespace(ns),
+			informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.FieldSelector = tlsSecretFieldSelector
+			}))
+		secretInformer := secretFactory.Core().V1().Secrets().Informer()
+		secretInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if secret, ok := obj.(*corev1.Secret); ok {
+					iw.handleSecretChange(secret)
+				}
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldSecret, ok := oldObj.(*corev1.Secret)
+				newSecret, ok2 := newObj.(*corev1.Secret)
+				if !ok || !ok2 || bytes.Equal(oldSecret.Data[corev1.TLSCertKey], newSecret.Data[corev1.TLSCertKey]) {
+					return
+				}
+				iw.handleSecretChange(newSecret)
+			},
+		})
+		iw.SecretInformers = append(iw.SecretInformers, secretInformer)
+	}
+
+	return iw, nil
+}
+
+// handleIngressAdd is called when an Ingress resource is added.
+func (iw *IngressWatcher) handleIngressAdd(ctx context.Context, ing *networkingv1.Ingress) error {
+	// debug
+	klog.Info("debug - handleIngressAdd")
+
+	// If "nimble.opti.adapter/enabled" label is true, process it.
+	if !iw.isAdapterEnabledLabel(ctx, ing) || !isBackendHttpsAnnotations(ctx, ing) {
+		return nil
+	}
+
+	pol, err := iw.resolvePolicy(ctx, ing)
+	if err != nil {
+		return err
+	}
+	if pol.Skip {
+		klog.Infof("Skipping ingress %s, it has %s set", utils.IngressKey(ing), policy.SkipAnnotation)
+		return nil
+	}
+	if pol.Suspended {
+		iw.reportSuspended(ctx, ing, pol, false)
+		return nil
+	}
+
+	// A pending on-demand request runs a forced renewal instead of the regular one.
+	if handled, err := iw.handleRenewRequest(ctx, ing, pol); handled || err != nil {
+		return err
+	}
+
+	ctx = withRenewalTrigger(ctx, v2.RenewalTriggerEvent)
+	if _, err := iw.processIngressForRenewal(ctx, ing, pol); err != nil {
+		klog.Errorf("error processing ingress. %v", err)
+		return err
+	}
+
+	// The certificates are renewed by the audit scheduled when they cross the renewal threshold.
+	iw.scheduleThresholdCrossing(ctx, ing, pol)
+
+	return nil
+}
+
+// newRateLimiter returns the rate limiter of the Ingress queue: a per-item exponential backoff
+// combined with an overall token bucket, like workqueue.DefaultControllerRateLimiter.
+func newRateLimiter(rl operatorconfig.RateLimit) workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(rl.BaseDelay.Duration, rl.MaxDelay.Duration),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(rl.QPS), rl.Burst)},
+	)
+}
+
+// section 2
+
+// isAdapterEnabledLabel checks if the Ingress matches the configured selector,
+// by default the "nimble.opti.adapter/enabled" label set to "true".
+func (iw *IngressWatcher) isAdapterEnabledLabel(ctx context.Context, ing *networkingv1.Ingress) bool {
+	// debug
+	klog.Info("debug - isAdapterEnabledLabel")
+
+	iw.configMu.RLock()
+	defer iw.configMu.RUnlock()
+	return iw.selector.Matches(labels.Set(ing.Labels))
+}
+
+// isBackendHttpsAnnotations checks if the "nginx.ingress.kubernetes.io/backend-protocol" annotation is present and set to "HTTPS".
+func isBackendHttpsAnnotations(ctx context.Context, ing *networkingv1.Ingress) bool {
+	// debug
+	klog.Info("debug - isBackendHttpsAnnotations")
+
+	val, ok := ing.Annotations[backendProtocolAnnotation]
+
+	return ok && val == "HTTPS"
+}
+
+// processIngressForRenewal return true if it renew the certificate.
+// pol is the renewal policy of the ingress, see resolvePolicy.
+func (iw *IngressWatcher) processIngressForRenewal(ctx context.Context, ing *networkingv1.Ingress, pol policy.Policy) (bool, error) {
+	// debug
+	klog.Info("debug  - processIngressForRenewal")
+
+	// indicate if make ceartificate renewal process
+	makeRenewal := false
+
+	// debug
+	klog.Infof("policy: %+v", pol)
+
+	// Scan for any path in spec.rules[].http.paths[].path containing .well-known/acme-challenge.
+	if isContainsAcmeChallenge(ctx, ing) {
+		// Outside of the maintenance windows the challenge waits, unless a certificate is about to expire.
+		if pol.Schedule != nil {
+			remaining, known := iw.timeUntilExpiry(ctx, ing)
+			if iw.deferRenewal(ing, pol, remaining, known) {
+				return false, nil
+			}
+		}
+
+		// The Ingresses of a staged policy wait for its canary.
+		if held, err := iw.holdBackRenewal(ctx, ing); held || err != nil {
+			return false, err
+		}
+
+		// Trigger the certificate renewal process.
+		renewCtx, attempt := iw.beginRenewal(ctx, ing, pol, nil)
+		isRenew, err := iw.startCertificateRenewal(renewCtx, ing, pol)
+		iw.finishRenewal(ctx, ing, attempt, isRenew, err)
+		iw.rollouts.done(ing, isRenew && err == nil)
+		if err != nil {
+			klog.Errorf("Failed to start certificate renewal: %v", err)
+			return false, err
+		}
+		makeRenewal = isRenew
+	}
+
+	return makeRenewal, nil
+}
+
+// isAcmeChallengePath checks if the given path contains the ACME challenge string.
+func isAcmeChallengePath(ctx context.Context, p string) bool {
+	// debug
+	klog.Info("debug - isAcmeChallengePath")
+
+	const acmeChallengePath = ".well-known/acme-challenge"
+
+	return strings.Contains(p, acmeChallengePath)
+}
+
+// isContainsAcmeChallenge checks if the given ingress contains any ACME challenge paths.
+func isContainsAcmeChallenge(ctx context.Context, ing *networkingv1.Ingress) bool {
+	// debug
+	klog.Info("debug - isContainsAcmeChallenge")
+
+	for _, rule := range ing.Spec.Rules {
+		for _, path := range rule.IngressRuleValue.HTTP.Paths {
+			if isAcmeChallengePath(ctx, path.Path) {
+				klog.Infof("Found %s in path %s", ".well-known/acme-challenge", path.Path)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getOrCreateNimbleOpti gets or creates a v2.NimbleOpti CRD in the same namespace as the Ingress.
+// The created NimbleOpti sets no duration, so it inherits the ClusterNimbleOpti and the operator defaults.
+// It returns nil without error when there is none and cluster disables the creation, or the namespace
+// was released by the deletion of its NimbleOpti, see markNamespaceReleased.
+func (iw *IngressWatcher) getOrCreateNimbleOpti(ctx context.Context, namespace string, cluster *v2.ClusterNimbleOpti) (*v2.NimbleOpti, error) {
+	// debug
+	klog.Info("debug - getOrCreateNimbleOpti")
+
+	nimbleOpti := &v2.NimbleOpti{}
+	key := types.NamespacedName{
+		Namespace: namespace,
+		Name:      namespace,
+	}
+
+	if err := iw.ClientObj.Get(ctx, key, nimbleOpti); err != nil {
+		if errorsK8S.IsNotFound(err) {
+			if cluster != nil && cluster.Spec.DisableNimbleOptiCreation {
+				return nil, nil
+			}
+			if released, err := iw.namespaceReleased(ctx, namespace); err != nil || released {
+				return nil, err
+			}
+
+			// debug
+			klog.Info("debug - create NimbleOpti")
+
+			nimbleOpti = &v2.NimbleOpti{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      namespace,
+					Namespace: namespace,
+				},
+				Spec: v2.NimbleOptiSpec{
+					TargetNamespace: namespace,
+				},
+			}
+
+			if err := iw.ClientObj.Create(ctx, nimbleOpti); err != nil {
+				klog.ErrorS(err, "Failed to create NimbleOpti", "namespace", namespace)
+				return nil, err
+			}
+			// debug
+			klog.Info("debug - create NimbleOpti done")
+
+		} else {
+			klog.ErrorS(err, "Failed to get NimbleOpti", "namespace", namespace)
+			return nil, err
+		}
+	}
+
+	return nimbleOpti, nil
+}
+
+// hasIngressChanged checks if the important parts of the Ingress have changed.
+func hasIngressChanged(ctx context.Context, oldIng *networkingv1.Ingress, newIng *networkingv1.Ingress) bool {
+	// debug
+	klog.Info("debug - hasIngressChanged")
+
+	// Check for changes in the spec.rules configurations
+	if !reflect.DeepEqual(oldIng.Spec.Rules, newIng.Spec.Rules) {
+		klog.Info("Ingress spec.rules configuration has changed")
+		return true
+	}
+
+	return false
+}
+
+// startCertificateRenewal get ingress that has "".well-known/acme-challenge" and resolve it.
+func (iw *IngressWatcher) startCertificateRenewal(ctx context.Context, ing *networkingv1.Ingress, pol policy.Policy) (bool, error) {
+	// debug
+	klog.Info("debug - startCertificateRenewal")
+
+	var isRenew = false
+
+	// Wait for a free slot, so only a bounded number of Ingresses are without the HTTPS annotation at once.
+	// Once the annotation is removed, the slot is held until it is reinstated, see endRenewal.
+	if err := iw.degraded.Acquire(ctx, ing.Namespace); err != nil {
+		klog.Errorf("Failed to wait for a degraded slot: %v", err)
+		return false, err
+	}
+
+	// The namespace may have been suspended while waiting, never remove the annotation then.
+	key := utils.IngressKey(ing)
+	if iw.suspension.isSuspended(ing.Namespace) {
+		iw.degraded.Release(ing.Namespace)
+		klog.Infof("Not starting the renewal of ingress %s, its namespace is suspended", key)
+		iw.Recorder.Event(ing, corev1.EventTypeNormal, reasonRenewalSuspended, "Renewal skipped, the NimbleOpti of the namespace is suspended")
+		return false, errRenewalSuspended
+	}
+
+	// Register the renewal with the pre-renewal annotations, so a shutdown can restore them if it cannot finish.
+	original := map[string]string{}
+	if val, ok := ing.Annotations[backendProtocolAnnotation]; ok {
+		original[backendProtocolAnnotation] = val
+	}
+	if !iw.inFlight.Begin(key, original) {
+		iw.degraded.Release(ing.Namespace)
+		return false, errShuttingDown
+	}
+	attempt := renewalAttemptFrom(ctx)
+	start := time.Now()
+
+	// Remove the annotation.
+	if err := iw.removeHTTPSAnnotation(ctx, ing); err != nil {
+		klog.Errorf("Failed to remove HTTPS annotation: %v", err)
+		iw.endRenewal(key)
+		return false, err
+	}
+	iw.setRenewalPhase(ctx, attempt, v2.NimbleOptiRenewalAnnotationsSuspended)
+
+	// Wait for the absence of the ACME challenge path or for the timeout.
+	// Suspending the namespace interrupts the wait, the annotation is then reinstated.
+	timeout := pol.ChallengeClearTimeout
+	iw.setRenewalPhase(ctx, attempt, v2.NimbleOptiRenewalChallengeInProgress)
+	waitCtx, stop := iw.suspension.context(ctx, ing.Namespace)
+	successTime, err := iw.waitForChallengeAbsence(waitCtx, timeout, pol.PollInterval, ing.Namespace, ing.Name)
+	if waitCtx.Err() != nil && ctx.Err() == nil {
+		klog.Warningf("Interrupting the renewal of ingress %s, its namespace was suspended", key)
+		iw.Recorder.Event(ing, corev1.EventTypeWarning, reasonRenewalSuspended, "Renewal interrupted, the NimbleOpti of the namespace is suspended")
+		err = errRenewalSuspended
+	}
+	stop()
+	attempt.phase(phaseChallengeClear, start)
+	if err != nil {
+		klog.Errorf("Failed to wait for the absence of ACME challenge path: %v", err)
+		// Never leave the ingress without its annotation, reinstate it before returning.
+		iw.setRenewalPhase(ctx, attempt, v2.NimbleOptiRenewalRestoring)
+		if addErr := iw.reinstateHTTPSAnnotation(ctx, ing); addErr != nil {
+			klog.Errorf("Failed to add HTTPS annotation: %v", addErr)
+		} else {
+			iw.endRenewal(key)
+		}
+		return false, err
+	}
+	if successTime > timeout {
+		klog.Warningln("Failed to confirm the absence of ACME challenge path before timeout.")
+	}
+
+	// log the duration (in seconds) of annotation updates during each renewal
+	if successTime == timeout*2 {
+		klog.Infof("Annotation update duration: %v", timeout)
+		metrics.RecordAnnotationUpdateDuration(timeout.Seconds())
+	} else {
+		klog.Infof("Annotation update duration: %v", successTime)
+		metrics.RecordAnnotationUpdateDuration(successTime.Seconds())
+		isRenew = true
+	}
+
+	// Reinstate the annotation. When it fails the renewal stays in flight, holding its degraded slot,
+	// and is restored on shutdown.
+	start = time.Now()
+	iw.setRenewalPhase(ctx, attempt, v2.NimbleOptiRenewalRestoring)
+	err = iw.reinstateHTTPSAnnotation(ctx, ing)
+	attempt.phase(phaseAnnotationRestore, start)
+	if err != nil {
+		klog.Errorf("Failed to add HTTPS annotation: %v", err)
+		return isRenew, err
+	}
+	iw.endRenewal(key)
+
+	// Increment the certificate renewals counter.
+	if successTime <= timeout {
+		metrics.IncrementCertificateRenewals()
+	}
+
+	return isRenew, nil
+}
+
+// reinstateHTTPSAnnotation adds the HTTPS annotation back to ing. Once ctx is done it uses a fresh context bounded by
+// annotationRestoreTimeout, a cancelled renewal must never leave the Ingress without its HTTPS annotation.
+func (iw *IngressWatcher) reinstateHTTPSAnnotation(ctx context.Context, ing *networkingv1.Ingress) error {
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), annotationRestoreTimeout)
+		defer cancel()
+	}
+	return iw.addHTTPSAnnotation(ctx, ing)
+}
+
+// endRenewal ends the renewal of the Ingress key once its annotations are reinstated, freeing its degraded slot.
+func (iw *IngressWatcher) endRenewal(key string) {
+	namespace, _, _ := cache.SplitMetaNamespaceKey(key)
+	iw.inFlight.End(key)
+	iw.degraded.Release(namespace)
+}
+
+// waitForChallengeAbsence waits for the absence of the ACME challenge path in the Ingress or until a timeout is reached.
+// The Ingress is checked every interval. Returns the time it took to renew(timeout*2 when it failed) or there is an error.
+func (iw *IngressWatcher) waitForChallengeAbsence(ctx context.Context, timeout, interval time.Duration, ingNamespace, ingName string) (time.Duration, error) {
+	// debug
+	klog.Info("Starting waitForChallengeAbsence")
+
+	// Capture the start time
+	startTime := time.Now()
+
+	// Create a child context with the specified timeout
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel() // Ensure resources are cleaned up after timeout or successful completion
+
+	for {
+		select {
+		case <-timeoutCtx.Done():
+			klog.Info("Timeout reached or context cancelled. Stopping.")
+			return timeout * 2, nil
+		default:
+			// debug
+			klog.Info("debug - Checking Ingress")
+
+			// Get the Ingress
+			ingress := &networkingv1.Ingress{}
+			if err := iw.ClientObj.Get(timeoutCtx, client.ObjectKey{Name: ingName, Namespace: ingNamespace}, ingress); err != nil {
+				klog.ErrorS(err, "Error fetching ingress")
+				elapsedTime := time.Since(startTime)
+				return elapsedTime, err
+			}
+
+			// Check all paths of the Ingress for the ACME challenge path
+			pathFound := false
+			for _, rule := range ingress.Spec.Rules {
+				for _, pathType := range rule.HTTP.Paths {
+					if strings.Contains(pathType.Path, ".well-known/acme-challenge") {
+						// debug
+						klog.Info("debug - ACME challenge path found")
+
+						pathFound = true
+						break
+					}
+				}
+				if pathFound {
+					break
+				}
+			}
+
+			if !pathFound {
+				// debug
+				klog.Info("ACME challenge path not found. Stopping.")
+
+				// If we reach here, the ACME challenge path was not found in any rule
+				elapsedTime := time.Since(startTime)
+				return elapsedTime, nil // Return the elapsed time on success
+			}
+
+			// Wait for the poll interval to prevent high CPU usage
+			select {
+			case <-time.After(interval):
+			case <-timeoutCtx.Done():
+			}
+		}
+	}
+}
+
+// auditIngressResources audits all Ingress with the label "nimble.opti.adapter/enabled:true".
+// The certificates due for renewal are not renewed at once, their renewals are spread evenly across the
+// audit interval, see scheduleRenewalSlots. The renewals of a staged policy wait for its canary, see holdBackRenewal.
+// Failing ingresses and held back policies are returned as a utilerrors.Aggregate.
+func (iw *IngressWatcher) auditIngressResources(ctx context.Context) error {
+	// debug
+	klog.Info("debug - auditIngressResources")
+
+	// Fetch all Ingress resources of the watched namespaces
+	ingresses, err := iw.listIngresses(ctx)
+	if err != nil {
+		klog.Errorf("Failed to list ingresses: %v", err)
+		return err
+	}
+
+	// Iterate through all Ingress resources. A failing ingress does not stop the audit,
+	// its error is collected and returned together with the others.
+	var errs []error
+	auditTime := iw.now()
+	audits := map[string]*namespaceAudit{}
+	iw.rollouts.reset()
+	ctx, slots := withRenewalSlots(ctx)
+	for i := range ingresses.Items {
+		// Stop taking new ingresses once a shutdown started.
+		if iw.inFlight.Draining() {
+			errs = append(errs, fmt.Errorf("%d ingresses not audited: %w", len(ingresses.Items)-i, errShuttingDown))
+			break
+		}
+		ing := &ingresses.Items[i]
+		auditErr := iw.auditIngress(ctx, ing)
+		if auditErr != nil {
+			errs = append(errs, fmt.Errorf("ingress %s: %w", utils.IngressKey(ing), auditErr))
+		}
+		if audits[ing.Namespace] == nil {
+			audits[ing.Namespace] = &namespaceAudit{}
+		}
+		iw.addIngress(ctx, audits[ing.Namespace], ing, auditErr)
+	}
+	if len(errs) > 0 {
+		klog.Errorf("Failed to audit %d of %d ingresses", len(errs), len(ingresses.Items))
+	}
+	errs = append(errs, iw.rollouts.errs()...)
+
+	// A shutdown leaves the due renewals to the next leader.
+	if !iw.inFlight.Draining() {
+		iw.scheduleRenewalSlots(slots)
+	}
+
+	// A partial audit would undercount, the status keeps the last complete one.
+	// The status is informative only, failing to record it does not fail the audit.
+	if !iw.inFlight.Draining() {
+		if err := iw.updateAuditStatus(ctx, audits, auditTime); err != nil {
+			klog.Errorf("Failed to record the audit in the NimbleOpti status: %v", err)
+		}
+	}
+
+	// NewAggregate returns nil when there are no errors.
+	return utilerrors.NewAggregate(errs)
+}
+
+// watchedNamespaces returns the namespaces to watch and list, metav1.NamespaceAll when not restricted.
+func (iw *IngressWatcher) watchedNamespaces() []string {
+	namespaces := iw.config().WatchNamespaces
+	if len(namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return namespaces
+}
+
+// config returns the current configuration of the watcher.
+func (iw *IngressWatcher) config() *operatorconfig.OperatorConfig {
+	iw.configMu.RLock()
+	defer iw.configMu.RUnlock()
+	return iw.Config
+}
+
+// ApplyConfig replaces the configuration of the running watcher. The defaults, the timings and
+// the selector apply to the next Ingress processed, the workers and the audit interval are resized by Start.
+// cfg must be valid and keep the keys that need a restart, see operatorconfig.CheckReload.
+func (iw *IngressWatcher) ApplyConfig(cfg *operatorconfig.OperatorConfig) {
+	iw.configMu.Lock()
+	iw.Config = cfg
+	iw.selector = cfg.Selector()
+	iw.configMu.Unlock()
+	iw.degraded.SetLimits(cfg.MaxDegradedIngresses, cfg.MaxDegradedIngressesPerNamespace)
+
+	select {
+	case iw.configChanged <- struct{}{}:
+	default:
+		// A change is already pending, Start reads the latest config.
+	}
+}
+
+// listIngresses lists the Ingress resources of every watched namespace.
+func (iw *IngressWatcher) listIngresses(ctx context.Context) (*networkingv1.IngressList, error) {
+	ingresses := &networkingv1.IngressList{}
+	for _, ns := range iw.watchedNamespaces() {
+		list := &networkingv1.IngressList{}
+		if err := iw.ClientObj.List(ctx, list, client.InNamespace(ns)); err != nil {
+			return nil, fmt.Errorf("listing ingresses in namespace %q: %w", ns, err)
+		}
+		ingresses.Items = append(ingresses.Items, list.Items...)
+	}
+	return ingresses, nil
+}
+
+// auditIngress audits a single Ingress and renews its certificate if necessary.
+func (iw *IngressWatcher) auditIngress(ctx context.Context, ing *networkingv1.Ingress) error {
+	// check if the ingress is labeled with the label "nimble.opti.adapter/enabled:true"
+	if !iw.isAdapterEnabledLabel(ctx, ing) || !isBackendHttpsAnnotations(ctx, ing) {
+		return nil
+	}
+	ctx = withRenewalTrigger(ctx, v2.RenewalTriggerAudit)
+
+	pol, err := iw.resolvePolicy(ctx, ing)
+	if err != nil {
+		return err
+	}
+	if pol.Skip {
+		klog.Infof("Skipping ingress %s, it has %s set", utils.IngressKey(ing), policy.SkipAnnotation)
+		return nil
+	}
+	if pol.Suspended {
+		iw.reportSuspended(ctx, ing, pol, true)
+		return nil
+	}
+
+	// A pending on-demand request runs a forced renewal instead of the regular one.
+	if handled, err := iw.handleRenewRequest(ctx, ing, pol); handled || err != nil {
+		return err
+	}
+
+	// process the ingress
+	isRenew, err := iw.processIngressForRenewal(ctx, ing, pol)
+	if err != nil {
+		klog.Errorf("Failed to process ingress: %v", err)
+		return err
+	}
+
+	// With the challenge-only strategy the secrets are never touched.
+	if !isRenew && pol.Strategy != policy.StrategyChallengeOnly {
+		// The operator fetches the associated Secret referenced in `spec.tls[].secretName` for each tls[],
+		//  calculates the remaining time until certificate expiry and checks it against the `CertificateRenewalThreshold` specified in the `NimbleOpti` CRD.
+		// If the certificate is due to expire within or on the threshold, certificate renewal is initiated.
+		if err := iw.renewValidCertificateIfNecessary(ctx, ing, pol); err != nil {
+			klog.Errorf("Error renewing certificate for ingress %s: %v", ing.Name, err)
+			return err
+		}
+	}
+
+	// Audit again when the certificates cross the renewal threshold, instead of waiting for the next audit.
+	iw.scheduleThresholdCrossing(ctx, ing, pol)
+
+	return nil
+}
+
+// move on all the secret connected to the ingress and renew the certificate if necessary.
+// A certificate due for renewal gets its secret deleted, or renamed with the secret-rename strategy.
+func (iw *IngressWatcher) renewValidCertificateIfNecessary(ctx context.Context, ing *networkingv1.Ingress, pol policy.Policy) error {
+	// debug
+	klog.Info("debug - renewValidCertificateIfNecessary")
+
+	// The threshold of the ingress within the renewal spread of the policy.
+	threshold := pol.Threshold(utils.IngressKey(ing))
+
+	// Iterate over spec.tls[] to fetch associated secrets
+	for _, tlsSpec := range ing.Spec.TLS {
+		secretName := tlsSpec.SecretName
+
+		cert, err := iw.secretCertificate(ctx, ing.Namespace, secretName)
+		if err != nil {
+			return err
+		}
+
+		// Calculate remaining duration until certificate expiry
+		timeRemaining := cert.NotAfter.Sub(time.Now())
+
+		// debug
+		klog.Infof("debug - timeRemaining: %v", timeRemaining)
+
+		// debug
+		klog.Infof("debug - threshold: %v", threshold)
+
+		// Check against the renewal threshold of the policy
+		if timeRemaining <= threshold {
+			// Outside of the maintenance windows the renewal waits, unless the certificate is about to expire.
+			if iw.deferRenewal(ing, pol, timeRemaining, true) {
+				continue
+			}
+			// During an audit of every Ingress, the renewal waits for its slot, the other secrets too.
+			if slots := renewalSlotsFrom(ctx); slots != nil {
+				slots.add(utils.IngressKey(ing), cert.NotAfter)
+				return nil
+			}
+			// The budget is shared by the secrets of the ingress, the others wait too.
+			if iw.deferForAcmeBudget(ctx, ing) {
+				return nil
+			}
+			// So does the canary of a staged policy.
+			if held, err := iw.holdBackRenewal(ctx, ing); held || err != nil {
+				return err
+			}
+
+			// debug
+			klog.Infof("Initiating certificate renewal for secret %s", secretName)
+
+			renewCtx, attempt := iw.beginRenewal(ctx, ing, pol, []string{secretName})
+			if err := iw.replaceSecret(renewCtx, ing, pol, secretName); err != nil {
+				iw.finishRenewal(ctx, ing, attempt, false, err)
+				iw.rollouts.done(ing, false)
+				return err
+			}
+
+			// Start certificate renewal
+			isRenew, err := iw.startCertificateRenewal(renewCtx, ing, pol)
+			iw.finishRenewal(ctx, ing, attempt, isRenew, err)
+			iw.rollouts.done(ing, isRenew && err == nil)
+			if err != nil {
+				klog.Errorf("Failed to start certificate renewal: %v", err)
+				continue
+			}
+		}
+	}
+	return nil
+}
+
+// secretCertificate returns the certificate stored under "tls.crt" of the secret, in PEM or DER format.
+func (iw *IngressWatcher) secretCertificate(ctx context.Context, namespace, secretName string) (*x509.Certificate, error) {
+	// Fetch the secret
+	secret := &corev1.Secret{}
+	err := iw.ClientObj.Get(ctx, client.ObjectKey{Name: secretName, Namespace: namespace}, secret)
+	if err != nil {
+		klog.Errorf("Failed to fetch secret %s: %v", secretName, err)
+		return nil, err
+	}
+	return certificateFromSecret(secret)
+}
+
+// cachedSecretCertificate returns the certificate of the secret from the Secret informers,
+// without calling the API server. A secret missing from the caches is reported as not found.
+func (iw *IngressWatcher) cachedSecretCertificate(namespace, secretName string) (*x509.Certificate, error) {
+	key := namespace + "/" + secretName
+	for _, informer := range iw.SecretInformers {
+		obj, exists, err := informer.GetIndexer().GetByKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if secret, ok := obj.(*corev1.Secret); exists && ok {
+			return certificateFromSecret(secret)
+		}
+	}
+	return nil, errorsK8S.NewNotFound(corev1.Resource("secrets"), secretName)
+}
+
+// certificateFromSecret returns the certificate stored under "tls.crt" of secret, in PEM or DER format.
+func certificateFromSecret(secret *corev1.Secret) (*x509.Certificate, error) {
+	secretName := secret.Name
+
+	// Extract the certificate from the secret. Assuming it's stored under the key "tls.crt"
+	certData, ok := secret.Data["tls.crt"]
+	if !ok {
+		klog.Errorf("Secret %s does not have tls.crt", secretName)
+		return nil, errors.New("missing tls.crt in secret")
+	}
+
+	// Check if the certificate is in PEM or DER format
+	var certDER []byte
+	if strings.Contains(string(certData), "-----BEGIN CERTIFICATE-----") {
+		// debug
+		klog.Info("debug - secretCertificate - PEM format")
+
+		// Decode PEM to get the DER-encoded certificate
+		block, _ := pem.Decode(certData)
+		if block == nil || block.Type != "CERTIFICATE" {
+			klog.Errorf("Failed to decode PEM block from secret %s", secretName)
+			return nil, errors.New("failed to decode PEM block")
+		}
+		certDER = block.Bytes
+	} else {
+		// debug
+		klog.Info("debug - secretCertificate - DER format")
+
+		// Assume it's DER format
+		certDER = certData
+	}
+
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		klog.Errorf("Failed to parse certificate from secret %s: %v", secretName, err)
+		return nil, err
+	}
+	return cert, nil
+}
+
+// replaceSecret makes cert-manager issue a new certificate for secretName: the secret is deleted,
+// or renamed with the secret-rename strategy. It then waits for the ACME challenge to appear in ing.
+func (iw *IngressWatcher) replaceSecret(ctx context.Context, ing *networkingv1.Ingress, pol policy.Policy, secretName string) error {
+	attempt := renewalAttemptFrom(ctx)
+	start := time.Now()
+	if pol.RenamesSecrets() {
+		// Point the ingress at a new secret, the old one is kept.
+		if err := iw.renameIngressSecret(ctx, ing, secretName); err != nil {
+			klog.Errorf("Failed to rename secret: %v", err)
+			return err
+		}
+	} else {
+		// Create a Secret object with only Name and Namespace populated.
+		deleteSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      secretName,
+				Namespace: ing.Namespace,
+			},
+		}
+
+		// Delete the secret.
+		if err := iw.ClientObj.Delete(ctx, deleteSecret); err != nil {
+			klog.Errorf("Failed to remove secret: %v", err)
+			return err
+		}
+	}
+
+	attempt.phase(phaseSecretReplace, start)
+
+	// Wait until ".well-known/acme-challenge" appears in the path of the associate ingress.
+	start = time.Now()
+	err := iw.waitForAcmeChallenge(ctx, pol.ChallengeAppearTimeout, ing.Namespace, ing.Name)
+	attempt.phase(phaseChallengeAppear, start)
+	return err
+}
+
+// waitForAcmeChallenge waits for the ".well-known/acme-challenge" to appear in the specified ingress's paths.
+// It uses a Kubernetes watcher to efficiently detect changes to the ingress resource.
+//
+// Parameters:
+// - ctx: context for cancellation and timeout.
+// - client: Kubernetes clientset to interact with the cluster.
+// - timeout: how long to wait for the acme challenge.
+// - namespace: The namespace where the ingress is located.
+// - ingressName: The name of the ingress resource to watch.
+//
+// Returns:
+// - nil if the acme challenge appears in the ingress paths.
+// - error if the ingress gets deleted, if there's a watcher error, or if the function times out.
+func (iw *IngressWatcher) waitForAcmeChallenge(ctx context.Context, timeout time.Duration, namespace string, ingressName string) error {
+	// debug
+	klog.Info("debug - waitForAcmeChallenge")
+
+	// Start watching the specified ingress for changes.
+	// watcher, err := iw.Client.Client.NetworkingV1().Ingresses(namespace).Watch(ctx, metav1.SingleObject(metav1.ObjectMeta{Name: ingressName}))
+	watcher, err := iw.Client.Watch(ctx, namespace, ingressName)
+	if err != nil {
+		return err
+	}
+	defer watcher.Stop()
+
+	// Set a timeout for safety, to exit if the condition doesn't become true.
+	timeoutCh := time.After(timeout)
+
+	for {
+		select {
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return fmt.Errorf("watch channel closed")
+			}
+
+			// debug
+			klog.Infof("debug - event.Type: %v", event.Type)
+			klog.Infof("debug - event.Object: %v", event.Object)
+
+			// Handle different types of watch events.
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				// Check if the updated ingress contains the ACME challenge.
+				ing, ok := event.Object.(*networkingv1.Ingress)
+				if ok && isContainsAcmeChallenge(ctx, ing) {
+					return nil
+				}
+			case watch.Deleted:
+				return fmt.Errorf("ingress deleted before acme challenge appeared")
+			case watch.Error:
+				return fmt.Errorf("error watching ingress")
+			}
+		case <-timeoutCh:
+			// Handle the case where the function times out.
+			return fmt.Errorf("timed out waiting for acme challenge")
+		case <-ctx.Done():
+			// Handle context cancellation or deadline exceed.
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// internal/controller/ingress_watcher_runnable.go
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// maxIngressRetries is the number of times a failing Ingress key is requeued before it is dropped.
+	maxIngressRetries = 5
+	// annotationRestoreTimeout bounds the restore of the annotations of one interrupted renewal on shutdown.
+	annotationRestoreTimeout = 10 * time.Second
+)
+
+// ingressInformerRunnable runs the Ingress and Secret informers on every replica, so a new leader starts with warm caches.
+type ingressInformerRunnable struct {
+	iw *IngressWatcher
+}
+
+// Start runs the informers until ctx is done.
+func (r *ingressInformerRunnable) Start(ctx context.Context) error {
+	for _, informer := range r.iw.IngressInformers {
+		go informer.Run(ctx.Done())
+	}
+	for _, informer := range r.iw.SecretInformers {
+		go informer.Run(ctx.Done())
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// NeedLeaderElection returns false, the informers only read and run on every replica.
+func (r *ingressInformerRunnable) NeedLeaderElection() bool {
+	return false
+}
+
+// SetupWithManager adds the IngressWatcher to the manager. The informers run on every replica,
+// while the queue workers and the audits, which mutate Ingresses, only run on the leader.
+func (iw *IngressWatcher) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.Add(&ingressInformerRunnable{iw: iw}); err != nil {
+		return fmt.Errorf("adding the ingress informers: %w", err)
+	}
+	if err := mgr.Add(iw); err != nil {
+		return fmt.Errorf("adding the ingress watcher: %w", err)
+	}
+	return nil
+}
+
+// NeedLeaderElection returns true, only the leader audits and renews certificates.
+func (iw *IngressWatcher) NeedLeaderElection() bool {
+	return true
+}
+
+// Start processes the queued Ingress keys and audits daily all Ingress resources
+// with the label "nimble.opti.adapter/enabled=true" until ctx is done.
+// The manager calls it once this replica is elected leader.
+// A config applied with ApplyConfig resizes the workers and the audit interval.
+// On shutdown it stops taking new work, waits up to Config.Timings.ShutdownGracePeriod for the in-flight
+// renewals and restores the annotations of those that did not finish.
+func (iw *IngressWatcher) Start(ctx context.Context) error {
+	// debug
+	klog.Info("debug - IngressWatcher.Start")
+
+	// The work runs on its own context, so in-flight renewals outlive ctx for the grace period.
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
+	if !cache.WaitForCacheSync(ctx.Done(), iw.hasSynced()...) {
+		iw.Queue.ShutDown()
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
+	iw.namespaceRenewals.start(workCtx)
+
+	var wg sync.WaitGroup
+	// stopWorkers holds one function per running worker, stopping it.
+	var stopWorkers []context.CancelFunc
+	scaleWorkers := func(n int) {
+		for len(stopWorkers) < n {
+			stopCtx, stop := context.WithCancel(workCtx)
+			stopWorkers = append(stopWorkers, stop)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				iw.runWorker(workCtx, stopCtx.Done())
+			}()
+		}
+		for len(stopWorkers) > n {
+			last := len(stopWorkers) - 1
+			stopWorkers[last]()
+			stopWorkers = stopWorkers[:last]
+		}
+	}
+	scaleWorkers(iw.config().Workers)
+
+	auditReset := make(chan struct{}, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		iw.runAudits(ctx, workCtx, auditReset)
+	}()
+
+	for {
+		select {
+		case <-iw.configChanged:
+			cfg := iw.config()
+			if cfg.Workers != len(stopWorkers) {
+				klog.InfoS("Resizing the ingress workers", "from", len(stopWorkers), "to", cfg.Workers)
+				scaleWorkers(cfg.Workers)
+			}
+			select {
+			case auditReset <- struct{}{}:
+			default:
+			}
+		case <-ctx.Done():
+			iw.shutdown(cancelWork, &wg)
+			return nil
+		}
+	}
+}
+
+// runAudits runs auditIngressResources with workCtx every Config.Timings.AuditInterval until ctx is done.
+// A signal on reset restarts the interval from the current config.
+func (iw *IngressWatcher) runAudits(ctx, workCtx context.Context, reset <-chan struct{}) {
+	interval := iw.config().Timings.AuditInterval.Duration
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := iw.auditIngressResources(workCtx); err != nil {
+				klog.ErrorS(err, "error auditing ingress resources")
+			}
+		case <-reset:
+			if next := iw.config().Timings.AuditInterval.Duration; next != interval {
+				klog.InfoS("Changing the audit interval", "from", interval, "to", next)
+				interval = next
+				ticker.Reset(interval)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// shutdown stops taking new work and waits up to Config.Timings.ShutdownGracePeriod for the in-flight renewals.
+// It then cancels the remaining work and restores the annotations of the renewals that did not finish.
+func (iw *IngressWatcher) shutdown(cancelWork context.CancelFunc, wg *sync.WaitGroup) {
+	grace := iw.config().Timings.ShutdownGracePeriod.Duration
+	klog.Infof("Shutting down the ingress watcher, waiting up to %v for in-flight renewals", grace)
+
+	graceCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	iw.Queue.ShutDown()
+	if !iw.inFlight.Drain(graceCtx) {
+		klog.Warning("Grace period expired with renewals still in flight, cancelling them")
+	}
+	cancelWork()
+	wg.Wait()
+	iw.namespaceRenewals.wait()
+
+	for key, annotations := range iw.inFlight.Pending() {
+		restoreCtx, cancel := context.WithTimeout(context.Background(), annotationRestoreTimeout)
+		err := iw.restoreAnnotations(restoreCtx, key, annotations)
+		cancel()
+		if err != nil {
+			klog.ErrorS(err, "Failed to restore the annotations of an interrupted renewal", "key", key)
+			continue
+		}
+		iw.endRenewal(key)
+		klog.InfoS("Restored the annotations of an interrupted renewal", "key", key)
+	}
+}
+
+// hasSynced returns the HasSynced functions of every informer.
+func (iw *IngressWatcher) hasSynced() []cache.InformerSynced {
+	synced := make([]cache.InformerSynced, 0, len(iw.IngressInformers)+len(iw.SecretInformers))
+	for _, informer := range iw.IngressInformers {
+		synced = append(synced, informer.HasSynced)
+	}
+	for _, informer := range iw.SecretInformers {
+		synced = append(synced, informer.HasSynced)
+	}
+	return synced
+}
+
+// runWorker processes queued Ingress keys until the queue is shut down or stop is closed.
+// A stopped worker exits after the key it is processing or waiting for.
+func (iw *IngressWatcher) runWorker(ctx context.Context, stop <-chan struct{}) {
+	for iw.processNextWorkItem(ctx) {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+	}
+}
+
+// processNextWorkItem processes one queued Ingress key, requeueing it with backoff when it fails.
+// It returns false once the queue is shut down.
+func (iw *IngressWatcher) processNextWorkItem(ctx context.Context) bool {
+	item, quit := iw.Queue.Get()
+	if quit {
+		return false
+	}
+	defer iw.Queue.Done(item)
+
+	// The queue hands out its remaining items after ShutDown, refuse them once a shutdown started.
+	if iw.inFlight.Draining() {
+		return false
+	}
+
+	key := item.(string)
+	if err := iw.syncIngress(ctx, key); err != nil {
+		if iw.Queue.NumRequeues(key) < maxIngressRetries {
+			klog.ErrorS(err, "Failed to process ingress, requeueing", "key", key)
+			iw.Queue.AddRateLimited(key)
+			return true
+		}
+		klog.ErrorS(err, "Failed to process ingress, dropping it", "key", key)
+	}
+	iw.Queue.Forget(key)
+	return true
+}
+
+// syncIngress processes the Ingress of the key, read from the informer caches.
+func (iw *IngressWatcher) syncIngress(ctx context.Context, key string) error {
+	if iw.auditMutex.IsLocked(key) {
+		klog.Info("debug - syncIngress - key is locked, skip the processing")
+		return nil
+	}
+
+	// A renewal deferred to its maintenance window, or a certificate crossing its renewal threshold,
+	// is audited once due.
+	scheduled := iw.takeScheduled(key)
+	for _, informer := range iw.IngressInformers {
+		obj, exists, err := informer.GetStore().GetByKey(key)
+		if err != nil {
+			return err
+		}
+		if exists {
+			// The cached object is shared, work on a copy.
+			ing := obj.(*networkingv1.Ingress).DeepCopy()
+			if scheduled {
+				return iw.auditIngress(ctx, ing)
+			}
+			return iw.handleIngressAdd(ctx, ing)
+		}
+	}
+
+	// The Ingress was deleted in the meantime.
+	iw.forgetIngress(key)
+	return nil
+}
@@ -0,0 +1,164 @@
+// internal/controller/ingress_watcher_runnable_test.go
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakec "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNeedLeaderElection(t *testing.T) {
+	iw := &IngressWatcher{}
+
+	// Only the runnable that mutates Ingresses needs the leader lease.
+	assert.True(t, iw.NeedLeaderElection())
+	assert.False(t, (&ingressInformerRunnable{iw: iw}).NeedLeaderElection())
+}
+
+func TestSecretInformersOnlyListTLSSecrets(t *testing.T) {
+	fakeClientset := fake.NewSimpleClientset()
+	selectors := make(chan string, 1)
+	fakeClientset.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		select {
+		case selectors <- action.(k8stesting.ListAction).GetListRestrictions().Fields.String():
+		default:
+		}
+		return false, nil, nil
+	})
+	iw, err := NewIngressWatcher(fakeClientset, nil)
+	require.NoError(t, err)
+	require.Len(t, iw.SecretInformers, 1)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go iw.SecretInformers[0].Run(stop)
+	require.True(t, cache.WaitForCacheSync(stop, iw.SecretInformers[0].HasSynced))
+	assert.Equal(t, "type=kubernetes.io/tls", <-selectors)
+}
+
+func TestSyncIngress(t *testing.T) {
+	ctx := context.TODO()
+	labels := map[string]string{"nimble.opti.adapter/enabled": "true"}
+	annotations := map[string]string{httpsAnnotation: "HTTPS"}
+
+	tests := []struct {
+		name           string
+		cached         bool
+		locked         bool
+		wantNimbleOpti bool
+	}{
+		{"cached ingress is processed", true, false, true},
+		{"deleted ingress is ignored", false, false, false},
+		{"locked ingress is skipped", true, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+			iw, err := setupIngressWatcher(fakeClient)
+			if err != nil {
+				t.Fatalf("Failed to setup IngressWatcher: %v", err)
+			}
+
+			ing := generateIngress("ing", "default", labels, []string{"/app"}, annotations)
+			if tt.cached {
+				assert.NoError(t, iw.IngressInformers[0].GetStore().Add(ing))
+			}
+			if tt.locked {
+				iw.auditMutex.Lock("default/ing")
+				defer iw.auditMutex.Unlock("default/ing")
+			}
+
+			assert.NoError(t, iw.syncIngress(ctx, "default/ing"))
+
+			err = fakeClient.Get(ctx, client.ObjectKey{Name: "default", Namespace: "default"}, &v2.NimbleOpti{})
+			assert.Equal(t, tt.wantNimbleOpti, err == nil, "NimbleOpti get error: %v", err)
+		})
+	}
+}
+
+// TestIngressWatcherStart checks that an Ingress seen by the informers is processed once the watcher is started.
+func TestIngressWatcherStart(t *testing.T) {
+	labels := map[string]string{"nimble.opti.adapter/enabled": "true"}
+	annotations := map[string]string{httpsAnnotation: "HTTPS"}
+	ing := generateIngress("ing", "default", labels, []string{"/app"}, annotations)
+
+	iw, err := NewIngressWatcher(fake.NewSimpleClientset(ing), nil)
+	if err != nil {
+		t.Fatalf("Failed to create IngressWatcher: %v", err)
+	}
+	if err := v2.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatalf("Failed to add NimbleOpti to scheme: %v", err)
+	}
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	iw.ClientObj = fakeClient
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	informersDone := make(chan error, 1)
+	watcherDone := make(chan error, 1)
+	go func() { informersDone <- (&ingressInformerRunnable{iw: iw}).Start(ctx) }()
+	go func() { watcherDone <- iw.Start(ctx) }()
+
+	assert.Eventually(t, func() bool {
+		return fakeClient.Get(ctx, client.ObjectKey{Name: "default", Namespace: "default"}, &v2.NimbleOpti{}) == nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	cancel()
+	for _, done := range []chan error{informersDone, watcherDone} {
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("runnable did not stop after the context was cancelled")
+		}
+	}
+	assert.True(t, iw.Queue.ShuttingDown())
+}
+
+// TestShutdownRestoresAnnotations checks that a renewal still in flight after the grace period gets its annotations back.
+func TestShutdownRestoresAnnotations(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+
+	// The renewal removed the annotation and never reinstated it.
+	ing := generateIngress("ing", "default", nil, []string{"/app"}, nil)
+	if err := fakeClient.Create(ctx, ing); err != nil {
+		t.Fatalf("Failed to create ingress: %v", err)
+	}
+
+	iw, err := setupIngressWatcher(fakeClient)
+	if err != nil {
+		t.Fatalf("Failed to setup IngressWatcher: %v", err)
+	}
+	iw.Config.Timings.ShutdownGracePeriod.Duration = 10 * time.Millisecond
+	assert.True(t, iw.inFlight.Begin("default/ing", map[string]string{httpsAnnotation: "HTTPS"}))
+
+	workCtx, cancelWork := context.WithCancel(context.TODO())
+	iw.shutdown(cancelWork, &sync.WaitGroup{})
+
+	assert.Error(t, workCtx.Err(), "the remaining work must be cancelled")
+	assert.Empty(t, iw.inFlight.Pending())
+	assert.True(t, iw.Queue.ShuttingDown())
+
+	restored := &networkingv1.Ingress{}
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "ing", Namespace: "default"}, restored))
+	assert.Equal(t, "HTTPS", restored.Annotations[httpsAnnotation])
+
+	// New renewals are refused once the shutdown started.
+	_, err = iw.startCertificateRenewal(ctx, ing, policy.Policy{})
+	assert.ErrorIs(t, err, errShuttingDown)
+}
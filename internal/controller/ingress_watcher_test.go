@@ -9,6 +9,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"math/big"
 	"testing"
@@ -16,17 +17,21 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
-	v1 "github.com/uri-tech/nimble-opti-adapter/api/v1"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/internal/operatorconfig"
 	"github.com/uri-tech/nimble-opti-adapter/utils"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	fakec "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 )
 
 const (
@@ -65,16 +70,15 @@ func (m *FakeKubernetesClient) Watch(ctx context.Context, namespace, ingressName
 // setupIngressWatcher initializes a mock IngressWatcher for testing purposes.
 func setupIngressWatcherMock(clientObj client.Client, client *FakeKubernetesClient) (*IngressWatcher, error) {
 	fakeClientset := fake.NewSimpleClientset()
-	stopCh := make(chan struct{})
 
 	// Add NimbleOpti to the scheme.
-	err := v1.AddToScheme(scheme.Scheme)
+	err := v2.AddToScheme(scheme.Scheme)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to add NimbleOpti to scheme: %v", err))
 	}
 
 	// Create a new IngressWatcher.
-	iw, err := NewIngressWatcher(fakeClientset, stopCh)
+	iw, err := NewIngressWatcher(fakeClientset, nil)
 	if err != nil {
 		klog.ErrorS(err, "Failed to create IngressWatcher")
 		return nil, err
@@ -92,15 +96,14 @@ func setupIngressWatcherMock(clientObj client.Client, client *FakeKubernetesClie
 // setupIngressWatcher initializes a mock IngressWatcher for testing purposes.
 func setupIngressWatcher(client client.Client) (*IngressWatcher, error) {
 	fakeClientset := fake.NewSimpleClientset()
-	stopCh := make(chan struct{})
 
 	// Add NimbleOpti to the scheme.
-	err := v1.AddToScheme(scheme.Scheme)
+	err := v2.AddToScheme(scheme.Scheme)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to add NimbleOpti to scheme: %v", err))
 	}
 
-	iw, err := NewIngressWatcher(fakeClientset, stopCh)
+	iw, err := NewIngressWatcher(fakeClientset, nil)
 	if err != nil {
 		klog.ErrorS(err, "Failed to create IngressWatcher")
 		return nil, err
@@ -231,6 +234,81 @@ func TestAuditIngressResources(t *testing.T) {
 	// assert.Nil(t, err)
 }
 
+// TestAuditIngressResourcesPartialFailure checks that a failing ingress does not stop the audit of the others.
+func TestAuditIngressResourcesPartialFailure(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+
+	labels := map[string]string{"nimble.opti.adapter/enabled": "true"}
+	annotations := map[string]string{"nginx.ingress.kubernetes.io/backend-protocol": "HTTPS"}
+
+	// The secret of the first ingress does not exist, so reading its certificate fails.
+	broken := generateIngress("broken", "a-namespace", labels, []string{"/app"}, annotations)
+	broken.Spec.TLS = []networkingv1.IngressTLS{{SecretName: "missing-secret"}}
+	healthy := generateIngress("healthy", "b-namespace", labels, []string{"/app"}, annotations)
+	for _, ing := range []*networkingv1.Ingress{broken, healthy} {
+		if err := fakeClient.Create(ctx, ing); err != nil {
+			t.Fatalf("Failed to create ingress: %v", err)
+		}
+	}
+
+	iw, err := setupIngressWatcher(fakeClient)
+	if err != nil {
+		t.Fatalf("Failed to setup IngressWatcher: %v", err)
+	}
+
+	err = iw.auditIngressResources(ctx)
+
+	var agg utilerrors.Aggregate
+	if assert.True(t, errors.As(err, &agg), "expected an aggregate error, got %v", err) {
+		assert.Len(t, agg.Errors(), 1)
+		assert.Contains(t, agg.Error(), "a-namespace/broken")
+	}
+
+	// The namespace after the broken one was still audited.
+	nimbleOpti := &v2.NimbleOpti{}
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "b-namespace", Namespace: "b-namespace"}, nimbleOpti))
+}
+
+// TestListIngressesNamespaces checks that only the watched namespaces are listed.
+func TestListIngressesNamespaces(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	for _, ns := range []string{"team-a", "team-b", "team-c"} {
+		if err := fakeClient.Create(ctx, generateIngress("ing", ns, nil, nil, nil)); err != nil {
+			t.Fatalf("Failed to create ingress: %v", err)
+		}
+	}
+
+	iw, err := setupIngressWatcher(fakeClient)
+	if err != nil {
+		t.Fatalf("Failed to setup IngressWatcher: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		namespaces []string
+		want       []string
+	}{
+		{"all namespaces", nil, []string{"team-a", "team-b", "team-c"}},
+		{"restricted", []string{"team-a", "team-c"}, []string{"team-a", "team-c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iw.Config.WatchNamespaces = tt.namespaces
+			ingresses, err := iw.listIngresses(ctx)
+			assert.NoError(t, err)
+
+			var got []string
+			for _, ing := range ingresses.Items {
+				got = append(got, ing.Namespace)
+			}
+			assert.ElementsMatch(t, tt.want, got)
+		})
+	}
+}
+
 func TestHandleIngressAdd(t *testing.T) {
 	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build()
 	iw, err := setupIngressWatcher(fakeClient)
@@ -262,10 +340,10 @@ func TestHandleIngressAdd(t *testing.T) {
 	}
 
 	// Call the handleIngressAdd function.
-	iw.handleIngressAdd(ingWithLabelAndAnnotation)
+	assert.NoError(t, iw.handleIngressAdd(context.TODO(), ingWithLabelAndAnnotation))
 
 	// check if the nimbleopti object was created
-	nimbleOpti := &v1.NimbleOpti{}
+	nimbleOpti := &v2.NimbleOpti{}
 	err = iw.ClientObj.Get(context.TODO(), client.ObjectKey{Name: "default", Namespace: "default"}, nimbleOpti)
 	assert.NoError(t, err)
 	assert.NotNil(t, nimbleOpti)
@@ -282,19 +360,19 @@ func TestGetOrCreateNimbleOpti(t *testing.T) {
 
 	// Scenario: NimbleOpti doesn't exist.
 	// Try to get or create a NimbleOpti in the "default" namespace.
-	nimbleOpti, err := iw.getOrCreateNimbleOpti(context.TODO(), "default")
+	nimbleOpti, err := iw.getOrCreateNimbleOpti(context.TODO(), "default", nil)
 	assert.NoError(t, err)
 	assert.NotNil(t, nimbleOpti)
 
 	// Use the fakeClient to retrieve the NimbleOpti to confirm it was created.
-	retrievedNimbleOpti := &v1.NimbleOpti{}
+	retrievedNimbleOpti := &v2.NimbleOpti{}
 	err = iw.ClientObj.Get(context.TODO(), client.ObjectKey{Name: "default", Namespace: "default"}, retrievedNimbleOpti)
 	assert.NoError(t, err)
 	assert.NotNil(t, retrievedNimbleOpti)
 
 	// Scenario: NimbleOpti exists.
 	// Try to get or create again a NimbleOpti in the "default" namespace.
-	secondNimbleOpti, err := iw.getOrCreateNimbleOpti(context.TODO(), "default")
+	secondNimbleOpti, err := iw.getOrCreateNimbleOpti(context.TODO(), "default", nil)
 	assert.NoError(t, err)
 	assert.NotNil(t, secondNimbleOpti)
 
@@ -303,17 +381,28 @@ func TestGetOrCreateNimbleOpti(t *testing.T) {
 }
 
 func TestIsAdapterEnabledLabel(t *testing.T) {
+	iw, err := setupIngressWatcher(fakec.NewClientBuilder().WithScheme(scheme.Scheme).Build())
+	if err != nil {
+		t.Fatalf("Failed to setup IngressWatcher: %v", err)
+	}
+
 	// Test if the function returns true when the label is present and set to "true".
 	ingWithLabel := generateIngress("test-ingress-with-label", "default", map[string]string{"nimble.opti.adapter/enabled": "true"}, nil, nil)
-	assert.True(t, isAdapterEnabledLabel(context.TODO(), ingWithLabel))
+	assert.True(t, iw.isAdapterEnabledLabel(context.TODO(), ingWithLabel))
 
 	// Test if the function returns false when the label is not present.
 	ingWithoutLabel := generateIngress("test-ingress", "default", nil, nil, nil)
-	assert.False(t, isAdapterEnabledLabel(context.TODO(), ingWithoutLabel))
+	assert.False(t, iw.isAdapterEnabledLabel(context.TODO(), ingWithoutLabel))
 
 	// Test if the function returns false when the label is present but not set to "true".
 	ingWithFalseLabel := generateIngress("test-ingress-with-false-label", "default", map[string]string{"nimble.opti.adapter/enabled": "false"}, nil, nil)
-	assert.False(t, isAdapterEnabledLabel(context.TODO(), ingWithFalseLabel))
+	assert.False(t, iw.isAdapterEnabledLabel(context.TODO(), ingWithFalseLabel))
+
+	// Test a custom selector from the operator config.
+	iw.selector = labels.SelectorFromSet(labels.Set{"team": "payments"})
+	assert.False(t, iw.isAdapterEnabledLabel(context.TODO(), ingWithLabel))
+	ingWithTeam := generateIngress("test-ingress-with-team", "default", map[string]string{"team": "payments"}, nil, nil)
+	assert.True(t, iw.isAdapterEnabledLabel(context.TODO(), ingWithTeam))
 }
 
 func TestHasIngressChanged(t *testing.T) {
@@ -439,11 +528,14 @@ func TestProcessIngressForRenewal(t *testing.T) {
 			ing := generateIngress("test-ingress", "default", tt.ingressLabels, tt.ingressPaths, nil)
 			assert.Nil(t, fakeClient.Create(ctx, ing))
 
+			pol, err := iw.resolvePolicy(ctx, ing)
+			assert.Nil(t, err)
+
 			// Test
 			gotRenewalCh := make(chan bool)
 			errorCh := make(chan error)
 			go func() {
-				renewal, err := iw.processIngressForRenewal(ctx, ing)
+				renewal, err := iw.processIngressForRenewal(ctx, ing, pol)
 				if err != nil {
 					errorCh <- err
 					return
@@ -533,7 +625,7 @@ func TestWaitForChallengeAbsence(t *testing.T) {
 			resultCh := make(chan time.Duration)
 			errorCh := make(chan error)
 			go func() {
-				res, err := iw.waitForChallengeAbsence(ctx, timeout, "default", "test-ingress")
+				res, err := iw.waitForChallengeAbsence(ctx, timeout, iw.config().Timings.PollInterval.Duration, "default", "test-ingress")
 				if err != nil {
 					errorCh <- err
 					return
@@ -605,22 +697,27 @@ func TestStartCertificateRenewal(t *testing.T) {
 			}
 
 			// Create the NimbleOpti object.
-			nimbleOpti := &v1.NimbleOpti{
+			nimbleOpti := &v2.NimbleOpti{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "default",
 					Namespace: "default",
 				},
-				Spec: v1.NimbleOptiSpec{
-					TargetNamespace:             "default",
-					CertificateRenewalThreshold: 3,
-					AnnotationRemovalDelay:      5,
+				Spec: v2.NimbleOptiSpec{
+					TargetNamespace:       "default",
+					RenewBefore:           &metav1.Duration{Duration: 3 * 24 * time.Hour},
+					ChallengeClearTimeout: &metav1.Duration{Duration: 5 * time.Second},
 				},
 			}
 			if err := fakeClient.Create(ctx, nimbleOpti); err != nil {
 				t.Fatalf("Failed to create NimbleOpti: %v", err)
 			}
 
-			isRenew, err := iw.startCertificateRenewal(ctx, ing, nimbleOpti)
+			pol, err := iw.resolvePolicy(ctx, ing)
+			if err != nil {
+				t.Fatalf("resolvePolicy failed: %v", err)
+			}
+
+			isRenew, err := iw.startCertificateRenewal(ctx, ing, pol)
 			if err != nil {
 				t.Fatalf("startCertificateRenewal failed: %v", err)
 			}
@@ -630,6 +727,42 @@ func TestStartCertificateRenewal(t *testing.T) {
 	}
 }
 
+// TestStartCertificateRenewalHoldsDegradedSlot checks that a renewal which could not reinstate the HTTPS annotation
+// keeps its degraded slot until the annotation is restored.
+func TestStartCertificateRenewalHoldsDegradedSlot(t *testing.T) {
+	ctx := context.TODO()
+	failRestore := true
+	fakeClient := fakec.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			if failRestore && obj.GetAnnotations()[httpsAnnotation] != "" {
+				return errors.New("update refused")
+			}
+			return c.Update(ctx, obj, opts...)
+		},
+	}).Build()
+	ing := generateIngress("ing", "default", nil, []string{"/app"}, map[string]string{httpsAnnotation: "HTTPS"})
+	if err := fakeClient.Create(ctx, ing); err != nil {
+		t.Fatalf("Failed to create ingress: %v", err)
+	}
+	iw, err := setupIngressWatcher(fakeClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = iw.startCertificateRenewal(ctx, ing, iw.clusterPolicy(nil))
+	assert.ErrorContains(t, err, "update refused")
+	assert.Equal(t, 1, iw.degraded.InUse(), "the ingress is still degraded")
+	assert.Contains(t, iw.inFlight.Pending(), "default/ing")
+
+	// Restoring the annotation frees the slot.
+	failRestore = false
+	for key, annotations := range iw.inFlight.Pending() {
+		assert.NoError(t, iw.restoreAnnotations(ctx, key, annotations))
+		iw.endRenewal(key)
+	}
+	assert.Equal(t, 0, iw.degraded.InUse())
+}
+
 func TestRenewValidCertificateIfNecessary(t *testing.T) {
 	ctx := context.TODO()
 
@@ -715,25 +848,28 @@ func TestRenewValidCertificateIfNecessary(t *testing.T) {
 			}
 
 			// Create the NimbleOpti object.
-			nimbleOpti := &v1.NimbleOpti{
+			nimbleOpti := &v2.NimbleOpti{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "default",
 					Namespace: "default",
 				},
-				Spec: v1.NimbleOptiSpec{
-					TargetNamespace:             "default",
-					CertificateRenewalThreshold: 3, // Renew if certificate expires within 3 days
-					AnnotationRemovalDelay:      5,
+				Spec: v2.NimbleOptiSpec{
+					TargetNamespace:       "default",
+					RenewBefore:           &metav1.Duration{Duration: 3 * 24 * time.Hour}, // Renew if certificate expires within 3 days
+					ChallengeClearTimeout: &metav1.Duration{Duration: 5 * time.Second},
 				},
 			}
 			if err := mockClient.Create(ctx, nimbleOpti); err != nil {
 				t.Fatalf("Failed to create NimbleOpti: %v", err)
 			}
 
+			pol, err := iw.resolvePolicy(ctx, ing)
+			assert.NoError(t, err)
+
 			// Start the certificate renewal process.
 			errorCh := make(chan error)
 			go func() {
-				err := iw.renewValidCertificateIfNecessary(ctx, ing) // Use iwMock here
+				err := iw.renewValidCertificateIfNecessary(ctx, ing, pol) // Use iwMock here
 				if err != nil {
 					errorCh <- err
 					return
@@ -821,7 +957,7 @@ func TestWaitForAcmeChallenge(t *testing.T) {
 	// Run waitForAcmeChallenge in a goroutine.
 	goErrCh := make(chan error)
 	go func() {
-		goErrCh <- iw.waitForAcmeChallenge(ctx, namespace, ingressName)
+		goErrCh <- iw.waitForAcmeChallenge(ctx, iw.config().Timings.AcmeChallengeTimeout.Duration, namespace, ingressName)
 	}()
 
 	// Simulate real-world delay before an update
@@ -849,19 +985,23 @@ func TestNewIngressWatcher(t *testing.T) {
 	fakeClientset := fake.NewSimpleClientset()
 
 	t.Run("successfully initialize an IngressWatcher", func(t *testing.T) {
-		// Mock the stopCh
-		stopCh := make(chan struct{})
-		defer close(stopCh)
-
 		// TODO: Mock config.GetConfig() to return a dummy configuration
 
-		iw, err := NewIngressWatcher(fakeClientset, stopCh)
+		iw, err := NewIngressWatcher(fakeClientset, nil)
 		assert.NoError(t, err)
 		assert.NotNil(t, iw)
 
 		// TODO: Check other attributes of iw to ensure they are correctly set up
 	})
 
+	t.Run("one informer per watched namespace", func(t *testing.T) {
+		cfg := operatorconfig.Default()
+		cfg.WatchNamespaces = []string{"team-a", "team-b"}
+		iw, err := NewIngressWatcher(fakeClientset, cfg)
+		assert.NoError(t, err)
+		assert.Len(t, iw.IngressInformers, 2)
+	})
+
 	// TODO: Add more test cases for negative scenarios like failing to get config, failing to set up the scheme, etc.
 }
 
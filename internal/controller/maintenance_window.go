@@ -0,0 +1,70 @@
+// internal/controller/maintenance_window.go
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/klog/v2"
+)
+
+// Reasons of the events recorded for the maintenance windows.
+const (
+	// reasonRenewalDeferred is recorded when a renewal waits for the next maintenance window.
+	reasonRenewalDeferred = "RenewalDeferred"
+	// reasonMaintenanceWindowBypassed is recorded when a certificate within the emergency threshold is renewed outside of the windows.
+	reasonMaintenanceWindowBypassed = "MaintenanceWindowBypassed"
+)
+
+// deferRenewal reports whether the renewal of ing must wait for the next maintenance window of pol.
+// timeRemaining is the time until its certificate expires, a certificate within the emergency threshold
+// never waits. Without a known expiry, a TLS secret missing or holding no valid certificate, the renewal waits.
+// A deferred Ingress is audited again at its next window, see scheduleAudit.
+func (iw *IngressWatcher) deferRenewal(ing *networkingv1.Ingress, pol policy.Policy, timeRemaining time.Duration, expiryKnown bool) bool {
+	now := iw.now()
+	if pol.Schedule.Open(now) {
+		return false
+	}
+
+	key := utils.IngressKey(ing)
+	if expiryKnown && pol.Bypasses(timeRemaining) {
+		klog.Infof("Renewing ingress %s outside of its maintenance windows, its certificate expires in %v", key, timeRemaining)
+		iw.Recorder.Eventf(ing, corev1.EventTypeNormal, reasonMaintenanceWindowBypassed,
+			"Certificate expires in %v, within the emergency threshold of %v", timeRemaining.Round(time.Second), pol.EmergencyThreshold)
+		return false
+	}
+
+	next, ok := pol.Schedule.Next(now)
+	if !ok {
+		// Nothing to queue, the next audit checks again.
+		klog.Warningf("Deferring the renewal of ingress %s, no maintenance window opens within a year", key)
+		iw.Recorder.Event(ing, corev1.EventTypeWarning, reasonRenewalDeferred, "Renewal deferred, no maintenance window opens within a year")
+		return true
+	}
+
+	klog.Infof("Deferring the renewal of ingress %s to the maintenance window at %s", key, next.Format(time.RFC3339))
+	iw.Recorder.Eventf(ing, corev1.EventTypeNormal, reasonRenewalDeferred, "Renewal deferred to the maintenance window at %s", next.Format(time.RFC3339))
+	iw.scheduleAudit(key, next.Sub(now))
+	return true
+}
+
+// timeUntilExpiry returns the time until the first certificate of ing expires, and false
+// when ing has no TLS secret, or one is missing or holds no valid certificate.
+func (iw *IngressWatcher) timeUntilExpiry(ctx context.Context, ing *networkingv1.Ingress) (time.Duration, bool) {
+	var remaining time.Duration
+	for i, tlsSpec := range ing.Spec.TLS {
+		cert, err := iw.secretCertificate(ctx, ing.Namespace, tlsSpec.SecretName)
+		if err != nil {
+			return 0, false
+		}
+		if left := cert.NotAfter.Sub(iw.now()); i == 0 || left < remaining {
+			remaining = left
+		}
+	}
+	return remaining, len(ing.Spec.TLS) > 0
+}
@@ -0,0 +1,244 @@
+// internal/controller/maintenance_window_test.go
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDeferRenewal(t *testing.T) {
+	// Saturday 2024-06-01 12:00 UTC.
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	weekend, err := policy.ParseWindow([]string{"Sat", "Sun"}, "10:00", "14:00", "UTC")
+	require.NoError(t, err)
+	night, err := policy.ParseWindow([]string{"Sat"}, "22:00", "02:00", "UTC")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		pol           policy.Policy
+		timeRemaining time.Duration
+		expiryUnknown bool
+		wantDeferred  bool
+		wantQueued    bool
+		wantEvent     string
+	}{
+		{
+			name: "no maintenance windows",
+			pol:  policy.Policy{},
+		},
+		{
+			name: "inside a maintenance window",
+			pol:  policy.Policy{Schedule: &policy.Schedule{Windows: []policy.Window{weekend}}},
+		},
+		{
+			name:         "outside of the maintenance windows",
+			pol:          policy.Policy{Schedule: &policy.Schedule{Windows: []policy.Window{night}}},
+			wantDeferred: true,
+			wantQueued:   true,
+			wantEvent:    "Normal RenewalDeferred Renewal deferred to the maintenance window at 2024-06-01T22:00:00Z",
+		},
+		{
+			name: "blackout date",
+			pol: policy.Policy{Schedule: &policy.Schedule{
+				Windows:       []policy.Window{weekend},
+				BlackoutDates: []string{"2024-06-01"},
+			}},
+			wantDeferred: true,
+			wantQueued:   true,
+			wantEvent:    "Normal RenewalDeferred Renewal deferred to the maintenance window at 2024-06-02T10:00:00Z",
+		},
+		{
+			name: "within the emergency threshold",
+			pol: policy.Policy{
+				Schedule:           &policy.Schedule{Windows: []policy.Window{night}},
+				EmergencyThreshold: 48 * time.Hour,
+			},
+			timeRemaining: 24 * time.Hour,
+			wantEvent:     "Normal MaintenanceWindowBypassed Certificate expires in 24h0m0s, within the emergency threshold of 48h0m0s",
+		},
+		{
+			name: "unknown expiry within the emergency threshold",
+			pol: policy.Policy{
+				Schedule:           &policy.Schedule{Windows: []policy.Window{night}},
+				EmergencyThreshold: 48 * time.Hour,
+			},
+			expiryUnknown: true,
+			wantDeferred:  true,
+			wantQueued:    true,
+			wantEvent:     "Normal RenewalDeferred Renewal deferred to the maintenance window at 2024-06-01T22:00:00Z",
+		},
+		{
+			name: "beyond the emergency threshold",
+			pol: policy.Policy{
+				Schedule:           &policy.Schedule{Windows: []policy.Window{night}},
+				EmergencyThreshold: 48 * time.Hour,
+			},
+			timeRemaining: 72 * time.Hour,
+			wantDeferred:  true,
+			wantQueued:    true,
+			wantEvent:     "Normal RenewalDeferred Renewal deferred to the maintenance window at 2024-06-01T22:00:00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iw, _, recorder := setupRenewRequestWatcher(t)
+			iw.now = func() time.Time { return now }
+			ing := generateIngress("ing", "default", nil, []string{"/app"}, nil)
+
+			assert.Equal(t, tt.wantDeferred, iw.deferRenewal(ing, tt.pol, tt.timeRemaining, !tt.expiryUnknown))
+			// The audit is due once the window opens.
+			iw.now = func() time.Time { return now.Add(366 * 24 * time.Hour) }
+			assert.Equal(t, tt.wantQueued, iw.takeScheduled("default/ing"))
+			assert.False(t, iw.takeScheduled("default/ing"))
+
+			if tt.wantEvent == "" {
+				assert.Empty(t, recorder.Events)
+				return
+			}
+			require.Len(t, recorder.Events, 1)
+			assert.Equal(t, tt.wantEvent, <-recorder.Events)
+		})
+	}
+}
+
+func TestTimeUntilExpiry(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name      string
+		tls       bool
+		secret    bool
+		want      time.Duration
+		wantKnown bool
+	}{
+		{name: "no TLS secret"},
+		{name: "missing TLS secret", tls: true},
+		{name: "valid certificate", tls: true, secret: true, want: 24 * time.Hour, wantKnown: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iw, fakeClient, _ := setupRenewRequestWatcher(t)
+			iw.now = func() time.Time { return now }
+			ing := generateIngress("ing", "default", nil, []string{"/app"}, nil)
+			if tt.tls {
+				ing.Spec.TLS = []networkingv1.IngressTLS{{SecretName: "tls"}}
+			}
+			if tt.secret {
+				require.NoError(t, fakeClient.Create(ctx, generateTLSSecret(t, "tls", "default", now.Add(24*time.Hour))))
+			}
+
+			remaining, known := iw.timeUntilExpiry(ctx, ing)
+			assert.Equal(t, tt.wantKnown, known)
+			if known {
+				assert.Equal(t, tt.want, remaining.Truncate(time.Second))
+			}
+		})
+	}
+}
+
+func TestNamespacePolicyMaintenanceWindows(t *testing.T) {
+	ctx := context.TODO()
+
+	tests := []struct {
+		name      string
+		spec      v2.NimbleOptiSpec
+		wantWins  int
+		wantDates []string
+		wantErr   bool
+	}{
+		{
+			name: "no maintenance windows",
+		},
+		{
+			name: "maintenance windows and blackout dates",
+			spec: v2.NimbleOptiSpec{
+				MaintenanceWindows: []v2.MaintenanceWindow{
+					{Days: []v2.Weekday{"Sat", "Sun"}, Start: "02:00", End: "05:00", TimeZone: "Europe/Berlin"},
+				},
+				BlackoutDates:      []v2.BlackoutDate{"2024-12-25"},
+				EmergencyThreshold: &metav1.Duration{Duration: 72 * time.Hour},
+			},
+			wantWins:  1,
+			wantDates: []string{"2024-12-25"},
+		},
+		{
+			name: "invalid time zone",
+			spec: v2.NimbleOptiSpec{
+				MaintenanceWindows: []v2.MaintenanceWindow{
+					{Days: []v2.Weekday{"Sat"}, Start: "02:00", End: "05:00", TimeZone: "Mars/Olympus"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nimbleOpti := &v2.NimbleOpti{
+				ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+				Spec:       tt.spec,
+			}
+			iw, _, _ := setupRenewRequestWatcher(t, nimbleOpti)
+
+			pol, _, err := iw.namespacePolicy(ctx, "default")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.wantWins == 0 && tt.wantDates == nil {
+				assert.Nil(t, pol.Schedule)
+				return
+			}
+			require.NotNil(t, pol.Schedule)
+			assert.Len(t, pol.Schedule.Windows, tt.wantWins)
+			assert.Equal(t, tt.wantDates, pol.Schedule.BlackoutDates)
+			assert.Equal(t, durationOf(tt.spec.EmergencyThreshold), pol.EmergencyThreshold)
+		})
+	}
+}
+
+func TestProcessIngressForRenewalDeferred(t *testing.T) {
+	ctx := context.TODO()
+	nimbleOpti := &v2.NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+		Spec: v2.NimbleOptiSpec{
+			MaintenanceWindows: []v2.MaintenanceWindow{
+				{Days: []v2.Weekday{"Sun"}, Start: "02:00", End: "05:00"},
+			},
+		},
+	}
+	iw, fakeClient, recorder := setupRenewRequestWatcher(t, nimbleOpti)
+	// Saturday, outside of the window.
+	iw.now = func() time.Time { return time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC) }
+
+	ing := generateIngress("ing", "default", nil, []string{"/app", "/.well-known/acme-challenge"},
+		map[string]string{"nginx.ingress.kubernetes.io/backend-protocol": "HTTPS"})
+	require.NoError(t, fakeClient.Create(ctx, ing))
+
+	pol, err := iw.resolvePolicy(ctx, ing)
+	require.NoError(t, err)
+	renewed, err := iw.processIngressForRenewal(ctx, ing, pol)
+	require.NoError(t, err)
+	assert.False(t, renewed)
+
+	// The annotation is left alone until the window opens.
+	assert.Equal(t, "HTTPS", ing.Annotations["nginx.ingress.kubernetes.io/backend-protocol"])
+	assert.False(t, iw.takeScheduled("default/ing"), "not due before the window opens")
+	iw.now = func() time.Time { return time.Date(2024, time.June, 2, 2, 0, 0, 0, time.UTC) }
+	assert.True(t, iw.takeScheduled("default/ing"))
+	require.Len(t, recorder.Events, 1)
+	assert.Equal(t, "Normal RenewalDeferred Renewal deferred to the maintenance window at 2024-06-02T02:00:00Z", <-recorder.Events)
+}
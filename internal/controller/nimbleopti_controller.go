@@ -18,19 +18,32 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
 	// networkingv1 "k8s.io/api/networking/v1"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	// Required for Watching
 
-	adapterv1 "github.com/uri-tech/nimble-opti-adapter/api/v1"
+	adapterv2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
 )
 
 // NimbleOptiReconciler reconciles a NimbleOpti object
@@ -40,11 +53,25 @@ type NimbleOptiReconciler struct {
 
 	KubernetesClient kubernetes.Interface
 	IngressWatcher   *IngressWatcher
+
+	// controller and cache are set by SetupWithManager, the Namespace watch is added to them, see watchNamespaces.
+	controller controller.Controller
+	cache      cache.Cache
+	// watchingNamespaces is set once the Namespace watch is registered.
+	watchingNamespaces bool
+	// namespaceWatchMu protects watchingNamespaces.
+	namespaceWatchMu sync.Mutex
 }
 
 //+kubebuilder:rbac:groups=adapter.uri-tech.github.io,resources=nimbleoptis,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=adapter.uri-tech.github.io,resources=nimbleoptis/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=adapter.uri-tech.github.io,resources=nimbleoptis/finalizers,verbs=update
+//+kubebuilder:rbac:groups=adapter.uri-tech.github.io,resources=clusternimbleoptis,verbs=get;list;watch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;update;delete
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=create;update
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=selfsubjectaccessreviews,verbs=create
 
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.15.0/pkg/reconcile
@@ -54,8 +81,85 @@ func (r *NimbleOptiReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	_ = log.FromContext(ctx)
 
-	// TODO(user): your logic here
+	nimbleOpti := &adapterv2.NimbleOpti{}
+	if err := r.Get(ctx, req.NamespacedName, nimbleOpti); err != nil {
+		if apierrors.IsNotFound(err) && r.IngressWatcher != nil {
+			// A deleted NimbleOpti no longer suspends its namespace, nor manages others.
+			if req.Name == req.Namespace {
+				r.IngressWatcher.suspension.set(req.Namespace, false)
+			}
+			r.IngressWatcher.managers.set(req.NamespacedName, nil)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// A NimbleOpti being deleted stops managing other namespaces at once.
+	if r.IngressWatcher != nil && !nimbleOpti.DeletionTimestamp.IsZero() {
+		r.IngressWatcher.managers.set(req.NamespacedName, nil)
+	}
+
+	// The NimbleOpti named after its namespace is the one the renewals read, its deletion releases the namespace.
+	if r.IngressWatcher != nil && nimbleOpti.Name == nimbleOpti.Namespace {
+		if !nimbleOpti.DeletionTimestamp.IsZero() {
+			return r.finalize(ctx, nimbleOpti)
+		}
+		if controllerutil.AddFinalizer(nimbleOpti, nimbleOptiFinalizer) {
+			if err := r.Update(ctx, nimbleOpti); err != nil {
+				return ctrl.Result{}, err
+			}
+			// A new NimbleOpti manages the namespace released by a previous one again.
+			if err := r.IngressWatcher.claimNamespace(ctx, nimbleOpti.Namespace); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	var requeueAfter time.Duration
+	if r.IngressWatcher != nil {
+		// Interrupt the running renewals of a suspended namespace first.
+		if err := r.IngressWatcher.updateSuspended(ctx, nimbleOpti); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// Record the other namespaces managed from the NimbleOpti, before the policy shown in their status.
+		if err := r.updateTargetNamespaces(ctx, nimbleOpti); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// Start the renewal of the whole namespace requested by spec.renewRequestedAt, it runs in the background.
+		// Until the watcher starts, the request is retried.
+		if !r.IngressWatcher.startNamespaceRenewRequest(nimbleOpti) {
+			requeueAfter = renewRequestRequeueDelay
+		}
 
+		// Show the policy of the namespace in the status.
+		if err := r.IngressWatcher.updateEffectivePolicy(ctx, nimbleOpti); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// finalize releases the Ingresses of the namespace of the deleted nimbleOpti, then removes its finalizer.
+func (r *NimbleOptiReconciler) finalize(ctx context.Context, nimbleOpti *adapterv2.NimbleOpti) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(nimbleOpti, nimbleOptiFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	done, err := r.IngressWatcher.finalizeNimbleOpti(ctx, nimbleOpti)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !done {
+		return ctrl.Result{RequeueAfter: finalizerRequeueDelay}, nil
+	}
+
+	controllerutil.RemoveFinalizer(nimbleOpti, nimbleOptiFinalizer)
+	if err := r.Update(ctx, nimbleOpti); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	klog.InfoS("Released the namespace of the deleted NimbleOpti", "namespace", nimbleOpti.Namespace)
 	return ctrl.Result{}, nil
 }
 
@@ -70,7 +174,13 @@ func (r *NimbleOptiReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	b := ctrl.NewControllerManagedBy(mgr)
 
 	// For the primary resource type that this controller watches
-	b = b.For(&adapterv1.NimbleOpti{})
+	b = b.For(&adapterv2.NimbleOpti{})
+
+	// A change of the ClusterNimbleOpti changes the effective policy of every NimbleOpti.
+	b = b.Watches(&adapterv2.ClusterNimbleOpti{}, handler.EnqueueRequestsFromMapFunc(r.allNimbleOptis))
+
+	// A change of a NimbleOpti changes the effective policy of the namespaces managed from it.
+	b = b.Watches(&adapterv2.NimbleOpti{}, handler.EnqueueRequestsFromMapFunc(r.managedNimbleOptis))
 
 	// Owns specifies objects that are owned by the primary resource
 	// The argument here must be a runtime object that will have its
@@ -92,7 +202,79 @@ func (r *NimbleOptiReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	// 	klog.Error(err, "unable to watch Pods")
 	// }
 
-	// Call Complete to create the NimbleOptiReconciler. This step comes at the end
+	// Call Build to create the controller of the NimbleOptiReconciler. This step comes at the end
 	// as it finalizes the controller's configuration.
-	return b.Complete(r)
+	c, err := b.Build(r)
+	if err != nil {
+		return err
+	}
+	r.controller = c
+	r.cache = mgr.GetCache()
+
+	// Namespaces are cluster-scoped, an operator restricted to some namespaces only watches them
+	// once a NimbleOpti selects namespaces by label, see updateTargetNamespaces.
+	if r.IngressWatcher == nil || isWatchedNamespace(r.IngressWatcher.watchedNamespaces(), metav1.NamespaceAll) {
+		return r.watchNamespaces()
+	}
+	return nil
+}
+
+// watchNamespaces registers the Namespace watch once: a new or relabelled namespace may be selected by the
+// namespaceSelector of a NimbleOpti. It needs get, list and watch on namespaces cluster-wide.
+func (r *NimbleOptiReconciler) watchNamespaces() error {
+	r.namespaceWatchMu.Lock()
+	defer r.namespaceWatchMu.Unlock()
+
+	if r.watchingNamespaces || r.controller == nil {
+		return nil
+	}
+	if err := r.controller.Watch(source.Kind(r.cache, &corev1.Namespace{}), handler.EnqueueRequestsFromMapFunc(r.selectingNimbleOptis)); err != nil {
+		return fmt.Errorf("watching namespaces: %w", err)
+	}
+	r.watchingNamespaces = true
+	klog.InfoS("Watching namespaces for the namespace selectors of the NimbleOptis")
+	return nil
+}
+
+// allNimbleOptis returns a request for every NimbleOpti.
+func (r *NimbleOptiReconciler) allNimbleOptis(ctx context.Context, _ client.Object) []reconcile.Request {
+	list := &adapterv2.NimbleOptiList{}
+	if err := r.List(ctx, list); err != nil {
+		klog.ErrorS(err, "Failed to list NimbleOpti")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: item.Namespace, Name: item.Name}})
+	}
+	return requests
+}
+
+// managedNimbleOptis returns a request for the NimbleOpti of every namespace managed from obj.
+func (r *NimbleOptiReconciler) managedNimbleOptis(_ context.Context, obj client.Object) []reconcile.Request {
+	if r.IngressWatcher == nil {
+		return nil
+	}
+	namespaces := r.IngressWatcher.managers.managed(types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()})
+	requests := make([]reconcile.Request, 0, len(namespaces))
+	for _, ns := range namespaces {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: ns, Name: ns}})
+	}
+	return requests
+}
+
+// selectingNimbleOptis returns a request for every NimbleOpti with a namespace selector.
+func (r *NimbleOptiReconciler) selectingNimbleOptis(ctx context.Context, _ client.Object) []reconcile.Request {
+	list := &adapterv2.NimbleOptiList{}
+	if err := r.List(ctx, list); err != nil {
+		klog.ErrorS(err, "Failed to list NimbleOpti")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, item := range list.Items {
+		if item.Spec.NamespaceSelector != nil {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: item.Namespace, Name: item.Name}})
+		}
+	}
+	return requests
 }
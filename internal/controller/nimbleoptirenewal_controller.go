@@ -0,0 +1,103 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	adapterv2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+)
+
+const (
+	// retryAnnotation on a finished NimbleOptiRenewal requests a new renewal of its Ingress.
+	retryAnnotation = "nimble.opti.adapter/retry"
+	// reasonRenewalRetried is the reason of the event recorded when a NimbleOptiRenewal is retried.
+	reasonRenewalRetried = "RenewalRetried"
+)
+
+// NimbleOptiRenewalReconciler retries the NimbleOptiRenewals annotated with retryAnnotation.
+type NimbleOptiRenewalReconciler struct {
+	client.Client
+
+	// Recorder records the retries as events on the NimbleOptiRenewal.
+	Recorder record.EventRecorder
+	// now returns the current time, the token of the renewal request of a retry. Unset uses time.Now.
+	now func() time.Time
+}
+
+//+kubebuilder:rbac:groups=adapter.uri-tech.github.io,resources=nimbleoptirenewals,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=adapter.uri-tech.github.io,resources=nimbleoptirenewals/status,verbs=get;update;patch
+
+// Reconcile retries a finished NimbleOptiRenewal annotated with retryAnnotation: the renewRequestedAtAnnotation
+// of its Ingress is set, so the operator runs an on-demand renewal that gets a NimbleOptiRenewal of its own.
+// A running renewal keeps its annotation until it finishes.
+func (r *NimbleOptiRenewalReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	renewal := &adapterv2.NimbleOptiRenewal{}
+	if err := r.Get(ctx, req.NamespacedName, renewal); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if _, ok := renewal.Annotations[retryAnnotation]; !ok || !isRenewalResourceFinished(renewal) {
+		return ctrl.Result{}, nil
+	}
+
+	ing := &networkingv1.Ingress{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: renewal.Namespace, Name: renewal.Spec.Ingress}, ing); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	now := time.Now
+	if r.now != nil {
+		now = r.now
+	}
+	token := now().UTC().Format(time.RFC3339)
+	patch := client.MergeFrom(ing.DeepCopy())
+	if ing.Annotations == nil {
+		ing.Annotations = map[string]string{}
+	}
+	ing.Annotations[renewRequestedAtAnnotation] = token
+	if err := r.Patch(ctx, ing, patch); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The retry is requested once, a new annotation requests another one.
+	patch = client.MergeFrom(renewal.DeepCopy())
+	delete(renewal.Annotations, retryAnnotation)
+	if err := r.Patch(ctx, renewal, patch); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	klog.Infof("Retrying NimbleOptiRenewal %s with renewal request %q on ingress %s", req.NamespacedName, token, renewal.Spec.Ingress)
+	if r.Recorder != nil {
+		r.Recorder.Eventf(renewal, corev1.EventTypeNormal, reasonRenewalRetried, "Requested a new renewal of ingress %s with token %q", renewal.Spec.Ingress, token)
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NimbleOptiRenewalReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&adapterv2.NimbleOptiRenewal{}).
+		Complete(r)
+}
@@ -0,0 +1,397 @@
+// internal/controller/renew_request.go
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// renewRequestedAtAnnotation requests an immediate renewal of an Ingress each time its value changes.
+const renewRequestedAtAnnotation = "nimble.opti.adapter/renew-requested-at"
+
+// Reasons of the events recorded for an on-demand renewal.
+const (
+	// reasonRenewRequestHandled is recorded when an on-demand renewal renewed the certificates or ran out of time.
+	reasonRenewRequestHandled = "RenewRequestHandled"
+	// reasonRenewRequestFailed is recorded when an on-demand renewal returned an error.
+	reasonRenewRequestFailed = "RenewRequestFailed"
+)
+
+// renewRequestRequeueDelay is how often a NimbleOpti whose renewal was requested is reconciled until the watcher starts.
+const renewRequestRequeueDelay = 5 * time.Second
+
+// errNoTLSSecret is returned for an on-demand renewal of an Ingress without TLS secret.
+var errNoTLSSecret = errors.New("ingress has no TLS secret to renew")
+
+// renewRequestToken returns the renew-requested-at annotation of an Ingress informer object.
+func renewRequestToken(obj interface{}) string {
+	ing, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return ""
+	}
+	return ing.Annotations[renewRequestedAtAnnotation]
+}
+
+// handleRenewRequest runs a forced renewal of ing when its renew-requested-at annotation holds a token
+// that was not handled yet, and records the result in the status of the NimbleOpti of its namespace.
+// It returns false when there is no pending request.
+func (iw *IngressWatcher) handleRenewRequest(ctx context.Context, ing *networkingv1.Ingress, pol policy.Policy) (bool, error) {
+	token := ing.Annotations[renewRequestedAtAnnotation]
+	if token == "" {
+		return false, nil
+	}
+
+	cluster, err := iw.getClusterNimbleOpti(ctx)
+	if err != nil {
+		return false, err
+	}
+	adapter, err := iw.getOrCreateNimbleOpti(ctx, ing.Namespace, cluster)
+	if err != nil {
+		return false, err
+	}
+	if adapter == nil {
+		// Without a NimbleOpti the handled token cannot be recorded, the renewal would run on every audit.
+		klog.Warningf("Ignoring the renewal request of ingress %s: no NimbleOpti in its namespace", utils.IngressKey(ing))
+		iw.Recorder.Eventf(ing, corev1.EventTypeWarning, reasonRenewRequestFailed,
+			"Renewal request %q ignored: no NimbleOpti in the namespace to record it", token)
+		return false, nil
+	}
+	if handled := findIngressRenewRequest(adapter.Status.IngressRenewRequests, ing.Name); handled != nil && handled.Token == token {
+		return false, nil
+	}
+
+	klog.Infof("Renewal of ingress %s requested with token %q", utils.IngressKey(ing), token)
+	renewed, renewErr := iw.forceRenewal(ctx, ing, pol)
+
+	status := newRenewRequestStatus(token, renewed, renewErr)
+	status.Ingress = ing.Name
+	iw.recordRenewRequest(ing, status)
+
+	// The requests of the deleted Ingresses are dropped, so the list does not grow forever.
+	existing, listErr := iw.ingressNames(ctx, ing.Namespace)
+	key := types.NamespacedName{Namespace: adapter.Namespace, Name: adapter.Name}
+	statusErr := iw.updateNimbleOptiStatus(ctx, key, func(s *v2.NimbleOptiStatus) {
+		setIngressRenewRequest(s, status)
+		if listErr == nil {
+			pruneIngressRenewRequests(s, existing)
+		}
+	})
+	if listErr != nil {
+		klog.Errorf("Not pruning the renewal requests of namespace %s: %v", ing.Namespace, listErr)
+	}
+
+	// NewAggregate skips the nil errors.
+	return true, utilerrors.NewAggregate([]error{renewErr, statusErr})
+}
+
+// namespaceRenewals runs the renewals of whole namespaces requested by spec.renewRequestedAt in the background,
+// so they never block the reconciles of the NimbleOpti resources.
+type namespaceRenewals struct {
+	mu      sync.Mutex        // mu protects the fields below.
+	ctx     context.Context   // ctx is the work context of the watcher, nil until it starts.
+	running map[string]string // running maps a namespace to the token of its running renewal.
+	wg      sync.WaitGroup    // wg tracks the running renewals.
+}
+
+// newNamespaceRenewals initializes and returns a new namespaceRenewals.
+func newNamespaceRenewals() *namespaceRenewals {
+	return &namespaceRenewals{running: make(map[string]string)}
+}
+
+// start sets the context the renewals run with, once the watcher starts.
+func (r *namespaceRenewals) start(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ctx = ctx
+}
+
+// run calls renew in the background for the token of namespace, unless a renewal already runs in namespace.
+// It returns false when the watcher did not start yet, nothing runs then.
+func (r *namespaceRenewals) run(namespace, token string, renew func(ctx context.Context)) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ctx == nil {
+		return false
+	}
+	if running, ok := r.running[namespace]; ok {
+		klog.Infof("Renewal of namespace %s requested with token %q waits for the one with token %q", namespace, token, running)
+		return true
+	}
+	r.running[namespace] = token
+	r.wg.Add(1)
+	go func(ctx context.Context) {
+		defer r.wg.Done()
+		renew(ctx)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.running, namespace)
+	}(r.ctx)
+	return true
+}
+
+// wait waits for the running renewals to end.
+func (r *namespaceRenewals) wait() {
+	r.wg.Wait()
+}
+
+// startNamespaceRenewRequest runs handleNamespaceRenewRequest for adapter in the background. The result is recorded
+// in the status of adapter, whose update reconciles it again, so a token changed meanwhile runs next.
+// It returns false when the watcher did not start yet.
+func (iw *IngressWatcher) startNamespaceRenewRequest(adapter *v2.NimbleOpti) bool {
+	token := adapter.Spec.RenewRequestedAt
+	if token == "" || (adapter.Status.LastRenewRequest != nil && adapter.Status.LastRenewRequest.Token == token) {
+		return true
+	}
+	adapter = adapter.DeepCopy()
+	return iw.namespaceRenewals.run(adapter.Namespace, token, func(ctx context.Context) {
+		if err := iw.handleNamespaceRenewRequest(ctx, adapter); err != nil {
+			klog.ErrorS(err, "Failed to handle the renewal request", "nimbleopti", types.NamespacedName{Namespace: adapter.Namespace, Name: adapter.Name})
+		}
+	})
+}
+
+// handleNamespaceRenewRequest runs a forced renewal of every enabled Ingress of the namespace of adapter
+// when its spec.renewRequestedAt holds a token that was not handled yet, and records the result in its status.
+// The Ingresses of a policy with a staged rollout are only renewed once the first one of them was, see stagedRollout.
+func (iw *IngressWatcher) handleNamespaceRenewRequest(ctx context.Context, adapter *v2.NimbleOpti) error {
+	token := adapter.Spec.RenewRequestedAt
+	if token == "" || (adapter.Status.LastRenewRequest != nil && adapter.Status.LastRenewRequest.Token == token) {
+		return nil
+	}
+	if adapter.Spec.Suspend {
+		// The request stays pending, it runs once the namespace is resumed.
+		klog.Infof("Skipping the renewal of namespace %s requested with token %q, it is suspended", adapter.Namespace, token)
+		return nil
+	}
+
+	klog.Infof("Renewal of namespace %s requested with token %q", adapter.Namespace, token)
+	list := &networkingv1.IngressList{}
+	if err := iw.ClientObj.List(ctx, list, client.InNamespace(adapter.Namespace)); err != nil {
+		return fmt.Errorf("listing ingresses in namespace %q: %w", adapter.Namespace, err)
+	}
+	manager, err := iw.managingNimbleOpti(ctx, adapter.Namespace)
+	if err != nil {
+		return err
+	}
+	rollout := newStagedRollout(ingressPoliciesOf(adapter, manager))
+
+	// A failing ingress does not stop the others, its error is reported together with the rest.
+	var errs []error
+	renewed, total := 0, 0
+	for i := range list.Items {
+		ing := &list.Items[i]
+		if !iw.isAdapterEnabledLabel(ctx, ing) || !isBackendHttpsAnnotations(ctx, ing) {
+			continue
+		}
+		pol, err := iw.resolvePolicy(ctx, ing)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ingress %s: %w", utils.IngressKey(ing), err))
+			continue
+		}
+		if pol.Skip {
+			continue
+		}
+		if pol.Suspended {
+			// Suspended meanwhile, the request stays pending and runs again once the namespace is resumed.
+			klog.Infof("Stopping the renewal of namespace %s requested with token %q, it was suspended", adapter.Namespace, token)
+			return utilerrors.NewAggregate(errs)
+		}
+
+		total++
+		if rollout.holdBack(iw, ing) {
+			continue
+		}
+		ok, err := iw.forceRenewal(ctx, ing, pol)
+		if iw.inFlight.Draining() {
+			// Interrupted by the shutdown, the request stays pending and runs again on the next leader.
+			klog.Infof("Stopping the renewal of namespace %s requested with token %q, the watcher is shutting down", adapter.Namespace, token)
+			return utilerrors.NewAggregate(append(errs, err))
+		}
+		rollout.done(ing, ok && err == nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ingress %s: %w", utils.IngressKey(ing), err))
+			continue
+		}
+		if ok {
+			renewed++
+		}
+	}
+
+	renewErr := utilerrors.NewAggregate(append(errs, rollout.errs()...))
+	status := newRenewRequestStatus(token, renewed == total, renewErr)
+	if renewErr == nil {
+		status.Message = fmt.Sprintf("Renewed %d of %d ingresses", renewed, total)
+	}
+	iw.recordRenewRequest(adapter, status)
+
+	key := types.NamespacedName{Namespace: adapter.Namespace, Name: adapter.Name}
+	statusErr := iw.updateNimbleOptiStatus(ctx, key, func(s *v2.NimbleOptiStatus) {
+		s.LastRenewRequest = &status
+	})
+
+	return utilerrors.NewAggregate([]error{renewErr, statusErr})
+}
+
+// forceRenewal runs the renewal of ing whatever the expiry of its certificates. A pending ACME challenge is resolved,
+// otherwise every TLS secret is replaced as the strategy of pol says. It returns true when every challenge was resolved.
+// The renewal is recorded in the renewal history of ing.
+func (iw *IngressWatcher) forceRenewal(ctx context.Context, ing *networkingv1.Ingress, pol policy.Policy) (bool, error) {
+	var secretNames []string
+	if !isContainsAcmeChallenge(ctx, ing) && pol.Strategy != policy.StrategyChallengeOnly {
+		secretNames = tlsSecretNames(ing)
+		// Replacing the secrets requests new certificates, a resolved challenge was already requested.
+		if err := iw.refuseForAcmeBudget(ctx, ing); err != nil {
+			return false, err
+		}
+	}
+	renewCtx, attempt := iw.beginRenewal(withRenewalTrigger(ctx, v2.RenewalTriggerManual), ing, pol, secretNames)
+	renewed, err := iw.runForcedRenewal(renewCtx, ing, pol)
+	iw.finishRenewal(ctx, ing, attempt, renewed, err)
+	return renewed, err
+}
+
+// runForcedRenewal runs the steps of forceRenewal.
+func (iw *IngressWatcher) runForcedRenewal(ctx context.Context, ing *networkingv1.Ingress, pol policy.Policy) (bool, error) {
+	// A challenge cert-manager already started only needs to be resolved.
+	if isContainsAcmeChallenge(ctx, ing) {
+		return iw.startCertificateRenewal(ctx, ing, pol)
+	}
+	if pol.Strategy == policy.StrategyChallengeOnly {
+		return false, fmt.Errorf("no pending ACME challenge and strategy %s never replaces secrets", policy.StrategyChallengeOnly)
+	}
+	if len(ing.Spec.TLS) == 0 {
+		return false, errNoTLSSecret
+	}
+
+	// The secret names change with the secret-rename strategy, take them first.
+	secretNames := tlsSecretNames(ing)
+
+	renewed := true
+	var errs []error
+	for _, secretName := range secretNames {
+		if err := iw.replaceSecret(ctx, ing, pol, secretName); err != nil {
+			errs = append(errs, fmt.Errorf("secret %s: %w", secretName, err))
+			continue
+		}
+		isRenew, err := iw.startCertificateRenewal(ctx, ing, pol)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("secret %s: %w", secretName, err))
+			continue
+		}
+		renewed = renewed && isRenew
+	}
+
+	// NewAggregate returns nil when there are no errors.
+	return renewed && len(errs) == 0, utilerrors.NewAggregate(errs)
+}
+
+// tlsSecretNames returns the TLS secrets of ing.
+func tlsSecretNames(ing *networkingv1.Ingress) []string {
+	secretNames := make([]string, 0, len(ing.Spec.TLS))
+	for _, tlsSpec := range ing.Spec.TLS {
+		secretNames = append(secretNames, tlsSpec.SecretName)
+	}
+	return secretNames
+}
+
+// newRenewRequestStatus returns the status of the handled request token.
+func newRenewRequestStatus(token string, renewed bool, err error) v2.RenewRequestStatus {
+	status := v2.RenewRequestStatus{
+		Token:     token,
+		Result:    v2.RenewRequestNotRenewed,
+		HandledAt: metav1.Now(),
+	}
+	switch {
+	case err != nil:
+		status.Result = v2.RenewRequestFailed
+		status.Message = err.Error()
+	case renewed:
+		status.Result = v2.RenewRequestRenewed
+	}
+	return status
+}
+
+// recordRenewRequest records the result of a handled request as an event on obj.
+func (iw *IngressWatcher) recordRenewRequest(obj runtime.Object, status v2.RenewRequestStatus) {
+	if status.Result == v2.RenewRequestFailed {
+		klog.Errorf("Renewal request %q failed: %s", status.Token, status.Message)
+		iw.Recorder.Eventf(obj, corev1.EventTypeWarning, reasonRenewRequestFailed, "Renewal request %q failed: %s", status.Token, status.Message)
+		return
+	}
+	klog.Infof("Renewal request %q handled: %s", status.Token, status.Result)
+	iw.Recorder.Eventf(obj, corev1.EventTypeNormal, reasonRenewRequestHandled, "Renewal request %q handled: %s", status.Token, status.Result)
+}
+
+// updateNimbleOptiStatus applies mutate to the status of the NimbleOpti of key, retrying on conflicts.
+func (iw *IngressWatcher) updateNimbleOptiStatus(ctx context.Context, key types.NamespacedName, mutate func(*v2.NimbleOptiStatus)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		adapter := &v2.NimbleOpti{}
+		if err := iw.ClientObj.Get(ctx, key, adapter); err != nil {
+			return err
+		}
+		mutate(&adapter.Status)
+		return iw.ClientObj.Status().Update(ctx, adapter)
+	})
+}
+
+// findIngressRenewRequest returns the handled request of the Ingress name, nil when there is none.
+func findIngressRenewRequest(requests []v2.RenewRequestStatus, name string) *v2.RenewRequestStatus {
+	for i := range requests {
+		if requests[i].Ingress == name {
+			return &requests[i]
+		}
+	}
+	return nil
+}
+
+// setIngressRenewRequest replaces the handled request of the Ingress of status, or adds it.
+func setIngressRenewRequest(s *v2.NimbleOptiStatus, status v2.RenewRequestStatus) {
+	if existing := findIngressRenewRequest(s.IngressRenewRequests, status.Ingress); existing != nil {
+		*existing = status
+		return
+	}
+	s.IngressRenewRequests = append(s.IngressRenewRequests, status)
+}
+
+// pruneIngressRenewRequests drops the handled requests of the Ingresses missing from existing.
+func pruneIngressRenewRequests(s *v2.NimbleOptiStatus, existing map[string]bool) {
+	requests := s.IngressRenewRequests[:0]
+	for _, r := range s.IngressRenewRequests {
+		if existing[r.Ingress] {
+			requests = append(requests, r)
+		}
+	}
+	s.IngressRenewRequests = requests
+}
+
+// ingressNames returns the names of the Ingresses of namespace.
+func (iw *IngressWatcher) ingressNames(ctx context.Context, namespace string) (map[string]bool, error) {
+	list := &networkingv1.IngressList{}
+	if err := iw.ClientObj.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("listing ingresses in namespace %q: %w", namespace, err)
+	}
+	names := make(map[string]bool, len(list.Items))
+	for _, ing := range list.Items {
+		names[ing.Name] = true
+	}
+	return names, nil
+}
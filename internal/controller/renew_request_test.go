@@ -0,0 +1,216 @@
+// internal/controller/renew_request_test.go
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakec "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// setupRenewRequestWatcher returns an IngressWatcher on a fake client with the NimbleOpti status subresource.
+func setupRenewRequestWatcher(t *testing.T, objs ...client.Object) (*IngressWatcher, client.Client, *record.FakeRecorder) {
+	t.Helper()
+	require.NoError(t, v2.AddToScheme(scheme.Scheme))
+	fakeClient := fakec.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithStatusSubresource(&v2.NimbleOpti{}, &v2.ClusterNimbleOpti{}, &v2.NimbleOptiRenewal{}).
+		WithObjects(objs...).
+		Build()
+	iw, err := setupIngressWatcher(fakeClient)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	iw.Recorder = recorder
+	return iw, fakeClient, recorder
+}
+
+func TestHandleRenewRequest(t *testing.T) {
+	ctx := context.TODO()
+	handled := &v2.NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+		Spec: v2.NimbleOptiSpec{
+			RenewBefore:           &metav1.Duration{Duration: 30 * 24 * time.Hour},
+			ChallengeClearTimeout: &metav1.Duration{Duration: time.Second},
+		},
+		Status: v2.NimbleOptiStatus{
+			// The request of the deleted Ingress is dropped with the next handled request.
+			IngressRenewRequests: []v2.RenewRequestStatus{
+				{Ingress: "ing", Token: "t1", Result: v2.RenewRequestRenewed},
+				{Ingress: "deleted", Token: "t1", Result: v2.RenewRequestRenewed},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		nimbleOpti  *v2.NimbleOpti
+		annotations map[string]string
+		paths       []string
+		wantHandled bool
+		wantResult  v2.RenewRequestResult
+		wantMessage string
+		wantEvent   string
+	}{
+		{
+			name:        "no request",
+			annotations: map[string]string{},
+		},
+		{
+			name:        "token already handled",
+			nimbleOpti:  handled,
+			annotations: map[string]string{renewRequestedAtAnnotation: "t1"},
+		},
+		{
+			name:        "pending challenge is resolved",
+			nimbleOpti:  handled,
+			annotations: map[string]string{renewRequestedAtAnnotation: "t2"},
+			paths:       []string{"/.well-known/acme-challenge"},
+			wantHandled: true,
+			wantResult:  v2.RenewRequestNotRenewed,
+			wantEvent:   `Normal RenewRequestHandled Renewal request "t2" handled: NotRenewed`,
+		},
+		{
+			name:        "ingress without TLS secret fails",
+			annotations: map[string]string{renewRequestedAtAnnotation: "t1"},
+			paths:       []string{"/app"},
+			wantHandled: true,
+			wantResult:  v2.RenewRequestFailed,
+			wantMessage: errNoTLSSecret.Error(),
+			wantEvent:   `Warning RenewRequestFailed Renewal request "t1" failed: ingress has no TLS secret to renew`,
+		},
+		{
+			name: "challenge-only strategy cannot replace secrets",
+			annotations: map[string]string{
+				renewRequestedAtAnnotation: "t1",
+				policy.StrategyAnnotation:  "challenge-only",
+			},
+			paths:       []string{"/app"},
+			wantHandled: true,
+			wantResult:  v2.RenewRequestFailed,
+			wantMessage: "strategy challenge-only never replaces secrets",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objs []client.Object
+			if tt.nimbleOpti != nil {
+				objs = append(objs, tt.nimbleOpti.DeepCopy())
+			}
+			iw, fakeClient, recorder := setupRenewRequestWatcher(t, objs...)
+
+			tt.annotations[httpsAnnotation] = "HTTPS"
+			ing := generateIngress("ing", "default", nil, tt.paths, tt.annotations)
+			require.NoError(t, fakeClient.Create(ctx, ing))
+
+			pol, err := iw.resolvePolicy(ctx, ing)
+			require.NoError(t, err)
+			gotHandled, err := iw.handleRenewRequest(ctx, ing, pol)
+			assert.Equal(t, tt.wantHandled, gotHandled)
+			if tt.wantResult == v2.RenewRequestFailed {
+				assert.ErrorContains(t, err, tt.wantMessage)
+			} else {
+				assert.NoError(t, err)
+			}
+			if !tt.wantHandled {
+				assert.Empty(t, recorder.Events)
+				return
+			}
+
+			adapter := &v2.NimbleOpti{}
+			require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "default", Namespace: "default"}, adapter))
+			require.Len(t, adapter.Status.IngressRenewRequests, 1)
+			got := adapter.Status.IngressRenewRequests[0]
+			assert.Equal(t, "ing", got.Ingress)
+			assert.Equal(t, tt.annotations[renewRequestedAtAnnotation], got.Token)
+			assert.Equal(t, tt.wantResult, got.Result)
+			assert.Contains(t, got.Message, tt.wantMessage)
+			assert.False(t, got.HandledAt.IsZero())
+
+			if tt.wantEvent != "" {
+				require.Len(t, recorder.Events, 1)
+				assert.Contains(t, <-recorder.Events, tt.wantEvent)
+			}
+
+			// The handled token is not renewed again.
+			gotHandled, err = iw.handleRenewRequest(ctx, ing, pol)
+			assert.False(t, gotHandled)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestReconcileNamespaceRenewRequest(t *testing.T) {
+	ctx := context.TODO()
+	nimbleOpti := &v2.NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+		Spec: v2.NimbleOptiSpec{
+			RenewBefore:           &metav1.Duration{Duration: 30 * 24 * time.Hour},
+			ChallengeClearTimeout: &metav1.Duration{Duration: time.Second},
+			RenewRequestedAt:      "2026-10-18T10:00:00Z",
+		},
+	}
+	labels := map[string]string{"nimble.opti.adapter/enabled": "true"}
+	challenge := generateIngress("challenge", "default", labels, []string{"/.well-known/acme-challenge"}, map[string]string{httpsAnnotation: "HTTPS"})
+	noTLS := generateIngress("no-tls", "default", labels, []string{"/app"}, map[string]string{httpsAnnotation: "HTTPS"})
+	skipped := generateIngress("skipped", "default", labels, []string{"/app"}, map[string]string{httpsAnnotation: "HTTPS", policy.SkipAnnotation: "true"})
+	disabled := generateIngress("disabled", "default", nil, []string{"/app"}, map[string]string{httpsAnnotation: "HTTPS"})
+
+	iw, fakeClient, recorder := setupRenewRequestWatcher(t, nimbleOpti, challenge, noTLS, skipped, disabled)
+	r := &NimbleOptiReconciler{Client: fakeClient, IngressWatcher: iw}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "default", Namespace: "default"}}
+
+	// Until the watcher starts the request is retried.
+	result, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, renewRequestRequeueDelay, result.RequeueAfter)
+
+	// The renewal runs in the background, the reconcile does not wait for it.
+	iw.namespaceRenewals.start(ctx)
+	result, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Zero(t, result)
+	adapter := &v2.NimbleOpti{}
+	require.NoError(t, fakeClient.Get(ctx, req.NamespacedName, adapter))
+	assert.Nil(t, adapter.Status.LastRenewRequest)
+
+	// A reconcile meanwhile does not start it again.
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	iw.namespaceRenewals.wait()
+
+	require.NoError(t, fakeClient.Get(ctx, req.NamespacedName, adapter))
+	require.NotNil(t, adapter.Status.LastRenewRequest)
+	assert.Equal(t, "2026-10-18T10:00:00Z", adapter.Status.LastRenewRequest.Token)
+	assert.Equal(t, v2.RenewRequestFailed, adapter.Status.LastRenewRequest.Result)
+	assert.Equal(t, "ingress default/no-tls: ingress has no TLS secret to renew", adapter.Status.LastRenewRequest.Message)
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning RenewRequestFailed")
+
+	// The challenge of the enabled ingress was resolved and its annotation reinstated.
+	got := &networkingv1.Ingress{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "challenge", Namespace: "default"}, got))
+	assert.Equal(t, "HTTPS", got.Annotations[httpsAnnotation])
+
+	// A handled token is not renewed again.
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	iw.namespaceRenewals.wait()
+	assert.Empty(t, recorder.Events)
+
+	// A missing NimbleOpti is ignored.
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "gone", Namespace: "default"}})
+	assert.NoError(t, err)
+}
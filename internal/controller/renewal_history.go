@@ -0,0 +1,176 @@
+// internal/controller/renewal_history.go
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	errorsK8S "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// reasonRenewalOutcome is recorded on an Ingress whose policy names receivers of the outcome of its renewals.
+const reasonRenewalOutcome = "RenewalOutcome"
+
+// notifyAnnotation lists the receivers of a RenewalOutcome event, separated by commas.
+const notifyAnnotation = "nimble.opti.adapter/notify"
+
+const (
+	// renewalHistoryLimit is the number of renewals kept for each Ingress.
+	renewalHistoryLimit = 10
+	// renewalHistoryIngressLimit is the number of Ingresses a NimbleOpti keeps the renewals of,
+	// the Ingresses renewed the longest ago are dropped first.
+	renewalHistoryIngressLimit = 100
+)
+
+// Phases of a renewal.
+const (
+	// phaseSecretReplace is the deletion or the renaming of a TLS secret.
+	phaseSecretReplace = "SecretReplace"
+	// phaseChallengeAppear is the wait for cert-manager to add the ACME challenge path.
+	phaseChallengeAppear = "ChallengeAppear"
+	// phaseChallengeClear is the wait for the ACME challenge path to go away while the HTTPS annotation is removed.
+	phaseChallengeClear = "ChallengeClear"
+	// phaseAnnotationRestore is the reinstatement of the HTTPS annotation.
+	phaseAnnotationRestore = "AnnotationRestore"
+)
+
+// renewalContextKey is the type of the context keys of the renewal history.
+type renewalContextKey int
+
+const (
+	// renewalTriggerKey holds the v2.RenewalTrigger of the renewals run with the context.
+	renewalTriggerKey renewalContextKey = iota
+	// renewalAttemptKey holds the *renewalAttempt of the running renewal.
+	renewalAttemptKey
+)
+
+// withRenewalTrigger returns a copy of ctx whose renewals are recorded as started by trigger.
+func withRenewalTrigger(ctx context.Context, trigger v2.RenewalTrigger) context.Context {
+	return context.WithValue(ctx, renewalTriggerKey, trigger)
+}
+
+// renewalAttempt collects the record of a running renewal.
+type renewalAttempt struct {
+	record v2.RenewalAttempt
+	// resource is the NimbleOptiRenewal of the renewal, nil when none was created.
+	resource *types.NamespacedName
+}
+
+// beginRenewal starts the record of a renewal of ing run with pol, replacing secretNames, and creates its
+// NimbleOptiRenewal. The returned context carries it, so the steps of the renewal add their phase,
+// see renewalAttemptFrom. Without a trigger in ctx the renewal is recorded as started by an event.
+func (iw *IngressWatcher) beginRenewal(ctx context.Context, ing *networkingv1.Ingress, pol policy.Policy, secretNames []string) (context.Context, *renewalAttempt) {
+	trigger, ok := ctx.Value(renewalTriggerKey).(v2.RenewalTrigger)
+	if !ok {
+		trigger = v2.RenewalTriggerEvent
+	}
+	attempt := &renewalAttempt{record: v2.RenewalAttempt{
+		StartedAt: metav1.Now(),
+		Trigger:   trigger,
+		Strategy:  string(pol.Strategy),
+		Notify:    pol.Notify,
+	}}
+	iw.createRenewalResource(ctx, ing, attempt, secretNames)
+	return context.WithValue(ctx, renewalAttemptKey, attempt), attempt
+}
+
+// renewalAttemptFrom returns the renewal running with ctx, nil when there is none.
+func renewalAttemptFrom(ctx context.Context) *renewalAttempt {
+	attempt, _ := ctx.Value(renewalAttemptKey).(*renewalAttempt)
+	return attempt
+}
+
+// phase records the step name that started at start. It does nothing on a nil attempt.
+func (a *renewalAttempt) phase(name string, start time.Time) {
+	if a == nil {
+		return
+	}
+	a.record.Phases = append(a.record.Phases, v2.RenewalPhase{
+		Name:     name,
+		Duration: metav1.Duration{Duration: time.Since(start)},
+	})
+}
+
+// finishRenewal records the outcome of attempt in its NimbleOptiRenewal and in the renewal history of ing, in the status
+// of the NimbleOpti of its namespace. The history is informative only, failing to record it is logged and ignored.
+func (iw *IngressWatcher) finishRenewal(ctx context.Context, ing *networkingv1.Ingress, attempt *renewalAttempt, renewed bool, err error) {
+	attempt.record.FinishedAt = metav1.Now()
+	attempt.record.Outcome = v2.RenewRequestNotRenewed
+	switch {
+	case err != nil:
+		attempt.record.Outcome = v2.RenewRequestFailed
+		attempt.record.Message = err.Error()
+	case renewed:
+		attempt.record.Outcome = v2.RenewRequestRenewed
+	}
+	iw.finishRenewalResource(ctx, attempt)
+	iw.recordAcmeBudget(ctx, ing, renewed, err)
+	iw.notifyRenewal(ing, attempt.record)
+
+	key := types.NamespacedName{Namespace: ing.Namespace, Name: ing.Namespace}
+	statusErr := iw.updateNimbleOptiStatus(ctx, key, func(s *v2.NimbleOptiStatus) {
+		addRenewalAttempt(s, ing.Name, attempt.record)
+		s.LastRenewalOutcome = attempt.record.Outcome
+		finishedAt := attempt.record.FinishedAt
+		s.LastRenewalTime = &finishedAt
+	})
+	switch {
+	case errorsK8S.IsNotFound(statusErr):
+		klog.Infof("Not recording the renewal of ingress %s: no NimbleOpti in its namespace", utils.IngressKey(ing))
+	case statusErr != nil:
+		klog.Errorf("Failed to record the renewal of ingress %s: %v", utils.IngressKey(ing), statusErr)
+	}
+}
+
+// notifyRenewal reports the outcome of attempt to its receivers, by a RenewalOutcome event on ing whose
+// notifyAnnotation lists them. It does nothing when attempt has no receivers.
+func (iw *IngressWatcher) notifyRenewal(ing *networkingv1.Ingress, attempt v2.RenewalAttempt) {
+	if len(attempt.Notify) == 0 {
+		return
+	}
+	eventType := corev1.EventTypeNormal
+	message := fmt.Sprintf("Renewal outcome: %s", attempt.Outcome)
+	if attempt.Outcome == v2.RenewRequestFailed {
+		eventType = corev1.EventTypeWarning
+		message = fmt.Sprintf("%s: %s", message, attempt.Message)
+	}
+	annotations := map[string]string{notifyAnnotation: strings.Join(attempt.Notify, ",")}
+	iw.Recorder.AnnotatedEventf(ing, annotations, eventType, reasonRenewalOutcome, "%s", message)
+}
+
+// addRenewalAttempt adds attempt at the head of the renewal history of the Ingress name in s,
+// dropping the oldest entries past the limits.
+func addRenewalAttempt(s *v2.NimbleOptiStatus, name string, attempt v2.RenewalAttempt) {
+	entry := v2.IngressRenewalHistory{Ingress: name}
+	history := make([]v2.IngressRenewalHistory, 1, len(s.RenewalHistory)+1)
+	for _, h := range s.RenewalHistory {
+		if h.Ingress == name {
+			entry = h
+			continue
+		}
+		history = append(history, h)
+	}
+
+	entry.Attempts = append([]v2.RenewalAttempt{attempt}, entry.Attempts...)
+	if len(entry.Attempts) > renewalHistoryLimit {
+		entry.Attempts = entry.Attempts[:renewalHistoryLimit]
+	}
+
+	// The most recently renewed Ingress goes first, so the ones past the limit are the least recent.
+	history[0] = entry
+	if len(history) > renewalHistoryIngressLimit {
+		history = history[:renewalHistoryIngressLimit]
+	}
+	s.RenewalHistory = history
+}
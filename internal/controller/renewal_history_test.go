@@ -0,0 +1,165 @@
+// internal/controller/renewal_history_test.go
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestAddRenewalAttempt(t *testing.T) {
+	s := &v2.NimbleOptiStatus{}
+	for i := 0; i < renewalHistoryIngressLimit+1; i++ {
+		addRenewalAttempt(s, fmt.Sprintf("ing-%d", i), v2.RenewalAttempt{Message: "first"})
+	}
+	require.Len(t, s.RenewalHistory, renewalHistoryIngressLimit)
+	// The Ingress renewed the longest ago was dropped.
+	assert.Equal(t, fmt.Sprintf("ing-%d", renewalHistoryIngressLimit), s.RenewalHistory[0].Ingress)
+	assert.Equal(t, "ing-1", s.RenewalHistory[renewalHistoryIngressLimit-1].Ingress)
+
+	for i := 0; i < renewalHistoryLimit+1; i++ {
+		addRenewalAttempt(s, "ing-1", v2.RenewalAttempt{Message: fmt.Sprintf("attempt %d", i)})
+	}
+	require.Len(t, s.RenewalHistory, renewalHistoryIngressLimit)
+	got := s.RenewalHistory[0]
+	assert.Equal(t, "ing-1", got.Ingress)
+	require.Len(t, got.Attempts, renewalHistoryLimit)
+	assert.Equal(t, fmt.Sprintf("attempt %d", renewalHistoryLimit), got.Attempts[0].Message)
+	assert.Equal(t, "attempt 1", got.Attempts[renewalHistoryLimit-1].Message)
+}
+
+func TestRenewalHistory(t *testing.T) {
+	ctx := context.TODO()
+
+	tests := []struct {
+		name        string
+		paths       []string
+		renew       func(iw *IngressWatcher, ing *networkingv1.Ingress) error
+		wantTrigger v2.RenewalTrigger
+		wantOutcome v2.RenewRequestResult
+		wantMessage string
+		wantPhases  []string
+	}{
+		{
+			name:  "event renewal of a pending challenge",
+			paths: []string{"/.well-known/acme-challenge"},
+			renew: func(iw *IngressWatcher, ing *networkingv1.Ingress) error {
+				return iw.handleIngressAdd(ctx, ing)
+			},
+			wantTrigger: v2.RenewalTriggerEvent,
+			wantOutcome: v2.RenewRequestNotRenewed,
+			wantPhases:  []string{phaseChallengeClear, phaseAnnotationRestore},
+		},
+		{
+			name:  "audit renewal of a pending challenge",
+			paths: []string{"/.well-known/acme-challenge"},
+			renew: func(iw *IngressWatcher, ing *networkingv1.Ingress) error {
+				return iw.auditIngress(ctx, ing)
+			},
+			wantTrigger: v2.RenewalTriggerAudit,
+			wantOutcome: v2.RenewRequestNotRenewed,
+			wantPhases:  []string{phaseChallengeClear, phaseAnnotationRestore},
+		},
+		{
+			name:  "failed manual renewal",
+			paths: []string{"/app"},
+			renew: func(iw *IngressWatcher, ing *networkingv1.Ingress) error {
+				pol, err := iw.resolvePolicy(ctx, ing)
+				require.NoError(t, err)
+				_, err = iw.forceRenewal(ctx, ing, pol)
+				assert.ErrorIs(t, err, errNoTLSSecret)
+				return nil
+			},
+			wantTrigger: v2.RenewalTriggerManual,
+			wantOutcome: v2.RenewRequestFailed,
+			wantMessage: errNoTLSSecret.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nimbleOpti := &v2.NimbleOpti{
+				ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+				Spec: v2.NimbleOptiSpec{
+					ChallengeClearTimeout: &metav1.Duration{Duration: time.Second},
+				},
+			}
+			iw, fakeClient, _ := setupRenewRequestWatcher(t, nimbleOpti)
+			ing := generateIngress("ing", "default", map[string]string{"nimble.opti.adapter/enabled": "true"}, tt.paths,
+				map[string]string{httpsAnnotation: "HTTPS"})
+			require.NoError(t, fakeClient.Create(ctx, ing))
+
+			before := time.Now()
+			require.NoError(t, tt.renew(iw, ing))
+
+			adapter := &v2.NimbleOpti{}
+			require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "default", Namespace: "default"}, adapter))
+			require.Len(t, adapter.Status.RenewalHistory, 1)
+			history := adapter.Status.RenewalHistory[0]
+			assert.Equal(t, "ing", history.Ingress)
+			require.Len(t, history.Attempts, 1)
+
+			got := history.Attempts[0]
+			assert.Equal(t, tt.wantTrigger, got.Trigger)
+			assert.Equal(t, "auto", got.Strategy)
+			assert.Equal(t, tt.wantOutcome, got.Outcome)
+			assert.Equal(t, tt.wantMessage, got.Message)
+			assert.False(t, got.StartedAt.Time.Before(before.Truncate(time.Second)))
+			assert.False(t, got.FinishedAt.Before(&got.StartedAt))
+			var phases []string
+			for _, phase := range got.Phases {
+				phases = append(phases, phase.Name)
+			}
+			assert.Equal(t, tt.wantPhases, phases)
+
+			assert.Equal(t, tt.wantOutcome, adapter.Status.LastRenewalOutcome)
+			require.NotNil(t, adapter.Status.LastRenewalTime)
+			assert.True(t, adapter.Status.LastRenewalTime.Equal(&got.FinishedAt))
+		})
+	}
+}
+
+func TestRenewalHistoryWithoutNimbleOpti(t *testing.T) {
+	ctx := context.TODO()
+	iw, fakeClient, _ := setupRenewRequestWatcher(t)
+	ing := generateIngress("ing", "default", nil, []string{"/app"}, nil)
+	require.NoError(t, fakeClient.Create(ctx, ing))
+
+	// The renewal itself is not affected by the missing history.
+	_, attempt := iw.beginRenewal(ctx, ing, iw.clusterPolicy(nil), nil)
+	iw.finishRenewal(ctx, ing, attempt, true, nil)
+	assert.Equal(t, v2.RenewRequestRenewed, attempt.record.Outcome)
+}
+
+func TestNotifyRenewal(t *testing.T) {
+	ctx := context.TODO()
+	nimbleOpti := &v2.NimbleOpti{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"}}
+	iw, fakeClient, recorder := setupRenewRequestWatcher(t, nimbleOpti)
+	ing := generateIngress("ing", "default", nil, []string{"/app"}, nil)
+	require.NoError(t, fakeClient.Create(ctx, ing))
+
+	pol := iw.clusterPolicy(nil)
+	pol.Notify = []string{"slack:#team-web", "mailto:ops@example.com"}
+	_, attempt := iw.beginRenewal(ctx, ing, pol, nil)
+	iw.finishRenewal(ctx, ing, attempt, false, errors.New("boom"))
+	assert.Equal(t, "Warning RenewalOutcome Renewal outcome: Failed: boom map[nimble.opti.adapter/notify:slack:#team-web,mailto:ops@example.com]", <-recorder.Events)
+
+	adapter := &v2.NimbleOpti{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "default", Namespace: "default"}, adapter))
+	require.Len(t, adapter.Status.RenewalHistory, 1)
+	assert.Equal(t, pol.Notify, adapter.Status.RenewalHistory[0].Attempts[0].Notify)
+
+	// Without receivers no event is recorded.
+	_, attempt = iw.beginRenewal(ctx, ing, iw.clusterPolicy(nil), nil)
+	iw.finishRenewal(ctx, ing, attempt, true, nil)
+	assert.Empty(t, recorder.Events)
+}
@@ -0,0 +1,214 @@
+// internal/controller/renewal_resource.go
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// renewalIngressLabel on a NimbleOptiRenewal identifies its Ingress, see renewalIngressLabelValue.
+const renewalIngressLabel = "nimble.opti.adapter/ingress"
+
+// renewalIngressLabelValue returns the value of renewalIngressLabel for the Ingress name: the name itself,
+// or its hash when it is longer than a label value may be.
+func renewalIngressLabelValue(name string) string {
+	if len(name) <= validation.LabelValueMaxLength {
+		return name
+	}
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return fmt.Sprintf("%x", h.Sum64())
+}
+
+// renewalOwners remembers the NimbleOpti of each namespace read by the last policy resolution, see namespacePolicy.
+// It owns the NimbleOptiRenewals of the namespace, so creating one needs no other read.
+type renewalOwners struct {
+	mu     sync.Mutex
+	owners map[string]metav1.OwnerReference
+}
+
+// newRenewalOwners returns an empty renewalOwners.
+func newRenewalOwners() *renewalOwners {
+	return &renewalOwners{owners: map[string]metav1.OwnerReference{}}
+}
+
+// set remembers adapter as the owner of the renewals of namespace, a nil adapter forgets it.
+func (o *renewalOwners) set(namespace string, adapter *v2.NimbleOpti) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if adapter == nil {
+		delete(o.owners, namespace)
+		return
+	}
+	o.owners[namespace] = *metav1.NewControllerRef(adapter, v2.GroupVersion.WithKind("NimbleOpti"))
+}
+
+// get returns the owner of the renewals of namespace, false when it has no NimbleOpti.
+func (o *renewalOwners) get(namespace string) (metav1.OwnerReference, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	owner, ok := o.owners[namespace]
+	return owner, ok
+}
+
+// createRenewalResource creates the NimbleOptiRenewal of attempt, a renewal of ing, owned by the NimbleOpti of
+// its namespace so it is garbage collected with it. The NimbleOpti is the one read to resolve the policy of ing,
+// see renewalOwners. The finished renewals of ing past renewalHistoryLimit are deleted.
+// Like the renewal history the resource is informative only, failing to create it is logged and ignored.
+func (iw *IngressWatcher) createRenewalResource(ctx context.Context, ing *networkingv1.Ingress, attempt *renewalAttempt, secretNames []string) {
+	owner, ok := iw.renewalOwners.get(ing.Namespace)
+	if !ok {
+		klog.Infof("Not creating a NimbleOptiRenewal for ingress %s: no NimbleOpti in its namespace", utils.IngressKey(ing))
+		return
+	}
+
+	renewal := &v2.NimbleOptiRenewal{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName:    ing.Name + "-",
+			Namespace:       ing.Namespace,
+			Labels:          map[string]string{renewalIngressLabel: renewalIngressLabelValue(ing.Name)},
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+		Spec: v2.NimbleOptiRenewalSpec{
+			Ingress:     ing.Name,
+			SecretNames: secretNames,
+			Strategy:    attempt.record.Strategy,
+			Trigger:     attempt.record.Trigger,
+		},
+	}
+	if err := iw.ClientObj.Create(ctx, renewal); err != nil {
+		klog.Errorf("Failed to create a NimbleOptiRenewal for ingress %s: %v", utils.IngressKey(ing), err)
+		return
+	}
+	attempt.resource = &types.NamespacedName{Namespace: renewal.Namespace, Name: renewal.Name}
+	klog.Infof("Created NimbleOptiRenewal %s for ingress %s", attempt.resource, utils.IngressKey(ing))
+
+	started := attempt.record.StartedAt
+	iw.updateRenewalResource(ctx, attempt, func(s *v2.NimbleOptiRenewalStatus) {
+		s.StartTime = &started
+		setRenewalResourcePhase(s, v2.NimbleOptiRenewalPending, started)
+	})
+	iw.pruneRenewalResources(ctx, ing)
+}
+
+// setRenewalPhase moves the NimbleOptiRenewal of the running renewal to phase.
+// It does nothing on a nil attempt or one without a resource.
+func (iw *IngressWatcher) setRenewalPhase(ctx context.Context, attempt *renewalAttempt, phase v2.NimbleOptiRenewalPhase) {
+	iw.updateRenewalResource(ctx, attempt, func(s *v2.NimbleOptiRenewalStatus) {
+		setRenewalResourcePhase(s, phase, metav1.Now())
+	})
+}
+
+// finishRenewalResource records the outcome of attempt in its NimbleOptiRenewal, Succeeded only when the certificates
+// were renewed: a renewal that failed, or whose ACME challenge was not resolved in time, is Failed.
+func (iw *IngressWatcher) finishRenewalResource(ctx context.Context, attempt *renewalAttempt) {
+	finished := attempt.record.FinishedAt
+	iw.updateRenewalResource(ctx, attempt, func(s *v2.NimbleOptiRenewalStatus) {
+		s.CompletionTime = &finished
+		s.Message = attempt.record.Message
+		condition := metav1.Condition{
+			Type:    v2.NimbleOptiRenewalComplete,
+			Status:  metav1.ConditionTrue,
+			Reason:  string(attempt.record.Outcome),
+			Message: "The renewal finished",
+		}
+		phase := v2.NimbleOptiRenewalSucceeded
+		switch attempt.record.Outcome {
+		case v2.RenewRequestFailed:
+			phase = v2.NimbleOptiRenewalFailed
+			condition.Type = v2.NimbleOptiRenewalFailure
+			condition.Message = attempt.record.Message
+		case v2.RenewRequestNotRenewed:
+			phase = v2.NimbleOptiRenewalFailed
+			condition.Type = v2.NimbleOptiRenewalFailure
+			condition.Message = "The ACME challenge was not resolved in time"
+		}
+		setRenewalResourcePhase(s, phase, finished)
+		meta.SetStatusCondition(&s.Conditions, condition)
+	})
+}
+
+// updateRenewalResource applies mutate to the status of the NimbleOptiRenewal of attempt, retrying on conflicts.
+// It does nothing on a nil attempt or one without a resource, and only logs the errors.
+func (iw *IngressWatcher) updateRenewalResource(ctx context.Context, attempt *renewalAttempt, mutate func(*v2.NimbleOptiRenewalStatus)) {
+	if attempt == nil || attempt.resource == nil {
+		return
+	}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		renewal := &v2.NimbleOptiRenewal{}
+		if err := iw.ClientObj.Get(ctx, *attempt.resource, renewal); err != nil {
+			return err
+		}
+		mutate(&renewal.Status)
+		return iw.ClientObj.Status().Update(ctx, renewal)
+	})
+	if err != nil {
+		klog.Errorf("Failed to update NimbleOptiRenewal %s: %v", attempt.resource, err)
+	}
+}
+
+// setRenewalResourcePhase sets the phase of s, entered at t.
+func setRenewalResourcePhase(s *v2.NimbleOptiRenewalStatus, phase v2.NimbleOptiRenewalPhase, t metav1.Time) {
+	s.Phase = phase
+	s.PhaseTransitions = append(s.PhaseTransitions, v2.NimbleOptiRenewalPhaseTransition{Phase: phase, Time: t})
+}
+
+// pruneRenewalResources deletes the finished NimbleOptiRenewals of ing but the renewalHistoryLimit most recent ones.
+// Only the renewals labelled with ing are listed, see renewalIngressLabel.
+func (iw *IngressWatcher) pruneRenewalResources(ctx context.Context, ing *networkingv1.Ingress) {
+	list := &v2.NimbleOptiRenewalList{}
+	err := iw.ClientObj.List(ctx, list, client.InNamespace(ing.Namespace),
+		client.MatchingLabels{renewalIngressLabel: renewalIngressLabelValue(ing.Name)})
+	if err != nil {
+		klog.Errorf("Failed to list the NimbleOptiRenewals of ingress %s: %v", utils.IngressKey(ing), err)
+		return
+	}
+
+	// A hashed label value may be shared by another Ingress.
+	var renewals []*v2.NimbleOptiRenewal
+	for i := range list.Items {
+		if list.Items[i].Spec.Ingress == ing.Name {
+			renewals = append(renewals, &list.Items[i])
+		}
+	}
+	// The most recent first, the renewals not started yet are the most recent ones.
+	sort.SliceStable(renewals, func(i, j int) bool {
+		a, b := renewals[i].Status.StartTime, renewals[j].Status.StartTime
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return b.Before(a)
+	})
+
+	if len(renewals) <= renewalHistoryLimit {
+		return
+	}
+	for _, renewal := range renewals[renewalHistoryLimit:] {
+		if !isRenewalResourceFinished(renewal) {
+			continue
+		}
+		if err := iw.ClientObj.Delete(ctx, renewal); client.IgnoreNotFound(err) != nil {
+			klog.Errorf("Failed to delete NimbleOptiRenewal %s/%s: %v", renewal.Namespace, renewal.Name, err)
+		}
+	}
+}
+
+// isRenewalResourceFinished reports whether renewal succeeded or failed.
+func isRenewalResourceFinished(renewal *v2.NimbleOptiRenewal) bool {
+	return renewal.Status.Phase == v2.NimbleOptiRenewalSucceeded || renewal.Status.Phase == v2.NimbleOptiRenewalFailed
+}
@@ -0,0 +1,257 @@
+// internal/controller/renewal_resource_test.go
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakec "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestRenewalResource(t *testing.T) {
+	ctx := context.TODO()
+
+	tests := []struct {
+		name          string
+		paths         []string
+		renew         func(iw *IngressWatcher, ing *networkingv1.Ingress)
+		wantTrigger   v2.RenewalTrigger
+		wantPhases    []v2.NimbleOptiRenewalPhase
+		wantCondition string
+		wantReason    string
+	}{
+		{
+			name:  "event renewal of a pending challenge",
+			paths: []string{"/.well-known/acme-challenge"},
+			renew: func(iw *IngressWatcher, ing *networkingv1.Ingress) {
+				require.NoError(t, iw.handleIngressAdd(ctx, ing))
+			},
+			wantTrigger: v2.RenewalTriggerEvent,
+			wantPhases: []v2.NimbleOptiRenewalPhase{
+				v2.NimbleOptiRenewalPending,
+				v2.NimbleOptiRenewalAnnotationsSuspended,
+				v2.NimbleOptiRenewalChallengeInProgress,
+				v2.NimbleOptiRenewalRestoring,
+				v2.NimbleOptiRenewalFailed,
+			},
+			wantCondition: v2.NimbleOptiRenewalFailure,
+			wantReason:    string(v2.RenewRequestNotRenewed),
+		},
+		{
+			name:  "failed manual renewal",
+			paths: []string{"/app"},
+			renew: func(iw *IngressWatcher, ing *networkingv1.Ingress) {
+				pol, err := iw.resolvePolicy(ctx, ing)
+				require.NoError(t, err)
+				_, err = iw.forceRenewal(ctx, ing, pol)
+				assert.ErrorIs(t, err, errNoTLSSecret)
+			},
+			wantTrigger:   v2.RenewalTriggerManual,
+			wantPhases:    []v2.NimbleOptiRenewalPhase{v2.NimbleOptiRenewalPending, v2.NimbleOptiRenewalFailed},
+			wantCondition: v2.NimbleOptiRenewalFailure,
+			wantReason:    string(v2.RenewRequestFailed),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nimbleOpti := &v2.NimbleOpti{
+				ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+				Spec: v2.NimbleOptiSpec{
+					ChallengeClearTimeout: &metav1.Duration{Duration: time.Second},
+				},
+			}
+			iw, fakeClient, _ := setupRenewRequestWatcher(t, nimbleOpti)
+			ing := generateIngress("ing", "default", map[string]string{"nimble.opti.adapter/enabled": "true"}, tt.paths,
+				map[string]string{httpsAnnotation: "HTTPS"})
+			require.NoError(t, fakeClient.Create(ctx, ing))
+
+			tt.renew(iw, ing)
+
+			list := &v2.NimbleOptiRenewalList{}
+			require.NoError(t, fakeClient.List(ctx, list, client.InNamespace("default")))
+			require.Len(t, list.Items, 1)
+			renewal := list.Items[0]
+			assert.Equal(t, "ing", renewal.Spec.Ingress)
+			assert.Equal(t, "ing", renewal.Labels[renewalIngressLabel])
+			assert.Equal(t, tt.wantTrigger, renewal.Spec.Trigger)
+			assert.Equal(t, "auto", renewal.Spec.Strategy)
+			require.Len(t, renewal.OwnerReferences, 1)
+			assert.Equal(t, "NimbleOpti", renewal.OwnerReferences[0].Kind)
+			assert.Equal(t, "default", renewal.OwnerReferences[0].Name)
+
+			assert.Equal(t, tt.wantPhases[len(tt.wantPhases)-1], renewal.Status.Phase)
+			var phases []v2.NimbleOptiRenewalPhase
+			for _, transition := range renewal.Status.PhaseTransitions {
+				phases = append(phases, transition.Phase)
+			}
+			assert.Equal(t, tt.wantPhases, phases)
+			require.NotNil(t, renewal.Status.StartTime)
+			require.NotNil(t, renewal.Status.CompletionTime)
+			condition := meta.FindStatusCondition(renewal.Status.Conditions, tt.wantCondition)
+			require.NotNil(t, condition)
+			assert.Equal(t, tt.wantReason, condition.Reason)
+		})
+	}
+}
+
+func TestRenewalResourceWithoutNimbleOpti(t *testing.T) {
+	ctx := context.TODO()
+	iw, fakeClient, _ := setupRenewRequestWatcher(t)
+	ing := generateIngress("ing", "default", nil, []string{"/app"}, nil)
+	require.NoError(t, fakeClient.Create(ctx, ing))
+
+	_, attempt := iw.beginRenewal(ctx, ing, iw.clusterPolicy(nil), nil)
+	assert.Nil(t, attempt.resource)
+	iw.finishRenewal(ctx, ing, attempt, true, nil)
+
+	list := &v2.NimbleOptiRenewalList{}
+	require.NoError(t, fakeClient.List(ctx, list))
+	assert.Empty(t, list.Items)
+}
+
+func TestRenewalResourceReusesNimbleOpti(t *testing.T) {
+	ctx := context.TODO()
+	nimbleOpti := &v2.NimbleOpti{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default", UID: "uid-1"}}
+	gets := 0
+	fakeClient := fakec.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithStatusSubresource(&v2.NimbleOpti{}, &v2.NimbleOptiRenewal{}).
+		WithObjects(nimbleOpti).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if _, ok := obj.(*v2.NimbleOpti); ok {
+					gets++
+				}
+				return c.Get(ctx, key, obj, opts...)
+			},
+		}).Build()
+	iw, err := setupIngressWatcher(fakeClient)
+	require.NoError(t, err)
+	ing := generateIngress("ing", "default", nil, []string{"/app"}, nil)
+	require.NoError(t, fakeClient.Create(ctx, ing))
+
+	pol, err := iw.resolvePolicy(ctx, ing)
+	require.NoError(t, err)
+	gets = 0
+	_, attempt := iw.beginRenewal(ctx, ing, pol, nil)
+	require.NotNil(t, attempt.resource)
+	assert.Zero(t, gets, "the NimbleOpti read for the policy is reused")
+
+	renewal := &v2.NimbleOptiRenewal{}
+	require.NoError(t, fakeClient.Get(ctx, *attempt.resource, renewal))
+	require.Len(t, renewal.OwnerReferences, 1)
+	assert.Equal(t, nimbleOpti.UID, renewal.OwnerReferences[0].UID)
+}
+
+func TestRenewalIngressLabelValue(t *testing.T) {
+	assert.Equal(t, "ing", renewalIngressLabelValue("ing"))
+	long := strings.Repeat("a", 100)
+	value := renewalIngressLabelValue(long)
+	assert.Empty(t, validation.IsValidLabelValue(value))
+	assert.Equal(t, value, renewalIngressLabelValue(long))
+}
+
+func TestPruneRenewalResources(t *testing.T) {
+	ctx := context.TODO()
+	start := time.Now().Add(-time.Hour)
+	renewal := func(name, ingress string, age int, phase v2.NimbleOptiRenewalPhase) *v2.NimbleOptiRenewal {
+		started := metav1.NewTime(start.Add(time.Duration(age) * time.Minute))
+		return &v2.NimbleOptiRenewal{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{renewalIngressLabel: ingress}},
+			Spec:       v2.NimbleOptiRenewalSpec{Ingress: ingress},
+			Status:     v2.NimbleOptiRenewalStatus{Phase: phase, StartTime: &started},
+		}
+	}
+
+	var objs []client.Object
+	for i := 0; i < renewalHistoryLimit+2; i++ {
+		objs = append(objs, renewal(fmt.Sprintf("ing-%d", i), "ing", i, v2.NimbleOptiRenewalSucceeded))
+	}
+	// The oldest renewal is still running, it is kept.
+	objs[0].(*v2.NimbleOptiRenewal).Status.Phase = v2.NimbleOptiRenewalChallengeInProgress
+	objs = append(objs, renewal("other-0", "other", 0, v2.NimbleOptiRenewalFailed))
+	iw, fakeClient, _ := setupRenewRequestWatcher(t, objs...)
+
+	iw.pruneRenewalResources(ctx, generateIngress("ing", "default", nil, []string{"/app"}, nil))
+
+	list := &v2.NimbleOptiRenewalList{}
+	require.NoError(t, fakeClient.List(ctx, list))
+	var names []string
+	for _, item := range list.Items {
+		names = append(names, item.Name)
+	}
+	assert.Len(t, names, renewalHistoryLimit+2)
+	assert.Contains(t, names, "ing-0")
+	assert.NotContains(t, names, "ing-1")
+	assert.Contains(t, names, "ing-2")
+	assert.Contains(t, names, "other-0")
+}
+
+func TestNimbleOptiRenewalRetry(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		phase          v2.NimbleOptiRenewalPhase
+		annotations    map[string]string
+		wantToken      string
+		wantAnnotation bool
+	}{
+		{
+			name:        "failed renewal is retried",
+			phase:       v2.NimbleOptiRenewalFailed,
+			annotations: map[string]string{retryAnnotation: "true"},
+			wantToken:   "2024-05-01T10:00:00Z",
+		},
+		{
+			name:           "running renewal waits",
+			phase:          v2.NimbleOptiRenewalChallengeInProgress,
+			annotations:    map[string]string{retryAnnotation: "true"},
+			wantAnnotation: true,
+		},
+		{
+			name:  "renewal without the annotation",
+			phase: v2.NimbleOptiRenewalSucceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renewal := &v2.NimbleOptiRenewal{
+				ObjectMeta: metav1.ObjectMeta{Name: "ing-abcde", Namespace: "default", Annotations: tt.annotations},
+				Spec:       v2.NimbleOptiRenewalSpec{Ingress: "ing"},
+				Status:     v2.NimbleOptiRenewalStatus{Phase: tt.phase},
+			}
+			ing := generateIngress("ing", "default", nil, []string{"/app"}, nil)
+			_, fakeClient, recorder := setupRenewRequestWatcher(t, renewal, ing)
+			r := &NimbleOptiRenewalReconciler{Client: fakeClient, Recorder: recorder, now: func() time.Time { return now }}
+
+			key := types.NamespacedName{Name: "ing-abcde", Namespace: "default"}
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			require.NoError(t, err)
+
+			require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(ing), ing))
+			assert.Equal(t, tt.wantToken, ing.Annotations[renewRequestedAtAnnotation])
+			require.NoError(t, fakeClient.Get(ctx, key, renewal))
+			_, ok := renewal.Annotations[retryAnnotation]
+			assert.Equal(t, tt.wantAnnotation, ok)
+		})
+	}
+}
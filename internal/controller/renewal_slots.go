@@ -0,0 +1,61 @@
+// internal/controller/renewal_slots.go
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	"k8s.io/klog/v2"
+)
+
+// renewalSlotsKey is the context key of the *renewalSlots of an audit of every Ingress.
+type renewalSlotsKey struct{}
+
+// renewalSlots collects the Ingresses whose certificates are due for renewal during an audit of every Ingress.
+// Certificates issued together are due together, their renewals are scheduled in evenly spaced slots instead of
+// running at once, see scheduleRenewalSlots.
+type renewalSlots struct {
+	due []policy.Due
+}
+
+// withRenewalSlots returns a copy of ctx whose due renewals are collected in the returned renewalSlots.
+func withRenewalSlots(ctx context.Context) (context.Context, *renewalSlots) {
+	slots := &renewalSlots{}
+	return context.WithValue(ctx, renewalSlotsKey{}, slots), slots
+}
+
+// renewalSlotsFrom returns the renewalSlots of the audit run with ctx, nil outside of an audit of every Ingress.
+func renewalSlotsFrom(ctx context.Context) *renewalSlots {
+	slots, _ := ctx.Value(renewalSlotsKey{}).(*renewalSlots)
+	return slots
+}
+
+// add records that the certificate of the Ingress of key, expiring at expiry, is due for renewal.
+func (s *renewalSlots) add(key string, expiry time.Time) {
+	s.due = append(s.due, policy.Due{Key: key, Expiry: expiry})
+}
+
+// scheduleRenewalSlots schedules the audits renewing the certificates collected in slots, evenly spaced across
+// the audit interval, see policy.Slots: the soonest expiry is renewed at once, the next ones every interval/n.
+// A slot is capped at half of the time left before its certificate expires. It replaces any audit already
+// scheduled, such as the one catchUpDelay gives a crossing seen for the first time.
+func (iw *IngressWatcher) scheduleRenewalSlots(slots *renewalSlots) {
+	if len(slots.due) == 0 {
+		return
+	}
+	window := iw.config().Timings.AuditInterval.Duration
+	offsets := policy.Slots(slots.due, window)
+	for _, due := range slots.due {
+		offset := offsets[due.Key]
+		if limit := due.Expiry.Sub(iw.now()) / 2; offset > limit {
+			offset = limit
+		}
+		if offset < 0 {
+			offset = 0
+		}
+		klog.Infof("Scheduling the renewal of ingress %s in %v, %d certificates are due within %v", due.Key, offset, len(slots.due), window)
+		iw.rescheduleAudit(due.Key, offset)
+	}
+}
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestAuditIngressResourcesRenewalSlots(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().Truncate(time.Second)
+	day := 24 * time.Hour
+
+	nimbleOpti := &v2.NimbleOpti{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"}}
+	iw, fakeClient, _ := setupRenewRequestWatcher(t, nimbleOpti)
+	iw.now = func() time.Time { return now }
+	iw.Config.Timings.AuditInterval.Duration = day
+
+	// Issued together, the four certificates are due within the 30 days of the default threshold.
+	expiries := map[string]time.Duration{"a": 5 * day, "b": 3 * day, "c": 4 * day, "d": 6 * day}
+	for name, expiry := range expiries {
+		require.NoError(t, fakeClient.Create(ctx, generateTLSSecret(t, name+"-tls", "default", now.Add(expiry))))
+		ing := generateIngress(name, "default", map[string]string{enabledLabel: "true"}, []string{"/app"},
+			map[string]string{httpsAnnotation: "HTTPS"})
+		ing.Spec.TLS = []networkingv1.IngressTLS{{SecretName: name + "-tls"}}
+		require.NoError(t, fakeClient.Create(ctx, ing))
+	}
+
+	require.NoError(t, iw.auditIngressResources(ctx))
+
+	// None is renewed by the audit, each is scheduled a quarter of the audit interval after the previous expiry.
+	assert.Equal(t, map[string]time.Time{
+		"default/b": now,
+		"default/c": now.Add(6 * time.Hour),
+		"default/a": now.Add(12 * time.Hour),
+		"default/d": now.Add(18 * time.Hour),
+	}, iw.scheduled)
+	for name := range expiries {
+		assert.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: name + "-tls"}, &corev1.Secret{}))
+	}
+	got := &v2.NimbleOpti{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(nimbleOpti), got))
+	assert.Empty(t, got.Status.RenewalHistory)
+
+	// A certificate about to expire does not wait past half of its remaining time.
+	slots := &renewalSlots{}
+	slots.add("default/b", now.Add(time.Hour))
+	slots.add("default/e", now.Add(2*time.Hour))
+	iw.scheduleRenewalSlots(slots)
+	assert.Equal(t, now, iw.scheduled["default/b"])
+	assert.Equal(t, now.Add(time.Hour), iw.scheduled["default/e"])
+}
@@ -0,0 +1,169 @@
+// internal/controller/staged_rollout.go
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	errorsK8S "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reasonRenewalHeldBack is recorded on an Ingress whose renewal was held back by the failed canary of its policy.
+const reasonRenewalHeldBack = "RenewalHeldBack"
+
+// stagedRollout tracks the canaries of the staged policies during the renewal of a namespace, requested or audited:
+// the first Ingress renewed of each policy, whose outcome gates the renewal of the others.
+type stagedRollout struct {
+	// policies is the NimbleOpti holding the policies of the Ingresses, nil when there is none.
+	policies *v2.NimbleOpti
+	// canaries holds the canary of each staged policy renewed so far.
+	canaries map[string]canary
+	// heldBack holds the staged policies with held back Ingresses, in the order they were held back.
+	heldBack []string
+	// held counts the Ingresses held back by each staged policy.
+	held map[string]int
+}
+
+// canary is the first Ingress renewed of a staged policy.
+type canary struct {
+	ingress string
+	renewed bool
+}
+
+// newStagedRollout returns the rollout of the Ingresses matching the policies of the NimbleOpti policies, which may be nil.
+func newStagedRollout(policies *v2.NimbleOpti) *stagedRollout {
+	return &stagedRollout{policies: policies, canaries: map[string]canary{}, held: map[string]int{}}
+}
+
+// group returns the staged policy of ing, empty when its renewal is not staged.
+func (r *stagedRollout) group(ing *networkingv1.Ingress) string {
+	if r.policies == nil {
+		return ""
+	}
+	// An invalid selector is reported by resolvePolicy, the Ingress is not staged.
+	p, err := matchIngressPolicy(r.policies, ing)
+	if err != nil || p == nil || !p.StagedRollout {
+		return ""
+	}
+	return p.Name
+}
+
+// holdBack reports whether the renewal of ing must wait, because the canary of its policy was not renewed.
+// The canary itself is never held back, its other secrets are renewed. A held back Ingress is reported by an event.
+func (r *stagedRollout) holdBack(iw *IngressWatcher, ing *networkingv1.Ingress) bool {
+	group := r.group(ing)
+	c, ok := r.canaries[group]
+	if group == "" || !ok || c.renewed || c.ingress == ing.Name {
+		return false
+	}
+
+	klog.Infof("Holding back the renewal of ingress %s, the canary %s of policy %s was not renewed", utils.IngressKey(ing), c.ingress, group)
+	iw.Recorder.Eventf(ing, corev1.EventTypeWarning, reasonRenewalHeldBack,
+		"Renewal held back, the canary %s of policy %s was not renewed", c.ingress, group)
+	if r.held[group] == 0 {
+		r.heldBack = append(r.heldBack, group)
+	}
+	r.held[group]++
+	return true
+}
+
+// done records the outcome of the renewal of ing, which makes it the canary of its policy when it is the first one.
+func (r *stagedRollout) done(ing *networkingv1.Ingress, renewed bool) {
+	group := r.group(ing)
+	if _, ok := r.canaries[group]; group == "" || ok {
+		return
+	}
+	r.canaries[group] = canary{ingress: ing.Name, renewed: renewed}
+}
+
+// errs returns an error for each staged policy whose Ingresses were held back.
+func (r *stagedRollout) errs() []error {
+	var errs []error
+	for _, group := range r.heldBack {
+		errs = append(errs, fmt.Errorf("policy %s: canary ingress %s was not renewed, held back %d ingresses",
+			group, r.canaries[group].ingress, r.held[group]))
+	}
+	return errs
+}
+
+// stagedRollouts holds the rollout of each namespace from one audit of every Ingress to the next, so the Ingresses
+// of a staged policy are only renewed once its canary was, as for a requested renewal of the namespace. The renewals
+// the audit schedules in their slots, see scheduleRenewalSlots, share it. It is safe for concurrent use.
+type stagedRollouts struct {
+	mu sync.Mutex // mu protects the fields below.
+	// rollouts maps a namespace to its rollout, created on the first renewal of the namespace.
+	rollouts map[string]*stagedRollout
+	// namespaces holds the namespaces of rollouts in the order they were created.
+	namespaces []string
+}
+
+// newStagedRollouts initializes and returns a new stagedRollouts.
+func newStagedRollouts() *stagedRollouts {
+	return &stagedRollouts{rollouts: map[string]*stagedRollout{}}
+}
+
+// reset forgets the rollouts, each audit of every Ingress starts new ones.
+func (s *stagedRollouts) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rollouts = map[string]*stagedRollout{}
+	s.namespaces = nil
+}
+
+// holdBackRenewal reports whether the renewal of ing must wait for the canary of its staged policy, see
+// stagedRollout.holdBack. The policies of its namespace are read on its first renewal since the last audit.
+func (iw *IngressWatcher) holdBackRenewal(ctx context.Context, ing *networkingv1.Ingress) (bool, error) {
+	s := iw.rollouts
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rollout, ok := s.rollouts[ing.Namespace]
+	if !ok {
+		adapter := &v2.NimbleOpti{}
+		if err := iw.ClientObj.Get(ctx, client.ObjectKey{Namespace: ing.Namespace, Name: ing.Namespace}, adapter); err != nil {
+			if !errorsK8S.IsNotFound(err) {
+				return false, fmt.Errorf("getting the nimbleopti of namespace %q: %w", ing.Namespace, err)
+			}
+			adapter = nil
+		}
+		manager, err := iw.managingNimbleOpti(ctx, ing.Namespace)
+		if err != nil {
+			return false, err
+		}
+		rollout = newStagedRollout(ingressPoliciesOf(adapter, manager))
+		s.rollouts[ing.Namespace] = rollout
+		s.namespaces = append(s.namespaces, ing.Namespace)
+	}
+	return rollout.holdBack(iw, ing), nil
+}
+
+// done records the outcome of the renewal of ing, see stagedRollout.done.
+func (s *stagedRollouts) done(ing *networkingv1.Ingress, renewed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rollout, ok := s.rollouts[ing.Namespace]; ok {
+		rollout.done(ing, renewed)
+	}
+}
+
+// errs returns an error for each staged policy whose Ingresses were held back, by namespace.
+func (s *stagedRollouts) errs() []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, ns := range s.namespaces {
+		for _, err := range s.rollouts[ns].errs() {
+			errs = append(errs, fmt.Errorf("namespace %s: %w", ns, err))
+		}
+	}
+	return errs
+}
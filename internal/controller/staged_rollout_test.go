@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestHandleNamespaceRenewRequestStagedRollout(t *testing.T) {
+	ctx := context.TODO()
+
+	tests := []struct {
+		name        string
+		staged      bool
+		wantMessage string
+		wantHistory []string
+	}{
+		{
+			name:        "failed canary holds back its policy",
+			staged:      true,
+			wantMessage: "[ingress default/a-canary: ingress has no TLS secret to renew, policy web: canary ingress a-canary was not renewed, held back 1 ingresses]",
+			wantHistory: []string{"a-canary"},
+		},
+		{
+			name:        "unstaged policy renews every ingress",
+			wantMessage: "ingress default/a-canary: ingress has no TLS secret to renew",
+			wantHistory: []string{"b-member", "a-canary"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nimbleOpti := &v2.NimbleOpti{
+				ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+				Spec: v2.NimbleOptiSpec{
+					RenewBefore:           &metav1.Duration{Duration: 30 * 24 * time.Hour},
+					ChallengeClearTimeout: &metav1.Duration{Duration: time.Second},
+					RenewRequestedAt:      "2026-10-18T10:00:00Z",
+					Policies: []v2.IngressPolicy{{
+						Name:          "web",
+						Selector:      &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "web"}},
+						StagedRollout: tt.staged,
+					}},
+				},
+			}
+			labels := map[string]string{"nimble.opti.adapter/enabled": "true", "tier": "web"}
+			annotations := map[string]string{httpsAnnotation: "HTTPS"}
+			// The canary is listed first and fails, it has no TLS secret.
+			canary := generateIngress("a-canary", "default", labels, []string{"/app"}, annotations)
+			member := generateIngress("b-member", "default", labels, []string{"/.well-known/acme-challenge"}, annotations)
+
+			iw, fakeClient, recorder := setupRenewRequestWatcher(t, nimbleOpti, canary, member)
+			require.Error(t, iw.handleNamespaceRenewRequest(ctx, nimbleOpti))
+
+			adapter := &v2.NimbleOpti{}
+			require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "default", Namespace: "default"}, adapter))
+			require.NotNil(t, adapter.Status.LastRenewRequest)
+			assert.Equal(t, v2.RenewRequestFailed, adapter.Status.LastRenewRequest.Result)
+			assert.Equal(t, tt.wantMessage, adapter.Status.LastRenewRequest.Message)
+
+			var history []string
+			for _, h := range adapter.Status.RenewalHistory {
+				history = append(history, h.Ingress)
+			}
+			assert.Equal(t, tt.wantHistory, history)
+
+			if tt.staged {
+				assert.Contains(t, <-recorder.Events, "Warning RenewalHeldBack Renewal held back, the canary a-canary of policy web was not renewed")
+			}
+		})
+	}
+}
+
+func TestAuditIngressResourcesStagedRollout(t *testing.T) {
+	ctx := context.TODO()
+
+	tests := []struct {
+		name        string
+		staged      bool
+		wantErr     string
+		wantHistory []string
+	}{
+		{
+			name:        "failed canary holds back its policy",
+			staged:      true,
+			wantErr:     "namespace default: policy web: canary ingress a-canary was not renewed, held back 1 ingresses",
+			wantHistory: []string{"a-canary"},
+		},
+		{
+			name:        "unstaged policy renews every ingress",
+			wantHistory: []string{"b-member", "a-canary"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nimbleOpti := &v2.NimbleOpti{
+				ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+				Spec: v2.NimbleOptiSpec{
+					ChallengeClearTimeout: &metav1.Duration{Duration: time.Second},
+					Policies: []v2.IngressPolicy{{
+						Name:          "web",
+						Selector:      &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "web"}},
+						StagedRollout: tt.staged,
+					}},
+				},
+			}
+			labels := map[string]string{"nimble.opti.adapter/enabled": "true", "tier": "web"}
+			annotations := map[string]string{httpsAnnotation: "HTTPS"}
+			// The canary is listed first and fails, its ACME challenge never clears.
+			canary := generateIngress("a-canary", "default", labels, []string{"/.well-known/acme-challenge"}, annotations)
+			member := generateIngress("b-member", "default", labels, []string{"/.well-known/acme-challenge"}, annotations)
+
+			iw, fakeClient, recorder := setupRenewRequestWatcher(t, nimbleOpti, canary, member)
+			err := iw.auditIngressResources(ctx)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			adapter := &v2.NimbleOpti{}
+			require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "default", Namespace: "default"}, adapter))
+			var history []string
+			for _, h := range adapter.Status.RenewalHistory {
+				history = append(history, h.Ingress)
+			}
+			assert.Equal(t, tt.wantHistory, history)
+
+			if tt.staged {
+				var events []string
+				for len(recorder.Events) > 0 {
+					events = append(events, <-recorder.Events)
+				}
+				assert.Contains(t, events, "Warning RenewalHeldBack Renewal held back, the canary a-canary of policy web was not renewed")
+			}
+		})
+	}
+}
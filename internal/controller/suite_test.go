@@ -33,6 +33,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	adapterv1 "github.com/uri-tech/nimble-opti-adapter/api/v1"
+	adapterv2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -75,6 +76,8 @@ var _ = BeforeSuite(func() {
 	// The scheme defines the mapping between Golang structs and Kubernetes API Groups, Versions, and Kinds.
 	err = adapterv1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
+	err = adapterv2.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
 
 	// Initialize the client, it's used to interact with the Kubernetes API
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
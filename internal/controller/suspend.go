@@ -0,0 +1,164 @@
+// internal/controller/suspend.go
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// reasonRenewalSuspended is recorded on an Ingress whose renewal is skipped or interrupted
+// because the NimbleOpti of its namespace is suspended.
+const reasonRenewalSuspended = "RenewalSuspended"
+
+// conditionSuspended is the condition type of a NimbleOpti reporting spec.suspend.
+const conditionSuspended = "Suspended"
+
+// errRenewalSuspended is returned by a renewal interrupted because its namespace got suspended.
+var errRenewalSuspended = errors.New("renewal interrupted: the NimbleOpti of the namespace is suspended")
+
+// suspension tracks the suspended namespaces and cancels the renewals running in a namespace when it gets suspended.
+type suspension struct {
+	mu        sync.Mutex                             // mu protects the fields below.
+	suspended map[string]bool                        // suspended holds the suspended namespaces.
+	cancels   map[string]map[*int]context.CancelFunc // cancels maps a namespace to the cancel functions of its running renewals.
+}
+
+// newSuspension initializes and returns a new suspension.
+func newSuspension() *suspension {
+	return &suspension{
+		suspended: make(map[string]bool),
+		cancels:   make(map[string]map[*int]context.CancelFunc),
+	}
+}
+
+// set records whether namespace is suspended. Suspending it cancels the contexts of its running renewals.
+func (s *suspension) set(namespace string, suspended bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !suspended {
+		delete(s.suspended, namespace)
+		return
+	}
+	s.suspended[namespace] = true
+	for _, cancel := range s.cancels[namespace] {
+		cancel()
+	}
+}
+
+// isSuspended reports whether namespace is suspended.
+func (s *suspension) isSuspended(namespace string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.suspended[namespace]
+}
+
+// context returns a copy of ctx cancelled when namespace gets suspended, already cancelled when it is.
+// The returned stop function must be called once the work ended.
+func (s *suspension) context(ctx context.Context, namespace string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.suspended[namespace] {
+		cancel()
+		return ctx, cancel
+	}
+	id := new(int)
+	if s.cancels[namespace] == nil {
+		s.cancels[namespace] = make(map[*int]context.CancelFunc)
+	}
+	s.cancels[namespace][id] = cancel
+
+	return ctx, func() {
+		s.mu.Lock()
+		delete(s.cancels[namespace], id)
+		if len(s.cancels[namespace]) == 0 {
+			delete(s.cancels, namespace)
+		}
+		s.mu.Unlock()
+		cancel()
+	}
+}
+
+// reportSuspended records a RenewalSuspended event on ing when a renewal is pending while its namespace is
+// suspended: an ACME challenge to resolve, an on-demand request, or, with checkExpiry, a certificate due for renewal.
+func (iw *IngressWatcher) reportSuspended(ctx context.Context, ing *networkingv1.Ingress, pol policy.Policy, checkExpiry bool) {
+	var pending string
+	switch {
+	case isContainsAcmeChallenge(ctx, ing):
+		pending = "an ACME challenge is pending"
+	case iw.pendingRenewRequest(ctx, ing):
+		pending = fmt.Sprintf("renewal %q is requested", ing.Annotations[renewRequestedAtAnnotation])
+	case checkExpiry && len(ing.Spec.TLS) > 0 && pol.Strategy != policy.StrategyChallengeOnly:
+		if remaining, ok := iw.timeUntilExpiry(ctx, ing); ok && remaining <= pol.RenewBefore {
+			pending = fmt.Sprintf("the certificate expires in %v", remaining.Round(time.Second))
+		}
+	}
+	if pending == "" {
+		return
+	}
+
+	klog.Infof("Skipping the renewal of ingress %s, its namespace is suspended: %s", utils.IngressKey(ing), pending)
+	iw.Recorder.Eventf(ing, corev1.EventTypeNormal, reasonRenewalSuspended, "Renewal skipped, the NimbleOpti of the namespace is suspended: %s", pending)
+}
+
+// pendingRenewRequest reports whether the renew-requested-at annotation of ing holds a token that was not handled yet.
+func (iw *IngressWatcher) pendingRenewRequest(ctx context.Context, ing *networkingv1.Ingress) bool {
+	token := ing.Annotations[renewRequestedAtAnnotation]
+	if token == "" {
+		return false
+	}
+	adapter := &v2.NimbleOpti{}
+	if err := iw.ClientObj.Get(ctx, types.NamespacedName{Namespace: ing.Namespace, Name: ing.Namespace}, adapter); err != nil {
+		return true
+	}
+	handled := findIngressRenewRequest(adapter.Status.IngressRenewRequests, ing.Name)
+	return handled == nil || handled.Token != token
+}
+
+// updateSuspended records spec.suspend of adapter: the renewals running in its namespace are interrupted
+// when it is set, and the Suspended condition of its status follows it.
+func (iw *IngressWatcher) updateSuspended(ctx context.Context, adapter *v2.NimbleOpti) error {
+	// The renewals only read the NimbleOpti named after its namespace, see getOrCreateNimbleOpti.
+	if adapter.Name == adapter.Namespace {
+		iw.suspension.set(adapter.Namespace, adapter.Spec.Suspend)
+	}
+
+	condition := metav1.Condition{
+		Type:               conditionSuspended,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Active",
+		Message:            "Renewals run",
+		ObservedGeneration: adapter.Generation,
+	}
+	if adapter.Spec.Suspend {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Suspended"
+		condition.Message = "Renewals are paused by spec.suspend"
+	}
+	if existing := meta.FindStatusCondition(adapter.Status.Conditions, conditionSuspended); existing != nil &&
+		existing.Status == condition.Status && existing.ObservedGeneration == condition.ObservedGeneration {
+		return nil
+	}
+
+	key := types.NamespacedName{Namespace: adapter.Namespace, Name: adapter.Name}
+	return iw.updateNimbleOptiStatus(ctx, key, func(s *v2.NimbleOptiStatus) {
+		meta.SetStatusCondition(&s.Conditions, condition)
+	})
+}
@@ -0,0 +1,193 @@
+// internal/controller/suspend_test.go
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSuspensionContext(t *testing.T) {
+	s := newSuspension()
+
+	running, stopRunning := s.context(context.TODO(), "team-a")
+	other, stopOther := s.context(context.TODO(), "team-b")
+	defer stopOther()
+
+	s.set("team-a", true)
+	assert.Error(t, running.Err(), "suspending the namespace cancels its running work")
+	assert.NoError(t, other.Err())
+	stopRunning()
+
+	suspended, stop := s.context(context.TODO(), "team-a")
+	assert.Error(t, suspended.Err(), "new work of a suspended namespace is cancelled at once")
+	stop()
+
+	s.set("team-a", false)
+	resumed, stop := s.context(context.TODO(), "team-a")
+	assert.NoError(t, resumed.Err())
+	stop()
+	assert.Error(t, resumed.Err(), "stop cancels the context")
+	assert.Empty(t, s.cancels["team-a"])
+}
+
+func TestSuspendedNamespace(t *testing.T) {
+	ctx := context.TODO()
+	suspended := &v2.NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+		Spec:       v2.NimbleOptiSpec{Suspend: true},
+	}
+
+	tests := []struct {
+		name        string
+		paths       []string
+		annotations map[string]string
+		audit       bool
+		wantEvent   string
+	}{
+		{
+			name:      "pending challenge is skipped",
+			paths:     []string{"/app", "/.well-known/acme-challenge"},
+			wantEvent: "Normal RenewalSuspended Renewal skipped, the NimbleOpti of the namespace is suspended: an ACME challenge is pending",
+		},
+		{
+			name:        "on-demand request is skipped",
+			paths:       []string{"/app"},
+			annotations: map[string]string{renewRequestedAtAnnotation: "t1"},
+			audit:       true,
+			wantEvent:   `Normal RenewalSuspended Renewal skipped, the NimbleOpti of the namespace is suspended: renewal "t1" is requested`,
+		},
+		{
+			name:  "nothing pending",
+			paths: []string{"/app"},
+			audit: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iw, fakeClient, recorder := setupRenewRequestWatcher(t, suspended.DeepCopy())
+			annotations := map[string]string{httpsAnnotation: "HTTPS"}
+			for k, v := range tt.annotations {
+				annotations[k] = v
+			}
+			ing := generateIngress("ing", "default", map[string]string{"nimble.opti.adapter/enabled": "true"}, tt.paths, annotations)
+			require.NoError(t, fakeClient.Create(ctx, ing))
+
+			if tt.audit {
+				require.NoError(t, iw.auditIngress(ctx, ing))
+			} else {
+				require.NoError(t, iw.handleIngressAdd(ctx, ing))
+			}
+
+			got := &networkingv1.Ingress{}
+			require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "ing", Namespace: "default"}, got))
+			assert.Equal(t, "HTTPS", got.Annotations[httpsAnnotation])
+
+			adapter := &v2.NimbleOpti{}
+			require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "default", Namespace: "default"}, adapter))
+			assert.Empty(t, adapter.Status.IngressRenewRequests, "a skipped request stays pending")
+			assert.Empty(t, adapter.Status.RenewalHistory)
+
+			if tt.wantEvent == "" {
+				assert.Empty(t, recorder.Events)
+				return
+			}
+			require.Len(t, recorder.Events, 1)
+			assert.Equal(t, tt.wantEvent, <-recorder.Events)
+		})
+	}
+}
+
+func TestSuspendInterruptsRenewal(t *testing.T) {
+	ctx := context.TODO()
+	nimbleOpti := &v2.NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"},
+		Spec: v2.NimbleOptiSpec{
+			ChallengeClearTimeout: &metav1.Duration{Duration: time.Minute},
+			PollInterval:          &metav1.Duration{Duration: 10 * time.Millisecond},
+		},
+	}
+	iw, fakeClient, recorder := setupRenewRequestWatcher(t, nimbleOpti)
+	ing := generateIngress("ing", "default", map[string]string{"nimble.opti.adapter/enabled": "true"},
+		[]string{"/app", "/.well-known/acme-challenge"}, map[string]string{httpsAnnotation: "HTTPS"})
+	require.NoError(t, fakeClient.Create(ctx, ing))
+
+	pol, err := iw.resolvePolicy(ctx, ing)
+	require.NoError(t, err)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := iw.startCertificateRenewal(ctx, ing, pol)
+		errCh <- err
+	}()
+
+	// Suspend the namespace once the renewal removed the annotation.
+	key := types.NamespacedName{Name: "ing", Namespace: "default"}
+	require.Eventually(t, func() bool {
+		got := &networkingv1.Ingress{}
+		return fakeClient.Get(ctx, key, got) == nil && got.Annotations[httpsAnnotation] == ""
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "default", Namespace: "default"}, nimbleOpti))
+	nimbleOpti.Spec.Suspend = true
+	require.NoError(t, iw.updateSuspended(ctx, nimbleOpti))
+
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, errRenewalSuspended)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the renewal was not interrupted")
+	}
+
+	got := &networkingv1.Ingress{}
+	require.NoError(t, fakeClient.Get(ctx, key, got))
+	assert.Equal(t, "HTTPS", got.Annotations[httpsAnnotation], "the annotation is restored")
+	assert.Empty(t, iw.inFlight.Pending())
+	require.Len(t, recorder.Events, 1)
+	assert.Equal(t, "Warning RenewalSuspended Renewal interrupted, the NimbleOpti of the namespace is suspended", <-recorder.Events)
+
+	adapter := &v2.NimbleOpti{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "default", Namespace: "default"}, adapter))
+	assert.True(t, meta.IsStatusConditionTrue(adapter.Status.Conditions, conditionSuspended))
+}
+
+func TestSuspendWhileWaitingForDegradedSlot(t *testing.T) {
+	ctx := context.TODO()
+	iw, fakeClient, recorder := setupRenewRequestWatcher(t)
+	ing := generateIngress("ing", "default", nil, []string{"/.well-known/acme-challenge"}, map[string]string{httpsAnnotation: "HTTPS"})
+	require.NoError(t, fakeClient.Create(ctx, ing))
+	key := types.NamespacedName{Name: "ing", Namespace: "default"}
+	require.NoError(t, fakeClient.Get(ctx, key, ing))
+
+	// Another renewal of the namespace holds its only slot.
+	iw.degraded.SetLimits(0, 1)
+	require.NoError(t, iw.degraded.Acquire(ctx, "default"))
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := iw.startCertificateRenewal(ctx, ing.DeepCopy(), iw.clusterPolicy(nil))
+		errCh <- err
+	}()
+
+	// The namespace gets suspended before the slot is freed.
+	iw.suspension.set("default", true)
+	iw.degraded.Release("default")
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, errRenewalSuspended)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the renewal did not return")
+	}
+
+	got := &networkingv1.Ingress{}
+	require.NoError(t, fakeClient.Get(ctx, key, got))
+	assert.Equal(t, ing.ResourceVersion, got.ResourceVersion, "the annotation was never removed")
+	assert.Empty(t, iw.inFlight.Pending())
+	assert.Equal(t, "Normal RenewalSuspended Renewal skipped, the NimbleOpti of the namespace is suspended", <-recorder.Events)
+}
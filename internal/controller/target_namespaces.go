@@ -0,0 +1,246 @@
+// internal/controller/target_namespaces.go
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// managedNamespaceChecks are the permissions a renewal needs in a namespace.
+var managedNamespaceChecks = []authorizationv1.ResourceAttributes{
+	{Group: "networking.k8s.io", Resource: "ingresses", Verb: "update"},
+	{Group: "", Resource: "secrets", Verb: "delete"},
+}
+
+// namespaceManagers tracks the namespaces managed from a NimbleOpti of another namespace.
+type namespaceManagers struct {
+	mu         sync.RWMutex                      // mu protects the fields below.
+	namespaces map[types.NamespacedName][]string // namespaces maps a NimbleOpti to the namespaces it manages.
+	managers   map[string][]types.NamespacedName // managers maps a namespace to the NimbleOptis managing it.
+}
+
+// newNamespaceManagers initializes and returns a new namespaceManagers.
+func newNamespaceManagers() *namespaceManagers {
+	return &namespaceManagers{
+		namespaces: make(map[types.NamespacedName][]string),
+		managers:   make(map[string][]types.NamespacedName),
+	}
+}
+
+// set records that the NimbleOpti key manages namespaces, replacing the namespaces it managed before.
+// Setting no namespaces forgets key.
+func (m *namespaceManagers) set(key types.NamespacedName, namespaces []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, ns := range m.namespaces[key] {
+		managers := m.managers[ns][:0]
+		for _, manager := range m.managers[ns] {
+			if manager != key {
+				managers = append(managers, manager)
+			}
+		}
+		if len(managers) == 0 {
+			delete(m.managers, ns)
+			continue
+		}
+		m.managers[ns] = managers
+	}
+	delete(m.namespaces, key)
+	if len(namespaces) == 0 {
+		return
+	}
+
+	m.namespaces[key] = namespaces
+	for _, ns := range namespaces {
+		managers := append(m.managers[ns], key)
+		sort.Slice(managers, func(i, j int) bool { return managers[i].String() < managers[j].String() })
+		m.managers[ns] = managers
+	}
+}
+
+// managed returns the namespaces managed from the NimbleOpti key.
+func (m *namespaceManagers) managed(key types.NamespacedName) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string(nil), m.namespaces[key]...)
+}
+
+// manager returns the NimbleOpti managing namespace, false when there is none. When several NimbleOptis manage it
+// the first by namespace and name wins, the others report a conflict.
+func (m *namespaceManagers) manager(namespace string) (types.NamespacedName, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	managers := m.managers[namespace]
+	if len(managers) == 0 {
+		return types.NamespacedName{}, false
+	}
+	return managers[0], true
+}
+
+// managingNimbleOpti returns the NimbleOpti of another namespace managing namespace, nil when there is none.
+func (iw *IngressWatcher) managingNimbleOpti(ctx context.Context, namespace string) (*v2.NimbleOpti, error) {
+	key, ok := iw.managers.manager(namespace)
+	if !ok {
+		return nil, nil
+	}
+	adapter := &v2.NimbleOpti{}
+	if err := iw.ClientObj.Get(ctx, key, adapter); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return adapter, nil
+}
+
+// targetNamespaces returns the namespaces adapter names or selects, sorted, but the one it is the NimbleOpti of.
+func targetNamespaces(ctx context.Context, c client.Client, adapter *v2.NimbleOpti) ([]string, error) {
+	set := map[string]struct{}{adapter.Spec.TargetNamespace: {}}
+	for _, ns := range adapter.Spec.TargetNamespaces {
+		set[ns] = struct{}{}
+	}
+	if adapter.Spec.NamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(adapter.Spec.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("namespace selector: %w", err)
+		}
+		list := &corev1.NamespaceList{}
+		if err := c.List(ctx, list, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return nil, fmt.Errorf("listing namespaces: %w", err)
+		}
+		for _, ns := range list.Items {
+			set[ns.Name] = struct{}{}
+		}
+	}
+	// The namespace of the NimbleOpti named after it is managed from it as usual.
+	if adapter.Name == adapter.Namespace {
+		delete(set, adapter.Namespace)
+	}
+	delete(set, "")
+
+	namespaces := make([]string, 0, len(set))
+	for ns := range set {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// updateTargetNamespaces records the namespaces managed from adapter and reports in its status the ones it names
+// or selects but may not manage: those the operator may not renew the certificates of, does not watch,
+// or another NimbleOpti manages. A namespaceSelector starts the Namespace watch, see watchNamespaces.
+func (r *NimbleOptiReconciler) updateTargetNamespaces(ctx context.Context, adapter *v2.NimbleOpti) error {
+	key := types.NamespacedName{Namespace: adapter.Namespace, Name: adapter.Name}
+	if adapter.Spec.NamespaceSelector != nil {
+		if err := r.watchNamespaces(); err != nil {
+			return err
+		}
+	}
+	namespaces, err := targetNamespaces(ctx, r.Client, adapter)
+	if err != nil {
+		return err
+	}
+
+	watched := r.IngressWatcher.watchedNamespaces()
+	statuses := make([]v2.TargetNamespaceStatus, 0, len(namespaces))
+	var managed []string
+	for _, ns := range namespaces {
+		status := v2.TargetNamespaceStatus{Namespace: ns, Reason: v2.TargetNamespaceManaged}
+		switch {
+		case !isWatchedNamespace(watched, ns):
+			status.Reason = v2.TargetNamespaceNotWatched
+			status.Message = "The operator does not watch the namespace, see watchNamespaces of its config"
+		default:
+			denied, err := canManageNamespace(ctx, r.KubernetesClient, ns)
+			if err != nil {
+				return fmt.Errorf("namespace %s: %w", ns, err)
+			}
+			if denied != "" {
+				status.Reason = v2.TargetNamespaceForbidden
+				status.Message = denied
+			}
+		}
+		if status.Reason == v2.TargetNamespaceManaged {
+			managed = append(managed, ns)
+		}
+		statuses = append(statuses, status)
+	}
+	r.IngressWatcher.managers.set(key, managed)
+
+	// The conflicts are known once every manager is recorded.
+	for i := range statuses {
+		if statuses[i].Reason != v2.TargetNamespaceManaged {
+			continue
+		}
+		if manager, _ := r.IngressWatcher.managers.manager(statuses[i].Namespace); manager != key {
+			statuses[i].Reason = v2.TargetNamespaceConflict
+			statuses[i].Message = fmt.Sprintf("Managed from NimbleOpti %s", manager)
+			continue
+		}
+		statuses[i].Managed = true
+	}
+	for _, status := range statuses {
+		if !status.Managed {
+			klog.InfoS("Not managing a target namespace", "nimbleopti", key, "namespace", status.Namespace, "reason", status.Reason, "message", status.Message)
+		}
+	}
+
+	if len(statuses) == 0 {
+		statuses = nil
+	}
+	if reflect.DeepEqual(adapter.Status.TargetNamespaces, statuses) {
+		return nil
+	}
+	return r.IngressWatcher.updateNimbleOptiStatus(ctx, key, func(s *v2.NimbleOptiStatus) {
+		s.TargetNamespaces = statuses
+	})
+}
+
+// isWatchedNamespace reports whether namespace is one of watched, which holds metav1.NamespaceAll when every
+// namespace is watched.
+func isWatchedNamespace(watched []string, namespace string) bool {
+	for _, ns := range watched {
+		if ns == metav1.NamespaceAll || ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// canManageNamespace asks the API server, with a SelfSubjectAccessReview, whether the operator has the permissions
+// of a renewal in namespace. It returns why it has not, empty when it has. Without the permission to create
+// the review, the namespace is assumed manageable and its renewals report the missing permissions.
+func canManageNamespace(ctx context.Context, clientset kubernetes.Interface, namespace string) (string, error) {
+	for _, check := range managedNamespaceChecks {
+		attributes := check
+		attributes.Namespace = namespace
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attributes},
+		}
+		review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if apierrors.IsForbidden(err) {
+			klog.Warningf("Cannot review the access to namespace %s, it is assumed manageable: %v", namespace, err)
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("reviewing access to %s: %w", attributes.Resource, err)
+		}
+		if !review.Status.Allowed {
+			return fmt.Sprintf("The operator may not %s %s in the namespace", attributes.Verb, attributes.Resource), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,186 @@
+// internal/controller/target_namespaces_test.go
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "github.com/uri-tech/nimble-opti-adapter/api/v2"
+	"github.com/uri-tech/nimble-opti-adapter/internal/operatorconfig"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+func TestNamespaceManagers(t *testing.T) {
+	m := newNamespaceManagers()
+	platform := types.NamespacedName{Namespace: "platform", Name: "platform"}
+	ops := types.NamespacedName{Namespace: "ops", Name: "ops"}
+
+	m.set(platform, []string{"app-a", "app-b"})
+	m.set(ops, []string{"app-b"})
+	got, ok := m.manager("app-a")
+	assert.True(t, ok)
+	assert.Equal(t, platform, got)
+	// The first NimbleOpti by namespace and name wins.
+	got, _ = m.manager("app-b")
+	assert.Equal(t, ops, got)
+	assert.Equal(t, []string{"app-a", "app-b"}, m.managed(platform))
+
+	m.set(ops, nil)
+	got, _ = m.manager("app-b")
+	assert.Equal(t, platform, got)
+	m.set(platform, []string{"app-b"})
+	_, ok = m.manager("app-a")
+	assert.False(t, ok)
+}
+
+func TestUpdateTargetNamespaces(t *testing.T) {
+	ctx := context.TODO()
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	platform := &v2.NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "platform", Namespace: "platform"},
+		Spec: v2.NimbleOptiSpec{
+			// The namespace of the NimbleOpti named after it is not a target.
+			TargetNamespace:   "platform",
+			TargetNamespaces:  []string{"app-c", "app-d"},
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+			RenewBefore:       &metav1.Duration{Duration: 14 * 24 * time.Hour},
+			Policies:          []v2.IngressPolicy{{Name: "platform-wide"}},
+		},
+	}
+	// ops manages app-c first, it sorts before platform.
+	ops := &v2.NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "ops"},
+		Spec:       v2.NimbleOptiSpec{TargetNamespace: "app-c"},
+	}
+	appA := &v2.NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-a", Namespace: "app-a"},
+		Spec:       v2.NimbleOptiSpec{TargetNamespace: "app-a", ChallengeClearTimeout: &metav1.Duration{Duration: 3 * time.Second}},
+	}
+	iw, fakeClient, _ := setupRenewRequestWatcher(t, platform, ops, appA,
+		namespace("app-a", map[string]string{"team": "a"}),
+		namespace("app-b", map[string]string{"team": "a"}),
+		namespace("app-e", map[string]string{"team": "a"}),
+		namespace("other", nil))
+	cfg := *operatorconfig.Default()
+	cfg.WatchNamespaces = []string{"platform", "ops", "app-a", "app-b", "app-c", "app-d"}
+	iw.Config = &cfg
+
+	// The operator may not delete secrets in app-b.
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attributes := review.Spec.ResourceAttributes
+		review.Status.Allowed = attributes.Namespace != "app-b" || attributes.Resource != "secrets"
+		return true, review, nil
+	})
+	r := &NimbleOptiReconciler{Client: fakeClient, KubernetesClient: clientset, IngressWatcher: iw}
+
+	for _, key := range []client.ObjectKey{{Namespace: "ops", Name: "ops"}, {Namespace: "platform", Name: "platform"}} {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		require.NoError(t, err)
+	}
+
+	got := &v2.NimbleOpti{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(platform), got))
+	assert.Equal(t, []v2.TargetNamespaceStatus{
+		{Namespace: "app-a", Managed: true, Reason: v2.TargetNamespaceManaged},
+		{Namespace: "app-b", Reason: v2.TargetNamespaceForbidden, Message: "The operator may not delete secrets in the namespace"},
+		{Namespace: "app-c", Reason: v2.TargetNamespaceConflict, Message: "Managed from NimbleOpti ops/ops"},
+		{Namespace: "app-d", Managed: true, Reason: v2.TargetNamespaceManaged},
+		{Namespace: "app-e", Reason: v2.TargetNamespaceNotWatched, Message: "The operator does not watch the namespace, see watchNamespaces of its config"},
+	}, got.Status.TargetNamespaces)
+
+	// The spec of platform applies in app-a under the one of its own NimbleOpti, and so do its policies.
+	pol, err := iw.resolvePolicy(ctx, generateIngress("ing", "app-a", nil, nil, nil))
+	require.NoError(t, err)
+	assert.Equal(t, 14*24*time.Hour, pol.RenewBefore)
+	assert.Equal(t, 3*time.Second, pol.ChallengeClearTimeout)
+	_, adapter, err := iw.namespacePolicy(ctx, "app-a")
+	require.NoError(t, err)
+	assert.Equal(t, "platform", adapter.Name)
+
+	// app-b is not managed from platform.
+	pol, err = iw.resolvePolicy(ctx, generateIngress("ing", "app-b", nil, nil, nil))
+	require.NoError(t, err)
+	assert.Equal(t, 30*24*time.Hour, pol.RenewBefore)
+
+	// Deleting platform releases its namespaces.
+	require.NoError(t, fakeClient.Delete(ctx, platform))
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(platform)})
+	require.NoError(t, err)
+	_, ok := iw.managers.manager("app-a")
+	assert.False(t, ok)
+}
+
+// fakeController counts the watches registered on it.
+type fakeController struct {
+	reconcile.Reconciler
+	watches int
+}
+
+func (c *fakeController) Watch(source.Source, handler.EventHandler, ...predicate.Predicate) error {
+	c.watches++
+	return nil
+}
+
+func (c *fakeController) Start(context.Context) error { return nil }
+
+func (c *fakeController) GetLogger() logr.Logger { return logr.Discard() }
+
+func TestWatchNamespacesOnlyForSelectors(t *testing.T) {
+	ctx := context.TODO()
+	ops := &v2.NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "ops"},
+		Spec:       v2.NimbleOptiSpec{TargetNamespaces: []string{"app-a"}},
+	}
+	platform := &v2.NimbleOpti{
+		ObjectMeta: metav1.ObjectMeta{Name: "platform", Namespace: "platform"},
+		Spec:       v2.NimbleOptiSpec{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}},
+	}
+	iw, fakeClient, _ := setupRenewRequestWatcher(t, ops, platform)
+	cfg := *operatorconfig.Default()
+	cfg.WatchNamespaces = []string{"ops", "platform", "app-a"}
+	iw.Config = &cfg
+
+	// A namespaced operator may not create SelfSubjectAccessReviews.
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(authorizationv1.Resource("selfsubjectaccessreviews"), "", nil)
+	})
+	c := &fakeController{}
+	r := &NimbleOptiReconciler{Client: fakeClient, KubernetesClient: clientset, IngressWatcher: iw, controller: c}
+
+	// Naming the target namespaces needs no Namespace watch.
+	_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(ops)})
+	require.NoError(t, err)
+	assert.Zero(t, c.watches)
+	got := &v2.NimbleOpti{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(ops), got))
+	assert.Equal(t, []v2.TargetNamespaceStatus{{Namespace: "app-a", Managed: true, Reason: v2.TargetNamespaceManaged}}, got.Status.TargetNamespaces)
+
+	// A namespace selector starts it, once.
+	for i := 0; i < 2; i++ {
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(platform)})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, c.watches)
+}
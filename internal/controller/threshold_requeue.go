@@ -0,0 +1,178 @@
+// internal/controller/threshold_requeue.go
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// tlsSecretIndex indexes the cached Ingresses by the "namespace/name" of their TLS secrets.
+const tlsSecretIndex = "tlsSecret"
+
+// indexTLSSecrets returns the "namespace/name" of every TLS secret of an Ingress, see tlsSecretIndex.
+func indexTLSSecrets(obj interface{}) ([]string, error) {
+	ing, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(ing.Spec.TLS))
+	for _, secretName := range tlsSecretNames(ing) {
+		keys = append(keys, ing.Namespace+"/"+secretName)
+	}
+	return keys, nil
+}
+
+// scheduleAudit queues the Ingress of key to be audited after delay, see takeScheduled.
+// When several audits are scheduled the earliest one wins, like in the delaying queue.
+func (iw *IngressWatcher) scheduleAudit(key string, delay time.Duration) {
+	due := iw.now().Add(delay)
+	iw.scheduledMu.Lock()
+	if current, ok := iw.scheduled[key]; !ok || due.Before(current) {
+		iw.scheduled[key] = due
+	}
+	iw.scheduledMu.Unlock()
+	iw.Queue.AddAfter(key, delay)
+}
+
+// rescheduleAudit queues the Ingress of key to be audited after delay, replacing the audit already scheduled.
+// An earlier one still fires, it is handled as an event, see takeScheduled.
+func (iw *IngressWatcher) rescheduleAudit(key string, delay time.Duration) {
+	iw.scheduledMu.Lock()
+	iw.scheduled[key] = iw.now().Add(delay)
+	iw.scheduledMu.Unlock()
+	iw.Queue.AddAfter(key, delay)
+}
+
+// takeScheduled reports whether an audit of the Ingress of key is due, and clears it.
+// An audit not due yet is kept, the key was queued by an event in the meantime.
+func (iw *IngressWatcher) takeScheduled(key string) bool {
+	iw.scheduledMu.Lock()
+	defer iw.scheduledMu.Unlock()
+	due, ok := iw.scheduled[key]
+	if !ok || due.After(iw.now()) {
+		return false
+	}
+	delete(iw.scheduled, key)
+	return true
+}
+
+// forgetIngress drops the scheduled audit and the threshold of a deleted Ingress.
+func (iw *IngressWatcher) forgetIngress(key string) {
+	iw.scheduledMu.Lock()
+	defer iw.scheduledMu.Unlock()
+	delete(iw.scheduled, key)
+	delete(iw.thresholds, key)
+}
+
+// scheduleThresholdCrossing schedules an audit of ing for the moment its first certificate
+// crosses its renewal threshold within the renewal spread of pol, see policy.Policy.Threshold. A crossing already passed is only scheduled the first time
+// the Ingress is seen, later the audit that just ran, or the one deferring it, already handled it. The thresholds are
+// only kept in memory, so after a restart every crossing already passed is seen for the first time: it is delayed
+// by catchUpDelay, so they are not all audited at once.
+// The threshold is remembered, so a change of the secrets reschedules it, see handleSecretChange.
+func (iw *IngressWatcher) scheduleThresholdCrossing(ctx context.Context, ing *networkingv1.Ingress, pol policy.Policy) {
+	// With the challenge-only strategy the secrets are never touched.
+	if pol.Strategy == policy.StrategyChallengeOnly {
+		return
+	}
+
+	key := utils.IngressKey(ing)
+	threshold := pol.Threshold(key)
+	iw.scheduledMu.Lock()
+	_, seen := iw.thresholds[key]
+	iw.thresholds[key] = threshold
+	iw.scheduledMu.Unlock()
+
+	var crossing time.Time
+	for _, secretName := range tlsSecretNames(ing) {
+		// A missing or invalid secret is reported by the audit, it is rescheduled once it changes.
+		cert, err := iw.secretCertificate(ctx, ing.Namespace, secretName)
+		if err != nil {
+			continue
+		}
+		if at := cert.NotAfter.Add(-threshold); crossing.IsZero() || at.Before(crossing) {
+			crossing = at
+		}
+	}
+	if crossing.IsZero() {
+		return
+	}
+
+	delay := crossing.Sub(iw.now())
+	if delay <= 0 {
+		if seen {
+			return
+		}
+		delay = iw.catchUpDelay(key, pol, crossing.Add(threshold).Sub(iw.now()))
+		klog.Infof("Scheduling the audit of ingress %s in %v, its certificate crossed the renewal threshold at %s", key, delay, crossing.Format(time.RFC3339))
+		iw.scheduleAudit(key, delay)
+		return
+	}
+	klog.Infof("Scheduling the audit of ingress %s at %s, when its certificate crosses the renewal threshold", key, crossing.Format(time.RFC3339))
+	iw.scheduleAudit(key, delay)
+}
+
+// catchUpDelay returns the delay of the audit of the Ingress of key, seen for the first time after its certificate
+// crossed the renewal threshold: its jitter within the renewal spread of pol, or within the audit interval without
+// one, which the periodic audit would take anyway. It is capped at half of untilExpiry, the time left before the
+// certificate expires.
+func (iw *IngressWatcher) catchUpDelay(key string, pol policy.Policy, untilExpiry time.Duration) time.Duration {
+	window := pol.RenewalSpread
+	if window <= 0 {
+		window = iw.config().Timings.AuditInterval.Duration
+	}
+	if limit := untilExpiry / 2; window > limit {
+		window = limit
+	}
+	return policy.Jitter(key, window)
+}
+
+// handleSecretChange reschedules the Ingresses using secret once its certificate changed.
+// Only Ingresses already processed are rescheduled, with their last threshold, and only when
+// the new certificate crosses it in the future: a renewal just issued it.
+func (iw *IngressWatcher) handleSecretChange(secret *corev1.Secret) {
+	secretKey := secret.Namespace + "/" + secret.Name
+	thresholds := map[string]time.Duration{}
+	for _, informer := range iw.IngressInformers {
+		objs, err := informer.GetIndexer().ByIndex(tlsSecretIndex, secretKey)
+		if err != nil {
+			klog.ErrorS(err, "Failed to look up the ingresses of a secret", "secret", secretKey)
+			continue
+		}
+		for _, obj := range objs {
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			if err != nil {
+				continue
+			}
+			iw.scheduledMu.Lock()
+			if threshold, ok := iw.thresholds[key]; ok {
+				thresholds[key] = threshold
+			}
+			iw.scheduledMu.Unlock()
+		}
+	}
+	// Most secrets are not used by a processed Ingress, they are not parsed.
+	if len(thresholds) == 0 {
+		return
+	}
+
+	cert, err := certificateFromSecret(secret)
+	if err != nil {
+		return
+	}
+	for key, threshold := range thresholds {
+		crossing := cert.NotAfter.Add(-threshold)
+		if delay := crossing.Sub(iw.now()); delay > 0 {
+			klog.Infof("Rescheduling the audit of ingress %s to %s, its secret %s changed", key, crossing.Format(time.RFC3339), secretKey)
+			iw.scheduleAudit(key, delay)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"context"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uri-tech/nimble-opti-adapter/policy"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// generateTLSSecret returns a secret holding a PEM certificate expiring at expiry.
+func generateTLSSecret(t *testing.T, name, namespace string, expiry time.Time) *corev1.Secret {
+	t.Helper()
+	certDER, err := generateTestCert(expiry)
+	require.NoError(t, err)
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Data:       map[string][]byte{"tls.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})},
+	}
+}
+
+func TestScheduleThresholdCrossing(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now().Truncate(time.Second)
+	renewBefore := 30 * 24 * time.Hour
+
+	tests := []struct {
+		name     string
+		expiry   time.Duration
+		secret   bool
+		seen     bool
+		spread   time.Duration
+		strategy policy.Strategy
+		wantDue  time.Duration
+		wantNone bool
+	}{
+		{name: "future crossing", expiry: 60 * 24 * time.Hour, secret: true, wantDue: 30 * 24 * time.Hour},
+		{name: "future crossing within the spread", expiry: 60 * 24 * time.Hour, secret: true, spread: 4 * 24 * time.Hour,
+			wantDue: 30*24*time.Hour + policy.Jitter("default/ing", 4*24*time.Hour)},
+		{name: "future crossing of a seen ingress", expiry: 60 * 24 * time.Hour, secret: true, seen: true, wantDue: 30 * 24 * time.Hour},
+		{name: "passed crossing of a new ingress is delayed within the audit interval", expiry: 10 * 24 * time.Hour, secret: true,
+			wantDue: policy.Jitter("default/ing", 24*time.Hour)},
+		{name: "passed crossing of a new ingress is delayed within the spread", expiry: 10 * 24 * time.Hour, secret: true, spread: 4 * 24 * time.Hour,
+			wantDue: policy.Jitter("default/ing", 4*24*time.Hour)},
+		{name: "passed crossing of a new ingress close to expiry", expiry: 2 * time.Hour, secret: true,
+			wantDue: policy.Jitter("default/ing", time.Hour)},
+		{name: "passed crossing of a seen ingress", expiry: 10 * 24 * time.Hour, secret: true, seen: true, wantNone: true},
+		{name: "missing secret", secret: false, wantNone: true},
+		{name: "challenge-only strategy", expiry: 60 * 24 * time.Hour, secret: true, strategy: policy.StrategyChallengeOnly, wantNone: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iw, fakeClient, _ := setupRenewRequestWatcher(t)
+			iw.now = func() time.Time { return now }
+			iw.Config.Timings.AuditInterval.Duration = 24 * time.Hour
+			if tt.secret {
+				require.NoError(t, fakeClient.Create(ctx, generateTLSSecret(t, "tls", "default", now.Add(tt.expiry))))
+			}
+			if tt.seen {
+				iw.thresholds["default/ing"] = renewBefore
+			}
+			ing := generateIngress("ing", "default", nil, []string{"/app"}, nil)
+			ing.Spec.TLS = []networkingv1.IngressTLS{{SecretName: "tls"}}
+
+			pol := policy.Policy{RenewBefore: renewBefore, RenewalSpread: tt.spread, Strategy: tt.strategy}
+			iw.scheduleThresholdCrossing(ctx, ing, pol)
+
+			if tt.wantNone {
+				assert.NotContains(t, iw.scheduled, "default/ing")
+				return
+			}
+			if tt.wantDue > 0 {
+				assert.False(t, iw.takeScheduled("default/ing"), "not due before the crossing")
+			}
+			iw.now = func() time.Time { return now.Add(tt.wantDue) }
+			assert.True(t, iw.takeScheduled("default/ing"))
+			assert.Equal(t, pol.Threshold("default/ing"), iw.thresholds["default/ing"])
+		})
+	}
+}
+
+func TestScheduleAuditKeepsEarliest(t *testing.T) {
+	iw, _, _ := setupRenewRequestWatcher(t)
+	now := time.Now()
+	iw.now = func() time.Time { return now }
+
+	iw.scheduleAudit("default/ing", 2*time.Hour)
+	iw.scheduleAudit("default/ing", time.Hour)
+	iw.scheduleAudit("default/ing", 3*time.Hour)
+	assert.Equal(t, now.Add(time.Hour), iw.scheduled["default/ing"])
+
+	iw.forgetIngress("default/ing")
+	assert.Empty(t, iw.scheduled)
+}
+
+func TestHandleSecretChange(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	renewBefore := 30 * 24 * time.Hour
+
+	tests := []struct {
+		name      string
+		known     bool
+		secret    string
+		expiry    time.Duration
+		wantDelay time.Duration
+		wantNone  bool
+	}{
+		{name: "renewed certificate reschedules", known: true, secret: "tls", expiry: 90 * 24 * time.Hour, wantDelay: 60 * 24 * time.Hour},
+		{name: "certificate within the threshold", known: true, secret: "tls", expiry: 10 * 24 * time.Hour, wantNone: true},
+		{name: "ingress not processed yet", secret: "tls", expiry: 90 * 24 * time.Hour, wantNone: true},
+		{name: "secret of no ingress", known: true, secret: "other", expiry: 90 * 24 * time.Hour, wantNone: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iw, _, _ := setupRenewRequestWatcher(t)
+			iw.now = func() time.Time { return now }
+			ing := generateIngress("ing", "default", nil, []string{"/app"}, nil)
+			ing.Spec.TLS = []networkingv1.IngressTLS{{SecretName: "tls"}}
+			require.NoError(t, iw.IngressInformers[0].GetIndexer().Add(ing))
+			if tt.known {
+				iw.thresholds["default/ing"] = renewBefore
+			}
+
+			iw.handleSecretChange(generateTLSSecret(t, tt.secret, "default", now.Add(tt.expiry)))
+
+			if tt.wantNone {
+				assert.NotContains(t, iw.scheduled, "default/ing")
+				return
+			}
+			assert.Equal(t, now.Add(tt.wantDelay), iw.scheduled["default/ing"])
+		})
+	}
+}
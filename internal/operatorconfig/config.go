@@ -0,0 +1,281 @@
+// internal/operatorconfig/config.go
+
+// Package operatorconfig holds the versioned component configuration of the operator:
+// its timings, the defaults of new NimbleOpti resources, the workers and rate limits
+// of the Ingress queue and the Ingress selector.
+package operatorconfig
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the only supported apiVersion of the config file.
+	APIVersion = "config.adapter.uri-tech.github.io/v1alpha1"
+	// Kind is the kind of the config file.
+	Kind = "OperatorConfig"
+	// ConfigMapKey is the key holding the config file in the ConfigMap it is reloaded from.
+	ConfigMapKey = "config.yaml"
+)
+
+// OperatorConfig is the configuration file of the operator.
+type OperatorConfig struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	// Timings holds the intervals and timeouts of the Ingress watcher.
+	Timings Timings `json:"timings"`
+	// NimbleOptiDefaults is the spec of the NimbleOpti created for a namespace that has none.
+	NimbleOptiDefaults NimbleOptiDefaults `json:"nimbleOptiDefaults"`
+	// Workers is the number of goroutines processing the Ingress queue.
+	Workers int `json:"workers"`
+	// MaxDegradedIngresses caps the Ingresses without their HTTPS annotation at once, 0 for no cap.
+	MaxDegradedIngresses int `json:"maxDegradedIngresses"`
+	// MaxDegradedIngressesPerNamespace caps the Ingresses of a namespace without their HTTPS annotation at once, 0 for no cap.
+	MaxDegradedIngressesPerNamespace int `json:"maxDegradedIngressesPerNamespace"`
+	// RateLimit configures the retries of the Ingress queue.
+	RateLimit RateLimit `json:"rateLimit"`
+	// IngressSelector is the label selector of the Ingresses the operator manages.
+	IngressSelector string `json:"ingressSelector"`
+	// WatchNamespaces restricts the operator to these namespaces. Empty means all namespaces.
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+	// LogLevel overrides the level of the manager logger: debug, info, error or a verbosity number.
+	// Empty keeps the level of the --zap-log-level flag.
+	LogLevel string `json:"logLevel,omitempty"`
+	// AcmeBudget limits the certificates requested per issuer and registered domain.
+	AcmeBudget AcmeBudget `json:"acmeBudget"`
+}
+
+// AcmeBudget limits the certificates requested per issuer and registered domain, see package budget.
+type AcmeBudget struct {
+	// ConfigMap is the "namespace/name" of the ConfigMap holding the ledger of the requests. Empty disables the budget.
+	ConfigMap string `json:"configMap,omitempty"`
+	// CertificatesPerWeek caps the certificates issued for a registered domain within a week, 0 for no cap.
+	CertificatesPerWeek int `json:"certificatesPerWeek"`
+	// FailedValidationsPerHour caps the failed renewals of a registered domain within an hour, 0 for no cap.
+	FailedValidationsPerHour int `json:"failedValidationsPerHour"`
+}
+
+// ConfigMapRef returns the namespace and name of ConfigMap, empty when the budget is disabled.
+func (b AcmeBudget) ConfigMapRef() (types.NamespacedName, error) {
+	if b.ConfigMap == "" {
+		return types.NamespacedName{}, nil
+	}
+	namespace, name, found := strings.Cut(b.ConfigMap, "/")
+	if !found || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return types.NamespacedName{}, fmt.Errorf("acmeBudget.configMap must be namespace/name, got %q", b.ConfigMap)
+	}
+	return types.NamespacedName{Namespace: namespace, Name: name}, nil
+}
+
+// Timings holds the intervals and timeouts of the Ingress watcher.
+type Timings struct {
+	// AcmeChallengeTimeout bounds the wait for the ACME challenge path to appear after a secret change.
+	AcmeChallengeTimeout metav1.Duration `json:"acmeChallengeTimeout"`
+	// PollInterval is the interval between two checks of the ACME challenge path.
+	PollInterval metav1.Duration `json:"pollInterval"`
+	// AuditInterval is the interval between two audits of all Ingresses.
+	AuditInterval metav1.Duration `json:"auditInterval"`
+	// ShutdownGracePeriod is how long a shutdown waits for in-flight renewals.
+	ShutdownGracePeriod metav1.Duration `json:"shutdownGracePeriod"`
+}
+
+// NimbleOptiDefaults is the spec of the NimbleOpti created for a namespace that has none.
+type NimbleOptiDefaults struct {
+	// CertificateRenewalThreshold is in days.
+	CertificateRenewalThreshold int `json:"certificateRenewalThreshold"`
+	// AnnotationRemovalDelay is in seconds.
+	AnnotationRemovalDelay int `json:"annotationRemovalDelay"`
+}
+
+// RateLimit configures the retries of the Ingress queue: a per-item exponential backoff
+// combined with an overall token bucket.
+type RateLimit struct {
+	// BaseDelay is the first retry delay of a failing Ingress.
+	BaseDelay metav1.Duration `json:"baseDelay"`
+	// MaxDelay caps the retry delay of a failing Ingress.
+	MaxDelay metav1.Duration `json:"maxDelay"`
+	// QPS is the overall rate of retries.
+	QPS float64 `json:"qps"`
+	// Burst is the overall burst of retries.
+	Burst int `json:"burst"`
+}
+
+// Default returns the configuration used when no file is given.
+// It matches the values the operator used before they were configurable.
+func Default() *OperatorConfig {
+	return &OperatorConfig{
+		APIVersion: APIVersion,
+		Kind:       Kind,
+		Timings: Timings{
+			AcmeChallengeTimeout: metav1.Duration{Duration: 10 * time.Second},
+			PollInterval:         metav1.Duration{Duration: time.Second},
+			AuditInterval:        metav1.Duration{Duration: 24 * time.Hour},
+			ShutdownGracePeriod:  metav1.Duration{Duration: 20 * time.Second},
+		},
+		NimbleOptiDefaults: NimbleOptiDefaults{
+			CertificateRenewalThreshold: 30,
+			AnnotationRemovalDelay:      10,
+		},
+		Workers:                          1,
+		MaxDegradedIngresses:             2,
+		MaxDegradedIngressesPerNamespace: 1,
+		RateLimit: RateLimit{
+			BaseDelay: metav1.Duration{Duration: 5 * time.Millisecond},
+			MaxDelay:  metav1.Duration{Duration: 1000 * time.Second},
+			QPS:       10,
+			Burst:     100,
+		},
+		IngressSelector: "nimble.opti.adapter/enabled=true",
+		// The rate limits of Let's Encrypt, the ledger is off until a ConfigMap is set.
+		AcmeBudget: AcmeBudget{
+			CertificatesPerWeek:      50,
+			FailedValidationsPerHour: 5,
+		},
+	}
+}
+
+// Load reads the config file at path over the defaults. Keys missing from the file keep their default.
+// Unknown keys, values of the wrong type and an unsupported apiVersion or kind are rejected.
+func Load(path string) (*OperatorConfig, error) {
+	if path == "" {
+		return Default(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading operator config: %w", err)
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w, in %s", err, path)
+	}
+	return cfg, nil
+}
+
+// Parse parses the content of a config file over the defaults, like Load.
+func Parse(data []byte) (*OperatorConfig, error) {
+	cfg := Default()
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing operator config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid operator config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate checks the version and the values of the configuration.
+func (c *OperatorConfig) Validate() error {
+	if c.APIVersion != APIVersion {
+		return fmt.Errorf("apiVersion must be %q, got %q", APIVersion, c.APIVersion)
+	}
+	if c.Kind != Kind {
+		return fmt.Errorf("kind must be %q, got %q", Kind, c.Kind)
+	}
+
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"timings.acmeChallengeTimeout", c.Timings.AcmeChallengeTimeout.Duration},
+		{"timings.pollInterval", c.Timings.PollInterval.Duration},
+		{"timings.auditInterval", c.Timings.AuditInterval.Duration},
+		{"rateLimit.baseDelay", c.RateLimit.BaseDelay.Duration},
+		{"rateLimit.maxDelay", c.RateLimit.MaxDelay.Duration},
+	} {
+		if d.value <= 0 {
+			return fmt.Errorf("%s must be positive, got %v", d.name, d.value)
+		}
+	}
+	if c.Timings.ShutdownGracePeriod.Duration < 0 {
+		return fmt.Errorf("timings.shutdownGracePeriod must not be negative, got %v", c.Timings.ShutdownGracePeriod.Duration)
+	}
+	if c.RateLimit.MaxDelay.Duration < c.RateLimit.BaseDelay.Duration {
+		return fmt.Errorf("rateLimit.maxDelay must not be lower than rateLimit.baseDelay")
+	}
+
+	for _, n := range []struct {
+		name  string
+		value int
+	}{
+		{"nimbleOptiDefaults.certificateRenewalThreshold", c.NimbleOptiDefaults.CertificateRenewalThreshold},
+		{"nimbleOptiDefaults.annotationRemovalDelay", c.NimbleOptiDefaults.AnnotationRemovalDelay},
+		{"workers", c.Workers},
+		{"rateLimit.burst", c.RateLimit.Burst},
+	} {
+		if n.value <= 0 {
+			return fmt.Errorf("%s must be positive, got %d", n.name, n.value)
+		}
+	}
+	for _, n := range []struct {
+		name  string
+		value int
+	}{
+		{"maxDegradedIngresses", c.MaxDegradedIngresses},
+		{"maxDegradedIngressesPerNamespace", c.MaxDegradedIngressesPerNamespace},
+		{"acmeBudget.certificatesPerWeek", c.AcmeBudget.CertificatesPerWeek},
+		{"acmeBudget.failedValidationsPerHour", c.AcmeBudget.FailedValidationsPerHour},
+	} {
+		if n.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %d", n.name, n.value)
+		}
+	}
+	if _, err := c.AcmeBudget.ConfigMapRef(); err != nil {
+		return err
+	}
+	if c.RateLimit.QPS <= 0 {
+		return fmt.Errorf("rateLimit.qps must be positive, got %v", c.RateLimit.QPS)
+	}
+
+	if _, err := labels.Parse(c.IngressSelector); err != nil {
+		return fmt.Errorf("ingressSelector is invalid: %w", err)
+	}
+	if _, err := parseLogLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("logLevel is invalid: %w", err)
+	}
+	return nil
+}
+
+// Selector returns the parsed IngressSelector. The configuration must be valid.
+func (c *OperatorConfig) Selector() labels.Selector {
+	selector, err := labels.Parse(c.IngressSelector)
+	if err != nil {
+		return labels.Nothing()
+	}
+	return selector
+}
+
+// Level returns the parsed LogLevel, and false when it is empty. The configuration must be valid.
+func (c *OperatorConfig) Level() (zapcore.Level, bool) {
+	level, err := parseLogLevel(c.LogLevel)
+	if err != nil || c.LogLevel == "" {
+		return 0, false
+	}
+	return level, true
+}
+
+// parseLogLevel parses a level name or, like --zap-log-level, a verbosity number which enables
+// the debug levels down to its negation.
+func parseLogLevel(s string) (zapcore.Level, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if v, err := strconv.Atoi(s); err == nil {
+		if v <= 0 {
+			return 0, fmt.Errorf("verbosity must be positive, got %d", v)
+		}
+		return zapcore.Level(-v), nil
+	}
+	return zapcore.ParseLevel(s)
+}
@@ -0,0 +1,301 @@
+// internal/operatorconfig/config_test.go
+
+package operatorconfig
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+// writeConfig writes content to a config file in a temporary directory and returns its path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	assert.NoError(t, Default().Validate())
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+		check   func(t *testing.T, cfg *OperatorConfig)
+	}{
+		{
+			name: "partial file keeps the defaults",
+			content: `apiVersion: config.adapter.uri-tech.github.io/v1alpha1
+kind: OperatorConfig
+timings:
+  pollInterval: 2s
+workers: 4
+`,
+			check: func(t *testing.T, cfg *OperatorConfig) {
+				assert.Equal(t, 2*time.Second, cfg.Timings.PollInterval.Duration)
+				assert.Equal(t, 4, cfg.Workers)
+				assert.Equal(t, 10*time.Second, cfg.Timings.AcmeChallengeTimeout.Duration)
+				assert.Equal(t, 30, cfg.NimbleOptiDefaults.CertificateRenewalThreshold)
+			},
+		},
+		{
+			name: "unknown key",
+			content: `apiVersion: config.adapter.uri-tech.github.io/v1alpha1
+kind: OperatorConfig
+timings:
+  pollIntervall: 2s
+`,
+			wantErr: "pollIntervall",
+		},
+		{
+			name: "wrong type",
+			content: `apiVersion: config.adapter.uri-tech.github.io/v1alpha1
+kind: OperatorConfig
+workers: four
+`,
+			wantErr: "parsing operator config",
+		},
+		{
+			name: "unsupported apiVersion",
+			content: `apiVersion: config.adapter.uri-tech.github.io/v2
+kind: OperatorConfig
+`,
+			wantErr: "apiVersion must be",
+		},
+		{
+			name: "invalid value",
+			content: `apiVersion: config.adapter.uri-tech.github.io/v1alpha1
+kind: OperatorConfig
+timings:
+  pollInterval: 0s
+`,
+			wantErr: "timings.pollInterval must be positive",
+		},
+		{
+			name: "invalid selector",
+			content: `apiVersion: config.adapter.uri-tech.github.io/v1alpha1
+kind: OperatorConfig
+ingressSelector: "a=b=c"
+`,
+			wantErr: "ingressSelector is invalid",
+		},
+		{
+			name: "acme budget",
+			content: `apiVersion: config.adapter.uri-tech.github.io/v1alpha1
+kind: OperatorConfig
+acmeBudget:
+  configMap: nimble-opti-adapter-system/acme-budget
+  certificatesPerWeek: 20
+`,
+			check: func(t *testing.T, cfg *OperatorConfig) {
+				ref, err := cfg.AcmeBudget.ConfigMapRef()
+				require.NoError(t, err)
+				assert.Equal(t, "nimble-opti-adapter-system", ref.Namespace)
+				assert.Equal(t, "acme-budget", ref.Name)
+				assert.Equal(t, 20, cfg.AcmeBudget.CertificatesPerWeek)
+				assert.Equal(t, 5, cfg.AcmeBudget.FailedValidationsPerHour)
+			},
+		},
+		{
+			name: "invalid acme budget config map",
+			content: `apiVersion: config.adapter.uri-tech.github.io/v1alpha1
+kind: OperatorConfig
+acmeBudget:
+  configMap: acme-budget
+`,
+			wantErr: "acmeBudget.configMap must be namespace/name",
+		},
+		{
+			name: "negative acme budget",
+			content: `apiVersion: config.adapter.uri-tech.github.io/v1alpha1
+kind: OperatorConfig
+acmeBudget:
+  failedValidationsPerHour: -1
+`,
+			wantErr: "acmeBudget.failedValidationsPerHour must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, tt.content))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, Default(), cfg)
+}
+
+func TestFlagsLoad(t *testing.T) {
+	path := writeConfig(t, `apiVersion: config.adapter.uri-tech.github.io/v1alpha1
+kind: OperatorConfig
+timings:
+  pollInterval: 2s
+  auditInterval: 1h
+workers: 4
+`)
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+		check   func(t *testing.T, cfg *OperatorConfig)
+	}{
+		{
+			name: "file values without flags",
+			args: []string{"--config", path},
+			check: func(t *testing.T, cfg *OperatorConfig) {
+				assert.Equal(t, 2*time.Second, cfg.Timings.PollInterval.Duration)
+				assert.Equal(t, 4, cfg.Workers)
+			},
+		},
+		{
+			name: "flags override the file",
+			args: []string{"--config", path, "--workers", "8", "--poll-interval", "3s", "--watch-namespaces", "team-a, team-b"},
+			check: func(t *testing.T, cfg *OperatorConfig) {
+				assert.Equal(t, 3*time.Second, cfg.Timings.PollInterval.Duration)
+				assert.Equal(t, 8, cfg.Workers)
+				assert.Equal(t, time.Hour, cfg.Timings.AuditInterval.Duration)
+				assert.Equal(t, []string{"team-a", "team-b"}, cfg.WatchNamespaces)
+			},
+		},
+		{
+			name: "flags without file",
+			args: []string{"--ingress-selector", "team=payments", "--rate-limit-qps", "2.5"},
+			check: func(t *testing.T, cfg *OperatorConfig) {
+				assert.Equal(t, "team=payments", cfg.IngressSelector)
+				assert.Equal(t, 2.5, cfg.RateLimit.QPS)
+				assert.Equal(t, time.Second, cfg.Timings.PollInterval.Duration)
+			},
+		},
+		{
+			name:    "invalid flag value names the flag",
+			args:    []string{"--config", path, "--workers", "0"},
+			wantErr: "workers must be positive, got 0 (flags set: --workers)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			f := BindFlags(fs)
+			require.NoError(t, fs.Parse(tt.args))
+
+			cfg, err := f.Load()
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestChangedAndCheckReload(t *testing.T) {
+	current := Default()
+
+	next := Default()
+	next.Workers = 4
+	next.Timings.AuditInterval.Duration = time.Hour
+	next.LogLevel = "debug"
+	assert.Equal(t, []string{"timings.auditInterval", "workers", "logLevel"}, current.Changed(next))
+	assert.NoError(t, current.CheckReload(next))
+
+	next.WatchNamespaces = []string{"team-a"}
+	next.RateLimit.QPS = 1
+	err := current.CheckReload(next)
+	require.Error(t, err)
+	assert.Equal(t, "rateLimit.qps, watchNamespaces cannot change without a restart", err.Error())
+
+	// An empty list and no list are the same namespaces.
+	empty := Default()
+	empty.WatchNamespaces = []string{}
+	assert.Empty(t, current.Changed(empty))
+}
+
+func TestLogLevel(t *testing.T) {
+	tests := []struct {
+		value     string
+		wantLevel zapcore.Level
+		wantSet   bool
+		wantErr   bool
+	}{
+		{value: "", wantSet: false},
+		{value: "debug", wantLevel: zapcore.DebugLevel, wantSet: true},
+		{value: "error", wantLevel: zapcore.ErrorLevel, wantSet: true},
+		{value: "3", wantLevel: zapcore.Level(-3), wantSet: true},
+		{value: "0", wantErr: true},
+		{value: "loud", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cfg := Default()
+			cfg.LogLevel = tt.value
+			if tt.wantErr {
+				assert.ErrorContains(t, cfg.Validate(), "logLevel is invalid")
+				return
+			}
+			require.NoError(t, cfg.Validate())
+			level, ok := cfg.Level()
+			assert.Equal(t, tt.wantSet, ok)
+			assert.Equal(t, tt.wantLevel, level)
+		})
+	}
+}
+
+func TestConfigMapRef(t *testing.T) {
+	tests := []struct {
+		value         string
+		wantNamespace string
+		wantName      string
+		wantErr       bool
+	}{
+		{value: ""},
+		{value: "system/operator-config", wantNamespace: "system", wantName: "operator-config"},
+		{value: "operator-config", wantErr: true},
+		{value: "system/", wantErr: true},
+		{value: "a/b/c", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			f := BindFlags(fs)
+			require.NoError(t, fs.Parse([]string{"--config-map", tt.value}))
+
+			namespace, name, err := f.ConfigMapRef()
+			if tt.wantErr {
+				assert.Error(t, err)
+				_, err = f.Load()
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantNamespace, namespace)
+			assert.Equal(t, tt.wantName, name)
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// internal/operatorconfig/flags.go
+
+package operatorconfig
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/uri-tech/nimble-opti-adapter/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Flags binds the command-line flags of the operator configuration.
+// Flags set on the command line override the config file, the others keep the file values.
+type Flags struct {
+	// ConfigFile is the path of the config file, empty for the defaults.
+	ConfigFile string
+	// ConfigMap is the "namespace/name" of the ConfigMap the config is reloaded from, empty to disable reloads.
+	ConfigMap string
+
+	fs     *flag.FlagSet
+	values *OperatorConfig                      // values holds the parsed flag values.
+	apply  map[string]func(dst *OperatorConfig) // apply copies the value of a flag into a config.
+}
+
+// BindFlags registers the --config flag and one flag per setting on fs.
+func BindFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{
+		fs:     fs,
+		values: Default(),
+		apply:  map[string]func(dst *OperatorConfig){},
+	}
+	v := f.values
+
+	fs.StringVar(&f.ConfigFile, "config", "", "Path of the "+Kind+" file. Flags set on the command line override it.")
+	fs.StringVar(&f.ConfigMap, "config-map", "", "namespace/name of a ConfigMap whose "+ConfigMapKey+" key holds the "+Kind+
+		" file. Its changes are applied without a restart. Empty to disable reloads.")
+
+	f.duration("acme-challenge-timeout", "How long to wait for the ACME challenge path to appear.",
+		func(c *OperatorConfig) *metav1.Duration { return &c.Timings.AcmeChallengeTimeout })
+	f.duration("poll-interval", "Interval between two checks of the ACME challenge path.",
+		func(c *OperatorConfig) *metav1.Duration { return &c.Timings.PollInterval })
+	f.duration("audit-interval", "Interval between two audits of all Ingress resources.",
+		func(c *OperatorConfig) *metav1.Duration { return &c.Timings.AuditInterval })
+	f.duration("shutdown-grace-period", "How long a shutdown waits for in-flight certificate renewals. "+
+		"Renewals still running afterwards are cancelled and their Ingress annotations restored.",
+		func(c *OperatorConfig) *metav1.Duration { return &c.Timings.ShutdownGracePeriod })
+
+	fs.IntVar(&v.NimbleOptiDefaults.CertificateRenewalThreshold, "default-certificate-renewal-threshold",
+		v.NimbleOptiDefaults.CertificateRenewalThreshold, "CertificateRenewalThreshold, in days, of the NimbleOpti created for a namespace.")
+	f.apply["default-certificate-renewal-threshold"] = func(dst *OperatorConfig) {
+		dst.NimbleOptiDefaults.CertificateRenewalThreshold = v.NimbleOptiDefaults.CertificateRenewalThreshold
+	}
+	fs.IntVar(&v.NimbleOptiDefaults.AnnotationRemovalDelay, "default-annotation-removal-delay",
+		v.NimbleOptiDefaults.AnnotationRemovalDelay, "AnnotationRemovalDelay, in seconds, of the NimbleOpti created for a namespace.")
+	f.apply["default-annotation-removal-delay"] = func(dst *OperatorConfig) {
+		dst.NimbleOptiDefaults.AnnotationRemovalDelay = v.NimbleOptiDefaults.AnnotationRemovalDelay
+	}
+
+	fs.IntVar(&v.Workers, "workers", v.Workers, "Number of workers processing Ingress events.")
+	f.apply["workers"] = func(dst *OperatorConfig) { dst.Workers = v.Workers }
+	fs.IntVar(&v.MaxDegradedIngresses, "max-degraded-ingresses", v.MaxDegradedIngresses,
+		"Ingresses allowed without the HTTPS annotation at once, 0 for no cap.")
+	f.apply["max-degraded-ingresses"] = func(dst *OperatorConfig) { dst.MaxDegradedIngresses = v.MaxDegradedIngresses }
+	fs.IntVar(&v.MaxDegradedIngressesPerNamespace, "max-degraded-ingresses-per-namespace", v.MaxDegradedIngressesPerNamespace,
+		"Ingresses of a namespace allowed without the HTTPS annotation at once, 0 for no cap.")
+	f.apply["max-degraded-ingresses-per-namespace"] = func(dst *OperatorConfig) {
+		dst.MaxDegradedIngressesPerNamespace = v.MaxDegradedIngressesPerNamespace
+	}
+
+	f.duration("rate-limit-base-delay", "First retry delay of a failing Ingress.",
+		func(c *OperatorConfig) *metav1.Duration { return &c.RateLimit.BaseDelay })
+	f.duration("rate-limit-max-delay", "Maximum retry delay of a failing Ingress.",
+		func(c *OperatorConfig) *metav1.Duration { return &c.RateLimit.MaxDelay })
+	fs.Float64Var(&v.RateLimit.QPS, "rate-limit-qps", v.RateLimit.QPS, "Overall rate of Ingress retries per second.")
+	f.apply["rate-limit-qps"] = func(dst *OperatorConfig) { dst.RateLimit.QPS = v.RateLimit.QPS }
+	fs.IntVar(&v.RateLimit.Burst, "rate-limit-burst", v.RateLimit.Burst, "Overall burst of Ingress retries.")
+	f.apply["rate-limit-burst"] = func(dst *OperatorConfig) { dst.RateLimit.Burst = v.RateLimit.Burst }
+
+	fs.StringVar(&v.IngressSelector, "ingress-selector", v.IngressSelector, "Label selector of the Ingress resources the operator manages.")
+	f.apply["ingress-selector"] = func(dst *OperatorConfig) { dst.IngressSelector = v.IngressSelector }
+
+	fs.Func("watch-namespaces", "Comma separated list of namespaces to watch. "+
+		"When set, the cache, the informers and every list call are restricted to them and no cluster-wide permission is needed.",
+		func(s string) error {
+			v.WatchNamespaces = utils.SplitCommaList(s)
+			return nil
+		})
+	f.apply["watch-namespaces"] = func(dst *OperatorConfig) { dst.WatchNamespaces = v.WatchNamespaces }
+
+	fs.StringVar(&v.LogLevel, "log-level", v.LogLevel, "Level of the manager logger: debug, info, error or a verbosity number. "+
+		"Overrides --zap-log-level and, unlike it, can be changed by a config reload.")
+	f.apply["log-level"] = func(dst *OperatorConfig) { dst.LogLevel = v.LogLevel }
+
+	fs.StringVar(&v.AcmeBudget.ConfigMap, "acme-budget-config-map", v.AcmeBudget.ConfigMap,
+		"namespace/name of the ConfigMap holding the ledger of the ACME requests, empty disables the budget.")
+	f.apply["acme-budget-config-map"] = func(dst *OperatorConfig) { dst.AcmeBudget.ConfigMap = v.AcmeBudget.ConfigMap }
+	fs.IntVar(&v.AcmeBudget.CertificatesPerWeek, "acme-budget-certificates-per-week", v.AcmeBudget.CertificatesPerWeek,
+		"Certificates issued for a registered domain within a week, 0 for no cap.")
+	f.apply["acme-budget-certificates-per-week"] = func(dst *OperatorConfig) {
+		dst.AcmeBudget.CertificatesPerWeek = v.AcmeBudget.CertificatesPerWeek
+	}
+	fs.IntVar(&v.AcmeBudget.FailedValidationsPerHour, "acme-budget-failed-validations-per-hour", v.AcmeBudget.FailedValidationsPerHour,
+		"Failed renewals of a registered domain within an hour, 0 for no cap.")
+	f.apply["acme-budget-failed-validations-per-hour"] = func(dst *OperatorConfig) {
+		dst.AcmeBudget.FailedValidationsPerHour = v.AcmeBudget.FailedValidationsPerHour
+	}
+
+	return f
+}
+
+// duration registers a duration flag for the field returned by field.
+func (f *Flags) duration(name, usage string, field func(c *OperatorConfig) *metav1.Duration) {
+	d := field(f.values)
+	f.fs.DurationVar(&d.Duration, name, d.Duration, usage)
+	f.apply[name] = func(dst *OperatorConfig) { *field(dst) = *field(f.values) }
+}
+
+// Load loads ConfigFile, applies the flags set on the command line and validates the result.
+// The flag set must be parsed.
+func (f *Flags) Load() (*OperatorConfig, error) {
+	if _, _, err := f.ConfigMapRef(); err != nil {
+		return nil, err
+	}
+	cfg, err := Load(f.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	return f.override(cfg)
+}
+
+// Parse parses the content of a config file, applies the flags set on the command line and validates the result.
+// It is used to reload the configuration, the flags keep their precedence over the file.
+func (f *Flags) Parse(data []byte) (*OperatorConfig, error) {
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return f.override(cfg)
+}
+
+// override applies the flags set on the command line to cfg and validates the result.
+func (f *Flags) override(cfg *OperatorConfig) (*OperatorConfig, error) {
+	var overridden []string
+	f.fs.Visit(func(fl *flag.Flag) {
+		if apply, ok := f.apply[fl.Name]; ok {
+			apply(cfg)
+			overridden = append(overridden, fl.Name)
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		return nil, errorWithFlags(err, overridden)
+	}
+	return cfg, nil
+}
+
+// ConfigMapRef returns the namespace and name of ConfigMap, empty when reloads are disabled.
+func (f *Flags) ConfigMapRef() (namespace, name string, err error) {
+	if f.ConfigMap == "" {
+		return "", "", nil
+	}
+	namespace, name, found := strings.Cut(f.ConfigMap, "/")
+	if !found || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("--config-map must be namespace/name, got %q", f.ConfigMap)
+	}
+	return namespace, name, nil
+}
+
+// errorWithFlags adds the overriding flags to a validation error, as they may be its cause.
+func errorWithFlags(err error, flags []string) error {
+	if len(flags) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w (flags set: --%s)", err, strings.Join(flags, ", --"))
+}
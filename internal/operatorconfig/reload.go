@@ -0,0 +1,69 @@
+// internal/operatorconfig/reload.go
+
+package operatorconfig
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// key is one setting of the configuration, compared when the configuration is reloaded.
+type key struct {
+	name       string      // name is the path of the key in the config file.
+	value      interface{} // value is the value of the key.
+	reloadable bool        // reloadable is false for the keys only read at startup.
+}
+
+// keys returns the settings of c. The namespaces, the rate limits and the shutdown grace period
+// size the cache, the queue and the manager at startup, they need a restart to change.
+func (c *OperatorConfig) keys() []key {
+	return []key{
+		{"timings.acmeChallengeTimeout", c.Timings.AcmeChallengeTimeout, true},
+		{"timings.pollInterval", c.Timings.PollInterval, true},
+		{"timings.auditInterval", c.Timings.AuditInterval, true},
+		{"timings.shutdownGracePeriod", c.Timings.ShutdownGracePeriod, false},
+		{"nimbleOptiDefaults.certificateRenewalThreshold", c.NimbleOptiDefaults.CertificateRenewalThreshold, true},
+		{"nimbleOptiDefaults.annotationRemovalDelay", c.NimbleOptiDefaults.AnnotationRemovalDelay, true},
+		{"workers", c.Workers, true},
+		{"maxDegradedIngresses", c.MaxDegradedIngresses, true},
+		{"maxDegradedIngressesPerNamespace", c.MaxDegradedIngressesPerNamespace, true},
+		{"rateLimit.baseDelay", c.RateLimit.BaseDelay, false},
+		{"rateLimit.maxDelay", c.RateLimit.MaxDelay, false},
+		{"rateLimit.qps", c.RateLimit.QPS, false},
+		{"rateLimit.burst", c.RateLimit.Burst, false},
+		{"ingressSelector", c.IngressSelector, true},
+		{"watchNamespaces", strings.Join(c.WatchNamespaces, ","), false},
+		{"logLevel", c.LogLevel, true},
+		{"acmeBudget.configMap", c.AcmeBudget.ConfigMap, true},
+		{"acmeBudget.certificatesPerWeek", c.AcmeBudget.CertificatesPerWeek, true},
+		{"acmeBudget.failedValidationsPerHour", c.AcmeBudget.FailedValidationsPerHour, true},
+	}
+}
+
+// Changed returns the keys whose value differs in next.
+func (c *OperatorConfig) Changed(next *OperatorConfig) []string {
+	var changed []string
+	nextKeys := next.keys()
+	for i, k := range c.keys() {
+		if !reflect.DeepEqual(k.value, nextKeys[i].value) {
+			changed = append(changed, k.name)
+		}
+	}
+	return changed
+}
+
+// CheckReload returns an error naming the keys changed in next that need a restart.
+func (c *OperatorConfig) CheckReload(next *OperatorConfig) error {
+	var restart []string
+	nextKeys := next.keys()
+	for i, k := range c.keys() {
+		if !k.reloadable && !reflect.DeepEqual(k.value, nextKeys[i].value) {
+			restart = append(restart, k.name)
+		}
+	}
+	if len(restart) > 0 {
+		return fmt.Errorf("%s cannot change without a restart", strings.Join(restart, ", "))
+	}
+	return nil
+}
@@ -16,6 +16,8 @@ import (
 var (
 	logger      *zap.Logger
 	sugarLogger *zap.SugaredLogger
+	// level is the level of the logger, it can be changed after the logger is built.
+	level zap.AtomicLevel
 )
 
 // init as as SetupLogger - initializes the logger with a default configuration.
@@ -61,6 +63,7 @@ func init() {
 		},
 		Level: zap.NewAtomicLevelAt(logLevel),
 	}
+	level = cfg.Level
 	var err error
 	logger, err = cfg.Build()
 	// logger, err = cfg.Build(zap.AddCallerSkip(1))
@@ -86,6 +89,16 @@ func GetNamedLogger(name string) *zap.SugaredLogger {
 	return sugarLogger.Named(name)
 }
 
+// SetRunMode sets the log level for the run mode, debug for "dev" and info otherwise.
+// It lets a run mode loaded after start-up, for example from a config file, take effect.
+func SetRunMode(runMode string) {
+	if runMode == "dev" {
+		level.SetLevel(zap.DebugLevel)
+	} else {
+		level.SetLevel(zap.InfoLevel)
+	}
+}
+
 // customCallerEncoder is a custom function to encode the caller information in a concise format.
 // Instead of displaying the full path, it shows only the folder and file name, followed by the line number.
 // For example, it transforms:
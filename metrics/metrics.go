@@ -5,6 +5,7 @@ package metrics
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/uri-tech/nimble-opti-adapter/budget"
 	"k8s.io/klog/v2"
 	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 )
@@ -26,6 +27,15 @@ var (
 			Buckets: prometheus.DefBuckets,
 		},
 	)
+
+	// AcmeBudgetRemaining is the ACME budget left to each issuer and registered domain, per limit.
+	AcmeBudgetRemaining = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nimble_opti_adapter_acme_budget_remaining",
+			Help: "ACME requests an issuer may still make for a registered domain before its rate limit",
+		},
+		[]string{"issuer", "domain", "limit"},
+	)
 )
 
 func init() {
@@ -43,6 +53,10 @@ func init() {
 	if err := ctrlmetrics.Registry.Register(AnnotationUpdatesDuration); err != nil {
 		klog.Errorf("Error registering AnnotationUpdatesDuration metric: %v", err)
 	}
+
+	if err := ctrlmetrics.Registry.Register(AcmeBudgetRemaining); err != nil {
+		klog.Errorf("Error registering AcmeBudgetRemaining metric: %v", err)
+	}
 }
 
 // IncrementCertificateRenewals increments the certificate renewals counter.
@@ -54,3 +68,18 @@ func IncrementCertificateRenewals() {
 func RecordAnnotationUpdateDuration(duration float64) {
 	AnnotationUpdatesDuration.Observe(duration)
 }
+
+// SetAcmeBudgetRemaining replaces the ACME budget left with remaining. Unlimited budgets are not reported.
+func SetAcmeBudgetRemaining(remaining []budget.Remaining) {
+	AcmeBudgetRemaining.Reset()
+	for _, r := range remaining {
+		for limit, left := range map[string]int{
+			"certificates_per_week":       r.Certificates,
+			"failed_validations_per_hour": r.Failures,
+		} {
+			if left >= 0 {
+				AcmeBudgetRemaining.WithLabelValues(r.Issuer, r.Domain, limit).Set(float64(left))
+			}
+		}
+	}
+}
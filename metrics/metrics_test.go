@@ -7,6 +7,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/uri-tech/nimble-opti-adapter/budget"
 	"k8s.io/klog/v2"
 )
 
@@ -62,3 +63,16 @@ func TestRecordAnnotationUpdateDuration(t *testing.T) {
 	// Check the count of observations after the second recording
 	assert.Equal(t, initialCount+2, metric.Histogram.GetSampleCount(), "Expected another observation in AnnotationUpdatesDuration")
 }
+
+func TestSetAcmeBudgetRemaining(t *testing.T) {
+	account := budget.Account{Issuer: "ClusterIssuer/letsencrypt", Domain: "example.com"}
+	SetAcmeBudgetRemaining([]budget.Remaining{
+		{Account: account, Certificates: 3, Failures: -1},
+		{Account: budget.Account{Domain: "example.org"}, Certificates: 0, Failures: 5},
+	})
+	assert.Equal(t, 3, testutil.CollectAndCount(AcmeBudgetRemaining))
+	assert.Equal(t, float64(3), testutil.ToFloat64(AcmeBudgetRemaining.WithLabelValues(account.Issuer, account.Domain, "certificates_per_week")))
+
+	SetAcmeBudgetRemaining(nil)
+	assert.Equal(t, 0, testutil.CollectAndCount(AcmeBudgetRemaining))
+}
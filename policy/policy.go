@@ -0,0 +1,206 @@
+// Package policy resolves the renewal policy of a single Ingress: the namespace or component
+// defaults overridden by the "nimble.opti.adapter/*" annotations of the Ingress.
+// It is shared by the operator and the cronjob.
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// The override annotations of an Ingress.
+const (
+	// RenewalThresholdAnnotation overrides how long before expiry a certificate is renewed,
+	// in days or as a duration such as "36h".
+	RenewalThresholdAnnotation = "nimble.opti.adapter/renewal-threshold"
+	// AnnotationRemovalDelayAnnotation overrides how long the HTTPS annotation stays removed during a renewal,
+	// in seconds or as a duration such as "2m".
+	AnnotationRemovalDelayAnnotation = "nimble.opti.adapter/annotation-removal-delay"
+	// StrategyAnnotation selects how a new certificate is obtained, see Strategy.
+	StrategyAnnotation = "nimble.opti.adapter/strategy"
+	// SkipAnnotation set to "true" leaves the Ingress alone.
+	SkipAnnotation = "nimble.opti.adapter/skip"
+)
+
+// The bookkeeping annotations shared by the operator and the cronjob.
+const (
+	// OriginalBackendProtocolAnnotation holds the backend-protocol annotation of an Ingress while a renewal removed it,
+	// set by the operator and the cronjob alike, so either can restore a renewal the other interrupted.
+	OriginalBackendProtocolAnnotation = "nimble.opti.adapter/original-backend-protocol"
+	// ReleasedAnnotation set to "true" on a Namespace marks it released by the deletion of its NimbleOpti: the operator
+	// creates no NimbleOpti in it and the cronjob leaves its Ingresses alone, until a NimbleOpti is created there again.
+	ReleasedAnnotation = "nimble.opti.adapter/released"
+)
+
+// Strategy selects how a new certificate is obtained for an Ingress.
+type Strategy string
+
+const (
+	// StrategyAuto keeps the default behaviour of the component.
+	StrategyAuto Strategy = "auto"
+	// StrategyChallengeOnly only resolves ACME challenges cert-manager already started, secrets are never touched.
+	StrategyChallengeOnly Strategy = "challenge-only"
+	// StrategySecretDelete deletes the TLS secret of a certificate due for renewal.
+	StrategySecretDelete Strategy = "secret-delete"
+	// StrategySecretRename points the Ingress at a new TLS secret name instead of deleting the secret,
+	// so the old certificate stays available.
+	StrategySecretRename Strategy = "secret-rename"
+)
+
+// strategies are the valid values of StrategyAnnotation.
+var strategies = []Strategy{StrategyAuto, StrategyChallengeOnly, StrategySecretDelete, StrategySecretRename}
+
+// Policy is the renewal policy of an Ingress. Zero fields are unset.
+type Policy struct {
+	// RenewBefore is how long before expiry a certificate is renewed.
+	RenewBefore time.Duration
+	// RenewalSpread spreads the renewals of the certificates reaching RenewBefore together, see Threshold.
+	RenewalSpread time.Duration
+	// ChallengeAppearTimeout bounds the wait for the ACME challenge path once a secret was replaced.
+	ChallengeAppearTimeout time.Duration
+	// ChallengeClearTimeout bounds how long the HTTPS annotation stays removed during a renewal.
+	ChallengeClearTimeout time.Duration
+	// PollInterval is how often the Ingress is checked while its HTTPS annotation is removed.
+	PollInterval time.Duration
+	// Schedule gates when the HTTPS annotation may be toggled, nil allows any time.
+	Schedule *Schedule
+	// EmergencyThreshold lets a certificate expiring sooner bypass the Schedule, zero never does.
+	EmergencyThreshold time.Duration
+	Strategy           Strategy
+	Skip               bool
+	// Suspended pauses every renewal of the namespace, set by the suspend field of its NimbleOpti.
+	Suspended bool
+	// Notify names the receivers of the outcome of the renewals, nil when there are none.
+	Notify []string
+}
+
+// Merge returns p overridden by the set fields of override.
+func (p Policy) Merge(override Policy) Policy {
+	if override.RenewBefore > 0 {
+		p.RenewBefore = override.RenewBefore
+	}
+	if override.RenewalSpread > 0 {
+		p.RenewalSpread = override.RenewalSpread
+	}
+	if override.ChallengeAppearTimeout > 0 {
+		p.ChallengeAppearTimeout = override.ChallengeAppearTimeout
+	}
+	if override.ChallengeClearTimeout > 0 {
+		p.ChallengeClearTimeout = override.ChallengeClearTimeout
+	}
+	if override.PollInterval > 0 {
+		p.PollInterval = override.PollInterval
+	}
+	if override.Schedule != nil {
+		p.Schedule = override.Schedule
+	}
+	if override.EmergencyThreshold > 0 {
+		p.EmergencyThreshold = override.EmergencyThreshold
+	}
+	if override.Strategy != "" {
+		p.Strategy = override.Strategy
+	}
+	if override.Skip {
+		p.Skip = true
+	}
+	if override.Suspended {
+		p.Suspended = true
+	}
+	if len(override.Notify) > 0 {
+		p.Notify = override.Notify
+	}
+	return p
+}
+
+// Resolve returns base overridden by the annotations. An invalid annotation is left out,
+// its default stays in place, and it is reported in the returned error.
+func Resolve(base Policy, annotations map[string]string) (Policy, error) {
+	override, err := FromAnnotations(annotations)
+	return base.Merge(override), err
+}
+
+// FromAnnotations parses the override annotations. The invalid ones are left unset and
+// reported together in the returned error.
+func FromAnnotations(annotations map[string]string) (Policy, error) {
+	var p Policy
+	var errs []error
+
+	if v, ok := annotations[RenewalThresholdAnnotation]; ok {
+		d, err := parseDuration(v, 24*time.Hour)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("annotation %s: %w", RenewalThresholdAnnotation, err))
+		}
+		p.RenewBefore = d
+	}
+	if v, ok := annotations[AnnotationRemovalDelayAnnotation]; ok {
+		d, err := parseDuration(v, time.Second)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("annotation %s: %w", AnnotationRemovalDelayAnnotation, err))
+		}
+		p.ChallengeClearTimeout = d
+	}
+	if v, ok := annotations[StrategyAnnotation]; ok {
+		s, err := parseStrategy(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("annotation %s: %w", StrategyAnnotation, err))
+		}
+		p.Strategy = s
+	}
+	if v, ok := annotations[SkipAnnotation]; ok {
+		skip, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("annotation %s: invalid boolean %q", SkipAnnotation, v))
+		}
+		p.Skip = skip
+	}
+
+	// NewAggregate returns nil when there are no errors.
+	return p, utilerrors.NewAggregate(errs)
+}
+
+// Bypasses reports whether a certificate expiring in timeRemaining may bypass the Schedule.
+func (p Policy) Bypasses(timeRemaining time.Duration) bool {
+	return p.EmergencyThreshold > 0 && timeRemaining <= p.EmergencyThreshold
+}
+
+// DeletesSecrets reports whether a certificate due for renewal gets its TLS secret deleted.
+func (p Policy) DeletesSecrets() bool {
+	return p.Strategy == "" || p.Strategy == StrategyAuto || p.Strategy == StrategySecretDelete
+}
+
+// RenamesSecrets reports whether a certificate due for renewal gets a new TLS secret name.
+func (p Policy) RenamesSecrets() bool {
+	return p.Strategy == StrategySecretRename
+}
+
+// parseDuration parses a positive duration such as "36h", or a positive integer counted in unit.
+func parseDuration(v string, unit time.Duration) (time.Duration, error) {
+	v = strings.TrimSpace(v)
+	if n, err := strconv.Atoi(v); err == nil {
+		if n > 0 {
+			return time.Duration(n) * unit, nil
+		}
+	} else if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid value %q, must be a positive integer or duration", v)
+}
+
+// parseStrategy parses one of the strategies.
+func parseStrategy(v string) (Strategy, error) {
+	s := Strategy(strings.TrimSpace(v))
+	for _, known := range strategies {
+		if s == known {
+			return s, nil
+		}
+	}
+	names := make([]string, len(strategies))
+	for i, known := range strategies {
+		names[i] = string(known)
+	}
+	return "", fmt.Errorf("invalid value %q, must be one of %s", v, strings.Join(names, ", "))
+}
@@ -0,0 +1,121 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const day = 24 * time.Hour
+
+func TestResolve(t *testing.T) {
+	base := Policy{RenewBefore: 30 * day, ChallengeClearTimeout: 10 * time.Second, Strategy: StrategyAuto}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        Policy
+		wantErrs    []string
+	}{
+		{
+			name: "no overrides",
+			want: base,
+		},
+		{
+			name: "every override",
+			annotations: map[string]string{
+				RenewalThresholdAnnotation:       "7",
+				AnnotationRemovalDelayAnnotation: " 20 ",
+				StrategyAnnotation:               "secret-rename",
+				SkipAnnotation:                   "true",
+			},
+			want: Policy{RenewBefore: 7 * day, ChallengeClearTimeout: 20 * time.Second, Strategy: StrategySecretRename, Skip: true},
+		},
+		{
+			name: "duration overrides",
+			annotations: map[string]string{
+				RenewalThresholdAnnotation:       "36h",
+				AnnotationRemovalDelayAnnotation: "1m30s",
+			},
+			want: Policy{RenewBefore: 36 * time.Hour, ChallengeClearTimeout: 90 * time.Second, Strategy: StrategyAuto},
+		},
+		{
+			name: "invalid overrides keep the defaults",
+			annotations: map[string]string{
+				RenewalThresholdAnnotation:       "0",
+				AnnotationRemovalDelayAnnotation: "ten",
+				StrategyAnnotation:               "force",
+				SkipAnnotation:                   "maybe",
+			},
+			want: base,
+			wantErrs: []string{
+				`annotation nimble.opti.adapter/renewal-threshold: invalid value "0", must be a positive integer or duration`,
+				`annotation nimble.opti.adapter/annotation-removal-delay: invalid value "ten", must be a positive integer or duration`,
+				`annotation nimble.opti.adapter/strategy: invalid value "force", must be one of auto, challenge-only, secret-delete, secret-rename`,
+				`annotation nimble.opti.adapter/skip: invalid boolean "maybe"`,
+			},
+		},
+		{
+			name: "valid overrides apply next to invalid ones",
+			annotations: map[string]string{
+				RenewalThresholdAnnotation: "-3",
+				StrategyAnnotation:         "challenge-only",
+			},
+			want:     Policy{RenewBefore: 30 * day, ChallengeClearTimeout: 10 * time.Second, Strategy: StrategyChallengeOnly},
+			wantErrs: []string{`invalid value "-3"`},
+		},
+		{
+			name:        "unrelated annotations are ignored",
+			annotations: map[string]string{"nimble.opti.adapter/enabled": "true"},
+			want:        base,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(base, tt.annotations)
+			assert.Equal(t, tt.want, got)
+			if len(tt.wantErrs) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			for _, want := range tt.wantErrs {
+				assert.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	defaults := Policy{RenewBefore: 30 * day, ChallengeClearTimeout: 10 * time.Second, PollInterval: 5 * time.Second}
+	namespace := Policy{RenewBefore: 14 * day, ChallengeAppearTimeout: time.Minute}
+
+	want := Policy{RenewBefore: 14 * day, ChallengeAppearTimeout: time.Minute, ChallengeClearTimeout: 10 * time.Second, PollInterval: 5 * time.Second}
+	assert.Equal(t, want, defaults.Merge(namespace))
+	assert.Equal(t, defaults, defaults.Merge(Policy{}))
+	assert.True(t, defaults.Merge(Policy{Suspended: true}).Merge(Policy{}).Suspended)
+	assert.Equal(t, 2*day, defaults.Merge(Policy{RenewalSpread: 2 * day}).Merge(Policy{}).RenewalSpread)
+}
+
+func TestStrategySecrets(t *testing.T) {
+	tests := []struct {
+		strategy    Strategy
+		wantDelete  bool
+		wantRenames bool
+	}{
+		{strategy: "", wantDelete: true},
+		{strategy: StrategyAuto, wantDelete: true},
+		{strategy: StrategySecretDelete, wantDelete: true},
+		{strategy: StrategySecretRename, wantRenames: true},
+		{strategy: StrategyChallengeOnly},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			p := Policy{Strategy: tt.strategy}
+			assert.Equal(t, tt.wantDelete, p.DeletesSecrets())
+			assert.Equal(t, tt.wantRenames, p.RenamesSecrets())
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package policy
+
+import (
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+// Jitter returns a deterministic pseudo-random offset of key within [0, spread), the same for a key on every
+// run and every replica. It is a hash of key, so the offsets of many keys are roughly uniform over the spread,
+// without any guarantee for a few keys: two Ingresses may get close offsets.
+func Jitter(key string, spread time.Duration) time.Duration {
+	if spread <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return time.Duration(h.Sum64() % uint64(spread))
+}
+
+// Threshold returns how long before expiry the certificate of the Ingress of key is renewed:
+// RenewBefore moved later by the jitter of key within RenewalSpread, so certificates issued together
+// are not renewed together. The spread is capped at half of RenewBefore, a certificate is never
+// renewed later than half way through its threshold.
+func (p Policy) Threshold(key string) time.Duration {
+	spread := p.RenewalSpread
+	if limit := p.RenewBefore / 2; spread > limit {
+		spread = limit
+	}
+	return p.RenewBefore - Jitter(key, spread)
+}
+
+// Due is a certificate due for renewal, see Slots.
+type Due struct {
+	// Key identifies the Ingress of the certificate.
+	Key string
+	// Expiry is when the certificate expires.
+	Expiry time.Time
+}
+
+// Slots spreads the renewals of due evenly across window: sorted by expiry, the soonest first, then by key,
+// the certificate of rank i gets the offset i × window/n from the start of the window. Unlike Jitter,
+// two renewals are never closer than window/n.
+func Slots(due []Due, window time.Duration) map[string]time.Duration {
+	sorted := append([]Due(nil), due...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].Expiry.Equal(sorted[j].Expiry) {
+			return sorted[i].Expiry.Before(sorted[j].Expiry)
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+
+	slots := make(map[string]time.Duration, len(sorted))
+	if window < 0 {
+		window = 0
+	}
+	for i, d := range sorted {
+		slots[d.Key] = window / time.Duration(len(sorted)) * time.Duration(i)
+	}
+	return slots
+}
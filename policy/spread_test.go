@@ -0,0 +1,89 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJitter(t *testing.T) {
+	spread := 10 * day
+
+	assert.Zero(t, Jitter("default/ing", 0))
+	assert.Equal(t, Jitter("default/ing", spread), Jitter("default/ing", spread), "deterministic")
+	assert.NotEqual(t, Jitter("default/a", spread), Jitter("default/b", spread))
+
+	// 1000 keys fall roughly uniformly in the 10 days of the spread.
+	perDay := make([]int, 10)
+	for i := 0; i < 1000; i++ {
+		j := Jitter(fmt.Sprintf("ns-%d/ing", i), spread)
+		assert.True(t, j >= 0 && j < spread, "jitter %v out of the spread", j)
+		perDay[j/day]++
+	}
+	for d, n := range perDay {
+		assert.InDelta(t, 100, n, 40, "day %d of the spread", d)
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	key := "default/ing"
+
+	tests := []struct {
+		name       string
+		pol        Policy
+		wantSpread time.Duration
+	}{
+		{"no spread", Policy{RenewBefore: 30 * day}, 0},
+		{"within the spread", Policy{RenewBefore: 30 * day, RenewalSpread: 5 * day}, 5 * day},
+		{"spread capped at half of the threshold", Policy{RenewBefore: 30 * day, RenewalSpread: 60 * day}, 15 * day},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.pol.Threshold(key)
+			assert.Equal(t, tt.pol.RenewBefore-Jitter(key, tt.wantSpread), got)
+			assert.LessOrEqual(t, got, tt.pol.RenewBefore)
+			assert.Greater(t, got, tt.pol.RenewBefore-tt.wantSpread-1)
+		})
+	}
+}
+
+func TestSlots(t *testing.T) {
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	window := 24 * time.Hour
+
+	// Issued together, the soonest expiry is renewed first, a tie is broken by the key.
+	due := []Due{
+		{Key: "default/d", Expiry: now.Add(3 * day)},
+		{Key: "default/b", Expiry: now.Add(day)},
+		{Key: "default/c", Expiry: now.Add(day)},
+		{Key: "default/a", Expiry: now.Add(2 * day)},
+	}
+	assert.Equal(t, map[string]time.Duration{
+		"default/b": 0,
+		"default/c": 6 * time.Hour,
+		"default/a": 12 * time.Hour,
+		"default/d": 18 * time.Hour,
+	}, Slots(due, window))
+
+	// The renewals are evenly spaced by window/n, however many are due.
+	due = nil
+	for i := 0; i < 96; i++ {
+		due = append(due, Due{Key: fmt.Sprintf("ns-%02d/ing", i), Expiry: now.Add(day)})
+	}
+	slots := Slots(due, window)
+	offsets := make([]time.Duration, 0, len(slots))
+	for _, offset := range slots {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	for i, offset := range offsets {
+		assert.Equal(t, time.Duration(i)*15*time.Minute, offset)
+	}
+
+	assert.Empty(t, Slots(nil, window))
+	assert.Equal(t, map[string]time.Duration{"ns-00/ing": 0}, Slots(due[:1], 0))
+}
@@ -0,0 +1,146 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateLayout is the layout of a blackout date.
+const DateLayout = "2006-01-02"
+
+// maxWindowSearch bounds the search for the next maintenance window.
+const maxWindowSearch = 400 * 24 * time.Hour
+
+// weekdays maps the day names of a maintenance window to their weekday.
+var weekdays = map[string]time.Weekday{
+	"Sun": time.Sunday, "Mon": time.Monday, "Tue": time.Tuesday, "Wed": time.Wednesday,
+	"Thu": time.Thursday, "Fri": time.Friday, "Sat": time.Saturday,
+}
+
+// Window is a recurring maintenance window. A window whose End is not after its Start ends
+// on the next day, Days are the days it starts on.
+type Window struct {
+	// Days are the weekdays the window starts on, every day when empty.
+	Days []time.Weekday
+	// Start and End are the times of day, as durations since midnight.
+	Start, End time.Duration
+	Location   *time.Location
+}
+
+// ParseWindow parses a window of days such as "Mon", times of day such as "22:00", and an IANA time zone, UTC when empty.
+func ParseWindow(days []string, start, end, timeZone string) (Window, error) {
+	w := Window{Location: time.UTC}
+	for _, d := range days {
+		wd, ok := weekdays[d]
+		if !ok {
+			return Window{}, fmt.Errorf("invalid day %q, must be one of Mon, Tue, Wed, Thu, Fri, Sat, Sun", d)
+		}
+		w.Days = append(w.Days, wd)
+	}
+
+	var err error
+	if w.Start, err = parseTimeOfDay(start); err != nil {
+		return Window{}, err
+	}
+	if w.End, err = parseTimeOfDay(end); err != nil {
+		return Window{}, err
+	}
+	if timeZone != "" {
+		if w.Location, err = time.LoadLocation(timeZone); err != nil {
+			return Window{}, fmt.Errorf("invalid time zone %q: %w", timeZone, err)
+		}
+	}
+	return w, nil
+}
+
+// contains reports whether t is within the window.
+func (w Window) contains(t time.Time) bool {
+	local := t.In(w.Location)
+	tod := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second
+	if w.Start < w.End {
+		return w.startsOn(local.Weekday()) && tod >= w.Start && tod < w.End
+	}
+	// The window ends on the next day.
+	return (w.startsOn(local.Weekday()) && tod >= w.Start) || (w.startsOn(local.AddDate(0, 0, -1).Weekday()) && tod < w.End)
+}
+
+// startsOn reports whether the window starts on day.
+func (w Window) startsOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// Schedule gates when the HTTPS annotation of an Ingress may be toggled.
+type Schedule struct {
+	Windows []Window
+	// BlackoutDates are dates, see DateLayout, on which no window opens. A date is read in the time zone of each window.
+	BlackoutDates []string
+}
+
+// Open reports whether t is within a window and not on a blackout date. A nil Schedule is always open.
+func (s *Schedule) Open(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	for _, w := range s.Windows {
+		if w.contains(t) && !s.blackout(t.In(w.Location)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the first time from t on the schedule is open, false when it stays closed for more than a year.
+func (s *Schedule) Next(t time.Time) (time.Time, bool) {
+	if s.Open(t) {
+		return t, true
+	}
+
+	// A schedule opens at the start of a window, or at midnight when a blackout date ends.
+	var next time.Time
+	for _, w := range s.Windows {
+		local := t.In(w.Location)
+		for day := 0; time.Duration(day)*24*time.Hour <= maxWindowSearch; day++ {
+			date := local.AddDate(0, 0, day)
+			midnight := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, w.Location)
+			if !next.IsZero() && midnight.After(next) {
+				break
+			}
+			start := time.Date(date.Year(), date.Month(), date.Day(), int(w.Start/time.Hour), int(w.Start%time.Hour/time.Minute), 0, 0, w.Location)
+			for _, candidate := range []time.Time{midnight, start} {
+				if candidate.After(t) && (next.IsZero() || candidate.Before(next)) && s.Open(candidate) {
+					next = candidate
+				}
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// blackout reports whether the date of local is a blackout date.
+func (s *Schedule) blackout(local time.Time) bool {
+	date := local.Format(DateLayout)
+	for _, d := range s.BlackoutDates {
+		if d == date {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimeOfDay parses a time of day such as "22:30" into the duration since midnight.
+func parseTimeOfDay(v string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, must be HH:MM", v)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
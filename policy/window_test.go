@@ -0,0 +1,107 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWindow(t *testing.T) {
+	w, err := ParseWindow([]string{"Sat", "Sun"}, "22:00", "04:30", "Europe/Berlin")
+	require.NoError(t, err)
+	assert.Equal(t, []time.Weekday{time.Saturday, time.Sunday}, w.Days)
+	assert.Equal(t, 22*time.Hour, w.Start)
+	assert.Equal(t, 4*time.Hour+30*time.Minute, w.End)
+	assert.Equal(t, "Europe/Berlin", w.Location.String())
+
+	w, err = ParseWindow(nil, "01:00", "02:00", "")
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, w.Location)
+
+	_, err = ParseWindow([]string{"Monday"}, "01:00", "02:00", "")
+	assert.ErrorContains(t, err, `invalid day "Monday"`)
+	_, err = ParseWindow(nil, "25:00", "02:00", "")
+	assert.ErrorContains(t, err, `invalid time of day "25:00"`)
+	_, err = ParseWindow(nil, "01:00", "02:00", "Mars/Olympus")
+	assert.ErrorContains(t, err, `invalid time zone "Mars/Olympus"`)
+}
+
+func TestScheduleOpen(t *testing.T) {
+	weekend, err := ParseWindow([]string{"Sat"}, "22:00", "04:00", "")
+	require.NoError(t, err)
+	s := &Schedule{Windows: []Window{weekend}, BlackoutDates: []string{"2026-10-25"}}
+
+	tests := []struct {
+		name string
+		at   string
+		want bool
+	}{
+		{name: "before the window", at: "2026-10-17T21:59:00Z", want: false},
+		{name: "start of the window", at: "2026-10-17T22:00:00Z", want: true},
+		{name: "after midnight of the start day", at: "2026-10-18T03:59:00Z", want: true},
+		{name: "end of the window", at: "2026-10-18T04:00:00Z", want: false},
+		{name: "other day", at: "2026-10-20T23:00:00Z", want: false},
+		{name: "start day of the next window", at: "2026-10-24T23:00:00Z", want: true},
+		{name: "blackout date", at: "2026-10-25T01:00:00Z", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, err := time.Parse(time.RFC3339, tt.at)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, s.Open(at))
+		})
+	}
+
+	var none *Schedule
+	assert.True(t, none.Open(time.Now()))
+}
+
+func TestScheduleNext(t *testing.T) {
+	nights, err := ParseWindow([]string{"Mon", "Tue", "Wed", "Thu", "Fri"}, "02:00", "05:00", "America/New_York")
+	require.NoError(t, err)
+	s := &Schedule{Windows: []Window{nights}, BlackoutDates: []string{"2026-10-20"}}
+
+	parse := func(v string) time.Time {
+		at, err := time.Parse(time.RFC3339, v)
+		require.NoError(t, err)
+		return at
+	}
+
+	// Saturday: the next window opens on Monday night in New York.
+	got, ok := s.Next(parse("2026-10-17T12:00:00Z"))
+	require.True(t, ok)
+	assert.True(t, parse("2026-10-19T02:00:00-04:00").Equal(got), "got %v", got)
+
+	// Tuesday is a blackout date, Wednesday opens.
+	got, ok = s.Next(parse("2026-10-19T10:00:00Z"))
+	require.True(t, ok)
+	assert.True(t, parse("2026-10-21T02:00:00-04:00").Equal(got), "got %v", got)
+
+	// Within a window it is open now.
+	now := parse("2026-10-21T07:00:00Z")
+	got, ok = s.Next(now)
+	require.True(t, ok)
+	assert.True(t, now.Equal(got), "got %v", got)
+
+	// A window crossing a blackout date opens at its end.
+	overnight, err := ParseWindow(nil, "22:00", "04:00", "")
+	require.NoError(t, err)
+	s = &Schedule{Windows: []Window{overnight}, BlackoutDates: []string{"2026-10-17"}}
+	got, ok = s.Next(parse("2026-10-17T12:00:00Z"))
+	require.True(t, ok)
+	assert.True(t, parse("2026-10-18T00:00:00Z").Equal(got), "got %v", got)
+
+	// A schedule without windows never opens.
+	_, ok = (&Schedule{}).Next(now)
+	assert.False(t, ok)
+}
+
+func TestBypasses(t *testing.T) {
+	assert.False(t, Policy{}.Bypasses(0))
+	p := Policy{EmergencyThreshold: 72 * time.Hour}
+	assert.True(t, p.Bypasses(24*time.Hour))
+	assert.False(t, p.Bypasses(96*time.Hour))
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+// WatchConfigMap calls onChange every time the ConfigMap namespace/name is created or updated, until ctx is done.
+// onChange is called from a single goroutine, one change at a time.
+func WatchConfigMap(ctx context.Context, client kubernetes.Interface, namespace, name string, onChange func(cm *corev1.ConfigMap)) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}))
+	informer := factory.Core().V1().ConfigMaps().Informer()
+
+	handle := func(obj interface{}) {
+		// The field selector already filters on the name, but not every client honours it.
+		if cm, ok := obj.(*corev1.ConfigMap); ok && cm.Name == name {
+			onChange(cm)
+		}
+	}
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    handle,
+		UpdateFunc: func(_, obj interface{}) { handle(obj) },
+	}); err != nil {
+		return fmt.Errorf("watching configmap %s/%s: %w", namespace, name, err)
+	}
+
+	informer.Run(ctx.Done())
+	return nil
+}
+
+// NewEventRecorder returns an EventRecorder writing the events of component to the API server,
+// and the function stopping it, which flushes the pending events.
+func NewEventRecorder(client kubernetes.Interface, component string) (record.EventRecorder, func()) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component}), broadcaster.Shutdown
+}
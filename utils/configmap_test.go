@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWatchConfigMap(t *testing.T) {
+	watched := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "system"},
+		Data:       map[string]string{"config.yaml": "a: 1"},
+	}
+	other := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "system"},
+	}
+	client := fake.NewSimpleClientset(watched, other)
+
+	changes := make(chan string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- WatchConfigMap(ctx, client, "system", "config", func(cm *corev1.ConfigMap) {
+			changes <- cm.Data["config.yaml"]
+		})
+	}()
+
+	receive := func() string {
+		select {
+		case data := <-changes:
+			return data
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a configmap change")
+			return ""
+		}
+	}
+
+	// The existing ConfigMap is reported on start, the other one is ignored.
+	assert.Equal(t, "a: 1", receive())
+
+	updated := watched.DeepCopy()
+	updated.Data["config.yaml"] = "a: 2"
+	_, err := client.CoreV1().ConfigMaps("system").Update(context.TODO(), updated, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "a: 2", receive())
+
+	cancel()
+	require.NoError(t, <-done)
+	assert.Empty(t, changes)
+}
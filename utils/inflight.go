@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+// InFlight tracks renewals that temporarily changed an Ingress, together with the
+// annotations to restore when a renewal cannot finish before the process exits.
+type InFlight struct {
+	mu       sync.Mutex                   // mu protects the fields below.
+	draining bool                         // draining is set once Drain was called, Begin then refuses new work.
+	entries  map[string]map[string]string // entries maps an Ingress key to the annotations to restore.
+	changed  chan struct{}                // changed is closed, and replaced, every time an entry ends.
+}
+
+// NewInFlight initializes and returns a new InFlight.
+func NewInFlight() *InFlight {
+	return &InFlight{
+		entries: make(map[string]map[string]string),
+		changed: make(chan struct{}),
+	}
+}
+
+// Begin registers the renewal of key with the annotations to restore if it cannot finish.
+// It returns false, and registers nothing, once Drain was called.
+func (f *InFlight) Begin(key string, annotations map[string]string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.draining {
+		return false
+	}
+	f.entries[key] = annotations
+	return true
+}
+
+// End removes key once its annotations are restored.
+func (f *InFlight) End(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.entries[key]; !ok {
+		return
+	}
+	delete(f.entries, key)
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// Draining reports whether Drain was called.
+func (f *InFlight) Draining() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.draining
+}
+
+// Drain refuses new work and waits until every registered renewal ended or the context is done.
+// It reports whether every renewal ended.
+func (f *InFlight) Drain(ctx context.Context) bool {
+	f.mu.Lock()
+	f.draining = true
+	f.mu.Unlock()
+
+	for {
+		f.mu.Lock()
+		if len(f.entries) == 0 {
+			f.mu.Unlock()
+			return true
+		}
+		changed := f.changed
+		f.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Pending returns a copy of the renewals that did not end, mapped to the annotations to restore.
+func (f *InFlight) Pending() map[string]map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pending := make(map[string]map[string]string, len(f.entries))
+	for key, annotations := range f.entries {
+		pending[key] = annotations
+	}
+	return pending
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInFlightDrain(t *testing.T) {
+	f := NewInFlight()
+	restore := map[string]string{"nginx.ingress.kubernetes.io/backend-protocol": "HTTPS"}
+
+	if !f.Begin("ns/a", restore) || !f.Begin("ns/b", restore) {
+		t.Fatal("Begin() = false before Drain; want true")
+	}
+
+	// End one renewal while draining, the other one never ends.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.End("ns/a")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+	if f.Drain(ctx) {
+		t.Fatal("Drain() = true; want false while ns/b is still in flight")
+	}
+
+	if !f.Draining() {
+		t.Error("Draining() = false after Drain; want true")
+	}
+	if f.Begin("ns/c", restore) {
+		t.Error("Begin() = true after Drain; want false")
+	}
+
+	pending := f.Pending()
+	if len(pending) != 1 || pending["ns/b"]["nginx.ingress.kubernetes.io/backend-protocol"] != "HTTPS" {
+		t.Errorf("Pending() = %v; want only ns/b", pending)
+	}
+}
+
+func TestInFlightDrainIdle(t *testing.T) {
+	f := NewInFlight()
+	f.Begin("ns/a", nil)
+	f.End("ns/a")
+	// Ending an unknown key is a no-op.
+	f.End("ns/unknown")
+
+	if !f.Drain(context.TODO()) {
+		t.Error("Drain() = false; want true when nothing is in flight")
+	}
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+// NamespaceSemaphore is a Semaphore with a limit in total and another one per namespace, both changeable
+// at runtime. A limit of zero or less means it never blocks.
+type NamespaceSemaphore struct {
+	total        *Semaphore            // total caps the holders of every namespace.
+	mu           sync.Mutex            // mu protects the fields below.
+	perNamespace int                   // perNamespace is the limit of each namespace.
+	namespaces   map[string]*Semaphore // namespaces holds the semaphore of each namespace seen so far.
+}
+
+// NewNamespaceSemaphore initializes and returns a new NamespaceSemaphore with the given limits.
+func NewNamespaceSemaphore(limit, perNamespace int) *NamespaceSemaphore {
+	return &NamespaceSemaphore{
+		total:        NewSemaphore(limit),
+		perNamespace: perNamespace,
+		namespaces:   map[string]*Semaphore{},
+	}
+}
+
+// Acquire takes a slot of namespace, blocking until one is free or the context is done.
+// The slot of the namespace is taken first, so a busy namespace never holds a slot of the others.
+func (s *NamespaceSemaphore) Acquire(ctx context.Context, namespace string) error {
+	ns := s.namespace(namespace)
+	if err := ns.Acquire(ctx); err != nil {
+		return err
+	}
+	if err := s.total.Acquire(ctx); err != nil {
+		ns.Release()
+		return err
+	}
+	return nil
+}
+
+// TryAcquire takes a slot of namespace without waiting and reports whether it succeeded.
+func (s *NamespaceSemaphore) TryAcquire(namespace string) bool {
+	ns := s.namespace(namespace)
+	if !ns.TryAcquire() {
+		return false
+	}
+	if !s.total.TryAcquire() {
+		ns.Release()
+		return false
+	}
+	return true
+}
+
+// Release frees a slot of namespace taken by Acquire or TryAcquire.
+func (s *NamespaceSemaphore) Release(namespace string) {
+	s.total.Release()
+	s.namespace(namespace).Release()
+}
+
+// SetLimits changes the limits. Lowering them never interrupts current holders,
+// it only delays new ones until enough slots are released.
+func (s *NamespaceSemaphore) SetLimits(limit, perNamespace int) {
+	s.total.SetLimit(limit)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.perNamespace = perNamespace
+	for _, ns := range s.namespaces {
+		ns.SetLimit(perNamespace)
+	}
+}
+
+// InUse returns the number of slots currently taken in total.
+func (s *NamespaceSemaphore) InUse() int {
+	return s.total.InUse()
+}
+
+// namespace returns the semaphore of namespace, created on first use.
+func (s *NamespaceSemaphore) namespace(namespace string) *Semaphore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ns, ok := s.namespaces[namespace]
+	if !ok {
+		ns = NewSemaphore(s.perNamespace)
+		s.namespaces[namespace] = ns
+	}
+	return ns
+}
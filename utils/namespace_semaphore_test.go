@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNamespaceSemaphoreLimits(t *testing.T) {
+	tests := []struct {
+		name         string
+		limit        int
+		perNamespace int
+		held         []string
+		try          string
+		wantBlocked  bool
+	}{
+		{name: "within both limits", limit: 3, perNamespace: 2, held: []string{"a", "b"}, try: "a"},
+		{name: "namespace full", limit: 3, perNamespace: 1, held: []string{"a"}, try: "a", wantBlocked: true},
+		{name: "other namespace", limit: 3, perNamespace: 1, held: []string{"a"}, try: "b"},
+		{name: "total full", limit: 2, perNamespace: 2, held: []string{"a", "b"}, try: "c", wantBlocked: true},
+		{name: "unlimited", held: []string{"a", "a", "a"}, try: "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sem := NewNamespaceSemaphore(tt.limit, tt.perNamespace)
+			for _, ns := range tt.held {
+				if err := sem.Acquire(context.TODO(), ns); err != nil {
+					t.Fatalf("Acquire(%q) error = %v", ns, err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.TODO(), 20*time.Millisecond)
+			defer cancel()
+			err := sem.Acquire(ctx, tt.try)
+			if blocked := err != nil; blocked != tt.wantBlocked {
+				t.Fatalf("Acquire(%q) error = %v; want blocked %t", tt.try, err, tt.wantBlocked)
+			}
+
+			// A blocked Acquire gives back the slot of its namespace.
+			want := len(tt.held)
+			if !tt.wantBlocked {
+				want++
+			}
+			if got := sem.InUse(); got != want {
+				t.Errorf("InUse() = %d; want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestNamespaceSemaphoreSetLimits(t *testing.T) {
+	sem := NewNamespaceSemaphore(0, 1)
+	if err := sem.Acquire(context.TODO(), "a"); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- sem.Acquire(context.TODO(), "a") }()
+	select {
+	case err := <-acquired:
+		t.Fatalf("Acquire() = %v before the limit was raised", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Raising the limit of the namespaces lets the waiter in.
+	sem.SetLimits(0, 2)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("Acquire() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Acquire() still blocked after the limit was raised")
+	}
+
+	sem.Release("a")
+	sem.Release("a")
+	if got := sem.InUse(); got != 0 {
+		t.Errorf("InUse() = %d; want 0", got)
+	}
+}
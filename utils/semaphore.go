@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+// Semaphore is a counting semaphore whose limit can be changed at runtime.
+// Waiters are served in FIFO order and can give up through their context.
+// A limit of zero or less means the semaphore never blocks.
+type Semaphore struct {
+	mu      sync.Mutex      // mu protects the fields below.
+	limit   int             // limit is the maximum number of holders.
+	inUse   int             // inUse is the current number of holders.
+	waiters []chan struct{} // waiters are closed, in order, when a slot is granted to them.
+}
+
+// NewSemaphore initializes and returns a new Semaphore with the given limit.
+func NewSemaphore(limit int) *Semaphore {
+	return &Semaphore{limit: limit}
+}
+
+// Acquire takes a slot, blocking until one is free or the context is done.
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	s.mu.Lock()
+	if s.hasRoomLocked() && len(s.waiters) == 0 {
+		s.inUse++
+		s.mu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	s.waiters = append(s.waiters, ch)
+	s.mu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for i, w := range s.waiters {
+			if w == ch {
+				// Still waiting, simply leave the queue.
+				s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+				s.mu.Unlock()
+				return ctx.Err()
+			}
+		}
+		s.mu.Unlock()
+		// The slot was granted while the context was cancelled, hand it back.
+		s.Release()
+		return ctx.Err()
+	}
+}
+
+// TryAcquire takes a slot without waiting and reports whether it succeeded.
+func (s *Semaphore) TryAcquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hasRoomLocked() && len(s.waiters) == 0 {
+		s.inUse++
+		return true
+	}
+	return false
+}
+
+// Release frees a slot taken by Acquire or TryAcquire.
+func (s *Semaphore) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inUse > 0 {
+		s.inUse--
+	}
+	s.grantLocked()
+}
+
+// SetLimit changes the limit. Lowering it never interrupts current holders,
+// it only delays new ones until enough slots are released.
+func (s *Semaphore) SetLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limit = limit
+	s.grantLocked()
+}
+
+// InUse returns the number of slots currently taken.
+func (s *Semaphore) InUse() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.inUse
+}
+
+// hasRoomLocked reports whether another slot may be taken. s.mu must be held.
+func (s *Semaphore) hasRoomLocked() bool {
+	return s.limit <= 0 || s.inUse < s.limit
+}
+
+// grantLocked hands free slots to waiters in FIFO order. s.mu must be held.
+func (s *Semaphore) grantLocked() {
+	for len(s.waiters) > 0 && s.hasRoomLocked() {
+		ch := s.waiters[0]
+		s.waiters = s.waiters[1:]
+		s.inUse++
+		close(ch)
+	}
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestSemaphoreLimit checks that no more than the limit of goroutines hold the semaphore at once.
+func TestSemaphoreLimit(t *testing.T) {
+	sem := NewSemaphore(2)
+	var current, peak int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sem.Acquire(context.TODO()); err != nil {
+				t.Errorf("Acquire() error = %v", err)
+				return
+			}
+			n := atomic.AddInt32(&current, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&current, -1)
+			sem.Release()
+		}()
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("peak holders = %d; want at most 2", peak)
+	}
+	if got := sem.InUse(); got != 0 {
+		t.Errorf("InUse() = %d; want 0", got)
+	}
+}
+
+func TestSemaphoreTryAcquire(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		tries int
+		want  []bool
+	}{
+		{"limited", 1, 2, []bool{true, false}},
+		{"unlimited", 0, 3, []bool{true, true, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sem := NewSemaphore(tt.limit)
+			for i := 0; i < tt.tries; i++ {
+				if got := sem.TryAcquire(); got != tt.want[i] {
+					t.Errorf("TryAcquire() #%d = %v; want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestSemaphoreAcquireContext checks that a waiter gives up when its context is done
+// without leaking a slot.
+func TestSemaphoreAcquireContext(t *testing.T) {
+	sem := NewSemaphore(1)
+	if !sem.TryAcquire() {
+		t.Fatal("TryAcquire() = false; want true")
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 20*time.Millisecond)
+	defer cancel()
+	if err := sem.Acquire(ctx); err == nil {
+		t.Fatal("Acquire() error = nil; want context error")
+	}
+
+	sem.Release()
+	if got := sem.InUse(); got != 0 {
+		t.Errorf("InUse() = %d; want 0", got)
+	}
+}
+
+// TestSemaphoreSetLimit checks that raising the limit wakes up waiters.
+func TestSemaphoreSetLimit(t *testing.T) {
+	sem := NewSemaphore(1)
+	sem.TryAcquire()
+
+	acquired := make(chan struct{})
+	go func() {
+		if err := sem.Acquire(context.TODO()); err == nil {
+			close(acquired)
+		}
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Acquire() succeeded before the limit was raised")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	sem.SetLimit(2)
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Acquire() still blocked after the limit was raised")
+	}
+}
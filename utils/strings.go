@@ -83,3 +83,14 @@ func IncVxSuffixToStr(str string) (string, error) {
 	// join the string parts back to one string
 	return strings.Join(strParts, "-"), nil
 }
+
+// SplitCommaList splits a comma separated list, trimming spaces and dropping empty entries.
+func SplitCommaList(s string) []string {
+	var items []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			items = append(items, part)
+		}
+	}
+	return items
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"reflect"
 	"testing"
 
 	networkingv1 "k8s.io/api/networking/v1"
@@ -104,3 +105,24 @@ func TestIncVxSuffixToStr(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitCommaList(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		want []string
+	}{
+		{"Empty", "", nil},
+		{"Single", "team-a", []string{"team-a"}},
+		{"Spaces and trailing comma", " team-a, team-b ,", []string{"team-a", "team-b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitCommaList(tt.str)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitCommaList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}